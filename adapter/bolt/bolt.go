@@ -0,0 +1,237 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bolt
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTimeout is how long NewAdapter waits for another process to release
+// the database file.
+const openTimeout = time.Second
+
+// Adapter is the bbolt adapter data structure. Cached responses are kept
+// in a bucket per prefix, so that they survive restarts.
+type Adapter struct {
+	db    *bolt.DB
+	codec cache.Codec
+}
+
+// AdapterOption is used to set Adapter settings.
+type AdapterOption func(a *Adapter) error
+
+// Get implements the cache Adapter interface Get method.
+func (a *Adapter) Get(prefix, key string) ([]byte, bool) {
+	var response []byte
+	a.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(prefix)); b != nil {
+			// the value is only valid during the transaction
+			if v := b.Get([]byte(key)); v != nil {
+				response = append([]byte(nil), v...)
+			}
+		}
+		return nil
+	})
+	return response, response != nil
+}
+
+// Exists implements the cache Adapter interface Exists method.
+func (a *Adapter) Exists(prefix, key string) bool {
+	exists := false
+	a.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(prefix)); b != nil {
+			exists = b.Get([]byte(key)) != nil
+		}
+		return nil
+	})
+	return exists
+}
+
+// Set implements the cache Adapter interface Set method.
+func (a *Adapter) Set(prefix, key string, response []byte) {
+	a.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(prefix))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), response)
+	})
+}
+
+// Keys implements the cache KeyLister interface Keys method.
+func (a *Adapter) Keys(prefix string) []string {
+	var keys []string
+	a.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(prefix)); b != nil {
+			b.ForEach(func(k, _ []byte) error {
+				keys = append(keys, string(k))
+				return nil
+			})
+		}
+		return nil
+	})
+	return keys
+}
+
+// Release implements the cache Adapter interface Release method.
+func (a *Adapter) Release(prefix, key string) (int, error) {
+	n := 0
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(prefix))
+		if b == nil || b.Get([]byte(key)) == nil {
+			return nil
+		}
+		n = 1
+		return b.Delete([]byte(key))
+	})
+	return n, err
+}
+
+// ReleasePrefix implements the cache Adapter interface ReleasePrefix method.
+func (a *Adapter) ReleasePrefix(prefix string) (int, error) {
+	n := 0
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(prefix))
+		if b == nil {
+			return nil
+		}
+		n = b.Stats().KeyN
+		return tx.DeleteBucket([]byte(prefix))
+	})
+	return n, err
+}
+
+// ReleaseIfStartsWith implements the cache Adapter interface
+// ReleaseIfStartsWith method.
+func (a *Adapter) ReleaseIfStartsWith(key string) (int, error) {
+	return a.releaseBuckets([]byte(key))
+}
+
+// Flush implements the cache Flusher interface Flush method.
+func (a *Adapter) Flush() (int, error) {
+	return a.releaseBuckets(nil)
+}
+
+// Sweep implements the cache Sweeper interface Sweep method, releasing
+// the responses whose expiration has passed, including the ones a client
+// would still serve stale.
+func (a *Adapter) Sweep(now time.Time) int {
+	n := 0
+	a.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			var expired [][]byte
+			b.ForEach(func(k, v []byte) error {
+				expiration, err := a.expiration(v)
+				if err == nil && !expiration.IsZero() && expiration.Before(now) {
+					expired = append(expired, k)
+				}
+				return nil
+			})
+			for _, k := range expired {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			n += len(expired)
+			return nil
+		})
+	})
+	return n
+}
+
+// Close closes the database.
+func (a *Adapter) Close() error {
+	return a.db.Close()
+}
+
+// releaseBuckets deletes the buckets whose name starts with the given
+// prefix and returns the number of responses they held.
+func (a *Adapter) releaseBuckets(prefix []byte) (int, error) {
+	n := 0
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		var names [][]byte
+		c := tx.Cursor()
+		for name, _ := c.Seek(prefix); name != nil && bytes.HasPrefix(name, prefix); name, _ = c.Next() {
+			names = append(names, append([]byte(nil), name...))
+		}
+		for _, name := range names {
+			n += tx.Bucket(name).Stats().KeyN
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// expiration returns the expiration of an encoded response.
+func (a *Adapter) expiration(v []byte) (time.Time, error) {
+	if r, ok := a.codec.(cache.ExpirationReader); ok {
+		return r.Expiration(v)
+	}
+	response, err := a.codec.Unmarshal(v)
+	return response.Expiration, err
+}
+
+// NewAdapter opens or creates the bbolt database at the given path and
+// initializes bbolt adapter, releasing the responses which expired while
+// the database was closed. Close the adapter to close the database.
+func NewAdapter(path string, opts ...AdapterOption) (cache.Adapter, error) {
+	a := &Adapter{
+		codec: cache.FrameCodec{},
+	}
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+	a.db = db
+	a.Sweep(time.Now())
+	return a, nil
+}
+
+// AdapterWithCodec sets the codec the responses were encoded with by the
+// cache client, which Sweep needs to read their expiration. It must match
+// the client one. Default is cache.FrameCodec. Optional setting.
+func AdapterWithCodec(codec cache.Codec) AdapterOption {
+	return func(a *Adapter) error {
+		if codec == nil {
+			return errors.New("bolt adapter codec is not set")
+		}
+		a.codec = codec
+		return nil
+	}
+}
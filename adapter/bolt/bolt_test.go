@@ -0,0 +1,240 @@
+package bolt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/cachetest"
+	"github.com/Columbus-internet/http-cache/codec/json"
+)
+
+func tempPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "http-cache-bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "cache.db")
+}
+
+func newTestAdapter(t *testing.T, path string) *Adapter {
+	a, err := NewAdapter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.(*Adapter)
+}
+
+func TestConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "http-cache-bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	n := 0
+	cachetest.TestAdapter(t, func() cache.Adapter {
+		n++
+		return newTestAdapter(t, filepath.Join(dir, fmt.Sprintf("cache-%d.db", n)))
+	})
+}
+
+func TestGet(t *testing.T) {
+	path := tempPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	a := newTestAdapter(t, path)
+	defer a.Close()
+	a.Set("/a", "1", []byte("value 1"))
+
+	tests := []struct {
+		name   string
+		prefix string
+		key    string
+		want   string
+		ok     bool
+	}{
+		{"returns right response", "/a", "1", "value 1", true},
+		{"key does not exist", "/a", "2", "", false},
+		{"prefix does not exist", "/b", "1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := a.Get(tt.prefix, tt.key)
+			if ok != tt.ok || string(got) != tt.want {
+				t.Errorf("bolt.Get() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+			if got := a.Exists(tt.prefix, tt.key); got != tt.ok {
+				t.Errorf("bolt.Exists() = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		name        string
+		release     func(a cache.Adapter) (int, error)
+		want        map[string]bool
+		wantRemoved int
+	}{
+		{
+			"releases a key",
+			func(a cache.Adapter) (int, error) { return a.Release("/a", "1") },
+			map[string]bool{"/a 1": false, "/a 2": true, "/ab 1": true, "/b 1": true},
+			1,
+		},
+		{
+			"releases a missing key",
+			func(a cache.Adapter) (int, error) { return a.Release("/a", "3") },
+			map[string]bool{"/a 1": true, "/a 2": true, "/ab 1": true, "/b 1": true},
+			0,
+		},
+		{
+			"releases a prefix",
+			func(a cache.Adapter) (int, error) { return a.ReleasePrefix("/a") },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": true, "/b 1": true},
+			2,
+		},
+		{
+			"releases a missing prefix",
+			func(a cache.Adapter) (int, error) { return a.ReleasePrefix("/c") },
+			map[string]bool{"/a 1": true, "/a 2": true, "/ab 1": true, "/b 1": true},
+			0,
+		},
+		{
+			"releases prefixes starting with",
+			func(a cache.Adapter) (int, error) { return a.ReleaseIfStartsWith("/a") },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": false, "/b 1": true},
+			3,
+		},
+		{
+			"flushes",
+			func(a cache.Adapter) (int, error) { return a.(cache.Flusher).Flush() },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": false, "/b 1": false},
+			4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tempPath(t)
+			defer os.RemoveAll(filepath.Dir(path))
+			a := newTestAdapter(t, path)
+			defer a.Close()
+			a.Set("/a", "1", []byte("1"))
+			a.Set("/a", "2", []byte("2"))
+			a.Set("/ab", "1", []byte("3"))
+			a.Set("/b", "1", []byte("4"))
+
+			removed, err := tt.release(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("bolt release removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			for _, prefix := range []string{"/a", "/ab", "/b"} {
+				for _, key := range []string{"1", "2"} {
+					want := tt.want[prefix+" "+key]
+					if got := a.Exists(prefix, key); got != want {
+						t.Errorf("bolt.Exists(%v, %v) = %v, want %v", prefix, key, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	path := tempPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	a := newTestAdapter(t, path)
+	defer a.Close()
+	a.Set("/a", "1", []byte("1"))
+	a.Set("/a", "2", []byte("2"))
+	a.Set("/b", "3", []byte("3"))
+
+	got := a.Keys("/a")
+	sort.Strings(got)
+	if want := []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bolt.Keys() = %v, want %v", got, want)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := tempPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	now := time.Now()
+
+	a := newTestAdapter(t, path)
+	a.Set("/a", "fresh", cache.Response{Value: []byte("1"), Expiration: now.Add(time.Minute)}.Bytes())
+	a.Set("/a", "expired", cache.Response{Value: []byte("2"), Expiration: now.Add(-time.Minute)}.Bytes())
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopening sweeps the responses which expired in the meantime
+	a = newTestAdapter(t, path)
+	defer a.Close()
+	if !a.Exists("/a", "fresh") {
+		t.Error("bolt.NewAdapter() lost a fresh response")
+	}
+	if a.Exists("/a", "expired") {
+		t.Error("bolt.NewAdapter() kept an expired response")
+	}
+
+	a.Set("/a", "later", cache.Response{Value: []byte("3"), Expiration: now.Add(time.Hour)}.Bytes())
+	if n := a.Sweep(now.Add(2 * time.Minute)); n != 1 {
+		t.Errorf("bolt.Sweep() = %v, want 1", n)
+	}
+	if !a.Exists("/a", "later") {
+		t.Error("bolt.Sweep() released a fresh response")
+	}
+}
+
+func TestSweepCodec(t *testing.T) {
+	path := tempPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	if _, err := NewAdapter(path, AdapterWithCodec(nil)); err == nil {
+		t.Error("bolt.NewAdapter() error = nil, want an error on a nil codec")
+	}
+
+	b, err := NewAdapter(path, AdapterWithCodec(json.Codec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := b.(*Adapter)
+	defer a.Close()
+	expired, _ := json.Codec{}.Marshal(cache.Response{Expiration: time.Now().Add(-time.Minute)})
+	a.Set("/a", "expired", expired)
+	if n := a.Sweep(time.Now()); n != 1 {
+		t.Errorf("bolt.Sweep() = %v, want 1", n)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	path := tempPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	a := newTestAdapter(t, path)
+	defer a.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				a.Set("/a", "1", []byte("1"))
+				a.Get("/a", "1")
+				a.Exists("/a", "2")
+			}
+		}()
+	}
+	wg.Wait()
+}
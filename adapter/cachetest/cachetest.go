@@ -0,0 +1,273 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package cachetest provides adapters for testing code using the cache
+// middleware.
+package cachetest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+)
+
+// Operations recorded by the Recording adapter.
+const (
+	OpGet                 = "get"
+	OpExists              = "exists"
+	OpSet                 = "set"
+	OpRelease             = "release"
+	OpReleasePrefix       = "release prefix"
+	OpReleaseIfStartsWith = "release if starts with"
+)
+
+// Null is an adapter which never stores anything, e.g. to disable caching
+// in an environment while keeping the middleware in place.
+type Null struct{}
+
+// Get implements the cache Adapter interface Get method.
+func (Null) Get(prefix, key string) ([]byte, bool) {
+	return nil, false
+}
+
+// Exists implements the cache Adapter interface Exists method.
+func (Null) Exists(prefix, key string) bool {
+	return false
+}
+
+// Set implements the cache Adapter interface Set method.
+func (Null) Set(prefix, key string, response []byte) {}
+
+// Release implements the cache Adapter interface Release method.
+func (Null) Release(prefix, key string) (int, error) {
+	return 0, nil
+}
+
+// ReleasePrefix implements the cache Adapter interface ReleasePrefix method.
+func (Null) ReleasePrefix(prefix string) (int, error) {
+	return 0, nil
+}
+
+// ReleaseIfStartsWith implements the cache Adapter interface
+// ReleaseIfStartsWith method.
+func (Null) ReleaseIfStartsWith(key string) (int, error) {
+	return 0, nil
+}
+
+// Call is an adapter call recorded by the Recording adapter.
+type Call struct {
+	// Op is the operation, e.g. OpGet.
+	Op string
+
+	// Prefix and Key are the arguments of the call. The key is the
+	// string argument of ReleaseIfStartsWith, and empty for
+	// ReleasePrefix.
+	Prefix string
+	Key    string
+
+	// Response is the response set, or got when Found.
+	Response []byte
+
+	// TTL is the ttl the response was set with, zero if none.
+	TTL time.Duration
+
+	// Found tells whether a Get or Exists found the response.
+	Found bool
+
+	// Released is the number of responses released by a release call.
+	Released int
+
+	// Err is the error returned by a release call.
+	Err error
+
+	// Time is when the call returned.
+	Time time.Time
+}
+
+// Recording is an adapter recording the calls made to the adapter it
+// wraps, and asserting on them. It is safe for concurrent use.
+type Recording struct {
+	adapter cache.Adapter
+	mutex   sync.Mutex
+	calls   []Call
+}
+
+// NewRecording returns a Recording adapter wrapping the given adapter, or
+// a Null adapter if nil.
+func NewRecording(adapter cache.Adapter) *Recording {
+	if adapter == nil {
+		adapter = Null{}
+	}
+	return &Recording{adapter: adapter}
+}
+
+// Get implements the cache Adapter interface Get method.
+func (r *Recording) Get(prefix, key string) ([]byte, bool) {
+	response, ok := r.adapter.Get(prefix, key)
+	r.record(Call{Op: OpGet, Prefix: prefix, Key: key, Response: response, Found: ok})
+	return response, ok
+}
+
+// Exists implements the cache Adapter interface Exists method.
+func (r *Recording) Exists(prefix, key string) bool {
+	ok := r.adapter.Exists(prefix, key)
+	r.record(Call{Op: OpExists, Prefix: prefix, Key: key, Found: ok})
+	return ok
+}
+
+// Set implements the cache Adapter interface Set method.
+func (r *Recording) Set(prefix, key string, response []byte) {
+	r.adapter.Set(prefix, key, response)
+	r.record(Call{Op: OpSet, Prefix: prefix, Key: key, Response: response})
+}
+
+// SetWithTTL implements the cache TTLSetter interface SetWithTTL method,
+// falling back to Set when the wrapped adapter does not implement it.
+func (r *Recording) SetWithTTL(prefix, key string, response []byte, ttl time.Duration) {
+	if s, ok := r.adapter.(cache.TTLSetter); ok {
+		s.SetWithTTL(prefix, key, response, ttl)
+	} else {
+		r.adapter.Set(prefix, key, response)
+	}
+	r.record(Call{Op: OpSet, Prefix: prefix, Key: key, Response: response, TTL: ttl})
+}
+
+// Release implements the cache Adapter interface Release method.
+func (r *Recording) Release(prefix, key string) (int, error) {
+	n, err := r.adapter.Release(prefix, key)
+	r.record(Call{Op: OpRelease, Prefix: prefix, Key: key, Released: n, Err: err})
+	return n, err
+}
+
+// ReleasePrefix implements the cache Adapter interface ReleasePrefix method.
+func (r *Recording) ReleasePrefix(prefix string) (int, error) {
+	n, err := r.adapter.ReleasePrefix(prefix)
+	r.record(Call{Op: OpReleasePrefix, Prefix: prefix, Released: n, Err: err})
+	return n, err
+}
+
+// ReleaseIfStartsWith implements the cache Adapter interface
+// ReleaseIfStartsWith method.
+func (r *Recording) ReleaseIfStartsWith(key string) (int, error) {
+	n, err := r.adapter.ReleaseIfStartsWith(key)
+	r.record(Call{Op: OpReleaseIfStartsWith, Key: key, Released: n, Err: err})
+	return n, err
+}
+
+// Calls returns the calls recorded so far, in order.
+func (r *Recording) Calls() []Call {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// CallsTo returns the calls of the given operation recorded so far.
+func (r *Recording) CallsTo(op string) []Call {
+	var calls []Call
+	for _, call := range r.Calls() {
+		if call.Op == op {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the recorded calls.
+func (r *Recording) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = nil
+}
+
+// AssertHit fails the test unless a Get of the response by the given key
+// found it.
+func (r *Recording) AssertHit(t testing.TB, prefix, key string) {
+	t.Helper()
+	if !r.has(OpGet, prefix, key, true) {
+		t.Errorf("cachetest: no cache hit for %v %v", prefix, key)
+	}
+}
+
+// AssertMiss fails the test unless a Get of the response by the given key
+// missed it.
+func (r *Recording) AssertMiss(t testing.TB, prefix, key string) {
+	t.Helper()
+	if !r.has(OpGet, prefix, key, false) {
+		t.Errorf("cachetest: no cache miss for %v %v", prefix, key)
+	}
+}
+
+// AssertStored fails the test unless the response by the given key was
+// set.
+func (r *Recording) AssertStored(t testing.TB, prefix, key string) {
+	t.Helper()
+	if !r.has(OpSet, prefix, key, false) {
+		t.Errorf("cachetest: %v %v was not stored", prefix, key)
+	}
+}
+
+// AssertNotStored fails the test if the response by the given key was
+// set.
+func (r *Recording) AssertNotStored(t testing.TB, prefix, key string) {
+	t.Helper()
+	if r.has(OpSet, prefix, key, false) {
+		t.Errorf("cachetest: %v %v was stored", prefix, key)
+	}
+}
+
+// AssertReleased fails the test unless the response by the given key was
+// released, by itself or along with its prefix.
+func (r *Recording) AssertReleased(t testing.TB, prefix, key string) {
+	t.Helper()
+	for _, call := range r.Calls() {
+		switch {
+		case call.Op == OpRelease && call.Prefix == prefix && call.Key == key,
+			call.Op == OpReleasePrefix && call.Prefix == prefix,
+			call.Op == OpReleaseIfStartsWith && strings.HasPrefix(prefix, call.Key):
+			return
+		}
+	}
+	t.Errorf("cachetest: %v %v was not released", prefix, key)
+}
+
+// has reports whether a call of the operation by the given key was
+// recorded, which found the response for gets.
+func (r *Recording) has(op, prefix, key string, found bool) bool {
+	for _, call := range r.CallsTo(op) {
+		if call.Prefix == prefix && call.Key == key && (op != OpGet || call.Found == found) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Recording) record(call Call) {
+	call.Time = time.Now()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = append(r.calls, call)
+}
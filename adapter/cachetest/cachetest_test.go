@@ -0,0 +1,124 @@
+package cachetest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/memory"
+)
+
+// fakeT records the failures of the assertions.
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestNull(t *testing.T) {
+	var a cache.Adapter = Null{}
+	a.Set("/a", "1", []byte("value"))
+	if _, ok := a.Get("/a", "1"); ok {
+		t.Error("Null.Get() found a response")
+	}
+	if a.Exists("/a", "1") {
+		t.Error("Null.Exists() found a response")
+	}
+	for _, release := range []func() (int, error){
+		func() (int, error) { return a.Release("/a", "1") },
+		func() (int, error) { return a.ReleasePrefix("/a") },
+		func() (int, error) { return a.ReleaseIfStartsWith("/") },
+	} {
+		if n, err := release(); n != 0 || err != nil {
+			t.Errorf("Null release = %v, %v, want 0, nil", n, err)
+		}
+	}
+}
+
+func TestRecording(t *testing.T) {
+	adapter, _ := memory.NewAdapter(memory.AdapterWithCapacity(10))
+	r := NewRecording(adapter)
+	client, err := cache.NewClient(
+		cache.ClientWithAdapter(r),
+		cache.ClientWithTTL(time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("value"))
+	}))
+
+	req := httptest.NewRequest("GET", "/a", nil)
+	prefix, key := client.GeneratePrefixAndKey(req)
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	client.ReleaseURI("/a")
+
+	r.AssertMiss(t, prefix, key)
+	r.AssertStored(t, prefix, key)
+	r.AssertHit(t, prefix, key)
+	r.AssertReleased(t, prefix, key)
+
+	var ops []string
+	for _, call := range r.Calls() {
+		ops = append(ops, call.Op)
+		if call.Time.Before(start) {
+			t.Errorf("%v call time = %v, want after %v", call.Op, call.Time, start)
+		}
+	}
+	if want := []string{OpGet, OpSet, OpGet, OpReleasePrefix}; !reflect.DeepEqual(ops, want) {
+		t.Errorf("Recording.Calls() ops = %v, want %v", ops, want)
+	}
+	if sets := r.CallsTo(OpSet); len(sets) != 1 || sets[0].TTL <= 0 {
+		t.Errorf("Recording.CallsTo(OpSet) = %v, want a call with a ttl", sets)
+	}
+
+	r.Reset()
+	if calls := r.Calls(); len(calls) != 0 {
+		t.Errorf("Recording.Calls() after Reset() = %v, want none", calls)
+	}
+}
+
+func TestRecordingAssertions(t *testing.T) {
+	r := NewRecording(nil)
+	r.Get("/a", "1")
+	r.Set("/b", "1", []byte("value"))
+	r.ReleasePrefix("/c")
+	r.ReleaseIfStartsWith("/d")
+
+	tests := []struct {
+		name   string
+		assert func(t testing.TB)
+		fails  bool
+	}{
+		{"miss", func(t testing.TB) { r.AssertMiss(t, "/a", "1") }, false},
+		{"no hit", func(t testing.TB) { r.AssertHit(t, "/a", "1") }, true},
+		{"stored", func(t testing.TB) { r.AssertStored(t, "/b", "1") }, false},
+		{"not stored", func(t testing.TB) { r.AssertNotStored(t, "/a", "1") }, false},
+		{"stored after all", func(t testing.TB) { r.AssertNotStored(t, "/b", "1") }, true},
+		{"released by prefix", func(t testing.TB) { r.AssertReleased(t, "/c", "1") }, false},
+		{"released by beginning", func(t testing.TB) { r.AssertReleased(t, "/de", "1") }, false},
+		{"not released", func(t testing.TB) { r.AssertReleased(t, "/b", "1") }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft := &fakeT{TB: t}
+			tt.assert(ft)
+			if failed := len(ft.errors) > 0; failed != tt.fails {
+				t.Errorf("assertion failed = %v (%v), want %v", failed, ft.errors, tt.fails)
+			}
+		})
+	}
+}
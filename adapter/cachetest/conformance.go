@@ -0,0 +1,258 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cachetest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	cache "github.com/Columbus-internet/http-cache"
+)
+
+// conformanceTests are the checks of the conformance suite. They only use
+// prefixes starting with "/cachetest/", but those needing an empty
+// adapter.
+var conformanceTests = []struct {
+	name  string
+	empty bool
+	run   func(t *testing.T, a cache.Adapter)
+}{
+	{"set and get", false, testSetGet},
+	{"overwrite", false, testOverwrite},
+	{"prefixes are separate", false, testPrefixes},
+	{"binary value", false, testBinaryValue},
+	{"large value", false, testLargeValue},
+	{"release", false, testRelease},
+	{"release missing", false, testReleaseMissing},
+	{"release prefix", false, testReleasePrefix},
+	{"release if starts with", false, testReleaseIfStartsWith},
+	{"release all", true, testReleaseAll},
+	{"concurrent use", false, testConcurrentUse},
+}
+
+// TestAdapter runs a conformance suite against the adapters returned by
+// newAdapter, so that adapter authors can check theirs behaves the way
+// the middleware expects with one line in its test file. Each check runs
+// against a new, empty adapter, which is closed afterwards if it
+// implements io.Closer.
+func TestAdapter(t *testing.T, newAdapter func() cache.Adapter) {
+	for _, tt := range conformanceTests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAdapter()
+			if closer, ok := a.(io.Closer); ok {
+				defer closer.Close()
+			}
+			tt.run(t, a)
+		})
+	}
+}
+
+// RunAdapterTests runs the conformance suite against a single adapter,
+// e.g. one backed by a shared store, and releases the responses it cached
+// when done. The checks needing an empty adapter are skipped.
+func RunAdapterTests(t *testing.T, a cache.Adapter) {
+	defer a.ReleaseIfStartsWith("/cachetest/")
+
+	for _, tt := range conformanceTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.empty {
+				t.Skip("needs an empty adapter, run TestAdapter instead")
+			}
+			tt.run(t, a)
+		})
+	}
+}
+
+func testSetGet(t *testing.T, a cache.Adapter) {
+	prefix := "/cachetest/get"
+	if _, ok := a.Get(prefix, "1"); ok {
+		t.Fatal("Get() found a response never set")
+	}
+	a.Set(prefix, "1", []byte("value 1"))
+	if response, ok := a.Get(prefix, "1"); !ok || string(response) != "value 1" {
+		t.Errorf("Get() = %q, %v, want value 1, true", response, ok)
+	}
+	if !a.Exists(prefix, "1") {
+		t.Error("Exists() = false, want true")
+	}
+	if a.Exists(prefix, "2") {
+		t.Error("Exists() = true for a response never set")
+	}
+}
+
+func testOverwrite(t *testing.T, a cache.Adapter) {
+	prefix := "/cachetest/overwrite"
+	a.Set(prefix, "1", []byte("value 1"))
+	a.Set(prefix, "1", []byte("value 2"))
+	if response, ok := a.Get(prefix, "1"); !ok || string(response) != "value 2" {
+		t.Errorf("Get() = %q, %v, want value 2, true", response, ok)
+	}
+	if n, err := a.Release(prefix, "1"); n != 1 || err != nil {
+		t.Errorf("Release() = %v, %v, want 1, nil: an overwrite must not add a response", n, err)
+	}
+}
+
+func testPrefixes(t *testing.T, a cache.Adapter) {
+	a.Set("/cachetest/a", "1", []byte("a"))
+	a.Set("/cachetest/b", "1", []byte("b"))
+	if response, _ := a.Get("/cachetest/a", "1"); string(response) != "a" {
+		t.Errorf("Get() = %q, want a", response)
+	}
+	if response, _ := a.Get("/cachetest/b", "1"); string(response) != "b" {
+		t.Errorf("Get() = %q, want b", response)
+	}
+}
+
+func testBinaryValue(t *testing.T, a cache.Adapter) {
+	value := make([]byte, 64<<10)
+	for i := range value {
+		value[i] = byte(i)
+	}
+	testValue(t, a, "/cachetest/binary", value)
+}
+
+func testLargeValue(t *testing.T, a cache.Adapter) {
+	testValue(t, a, "/cachetest/large", bytes.Repeat([]byte("0123456789abcdef"), 512<<10/16))
+}
+
+func testValue(t *testing.T, a cache.Adapter, prefix string, value []byte) {
+	a.Set(prefix, "1", value)
+	if response, ok := a.Get(prefix, "1"); !ok || !bytes.Equal(response, value) {
+		t.Errorf("Get() = %v bytes, %v, want the %v bytes set back", len(response), ok, len(value))
+	}
+}
+
+func testRelease(t *testing.T, a cache.Adapter) {
+	prefix := "/cachetest/release"
+	a.Set(prefix, "1", []byte("value 1"))
+	a.Set(prefix, "2", []byte("value 2"))
+	if n, err := a.Release(prefix, "1"); n != 1 || err != nil {
+		t.Fatalf("Release() = %v, %v, want 1, nil", n, err)
+	}
+	if _, ok := a.Get(prefix, "1"); ok {
+		t.Error("Get() found a released response")
+	}
+	if _, ok := a.Get(prefix, "2"); !ok {
+		t.Error("Release() released another key of the prefix")
+	}
+}
+
+func testReleaseMissing(t *testing.T, a cache.Adapter) {
+	a.Set("/cachetest/missing", "1", []byte("value 1"))
+	if n, err := a.Release("/cachetest/missing", "2"); n != 0 || err != nil {
+		t.Errorf("Release() of a missing key = %v, %v, want 0, nil", n, err)
+	}
+	if n, err := a.Release("/cachetest/missing/none", "1"); n != 0 || err != nil {
+		t.Errorf("Release() of a missing prefix = %v, %v, want 0, nil", n, err)
+	}
+	if n, err := a.ReleasePrefix("/cachetest/missing/none"); n != 0 || err != nil {
+		t.Errorf("ReleasePrefix() of a missing prefix = %v, %v, want 0, nil", n, err)
+	}
+	if _, ok := a.Get("/cachetest/missing", "1"); !ok {
+		t.Error("releasing missing responses released another one")
+	}
+}
+
+func testReleasePrefix(t *testing.T, a cache.Adapter) {
+	a.Set("/cachetest/prefix", "1", []byte("value 1"))
+	a.Set("/cachetest/prefix", "2", []byte("value 2"))
+	a.Set("/cachetest/prefix/other", "1", []byte("other"))
+	a.Set("/cachetest/prefixes", "1", []byte("other"))
+	if n, err := a.ReleasePrefix("/cachetest/prefix"); n != 2 || err != nil {
+		t.Fatalf("ReleasePrefix() = %v, %v, want 2, nil", n, err)
+	}
+	for _, key := range []string{"1", "2"} {
+		if _, ok := a.Get("/cachetest/prefix", key); ok {
+			t.Errorf("Get() found the released response %v", key)
+		}
+	}
+	for _, prefix := range []string{"/cachetest/prefix/other", "/cachetest/prefixes"} {
+		if _, ok := a.Get(prefix, "1"); !ok {
+			t.Errorf("ReleasePrefix() released the prefix %v", prefix)
+		}
+	}
+}
+
+// testReleaseIfStartsWith checks the string is matched against the start
+// of the prefixes alone, not of the keys nor of the prefixes and keys
+// joined, and that it may end in the middle of a path segment.
+func testReleaseIfStartsWith(t *testing.T, a cache.Adapter) {
+	a.Set("/cachetest/starts/a", "1", []byte("a"))
+	a.Set("/cachetest/starts/ab", "1", []byte("ab"))
+	a.Set("/cachetest/starts/b", "1", []byte("b"))
+	a.Set("/cachetest/start", "s/a", []byte("key"))
+	if n, err := a.ReleaseIfStartsWith("/cachetest/starts/a"); n != 2 || err != nil {
+		t.Fatalf("ReleaseIfStartsWith() = %v, %v, want 2, nil", n, err)
+	}
+	for _, prefix := range []string{"/cachetest/starts/a", "/cachetest/starts/ab"} {
+		if _, ok := a.Get(prefix, "1"); ok {
+			t.Errorf("Get() found the released response of %v", prefix)
+		}
+	}
+	if _, ok := a.Get("/cachetest/starts/b", "1"); !ok {
+		t.Error("ReleaseIfStartsWith() released a prefix not matching")
+	}
+	if _, ok := a.Get("/cachetest/start", "s/a"); !ok {
+		t.Error("ReleaseIfStartsWith() matched the prefix and key joined")
+	}
+}
+
+func testReleaseAll(t *testing.T, a cache.Adapter) {
+	a.Set("/cachetest/all/a", "1", []byte("a"))
+	a.Set("/cachetest/all/b", "1", []byte("b"))
+	a.Set("/cachetest/all/b", "2", []byte("b"))
+	if n, err := a.ReleaseIfStartsWith(""); n != 3 || err != nil {
+		t.Fatalf("ReleaseIfStartsWith() = %v, %v, want 3, nil", n, err)
+	}
+	if _, ok := a.Get("/cachetest/all/a", "1"); ok {
+		t.Error("Get() found a released response")
+	}
+}
+
+func testConcurrentUse(t *testing.T, a cache.Adapter) {
+	prefix := "/cachetest/concurrent"
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprint(j % 10)
+				a.Set(prefix, key, []byte(fmt.Sprint("value ", i)))
+				if response, ok := a.Get(prefix, key); ok && !strings.HasPrefix(string(response), "value ") {
+					t.Errorf("Get() = %q, want one of the values set", response)
+				}
+				if j%25 == 0 {
+					a.Release(prefix, key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,31 @@
+package cachetest
+
+import (
+	"testing"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/memory"
+)
+
+func newMemoryAdapter(t *testing.T, shards int) cache.Adapter {
+	adapter, err := memory.NewAdapter(
+		memory.AdapterWithCapacity(100),
+		memory.AdapterWithShardCount(shards),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adapter
+}
+
+func TestTestAdapter(t *testing.T) {
+	for _, shards := range []int{1, 4} {
+		TestAdapter(t, func() cache.Adapter {
+			return newMemoryAdapter(t, shards)
+		})
+	}
+}
+
+func TestRunAdapterTests(t *testing.T) {
+	RunAdapterTests(t, newMemoryAdapter(t, 4))
+}
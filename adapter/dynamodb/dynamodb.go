@@ -0,0 +1,494 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// prefixAttribute is the partition key of the table.
+	prefixAttribute = "prefix"
+
+	// keyAttribute is the sort key of the table.
+	keyAttribute = "key"
+
+	// responseAttribute holds the cached response.
+	responseAttribute = "response"
+
+	// ttlAttribute holds the Unix time the response expires at, to be set
+	// as the time to live attribute of the table.
+	ttlAttribute = "ttl"
+
+	// bucketAttribute is the partition key of the prefix index, holding
+	// the same value on every item so that the index can be queried by
+	// the beginning of the prefixes.
+	bucketAttribute = "bucket"
+	bucket          = "cache"
+
+	// batchSize is the maximum number of requests per BatchWriteItem call.
+	batchSize = 25
+)
+
+// API is the part of the DynamoDB client used by the adapter. It is
+// implemented by *dynamodb.Client.
+type API interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// Adapter is the DynamoDB adapter data structure.
+//
+// The table has the prefix as partition key and the key as sort key, both
+// strings. Responses cached with a TTL get a numeric "ttl" attribute
+// holding the Unix time they expire at: enabling time to live on it lets
+// DynamoDB delete them, and until it does they are read as missing.
+//
+// ReleaseIfStartsWith queries a global secondary index, set with
+// AdapterWithPrefixIndex, having the "bucket" string attribute as
+// partition key and the prefix as sort key. Every item shares the same
+// bucket, so the index fits moderate write rates; without it, the table is
+// scanned.
+type Adapter struct {
+	client      API
+	table       string
+	prefixIndex string
+	retries     int
+	backoff     time.Duration
+}
+
+// AdapterOption is used to set Adapter settings.
+type AdapterOption func(a *Adapter) error
+
+// Get implements the cache Adapter interface Get method.
+func (a *Adapter) Get(prefix, key string) ([]byte, bool) {
+	b, ok, _ := a.GetContext(context.Background(), prefix, key)
+	return b, ok
+}
+
+// Exists implements the cache Adapter interface Exists method.
+func (a *Adapter) Exists(prefix, key string) bool {
+	ok, _ := a.ExistsContext(context.Background(), prefix, key)
+	return ok
+}
+
+// Set implements the cache Adapter interface Set method.
+func (a *Adapter) Set(prefix, key string, response []byte) {
+	a.SetContext(context.Background(), prefix, key, response, 0)
+}
+
+// SetWithTTL implements the cache TTLSetter interface SetWithTTL method,
+// letting DynamoDB expire the cached response.
+func (a *Adapter) SetWithTTL(prefix, key string, response []byte, ttl time.Duration) {
+	a.SetContext(context.Background(), prefix, key, response, ttl)
+}
+
+// GetChecked implements the cache CheckedAdapter interface GetChecked
+// method.
+func (a *Adapter) GetChecked(prefix, key string) ([]byte, bool, error) {
+	return a.GetContext(context.Background(), prefix, key)
+}
+
+// ExistsChecked implements the cache CheckedAdapter interface
+// ExistsChecked method.
+func (a *Adapter) ExistsChecked(prefix, key string) (bool, error) {
+	return a.ExistsContext(context.Background(), prefix, key)
+}
+
+// SetChecked implements the cache CheckedAdapter interface SetChecked
+// method.
+func (a *Adapter) SetChecked(prefix, key string, response []byte, ttl time.Duration) error {
+	return a.SetContext(context.Background(), prefix, key, response, ttl)
+}
+
+// GetContext implements the cache ContextAdapter interface GetContext
+// method.
+func (a *Adapter) GetContext(ctx context.Context, prefix, key string) ([]byte, bool, error) {
+	var out *dynamodb.GetItemOutput
+	err := a.retry(ctx, func() (err error) {
+		out, err = a.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(a.table),
+			Key:            itemKey(prefix, key),
+			ConsistentRead: aws.Bool(true),
+		})
+		return err
+	})
+	if err != nil || out.Item == nil || expired(out.Item, time.Now()) {
+		return nil, false, err
+	}
+	response, ok := out.Item[responseAttribute].(*types.AttributeValueMemberB)
+	if !ok {
+		return nil, false, errors.New("dynamodb adapter item has no response")
+	}
+	return response.Value, true, nil
+}
+
+// ExistsContext implements the cache ContextAdapter interface
+// ExistsContext method.
+func (a *Adapter) ExistsContext(ctx context.Context, prefix, key string) (bool, error) {
+	var out *dynamodb.GetItemOutput
+	err := a.retry(ctx, func() (err error) {
+		out, err = a.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:                aws.String(a.table),
+			Key:                      itemKey(prefix, key),
+			ConsistentRead:           aws.Bool(true),
+			ProjectionExpression:     aws.String("#ttl"),
+			ExpressionAttributeNames: map[string]string{"#ttl": ttlAttribute},
+		})
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return out.Item != nil && !expired(out.Item, time.Now()), nil
+}
+
+// SetContext implements the cache ContextAdapter interface SetContext
+// method.
+func (a *Adapter) SetContext(ctx context.Context, prefix, key string, response []byte, ttl time.Duration) error {
+	item := itemKey(prefix, key)
+	item[responseAttribute] = &types.AttributeValueMemberB{Value: response}
+	item[bucketAttribute] = &types.AttributeValueMemberS{Value: bucket}
+	if ttl > 0 {
+		item[ttlAttribute] = &types.AttributeValueMemberN{Value: expiration(ttl, time.Now())}
+	}
+	return a.retry(ctx, func() error {
+		_, err := a.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(a.table),
+			Item:      item,
+		})
+		return err
+	})
+}
+
+// Release implements the cache Adapter interface Release method.
+func (a *Adapter) Release(prefix, key string) (int, error) {
+	return a.ReleaseContext(context.Background(), prefix, key)
+}
+
+// ReleasePrefix implements the cache Adapter interface ReleasePrefix method.
+func (a *Adapter) ReleasePrefix(prefix string) (int, error) {
+	return a.ReleasePrefixContext(context.Background(), prefix)
+}
+
+// ReleaseIfStartsWith implements the cache Adapter interface
+// ReleaseIfStartsWith method.
+func (a *Adapter) ReleaseIfStartsWith(key string) (int, error) {
+	return a.ReleaseIfStartsWithContext(context.Background(), key)
+}
+
+// ReleaseContext implements the cache ContextAdapter interface
+// ReleaseContext method.
+func (a *Adapter) ReleaseContext(ctx context.Context, prefix, key string) (int, error) {
+	var out *dynamodb.DeleteItemOutput
+	err := a.retry(ctx, func() (err error) {
+		out, err = a.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName:    aws.String(a.table),
+			Key:          itemKey(prefix, key),
+			ReturnValues: types.ReturnValueAllOld,
+		})
+		return err
+	})
+	if err != nil || len(out.Attributes) == 0 {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// ReleasePrefixContext implements the cache ContextAdapter interface
+// ReleasePrefixContext method, querying the keys of the prefix and
+// deleting them in batches.
+func (a *Adapter) ReleasePrefixContext(ctx context.Context, prefix string) (int, error) {
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(a.table),
+		KeyConditionExpression:   aws.String("#prefix = :prefix"),
+		ProjectionExpression:     aws.String("#prefix, #key"),
+		ExpressionAttributeNames: map[string]string{"#prefix": prefixAttribute, "#key": keyAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":prefix": &types.AttributeValueMemberS{Value: prefix},
+		},
+	}
+	return a.releaseQuery(ctx, input)
+}
+
+// ReleaseIfStartsWithContext implements the cache ContextAdapter interface
+// ReleaseIfStartsWithContext method, querying the prefix index, or
+// scanning the table without one.
+func (a *Adapter) ReleaseIfStartsWithContext(ctx context.Context, key string) (int, error) {
+	if a.prefixIndex == "" {
+		return a.releaseScan(ctx, key)
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(a.table),
+		IndexName:                aws.String(a.prefixIndex),
+		KeyConditionExpression:   aws.String("#bucket = :bucket AND begins_with(#prefix, :prefix)"),
+		ProjectionExpression:     aws.String("#prefix, #key"),
+		ExpressionAttributeNames: map[string]string{"#bucket": bucketAttribute, "#prefix": prefixAttribute, "#key": keyAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":bucket": &types.AttributeValueMemberS{Value: bucket},
+			":prefix": &types.AttributeValueMemberS{Value: key},
+		},
+	}
+	if key == "" {
+		input.KeyConditionExpression = aws.String("#bucket = :bucket")
+		delete(input.ExpressionAttributeValues, ":prefix")
+	}
+	return a.releaseQuery(ctx, input)
+}
+
+// releaseQuery deletes the items returned by every page of the query.
+func (a *Adapter) releaseQuery(ctx context.Context, input *dynamodb.QueryInput) (int, error) {
+	var released int
+	for {
+		var out *dynamodb.QueryOutput
+		err := a.retry(ctx, func() (err error) {
+			out, err = a.client.Query(ctx, input)
+			return err
+		})
+		if err != nil {
+			return released, err
+		}
+		n, err := a.deleteItems(ctx, out.Items)
+		released += n
+		if err != nil || len(out.LastEvaluatedKey) == 0 {
+			return released, err
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// releaseScan deletes the items whose prefix starts with the key, scanning
+// the whole table.
+func (a *Adapter) releaseScan(ctx context.Context, key string) (int, error) {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(a.table),
+		ProjectionExpression:     aws.String("#prefix, #key"),
+		ExpressionAttributeNames: map[string]string{"#prefix": prefixAttribute, "#key": keyAttribute},
+	}
+	if key != "" {
+		input.FilterExpression = aws.String("begins_with(#prefix, :prefix)")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":prefix": &types.AttributeValueMemberS{Value: key},
+		}
+	}
+
+	var released int
+	for {
+		var out *dynamodb.ScanOutput
+		err := a.retry(ctx, func() (err error) {
+			out, err = a.client.Scan(ctx, input)
+			return err
+		})
+		if err != nil {
+			return released, err
+		}
+		n, err := a.deleteItems(ctx, out.Items)
+		released += n
+		if err != nil || len(out.LastEvaluatedKey) == 0 {
+			return released, err
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// deleteItems deletes the items by batches, retrying the unprocessed
+// requests, and returns how many were deleted.
+func (a *Adapter) deleteItems(ctx context.Context, items []map[string]types.AttributeValue) (int, error) {
+	var deleted int
+	for len(items) > 0 {
+		n := len(items)
+		if n > batchSize {
+			n = batchSize
+		}
+		requests := make([]types.WriteRequest, n)
+		for i, item := range items[:n] {
+			requests[i] = types.WriteRequest{DeleteRequest: &types.DeleteRequest{
+				Key: map[string]types.AttributeValue{
+					prefixAttribute: item[prefixAttribute],
+					keyAttribute:    item[keyAttribute],
+				},
+			}}
+		}
+		items = items[n:]
+
+		for attempt := 0; ; attempt++ {
+			var out *dynamodb.BatchWriteItemOutput
+			err := a.retry(ctx, func() (err error) {
+				out, err = a.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+					RequestItems: map[string][]types.WriteRequest{a.table: requests},
+				})
+				return err
+			})
+			if err != nil {
+				return deleted, err
+			}
+			unprocessed := out.UnprocessedItems[a.table]
+			deleted += len(requests) - len(unprocessed)
+			requests = unprocessed
+			if len(requests) == 0 {
+				break
+			}
+			if attempt == a.retries {
+				return deleted, errors.New("dynamodb adapter batch delete left unprocessed items")
+			}
+			if err := a.wait(ctx, attempt); err != nil {
+				return deleted, err
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// retry runs the operation, running it again with an exponential backoff
+// while DynamoDB throttles it.
+func (a *Adapter) retry(ctx context.Context, op func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt == a.retries || !throttled(err) {
+			return err
+		}
+		if err := a.wait(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// wait sleeps for the backoff of the attempt, doubled at every attempt,
+// unless the context is done first.
+func (a *Adapter) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(a.backoff << uint(attempt))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttled reports whether the error comes from DynamoDB throttling the
+// request.
+func throttled(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "ProvisionedThroughputExceededException", "RequestLimitExceeded", "ThrottlingException":
+		return true
+	}
+	return false
+}
+
+// itemKey returns the primary key of a cached response.
+func itemKey(prefix, key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		prefixAttribute: &types.AttributeValueMemberS{Value: prefix},
+		keyAttribute:    &types.AttributeValueMemberS{Value: key},
+	}
+}
+
+// expiration returns the ttl attribute of a TTL starting now, rounded up
+// to the second.
+func expiration(ttl time.Duration, now time.Time) string {
+	return strconv.FormatInt(now.Add(ttl+time.Second-1).Unix(), 10)
+}
+
+// expired reports whether the item has expired but has not yet been
+// deleted by DynamoDB, which may take days.
+func expired(item map[string]types.AttributeValue, now time.Time) bool {
+	ttl, ok := item[ttlAttribute].(*types.AttributeValueMemberN)
+	if !ok {
+		return false
+	}
+	exp, err := strconv.ParseInt(ttl.Value, 10, 64)
+	return err == nil && exp <= now.Unix()
+}
+
+// NewAdapter initializes DynamoDB adapter with the table it caches the
+// responses in.
+func NewAdapter(client API, table string, opts ...AdapterOption) (cache.Adapter, error) {
+	if client == nil {
+		return nil, errors.New("dynamodb adapter client is not set")
+	}
+	if table == "" {
+		return nil, errors.New("dynamodb adapter table is not set")
+	}
+	a := &Adapter{
+		client:  client,
+		table:   table,
+		retries: 5,
+		backoff: 50 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// AdapterWithPrefixIndex sets the name of the global secondary index
+// ReleaseIfStartsWith queries, keyed by the "bucket" and "prefix"
+// attributes. Optional setting.
+func AdapterWithPrefixIndex(name string) AdapterOption {
+	return func(a *Adapter) error {
+		if name == "" {
+			return errors.New("dynamodb adapter prefix index is not set")
+		}
+		a.prefixIndex = name
+		return nil
+	}
+}
+
+// AdapterWithRetries sets how many times a throttled operation is retried,
+// waiting for the backoff, doubled at every retry, in between. The default
+// is 5 retries from 50 milliseconds. Optional setting.
+func AdapterWithRetries(retries int, backoff time.Duration) AdapterOption {
+	return func(a *Adapter) error {
+		if retries < 0 {
+			return errors.New("dynamodb adapter retries is negative")
+		}
+		if backoff <= 0 {
+			return errors.New("dynamodb adapter backoff is not positive")
+		}
+		a.retries = retries
+		a.backoff = backoff
+		return nil
+	}
+}
@@ -0,0 +1,411 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// pageSize is the number of items per page returned by fakeAPI queries
+// and scans.
+const pageSize = 2
+
+// fakeAPI is an in-memory table understanding the requests the adapter
+// makes.
+type fakeAPI struct {
+	sync.Mutex
+	items map[[2]string]map[string]types.AttributeValue
+
+	// throttles is the number of calls to throttle before serving one.
+	throttles int
+
+	// unprocessed makes every batch write leave its last request
+	// unprocessed.
+	unprocessed bool
+
+	calls   int
+	indexed bool
+}
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{items: map[[2]string]map[string]types.AttributeValue{}}
+}
+
+func (f *fakeAPI) call() error {
+	f.calls++
+	if f.throttles > 0 {
+		f.throttles--
+		return &types.ProvisionedThroughputExceededException{Message: aws.String("throttled")}
+	}
+	return nil
+}
+
+func primaryKey(item map[string]types.AttributeValue) [2]string {
+	return [2]string{
+		item[prefixAttribute].(*types.AttributeValueMemberS).Value,
+		item[keyAttribute].(*types.AttributeValueMemberS).Value,
+	}
+}
+
+func (f *fakeAPI) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call(); err != nil {
+		return nil, err
+	}
+	return &dynamodb.GetItemOutput{Item: f.items[primaryKey(params.Key)]}, nil
+}
+
+func (f *fakeAPI) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call(); err != nil {
+		return nil, err
+	}
+	f.items[primaryKey(params.Item)] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeAPI) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call(); err != nil {
+		return nil, err
+	}
+	item := f.items[primaryKey(params.Key)]
+	delete(f.items, primaryKey(params.Key))
+	return &dynamodb.DeleteItemOutput{Attributes: item}, nil
+}
+
+func (f *fakeAPI) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call(); err != nil {
+		return nil, err
+	}
+	var prefix string
+	if v, ok := params.ExpressionAttributeValues[":prefix"]; ok {
+		prefix = v.(*types.AttributeValueMemberS).Value
+	}
+	match := func(p string) bool { return p == prefix }
+	if params.IndexName != nil {
+		f.indexed = true
+		match = func(p string) bool { return strings.HasPrefix(p, prefix) }
+	}
+	items, last := f.page(match, params.ExclusiveStartKey)
+	return &dynamodb.QueryOutput{Items: items, LastEvaluatedKey: last}, nil
+}
+
+func (f *fakeAPI) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call(); err != nil {
+		return nil, err
+	}
+	var prefix string
+	if v, ok := params.ExpressionAttributeValues[":prefix"]; ok {
+		prefix = v.(*types.AttributeValueMemberS).Value
+	}
+	items, last := f.page(func(p string) bool { return strings.HasPrefix(p, prefix) }, params.ExclusiveStartKey)
+	return &dynamodb.ScanOutput{Items: items, LastEvaluatedKey: last}, nil
+}
+
+// page returns a page of the items whose prefix matches, after the start
+// key, and the key to start the next page at.
+func (f *fakeAPI) page(match func(prefix string) bool, start map[string]types.AttributeValue) ([]map[string]types.AttributeValue, map[string]types.AttributeValue) {
+	var keys [][2]string
+	for k := range f.items {
+		if match(k[0]) && (start == nil || k[0]+"\x00"+k[1] > primaryKey(start)[0]+"\x00"+primaryKey(start)[1]) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i][0]+"\x00"+keys[i][1] < keys[j][0]+"\x00"+keys[j][1] })
+
+	var items []map[string]types.AttributeValue
+	for _, k := range keys {
+		if len(items) == pageSize {
+			return items, items[len(items)-1]
+		}
+		items = append(items, f.items[k])
+	}
+	return items, nil
+}
+
+func (f *fakeAPI) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call(); err != nil {
+		return nil, err
+	}
+	out := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]types.WriteRequest{}}
+	for table, requests := range params.RequestItems {
+		if f.unprocessed {
+			out.UnprocessedItems[table] = requests[len(requests)-1:]
+			requests = requests[:len(requests)-1]
+		}
+		for _, request := range requests {
+			delete(f.items, primaryKey(request.DeleteRequest.Key))
+		}
+	}
+	return out, nil
+}
+
+func newTestAdapter(t *testing.T, opts ...AdapterOption) (*fakeAPI, *Adapter) {
+	api := newFakeAPI()
+	opts = append([]AdapterOption{AdapterWithRetries(3, time.Millisecond)}, opts...)
+	a, err := NewAdapter(api, "cache", opts...)
+	if err != nil {
+		t.Fatalf("NewAdapter() error = %v", err)
+	}
+	return api, a.(*Adapter)
+}
+
+func TestSetGet(t *testing.T) {
+	_, a := newTestAdapter(t)
+	a.Set("/a", "1", []byte("value 1"))
+	a.SetWithTTL("/a", "2", []byte("value 2"), time.Minute)
+
+	tests := []struct {
+		name   string
+		prefix string
+		key    string
+		want   string
+		ok     bool
+	}{
+		{"returns right response", "/a", "1", "value 1", true},
+		{"returns right response with ttl", "/a", "2", "value 2", true},
+		{"key does not exist", "/a", "3", "", false},
+		{"prefix does not exist", "/b", "1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := a.Get(tt.prefix, tt.key)
+			if ok != tt.ok || string(got) != tt.want {
+				t.Errorf("dynamodb.Get() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+			if got := a.Exists(tt.prefix, tt.key); got != tt.ok {
+				t.Errorf("dynamodb.Exists() = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSetWithTTL(t *testing.T) {
+	api, a := newTestAdapter(t)
+	a.Set("/a", "1", []byte("1"))
+	a.SetWithTTL("/a", "2", []byte("2"), 90*time.Second)
+
+	if _, ok := api.items[[2]string{"/a", "1"}][ttlAttribute]; ok {
+		t.Errorf("dynamodb.Set() set the ttl attribute")
+	}
+	ttl, ok := api.items[[2]string{"/a", "2"}][ttlAttribute].(*types.AttributeValueMemberN)
+	if !ok {
+		t.Fatalf("dynamodb.SetWithTTL() did not set the ttl attribute")
+	}
+	if want := expiration(90*time.Second, time.Now()); ttl.Value != want {
+		t.Errorf("dynamodb.SetWithTTL() ttl = %v, want %v", ttl.Value, want)
+	}
+
+	// DynamoDB deletes expired items lazily
+	api.items[[2]string{"/a", "2"}][ttlAttribute] = &types.AttributeValueMemberN{Value: expiration(-time.Minute, time.Now())}
+	if _, ok := a.Get("/a", "2"); ok {
+		t.Errorf("dynamodb.Get() found an expired response")
+	}
+	if a.Exists("/a", "2") {
+		t.Errorf("dynamodb.Exists() found an expired response")
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want string
+	}{
+		{"seconds", time.Minute, "1500000060"},
+		{"rounds up", 1500 * time.Millisecond, "1500000002"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expiration(tt.ttl, now); got != tt.want {
+				t.Errorf("expiration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []AdapterOption
+		release     func(a cache.Adapter) (int, error)
+		want        map[[2]string]bool
+		wantRemoved int
+	}{
+		{
+			"releases a key",
+			nil,
+			func(a cache.Adapter) (int, error) { return a.Release("/a", "1") },
+			map[[2]string]bool{{"/a", "1"}: false, {"/a", "2"}: true, {"/a", "3"}: true, {"/ab", "1"}: true, {"/b", "1"}: true},
+			1,
+		},
+		{
+			"releases a missing key",
+			nil,
+			func(a cache.Adapter) (int, error) { return a.Release("/a", "4") },
+			map[[2]string]bool{{"/a", "1"}: true, {"/a", "2"}: true, {"/a", "3"}: true, {"/ab", "1"}: true, {"/b", "1"}: true},
+			0,
+		},
+		{
+			"releases a prefix over several pages",
+			nil,
+			func(a cache.Adapter) (int, error) { return a.ReleasePrefix("/a") },
+			map[[2]string]bool{{"/a", "1"}: false, {"/a", "2"}: false, {"/a", "3"}: false, {"/ab", "1"}: true, {"/b", "1"}: true},
+			3,
+		},
+		{
+			"releases the prefixes starting with a key by scanning",
+			nil,
+			func(a cache.Adapter) (int, error) { return a.ReleaseIfStartsWith("/a") },
+			map[[2]string]bool{{"/a", "1"}: false, {"/a", "2"}: false, {"/a", "3"}: false, {"/ab", "1"}: false, {"/b", "1"}: true},
+			4,
+		},
+		{
+			"releases the prefixes starting with a key through the index",
+			[]AdapterOption{AdapterWithPrefixIndex("prefix-index")},
+			func(a cache.Adapter) (int, error) { return a.ReleaseIfStartsWith("/a") },
+			map[[2]string]bool{{"/a", "1"}: false, {"/a", "2"}: false, {"/a", "3"}: false, {"/ab", "1"}: false, {"/b", "1"}: true},
+			4,
+		},
+		{
+			"releases everything through the index",
+			[]AdapterOption{AdapterWithPrefixIndex("prefix-index")},
+			func(a cache.Adapter) (int, error) { return a.ReleaseIfStartsWith("") },
+			map[[2]string]bool{{"/a", "1"}: false, {"/a", "2"}: false, {"/a", "3"}: false, {"/ab", "1"}: false, {"/b", "1"}: false},
+			5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, a := newTestAdapter(t, tt.opts...)
+			for k := range tt.want {
+				a.Set(k[0], k[1], []byte("value"))
+			}
+
+			removed, err := tt.release(a)
+			if err != nil {
+				t.Fatalf("release error = %v", err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("release removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			for k, want := range tt.want {
+				if got := a.Exists(k[0], k[1]); got != want {
+					t.Errorf("dynamodb.Exists(%v, %v) = %v, want %v", k[0], k[1], got, want)
+				}
+			}
+			if indexed := len(tt.opts) > 0; api.indexed != indexed {
+				t.Errorf("queried the index = %v, want %v", api.indexed, indexed)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		throttles int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"not throttled", 0, 1, false},
+		{"retries while throttled", 2, 3, false},
+		{"gives up after the retries", 4, 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, a := newTestAdapter(t)
+			api.throttles = tt.throttles
+			err := a.SetChecked("/a", "1", []byte("value"), 0)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("dynamodb.SetChecked() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if api.calls != tt.wantCalls {
+				t.Errorf("calls = %v, want %v", api.calls, tt.wantCalls)
+			}
+		})
+	}
+
+	t.Run("stops on other errors", func(t *testing.T) {
+		_, a := newTestAdapter(t)
+		calls := 0
+		err := a.retry(context.Background(), func() error {
+			calls++
+			return errors.New("failed")
+		})
+		if err == nil || calls != 1 {
+			t.Errorf("retry() error = %v after %v calls, want an error after 1", err, calls)
+		}
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		api, a := newTestAdapter(t)
+		api.throttles = 10
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := a.SetContext(ctx, "/a", "1", []byte("value"), 0); err != context.Canceled {
+			t.Errorf("dynamodb.SetContext() error = %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestReleaseUnprocessed(t *testing.T) {
+	api, a := newTestAdapter(t)
+	for _, key := range []string{"1", "2"} {
+		a.Set("/a", key, []byte("value"))
+	}
+
+	api.unprocessed = true
+	removed, err := a.ReleasePrefix("/a")
+	if err == nil {
+		t.Errorf("dynamodb.ReleasePrefix() error = nil, want one")
+	}
+	if removed != 1 {
+		t.Errorf("dynamodb.ReleasePrefix() removed = %v, want 1", removed)
+	}
+}
+
+func TestNewAdapter(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  API
+		table   string
+		opts    []AdapterOption
+		wantErr bool
+	}{
+		{"returns an adapter", newFakeAPI(), "cache", nil, false},
+		{"client is not set", nil, "cache", nil, true},
+		{"table is not set", newFakeAPI(), "", nil, true},
+		{"prefix index is not set", newFakeAPI(), "cache", []AdapterOption{AdapterWithPrefixIndex("")}, true},
+		{"retries are negative", newFakeAPI(), "cache", []AdapterOption{AdapterWithRetries(-1, time.Second)}, true},
+		{"backoff is not positive", newFakeAPI(), "cache", []AdapterOption{AdapterWithRetries(1, 0)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAdapter(tt.client, tt.table, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAdapter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
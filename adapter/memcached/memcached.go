@@ -0,0 +1,229 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package memcached
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+const (
+	// keyPrefix namespaces the keys set by the adapter.
+	keyPrefix = "http-cache:"
+
+	// globalGenerationKey is the key of the global generation counter.
+	globalGenerationKey = keyPrefix + "generation"
+
+	// maxRelativeExpiration is the longest expiration memcached reads as
+	// a number of seconds rather than a Unix time.
+	maxRelativeExpiration = 30 * 24 * time.Hour
+)
+
+// Adapter is the memcached adapter data structure.
+//
+// Responses cached with a TTL expire after it: TTLs up to 30 days are
+// given to memcached as seconds, longer ones as the Unix time they end
+// at, since memcached reads larger values as timestamps. Responses cached
+// without a TTL never expire and are left to the memcached eviction.
+//
+// Memcached cannot list its keys, so every cached key is mixed with a
+// generation counter of its prefix and a global one. ReleasePrefix bumps
+// the prefix counter, leaving the released responses unreachable until
+// memcached evicts them. ReleaseIfStartsWith and Flush bump the global
+// counter, which releases every response of the adapter.
+type Adapter struct {
+	client *memcache.Client
+}
+
+// Get implements the cache Adapter interface Get method.
+func (a *Adapter) Get(prefix, key string) ([]byte, bool) {
+	k, err := a.storeKey(prefix, key)
+	if err != nil {
+		return nil, false
+	}
+	item, err := a.client.Get(k)
+	if err != nil {
+		return nil, false
+	}
+	return item.Value, true
+}
+
+// Exists implements the cache Adapter interface Exists method.
+func (a *Adapter) Exists(prefix, key string) bool {
+	_, ok := a.Get(prefix, key)
+	return ok
+}
+
+// Set implements the cache Adapter interface Set method.
+func (a *Adapter) Set(prefix, key string, response []byte) {
+	a.set(prefix, key, response, 0)
+}
+
+// SetWithTTL implements the cache TTLSetter interface SetWithTTL method,
+// letting memcached expire the cached response.
+func (a *Adapter) SetWithTTL(prefix, key string, response []byte, ttl time.Duration) {
+	a.set(prefix, key, response, expiration(ttl, time.Now()))
+}
+
+func (a *Adapter) set(prefix, key string, response []byte, exp int32) {
+	k, err := a.storeKey(prefix, key)
+	if err != nil {
+		return
+	}
+	a.client.Set(&memcache.Item{Key: k, Value: response, Expiration: exp})
+}
+
+// Release implements the cache Adapter interface Release method.
+func (a *Adapter) Release(prefix, key string) (int, error) {
+	k, err := a.storeKey(prefix, key)
+	if err != nil {
+		return 0, err
+	}
+	switch err := a.client.Delete(k); err {
+	case nil:
+		return 1, nil
+	case memcache.ErrCacheMiss:
+		return 0, nil
+	default:
+		return 0, err
+	}
+}
+
+// ReleasePrefix implements the cache Adapter interface ReleasePrefix
+// method. The released responses cannot be counted, so it returns zero.
+func (a *Adapter) ReleasePrefix(prefix string) (int, error) {
+	return 0, a.bump(generationKey(prefix))
+}
+
+// ReleaseIfStartsWith implements the cache Adapter interface
+// ReleaseIfStartsWith method. Memcached cannot find the prefixes starting
+// with the key, so every cached response is released.
+func (a *Adapter) ReleaseIfStartsWith(key string) (int, error) {
+	return a.Flush()
+}
+
+// Flush implements the cache Flusher interface Flush method. Rather than
+// flushing the servers, which may hold other data, it bumps the global
+// generation. The released responses cannot be counted, so it returns
+// zero.
+func (a *Adapter) Flush() (int, error) {
+	return 0, a.bump(globalGenerationKey)
+}
+
+// Close closes the connections to the memcached servers.
+func (a *Adapter) Close() error {
+	return a.client.Close()
+}
+
+// storeKey returns the memcached key of a cached response, which changes
+// whenever its prefix or the whole cache is released.
+func (a *Adapter) storeKey(prefix, key string) (string, error) {
+	prefixKey := generationKey(prefix)
+	items, err := a.client.GetMulti([]string{globalGenerationKey, prefixKey})
+	if err != nil {
+		return "", err
+	}
+	global, err := a.generation(items, globalGenerationKey)
+	if err != nil {
+		return "", err
+	}
+	local, err := a.generation(items, prefixKey)
+	if err != nil {
+		return "", err
+	}
+	return keyPrefix + hash(global, local, prefix, key), nil
+}
+
+// generation returns the generation counter stored by the key among the
+// items, initializing it when it is missing.
+func (a *Adapter) generation(items map[string]*memcache.Item, key string) (string, error) {
+	if item, ok := items[key]; ok {
+		return string(item.Value), nil
+	}
+
+	// starting from the current time rather than zero, an evicted counter
+	// never brings back the responses of a former generation
+	item := &memcache.Item{Key: key, Value: []byte(strconv.FormatInt(time.Now().UnixNano(), 10))}
+	err := a.client.Add(item)
+	if err == memcache.ErrNotStored {
+		// initialized concurrently
+		if item, err = a.client.Get(key); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+	return string(item.Value), nil
+}
+
+// bump increments the generation counter stored by the key.
+func (a *Adapter) bump(key string) error {
+	_, err := a.client.Increment(key, 1)
+	if err == memcache.ErrCacheMiss {
+		_, err = a.generation(nil, key)
+	}
+	return err
+}
+
+// generationKey returns the key of the generation counter of a prefix.
+func generationKey(prefix string) string {
+	return keyPrefix + "generation:" + hash(prefix)
+}
+
+// hash returns the hex encoded hash of the parts, fitting any prefix and
+// key in the memcached key length limit.
+func hash(parts ...string) string {
+	h := sha1.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// expiration returns the memcached expiration of a TTL starting now.
+func expiration(ttl time.Duration, now time.Time) int32 {
+	if ttl > maxRelativeExpiration {
+		return int32(now.Add(ttl).Unix())
+	}
+	// rounded up, since zero would mean never
+	seconds := int32((ttl + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// NewAdapter initializes memcached adapter.
+func NewAdapter(client *memcache.Client) cache.Adapter {
+	return &Adapter{
+		client: client,
+	}
+}
@@ -0,0 +1,265 @@
+package memcached
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// fakeServer is a miniature memcached server speaking the subset of the
+// text protocol the adapter uses.
+type fakeServer struct {
+	sync.Mutex
+	listener net.Listener
+	items    map[string][]byte
+	exps     map[string]int32
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{listener: l, items: map[string][]byte{}, exps: map[string]int32{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return
+		}
+		s.Lock()
+		switch fields[0] {
+		case "gets":
+			for _, key := range fields[1:] {
+				if v, ok := s.items[key]; ok {
+					fmt.Fprintf(rw, "VALUE %s 0 %d 1\r\n%s\r\n", key, len(v), v)
+				}
+			}
+			fmt.Fprint(rw, "END\r\n")
+		case "set", "add":
+			exp, _ := strconv.Atoi(fields[3])
+			size, _ := strconv.Atoi(fields[4])
+			value := make([]byte, size+2)
+			io.ReadFull(rw, value)
+			if _, ok := s.items[fields[1]]; ok && fields[0] == "add" {
+				fmt.Fprint(rw, "NOT_STORED\r\n")
+				break
+			}
+			s.items[fields[1]] = value[:size]
+			s.exps[fields[1]] = int32(exp)
+			fmt.Fprint(rw, "STORED\r\n")
+		case "delete":
+			if _, ok := s.items[fields[1]]; !ok {
+				fmt.Fprint(rw, "NOT_FOUND\r\n")
+				break
+			}
+			delete(s.items, fields[1])
+			fmt.Fprint(rw, "DELETED\r\n")
+		case "incr":
+			v, ok := s.items[fields[1]]
+			if !ok {
+				fmt.Fprint(rw, "NOT_FOUND\r\n")
+				break
+			}
+			n, _ := strconv.ParseUint(string(v), 10, 64)
+			delta, _ := strconv.ParseUint(fields[2], 10, 64)
+			s.items[fields[1]] = []byte(strconv.FormatUint(n+delta, 10))
+			fmt.Fprintf(rw, "%d\r\n", n+delta)
+		default:
+			fmt.Fprint(rw, "ERROR\r\n")
+		}
+		s.Unlock()
+		rw.Flush()
+	}
+}
+
+// evict removes every generation counter, as memcached may do.
+func (s *fakeServer) evict() {
+	s.Lock()
+	defer s.Unlock()
+	for key := range s.items {
+		if strings.HasPrefix(key, globalGenerationKey) {
+			delete(s.items, key)
+		}
+	}
+}
+
+func newTestAdapter(t *testing.T) (*fakeServer, *Adapter) {
+	s := newFakeServer(t)
+	a := NewAdapter(memcache.New(s.listener.Addr().String())).(*Adapter)
+	return s, a
+}
+
+func TestSetGet(t *testing.T) {
+	_, a := newTestAdapter(t)
+	a.Set("/a", "1", []byte("value 1"))
+
+	tests := []struct {
+		name   string
+		prefix string
+		key    string
+		want   string
+		ok     bool
+	}{
+		{"returns right response", "/a", "1", "value 1", true},
+		{"key does not exist", "/a", "2", "", false},
+		{"prefix does not exist", "/b", "1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := a.Get(tt.prefix, tt.key)
+			if ok != tt.ok || string(got) != tt.want {
+				t.Errorf("memcached.Get() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+			if got := a.Exists(tt.prefix, tt.key); got != tt.ok {
+				t.Errorf("memcached.Exists() = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSetWithTTL(t *testing.T) {
+	s, a := newTestAdapter(t)
+	a.SetWithTTL("/a", "1", []byte("1"), 90*time.Second)
+
+	k, err := a.storeKey("/a", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Lock()
+	defer s.Unlock()
+	if got := s.exps[k]; got != 90 {
+		t.Errorf("memcached.SetWithTTL() expiration = %v, want 90", got)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want int32
+	}{
+		{"seconds", time.Minute, 60},
+		{"rounds up", 1500 * time.Millisecond, 2},
+		{"never zero", time.Millisecond, 1},
+		{"30 days", maxRelativeExpiration, int32(maxRelativeExpiration / time.Second)},
+		{"unix time beyond 30 days", 31 * 24 * time.Hour, 1500000000 + 31*24*3600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expiration(tt.ttl, now); got != tt.want {
+				t.Errorf("expiration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		name        string
+		release     func(a cache.Adapter) (int, error)
+		want        map[string]bool
+		wantRemoved int
+	}{
+		{
+			"releases a key",
+			func(a cache.Adapter) (int, error) { return a.Release("/a", "1") },
+			map[string]bool{"/a 1": false, "/a 2": true, "/ab 1": true, "/b 1": true},
+			1,
+		},
+		{
+			"releases a missing key",
+			func(a cache.Adapter) (int, error) { return a.Release("/a", "3") },
+			map[string]bool{"/a 1": true, "/a 2": true, "/ab 1": true, "/b 1": true},
+			0,
+		},
+		{
+			"releases a prefix",
+			func(a cache.Adapter) (int, error) { return a.ReleasePrefix("/a") },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": true, "/b 1": true},
+			0,
+		},
+		{
+			"releases everything for prefixes starting with",
+			func(a cache.Adapter) (int, error) { return a.ReleaseIfStartsWith("/a") },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": false, "/b 1": false},
+			0,
+		},
+		{
+			"flushes",
+			func(a cache.Adapter) (int, error) { return a.(cache.Flusher).Flush() },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": false, "/b 1": false},
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, a := newTestAdapter(t)
+			a.Set("/a", "1", []byte("1"))
+			a.Set("/a", "2", []byte("2"))
+			a.Set("/ab", "1", []byte("3"))
+			a.Set("/b", "1", []byte("4"))
+
+			removed, err := tt.release(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("memcached release removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			for _, prefix := range []string{"/a", "/ab", "/b"} {
+				for _, key := range []string{"1", "2"} {
+					want := tt.want[prefix+" "+key]
+					if got := a.Exists(prefix, key); got != want {
+						t.Errorf("memcached.Exists(%v, %v) = %v, want %v", prefix, key, got, want)
+					}
+				}
+			}
+
+			// the released prefix is usable again
+			a.Set("/a", "1", []byte("5"))
+			if got, ok := a.Get("/a", "1"); !ok || string(got) != "5" {
+				t.Errorf("memcached.Get() after release = %q, %v, want 5", got, ok)
+			}
+		})
+	}
+}
+
+func TestEvictedGeneration(t *testing.T) {
+	s, a := newTestAdapter(t)
+	a.Set("/a", "1", []byte("1"))
+	a.ReleasePrefix("/a")
+	s.evict()
+
+	if a.Exists("/a", "1") {
+		t.Error("memcached.Exists() found a response of a former generation")
+	}
+}
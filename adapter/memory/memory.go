@@ -0,0 +1,539 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package memory
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+)
+
+// Algorithm is the string type for caching algorithms labels.
+type Algorithm string
+
+const (
+	// LRU is the constant for Least Recently Used.
+	LRU Algorithm = "LRU"
+
+	// MRU is the constant for Most Recently Used.
+	MRU Algorithm = "MRU"
+
+	// LFU is the constant for Least Frequently Used.
+	LFU Algorithm = "LFU"
+
+	// MFU is the constant for Most Frequently Used.
+	MFU Algorithm = "MFU"
+)
+
+// Adapter is the memory adapter data structure. Cached responses are
+// spread over shards by key, each with its own lock and eviction order,
+// so that requests for different keys seldom contend.
+type Adapter struct {
+	capacity   int
+	maxBytes   int64
+	algorithm  Algorithm
+	shardCount int
+	shards     []*shard
+	metrics    Metrics
+	entries    int64
+	bytes      int64
+}
+
+// shard holds a part of the cached responses.
+type shard struct {
+	mutex    sync.Mutex
+	adapter  *Adapter
+	capacity int
+	maxBytes int64
+	bytes    int64
+	store    map[string]map[string]*entry
+	policy   policy
+	tags     map[string]map[*entry]bool
+}
+
+// Metrics receives the memory adapter events, e.g. to export them as
+// metrics. Its methods may be called concurrently.
+type Metrics interface {
+	// IncEviction counts a cached response evicted to make room for a
+	// new one.
+	IncEviction()
+
+	// SetEntries records the current number of cached responses.
+	SetEntries(n int)
+}
+
+// nopMetrics is the Metrics used when none are set.
+type nopMetrics struct{}
+
+func (nopMetrics) IncEviction()   {}
+func (nopMetrics) SetEntries(int) {}
+
+// BytesMetrics is implemented by the Metrics that also record the size
+// of the cached responses.
+type BytesMetrics interface {
+	// SetBytes records the current number of bytes cached.
+	SetBytes(n int64)
+}
+
+// entry is a stored response along with its access metadata, so that
+// eviction never needs to decode the response.
+type entry struct {
+	prefix     string
+	key        string
+	value      []byte
+	expiration time.Time
+	element    *list.Element
+	index      int
+	frequency  int
+	lastAccess uint64
+	tags       []string
+}
+
+// AdapterOption is used to set Adapter settings.
+type AdapterOption func(a *Adapter) error
+
+// Get implements the cache Adapter interface Get method.
+func (a *Adapter) Get(prefix, key string) ([]byte, bool) {
+	s := a.shard(prefix, key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if e, ok := s.lookup(prefix, key); ok {
+		s.access(e)
+		return e.value, true
+	}
+	return nil, false
+}
+
+// Exists implements the cache Adapter interface Exists method.
+func (a *Adapter) Exists(prefix, key string) bool {
+	s := a.shard(prefix, key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.lookup(prefix, key)
+	return ok
+}
+
+// Stats implements the cache StatsReporter interface Stats method.
+func (a *Adapter) Stats() cache.AdapterStats {
+	return cache.AdapterStats{
+		Entries: int(atomic.LoadInt64(&a.entries)),
+		Bytes:   atomic.LoadInt64(&a.bytes),
+	}
+}
+
+// Set implements the cache Adapter interface Set method.
+func (a *Adapter) Set(prefix, key string, response []byte) {
+	a.shard(prefix, key).set(prefix, key, response, time.Time{})
+}
+
+// SetWithTTL implements the cache TTLSetter interface SetWithTTL method.
+// The cached response is dropped once the ttl is over.
+func (a *Adapter) SetWithTTL(prefix, key string, response []byte, ttl time.Duration) {
+	a.shard(prefix, key).set(prefix, key, response, time.Now().Add(ttl))
+}
+
+// Touch implements the cache Toucher interface Touch method.
+func (a *Adapter) Touch(prefix, key string) {
+	s := a.shard(prefix, key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if e, ok := s.lookup(prefix, key); ok {
+		s.access(e)
+	}
+}
+
+// AddTags implements the cache TagStore interface AddTags method.
+func (a *Adapter) AddTags(prefix, key string, tags []string) {
+	s := a.shard(prefix, key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.store[prefix][key]
+	if !ok {
+		return
+	}
+	for _, tag := range tags {
+		if s.tags[tag][e] {
+			continue
+		}
+		if s.tags[tag] == nil {
+			s.tags[tag] = make(map[*entry]bool)
+		}
+		s.tags[tag][e] = true
+		e.tags = append(e.tags, tag)
+	}
+}
+
+// ReleaseTag implements the cache TagStore interface ReleaseTag method.
+func (a *Adapter) ReleaseTag(tag string) {
+	for _, s := range a.shards {
+		s.mutex.Lock()
+		for e := range s.tags[tag] {
+			s.remove(e)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// Keys implements the cache KeyLister interface Keys method.
+func (a *Adapter) Keys(prefix string) []string {
+	var keys []string
+	for _, s := range a.shards {
+		s.mutex.Lock()
+		for key := range s.store[prefix] {
+			keys = append(keys, key)
+		}
+		s.mutex.Unlock()
+	}
+	return keys
+}
+
+// Release implements the cache Adapter interface Release method.
+func (a *Adapter) Release(prefix, key string) (int, error) {
+	s := a.shard(prefix, key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.store[prefix][key]
+	if !ok {
+		return 0, nil
+	}
+	s.remove(e)
+	return 1, nil
+}
+
+// ReleasePrefix implements the cache Adapter interface ReleasePrefix method.
+func (a *Adapter) ReleasePrefix(prefix string) (int, error) {
+	return a.release(func(p string) bool { return p == prefix }), nil
+}
+
+// ReleaseIfStartsWith implements the cache Adapter interface
+// ReleaseIfStartsWith method.
+func (a *Adapter) ReleaseIfStartsWith(key string) (int, error) {
+	return a.release(func(prefix string) bool { return strings.HasPrefix(prefix, key) }), nil
+}
+
+// Sweep implements the cache Sweeper interface Sweep method.
+func (a *Adapter) Sweep(now time.Time) int {
+	n := 0
+	for _, s := range a.shards {
+		s.mutex.Lock()
+		for _, entries := range s.store {
+			for _, e := range entries {
+				if !e.expiration.IsZero() && !e.expiration.After(now) {
+					s.remove(e)
+					n++
+				}
+			}
+		}
+		s.mutex.Unlock()
+	}
+	return n
+}
+
+// Flush implements the cache Flusher interface Flush method.
+func (a *Adapter) Flush() (int, error) {
+	n := 0
+	for _, s := range a.shards {
+		s.mutex.Lock()
+		n += s.policy.len()
+		atomic.AddInt64(&a.entries, -int64(s.policy.len()))
+		atomic.AddInt64(&a.bytes, -s.bytes)
+		s.bytes = 0
+		s.store = make(map[string]map[string]*entry)
+		s.policy = newPolicy(a.algorithm)
+		s.tags = make(map[string]map[*entry]bool)
+		s.mutex.Unlock()
+	}
+	a.metrics.SetEntries(int(atomic.LoadInt64(&a.entries)))
+	a.setBytes(0)
+	return n, nil
+}
+
+// release removes the entries of the prefixes matching on every shard and
+// returns how many were removed.
+func (a *Adapter) release(match func(prefix string) bool) int {
+	n := 0
+	for _, s := range a.shards {
+		s.mutex.Lock()
+		for prefix, entries := range s.store {
+			if !match(prefix) {
+				continue
+			}
+			n += len(entries)
+			for _, e := range entries {
+				s.remove(e)
+			}
+		}
+		s.mutex.Unlock()
+	}
+	return n
+}
+
+// setBytes adds delta to the number of bytes cached and reports it to the
+// metrics, when they record it.
+func (a *Adapter) setBytes(delta int64) {
+	n := atomic.AddInt64(&a.bytes, delta)
+	if m, ok := a.metrics.(BytesMetrics); ok {
+		m.SetBytes(n)
+	}
+}
+
+// shard returns the shard holding the response by a given key.
+func (a *Adapter) shard(prefix, key string) *shard {
+	if len(a.shards) == 1 {
+		return a.shards[0]
+	}
+	// FNV-1a, inlined to hash without allocating
+	h := uint32(2166136261)
+	for i := 0; i < len(prefix); i++ {
+		h = (h ^ uint32(prefix[i])) * 16777619
+	}
+	h *= 16777619
+	for i := 0; i < len(key); i++ {
+		h = (h ^ uint32(key[i])) * 16777619
+	}
+	return a.shards[h&uint32(len(a.shards)-1)]
+}
+
+func (s *shard) set(prefix, key string, response []byte, expiration time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	size := int64(len(response))
+	e, ok := s.store[prefix][key]
+	if ok && (s.maxBytes == 0 || s.bytes-int64(len(e.value))+size <= s.maxBytes) {
+		s.grow(size - int64(len(e.value)))
+		e.value = response
+		e.expiration = expiration
+		s.untag(e)
+		s.access(e)
+		return
+	}
+	if ok {
+		// the response outgrew the room left, so it makes room as a new
+		// one would, without being evicted itself
+		s.remove(e)
+	}
+
+	// a response larger than the whole budget would only flush the
+	// others before being evicted in turn
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return
+	}
+
+	for s.capacity > 0 && s.policy.len() >= s.capacity {
+		s.evict()
+	}
+	for s.maxBytes > 0 && s.bytes+size > s.maxBytes {
+		s.evict()
+	}
+
+	e = &entry{prefix: prefix, key: key, value: response, expiration: expiration}
+	s.policy.add(e)
+	if s.store[prefix] == nil {
+		s.store[prefix] = make(map[string]*entry)
+	}
+	s.store[prefix][key] = e
+	s.grow(size)
+	s.adapter.metrics.SetEntries(int(atomic.AddInt64(&s.adapter.entries, 1)))
+}
+
+// grow adds delta to the number of bytes cached by the shard.
+func (s *shard) grow(delta int64) {
+	s.bytes += delta
+	s.adapter.setBytes(delta)
+}
+
+// lookup returns the entry by a given key, removing it when it is expired.
+func (s *shard) lookup(prefix, key string) (*entry, bool) {
+	e, ok := s.store[prefix][key]
+	if !ok {
+		return nil, false
+	}
+	if !e.expiration.IsZero() && !e.expiration.After(time.Now()) {
+		s.remove(e)
+		return nil, false
+	}
+	return e, true
+}
+
+// access records an access to the entry.
+func (s *shard) access(e *entry) {
+	s.policy.access(e)
+}
+
+// evict removes the entry chosen by the adapter algorithm.
+func (s *shard) evict() {
+	if e := s.policy.victim(); e != nil {
+		s.remove(e)
+		s.adapter.metrics.IncEviction()
+	}
+}
+
+// untag removes the entry from the tag index.
+func (s *shard) untag(e *entry) {
+	for _, tag := range e.tags {
+		delete(s.tags[tag], e)
+		if len(s.tags[tag]) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+	e.tags = nil
+}
+
+// remove deletes the entry from the store.
+func (s *shard) remove(e *entry) {
+	s.untag(e)
+	s.policy.remove(e)
+	delete(s.store[e.prefix], e.key)
+	if len(s.store[e.prefix]) == 0 {
+		delete(s.store, e.prefix)
+	}
+	s.grow(-int64(len(e.value)))
+	s.adapter.metrics.SetEntries(int(atomic.AddInt64(&s.adapter.entries, -1)))
+}
+
+// NewAdapter initializes memory adapter.
+func NewAdapter(opts ...AdapterOption) (cache.Adapter, error) {
+	a := &Adapter{
+		algorithm:  LRU,
+		shardCount: 1,
+		metrics:    nopMetrics{},
+	}
+
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.capacity < 1 && a.maxBytes < 1 {
+		return nil, errors.New("memory adapter capacity is not set")
+	}
+
+	// the capacity is split evenly, rounding up so that none is lost
+	capacity := (a.capacity + a.shardCount - 1) / a.shardCount
+	maxBytes := (a.maxBytes + int64(a.shardCount) - 1) / int64(a.shardCount)
+	a.shards = make([]*shard, a.shardCount)
+	for i := range a.shards {
+		a.shards[i] = &shard{
+			adapter:  a,
+			capacity: capacity,
+			maxBytes: maxBytes,
+			store:    make(map[string]map[string]*entry),
+			policy:   newPolicy(a.algorithm),
+			tags:     make(map[string]map[*entry]bool),
+		}
+	}
+
+	return a, nil
+}
+
+// AdapterWithAlgorithm sets the approach used to select a cached
+// response to be evicted when the capacity is reached.
+func AdapterWithAlgorithm(alg Algorithm) AdapterOption {
+	return func(a *Adapter) error {
+		switch alg {
+		case LRU, MRU, LFU, MFU:
+		default:
+			return fmt.Errorf("memory adapter algorithm %v is invalid", alg)
+		}
+
+		a.algorithm = alg
+
+		return nil
+	}
+}
+
+// AdapterWithCapacity sets the maximum number of cached responses.
+func AdapterWithCapacity(capacity int) AdapterOption {
+	return func(a *Adapter) error {
+		if capacity < 1 {
+			return fmt.Errorf("memory adapter capacity %v is invalid", capacity)
+		}
+
+		a.capacity = capacity
+
+		return nil
+	}
+}
+
+// AdapterWithMaxBytes sets the maximum number of bytes of cached
+// responses, evicting as the algorithm chooses until a new one fits. A
+// response larger than the budget is not stored. It can replace or
+// complement AdapterWithCapacity; with shards, each one gets an even part
+// of the budget.
+func AdapterWithMaxBytes(n int64) AdapterOption {
+	return func(a *Adapter) error {
+		if n < 1 {
+			return fmt.Errorf("memory adapter max bytes %v is invalid", n)
+		}
+
+		a.maxBytes = n
+
+		return nil
+	}
+}
+
+// AdapterWithMetrics sets the metrics receiving the adapter evictions and
+// number of cached responses. Optional setting.
+func AdapterWithMetrics(m Metrics) AdapterOption {
+	return func(a *Adapter) error {
+		if m == nil {
+			return errors.New("memory adapter metrics is not set")
+		}
+
+		a.metrics = m
+
+		return nil
+	}
+}
+
+// AdapterWithShardCount sets the number of shards the cached responses are
+// spread over, which must be a power of two. More shards cut the lock
+// contention of concurrent requests, but the capacity and the eviction
+// order apply to each shard rather than to the whole cache. Default is 1.
+// Optional setting.
+func AdapterWithShardCount(n int) AdapterOption {
+	return func(a *Adapter) error {
+		if n < 1 || n&(n-1) != 0 {
+			return fmt.Errorf("memory adapter shard count %v is not a power of two", n)
+		}
+
+		a.shardCount = n
+
+		return nil
+	}
+}
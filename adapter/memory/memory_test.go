@@ -0,0 +1,680 @@
+package memory
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+)
+
+func newTestAdapter(t testing.TB, capacity int) cache.Adapter {
+	a, err := NewAdapter(AdapterWithAlgorithm(LRU), AdapterWithCapacity(capacity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestGet(t *testing.T) {
+	a := newTestAdapter(t, 10)
+	a.Set("/a", "1", cache.Response{Value: []byte("value 1")}.Bytes())
+	a.Set("/a", "2", cache.Response{Value: []byte("value 2")}.Bytes())
+
+	tests := []struct {
+		name   string
+		prefix string
+		key    string
+		want   []byte
+		ok     bool
+	}{
+		{
+			"returns right response",
+			"/a",
+			"1",
+			[]byte("value 1"),
+			true,
+		},
+		{
+			"returns right response",
+			"/a",
+			"2",
+			[]byte("value 2"),
+			true,
+		},
+		{
+			"key does not exist",
+			"/a",
+			"3",
+			nil,
+			false,
+		},
+		{
+			"prefix does not exist",
+			"/b",
+			"1",
+			nil,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, ok := a.Get(tt.prefix, tt.key)
+			if ok != tt.ok {
+				t.Errorf("memory.Get() ok = %v, tt.ok %v", ok, tt.ok)
+				return
+			}
+			if !ok {
+				return
+			}
+			response, _ := cache.BytesToResponse(b)
+			if !reflect.DeepEqual(response.Value, tt.want) {
+				t.Errorf("memory.Get() = %v, want %v", string(response.Value), string(tt.want))
+			}
+			if !a.Exists(tt.prefix, tt.key) {
+				t.Errorf("memory.Exists() = false, want true")
+			}
+		})
+	}
+}
+
+func TestSetWithTTL(t *testing.T) {
+	a := newTestAdapter(t, 10)
+	a.(cache.TTLSetter).SetWithTTL("/a", "1", []byte("1"), 1*time.Minute)
+	a.(cache.TTLSetter).SetWithTTL("/a", "2", []byte("2"), 1*time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := a.Get("/a", "1"); !ok {
+		t.Error("memory.Get() error; key 1 should be found")
+	}
+	if _, ok := a.Get("/a", "2"); ok {
+		t.Error("memory.Get() error; expired key 2 should not be found")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		name        string
+		release     func(a cache.Adapter) (int, error)
+		want        map[string]bool
+		wantRemoved int
+	}{
+		{
+			"releases a key",
+			func(a cache.Adapter) (int, error) { return a.Release("/a", "1") },
+			map[string]bool{"/a 1": false, "/a 2": true, "/ab 1": true, "/b 1": true},
+			1,
+		},
+		{
+			"releases a missing key",
+			func(a cache.Adapter) (int, error) { return a.Release("/a", "3") },
+			map[string]bool{"/a 1": true, "/a 2": true, "/ab 1": true, "/b 1": true},
+			0,
+		},
+		{
+			"releases a prefix",
+			func(a cache.Adapter) (int, error) { return a.ReleasePrefix("/a") },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": true, "/b 1": true},
+			2,
+		},
+		{
+			"releases prefixes starting with",
+			func(a cache.Adapter) (int, error) { return a.ReleaseIfStartsWith("/a") },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": false, "/b 1": true},
+			3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAdapter(t, 10)
+			a.Set("/a", "1", []byte("1"))
+			a.Set("/a", "2", []byte("2"))
+			a.Set("/ab", "1", []byte("3"))
+			a.Set("/b", "1", []byte("4"))
+
+			removed, err := tt.release(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("memory release removed = %v, want %v", removed, tt.wantRemoved)
+			}
+
+			for _, prefix := range []string{"/a", "/ab", "/b"} {
+				for _, key := range []string{"1", "2"} {
+					want := tt.want[prefix+" "+key]
+					if got := a.Exists(prefix, key); got != want {
+						t.Errorf("memory.Exists(%v, %v) = %v, want %v", prefix, key, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	a := newTestAdapter(t, 3)
+	a.Set("/a", "1", []byte("1"))
+	a.Set("/a", "2", []byte("2"))
+	a.Set("/b", "3", []byte("3"))
+	a.Get("/a", "1")
+	a.(*Adapter).Touch("/a", "2")
+	a.Set("/b", "4", []byte("4"))
+	a.Set("/b", "5", []byte("5"))
+
+	tests := []struct {
+		prefix string
+		key    string
+		want   bool
+	}{
+		{"/a", "1", false},
+		{"/a", "2", true},
+		{"/b", "3", false},
+		{"/b", "4", true},
+		{"/b", "5", true},
+	}
+	for _, tt := range tests {
+		if got := a.Exists(tt.prefix, tt.key); got != tt.want {
+			t.Errorf("memory.Exists(%v, %v) = %v, want %v", tt.prefix, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestEviction(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm Algorithm
+		evicted   string
+	}{
+		{"LRU evicts the least recently used", LRU, "2"},
+		{"MRU evicts the most recently used", MRU, "1"},
+		{"LFU evicts the least frequently used", LFU, "3"},
+		{"MFU evicts the most frequently used", MFU, "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAdapter(AdapterWithAlgorithm(tt.algorithm), AdapterWithCapacity(3))
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.Set("/a", "1", []byte("1"))
+			a.Set("/a", "2", []byte("2"))
+			a.Set("/a", "3", []byte("3"))
+			// 2 is the most frequently used, 1 the most recently used and
+			// 3 the least frequently used
+			a.Get("/a", "2")
+			a.Get("/a", "2")
+			a.Get("/a", "3")
+			a.Get("/a", "1")
+			a.Get("/a", "1")
+			a.Set("/a", "4", []byte("4"))
+
+			for _, key := range []string{"1", "2", "3", "4"} {
+				if want := key != tt.evicted; a.Exists("/a", key) != want {
+					t.Errorf("memory.Exists(/a, %v) = %v, want %v", key, !want, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	a := newTestAdapter(t, 10).(*Adapter)
+	a.Set("/products/42", "1", []byte("1"))
+	a.Set("/home", "2", []byte("2"))
+	a.Set("/categories/8", "3", []byte("3"))
+	a.AddTags("/products/42", "1", []string{"product-42", "category-7"})
+	a.AddTags("/home", "2", []string{"product-42"})
+	a.AddTags("/categories/8", "3", []string{"category-8"})
+	a.AddTags("/missing", "4", []string{"product-42"})
+
+	a.ReleaseTag("product-42")
+
+	tests := []struct {
+		prefix string
+		key    string
+		want   bool
+	}{
+		{"/products/42", "1", false},
+		{"/home", "2", false},
+		{"/categories/8", "3", true},
+	}
+	for _, tt := range tests {
+		if got := a.Exists(tt.prefix, tt.key); got != tt.want {
+			t.Errorf("memory.Exists(%v, %v) = %v, want %v", tt.prefix, tt.key, got, tt.want)
+		}
+	}
+	if _, ok := a.shards[0].tags["category-7"]; ok {
+		t.Error("memory.ReleaseTag() left a released entry in the tag index")
+	}
+
+	// storing a new response drops the tags of the previous one
+	a.Set("/categories/8", "3", []byte("3"))
+	a.ReleaseTag("category-8")
+	if !a.Exists("/categories/8", "3") {
+		t.Error("memory.ReleaseTag() released an entry stored without the tag")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	a := newTestAdapter(t, 10).(*Adapter)
+	a.Set("/a", "1", []byte("1"))
+	a.Set("/a", "2", []byte("2"))
+	a.Set("/b", "3", []byte("3"))
+
+	got := a.Keys("/a")
+	sort.Strings(got)
+	if want := []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("memory.Keys() = %v, want %v", got, want)
+	}
+	if got := a.Keys("/c"); len(got) != 0 {
+		t.Errorf("memory.Keys() = %v, want none", got)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	a := newTestAdapter(t, 10).(*Adapter)
+	a.SetWithTTL("/a", "1", []byte("1"), time.Minute)
+	a.SetWithTTL("/a", "2", []byte("2"), time.Hour)
+	a.Set("/b", "3", []byte("3"))
+
+	if n := a.Sweep(time.Now().Add(2 * time.Minute)); n != 1 {
+		t.Errorf("memory.Sweep() = %v, want 1", n)
+	}
+	if a.Exists("/a", "1") {
+		t.Error("memory.Sweep() kept an expired response")
+	}
+	if !a.Exists("/a", "2") || !a.Exists("/b", "3") {
+		t.Error("memory.Sweep() released a fresh response")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	a := newTestAdapter(t, 10).(*Adapter)
+	a.Set("/a", "1", []byte("1"))
+	a.Set("/b", "2", []byte("2"))
+	a.AddTags("/a", "1", []string{"tag"})
+
+	n, err := a.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("memory.Flush() = %v, want 2", n)
+	}
+	if a.Exists("/a", "1") || a.Exists("/b", "2") || len(a.shards[0].tags) > 0 {
+		t.Error("memory.Flush() left cached responses")
+	}
+
+	// the adapter keeps working after a flush
+	a.Set("/a", "1", []byte("1"))
+	if !a.Exists("/a", "1") {
+		t.Error("memory.Set() after memory.Flush() did not store the response")
+	}
+}
+
+type metricsMock struct {
+	evictions int
+	entries   int
+	bytes     int64
+}
+
+func (m *metricsMock) IncEviction()     { m.evictions++ }
+func (m *metricsMock) SetEntries(n int) { m.entries = n }
+func (m *metricsMock) SetBytes(n int64) { m.bytes = n }
+
+func TestMetrics(t *testing.T) {
+	m := &metricsMock{}
+	a, err := NewAdapter(AdapterWithCapacity(2), AdapterWithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Set("/a", "1", []byte("1"))
+	a.Set("/a", "2", []byte("2"))
+	a.Set("/a", "3", []byte("3"))
+	a.Release("/a", "3")
+
+	if m.evictions != 1 {
+		t.Errorf("memory metrics evictions = %v, want 1", m.evictions)
+	}
+	if m.entries != 1 {
+		t.Errorf("memory metrics entries = %v, want 1", m.entries)
+	}
+	if m.bytes != 1 {
+		t.Errorf("memory metrics bytes = %v, want 1", m.bytes)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	tests := []struct {
+		name        string
+		alg         Algorithm
+		sets        []string
+		wantKeys    []string
+		wantBytes   int64
+		wantEvicted int
+	}{
+		{
+			"stores within budget",
+			LRU,
+			[]string{"a:1111", "b:2222"},
+			[]string{"a", "b"},
+			8,
+			0,
+		},
+		{
+			"evicts least recently used until the response fits",
+			LRU,
+			[]string{"a:1111", "b:2222", "c:333333"},
+			[]string{"b", "c"},
+			10,
+			1,
+		},
+		{
+			"evicts most recently used until the response fits",
+			MRU,
+			[]string{"a:1111", "b:2222", "c:333333"},
+			[]string{"a", "c"},
+			10,
+			1,
+		},
+		{
+			"evicts several responses for a large one",
+			LRU,
+			[]string{"a:11", "b:22", "c:33", "d:4444444444"},
+			[]string{"d"},
+			10,
+			3,
+		},
+		{
+			"rejects a response larger than the budget",
+			LRU,
+			[]string{"a:1111", "b:2222", "c:33333333333"},
+			[]string{"a", "b"},
+			8,
+			0,
+		},
+		{
+			"accounts for overwritten responses",
+			LRU,
+			[]string{"a:1111", "a:22", "b:333333"},
+			[]string{"a", "b"},
+			8,
+			0,
+		},
+		{
+			"drops a response overwritten by one larger than the budget",
+			LRU,
+			[]string{"a:1111", "a:22222222222"},
+			nil,
+			0,
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &metricsMock{}
+			b, err := NewAdapter(AdapterWithMaxBytes(10), AdapterWithAlgorithm(tt.alg), AdapterWithMetrics(m))
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := b.(*Adapter)
+			for _, set := range tt.sets {
+				kv := strings.SplitN(set, ":", 2)
+				a.Set("/", kv[0], []byte(kv[1]))
+			}
+
+			keys := a.Keys("/")
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("memory keys = %v, want %v", keys, tt.wantKeys)
+			}
+			want := cache.AdapterStats{Entries: len(tt.wantKeys), Bytes: tt.wantBytes}
+			if stats := a.Stats(); stats != want {
+				t.Errorf("memory.Stats() = %+v, want %+v", stats, want)
+			}
+			if m.bytes != tt.wantBytes {
+				t.Errorf("memory metrics bytes = %v, want %v", m.bytes, tt.wantBytes)
+			}
+			if m.evictions != tt.wantEvicted {
+				t.Errorf("memory metrics evictions = %v, want %v", m.evictions, tt.wantEvicted)
+			}
+		})
+	}
+}
+
+func TestStatsAfterRelease(t *testing.T) {
+	b, err := NewAdapter(AdapterWithCapacity(10), AdapterWithMaxBytes(100), AdapterWithShardCount(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := b.(*Adapter)
+	a.Set("/a", "1", []byte("123"))
+	a.Set("/a", "2", []byte("45"))
+	a.Set("/b", "1", []byte("6789"))
+	if want := (cache.AdapterStats{Entries: 3, Bytes: 9}); a.Stats() != want {
+		t.Errorf("memory.Stats() = %+v, want %+v", a.Stats(), want)
+	}
+
+	a.ReleasePrefix("/a")
+	if want := (cache.AdapterStats{Entries: 1, Bytes: 4}); a.Stats() != want {
+		t.Errorf("memory.Stats() after ReleasePrefix() = %+v, want %+v", a.Stats(), want)
+	}
+
+	a.Flush()
+	if want := (cache.AdapterStats{}); a.Stats() != want {
+		t.Errorf("memory.Stats() after Flush() = %+v, want %+v", a.Stats(), want)
+	}
+}
+
+func TestNewAdapter(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []AdapterOption
+		wantErr bool
+	}{
+		{
+			"returns new adapter",
+			[]AdapterOption{AdapterWithCapacity(10)},
+			false,
+		},
+		{
+			"returns error when capacity is not set",
+			[]AdapterOption{AdapterWithAlgorithm(LRU)},
+			true,
+		},
+		{
+			"returns error on invalid capacity",
+			[]AdapterOption{AdapterWithCapacity(0)},
+			true,
+		},
+		{
+			"returns new adapter with LFU algorithm",
+			[]AdapterOption{AdapterWithCapacity(10), AdapterWithAlgorithm(LFU)},
+			false,
+		},
+		{
+			"returns error on invalid algorithm",
+			[]AdapterOption{AdapterWithCapacity(10), AdapterWithAlgorithm("FIFO")},
+			true,
+		},
+		{
+			"returns new sharded adapter",
+			[]AdapterOption{AdapterWithCapacity(10), AdapterWithShardCount(4)},
+			false,
+		},
+		{
+			"returns error when shard count is not a power of two",
+			[]AdapterOption{AdapterWithCapacity(10), AdapterWithShardCount(3)},
+			true,
+		},
+		{
+			"returns error on invalid shard count",
+			[]AdapterOption{AdapterWithCapacity(10), AdapterWithShardCount(0)},
+			true,
+		},
+		{
+			"returns new adapter with max bytes only",
+			[]AdapterOption{AdapterWithMaxBytes(1 << 20)},
+			false,
+		},
+		{
+			"returns error on invalid max bytes",
+			[]AdapterOption{AdapterWithMaxBytes(0)},
+			true,
+		},
+		{
+			"returns error on nil metrics",
+			[]AdapterOption{AdapterWithCapacity(10), AdapterWithMetrics(nil)},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAdapter(tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAdapter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShards(t *testing.T) {
+	m := &metricsMock{}
+	b, err := NewAdapter(AdapterWithCapacity(1000), AdapterWithShardCount(8), AdapterWithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := b.(*Adapter)
+	for i := 0; i < 50; i++ {
+		a.Set("/a", strconv.Itoa(i), []byte("a"))
+		a.Set("/b", strconv.Itoa(i), []byte("b"))
+	}
+
+	used := 0
+	for _, s := range a.shards {
+		if s.capacity != 125 {
+			t.Errorf("memory shard capacity = %v, want 125", s.capacity)
+		}
+		if s.policy.len() > 0 {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Errorf("memory adapter used %v shards, want responses spread over several", used)
+	}
+	if got := len(a.Keys("/a")); got != 50 {
+		t.Errorf("memory.Keys() = %v keys, want 50", got)
+	}
+
+	n, err := a.ReleasePrefix("/a")
+	if err != nil || n != 50 {
+		t.Errorf("memory.ReleasePrefix() = %v, %v, want 50", n, err)
+	}
+	if m.entries != 50 {
+		t.Errorf("memory metrics entries = %v, want 50", m.entries)
+	}
+	for _, s := range a.shards {
+		if len(s.store["/a"]) > 0 {
+			t.Error("memory.ReleasePrefix() left responses on a shard")
+		}
+	}
+
+	if _, err := a.ReleaseIfStartsWith("/"); err != nil {
+		t.Fatal(err)
+	}
+	if m.entries != 0 {
+		t.Errorf("memory metrics entries = %v, want 0", m.entries)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	a, err := NewAdapter(AdapterWithCapacity(100), AdapterWithShardCount(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				prefix := fmt.Sprintf("/%d", j%7)
+				key := strconv.Itoa(j % 150)
+				switch (i + j) % 5 {
+				case 0:
+					a.Set(prefix, key, []byte(key))
+				case 1:
+					a.Release(prefix, key)
+				case 2:
+					a.ReleasePrefix(prefix)
+				default:
+					a.Get(prefix, key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func benchmarkMixed(b *testing.B, writePercent int) {
+	a := newTestAdapter(b, 10000)
+	value := cache.Response{Value: make([]byte, 1024), Expiration: time.Now().Add(time.Minute)}.Bytes()
+	for i := 0; i < 10000; i++ {
+		a.Set("/bench", strconv.Itoa(i), value)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		for pb.Next() {
+			key := strconv.Itoa(r.Intn(20000))
+			if r.Intn(100) < writePercent {
+				a.Set("/bench", key, value)
+			} else {
+				a.Get("/bench", key)
+			}
+		}
+	})
+}
+
+func BenchmarkMixed90Read10Write(b *testing.B) {
+	benchmarkMixed(b, 10)
+}
+
+func BenchmarkMixed50Read50Write(b *testing.B) {
+	benchmarkMixed(b, 50)
+}
+
+func BenchmarkParallelGet(b *testing.B) {
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("%dShards", shards), func(b *testing.B) {
+			a, err := NewAdapter(AdapterWithCapacity(10000), AdapterWithShardCount(shards))
+			if err != nil {
+				b.Fatal(err)
+			}
+			keys := make([]string, 10000)
+			for i := range keys {
+				keys[i] = strconv.Itoa(i)
+				a.Set("/bench", keys[i], []byte(keys[i]))
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(time.Now().UnixNano()))
+				for pb.Next() {
+					a.Get("/bench", keys[r.Intn(len(keys))])
+				}
+			})
+		})
+	}
+}
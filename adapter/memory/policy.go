@@ -0,0 +1,167 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package memory
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// policy keeps the order in which the entries of a shard are evicted.
+type policy interface {
+	// add records a new entry.
+	add(e *entry)
+
+	// access records an access to the entry.
+	access(e *entry)
+
+	// remove forgets the entry.
+	remove(e *entry)
+
+	// victim returns the entry to be evicted next, or nil when there is
+	// none.
+	victim() *entry
+
+	// len returns the number of entries recorded.
+	len() int
+}
+
+// newPolicy returns the policy implementing the algorithm.
+func newPolicy(alg Algorithm) policy {
+	switch alg {
+	case MRU:
+		return &recencyPolicy{list: list.New(), mostRecent: true}
+	case LFU:
+		return &frequencyPolicy{}
+	case MFU:
+		return &frequencyPolicy{mostFrequent: true}
+	default:
+		return &recencyPolicy{list: list.New()}
+	}
+}
+
+// recencyPolicy evicts by access order, from the least or the most
+// recently used entry.
+type recencyPolicy struct {
+	list       *list.List
+	mostRecent bool
+}
+
+func (p *recencyPolicy) add(e *entry) {
+	e.element = p.list.PushFront(e)
+}
+
+func (p *recencyPolicy) access(e *entry) {
+	p.list.MoveToFront(e.element)
+}
+
+func (p *recencyPolicy) remove(e *entry) {
+	p.list.Remove(e.element)
+}
+
+func (p *recencyPolicy) victim() *entry {
+	element := p.list.Back()
+	if p.mostRecent {
+		element = p.list.Front()
+	}
+	if element == nil {
+		return nil
+	}
+	return element.Value.(*entry)
+}
+
+func (p *recencyPolicy) len() int {
+	return p.list.Len()
+}
+
+// frequencyPolicy evicts by access count, from the least or the most
+// frequently used entry. Ties go to the least recently used one. Entries
+// are kept in a heap, so each operation is O(log n).
+type frequencyPolicy struct {
+	entries      []*entry
+	mostFrequent bool
+	clock        uint64
+}
+
+func (p *frequencyPolicy) add(e *entry) {
+	p.clock++
+	e.frequency = 1
+	e.lastAccess = p.clock
+	heap.Push(p, e)
+}
+
+func (p *frequencyPolicy) access(e *entry) {
+	p.clock++
+	e.frequency++
+	e.lastAccess = p.clock
+	heap.Fix(p, e.index)
+}
+
+func (p *frequencyPolicy) remove(e *entry) {
+	heap.Remove(p, e.index)
+}
+
+func (p *frequencyPolicy) victim() *entry {
+	if len(p.entries) == 0 {
+		return nil
+	}
+	return p.entries[0]
+}
+
+func (p *frequencyPolicy) len() int {
+	return len(p.entries)
+}
+
+// Len, Less, Swap, Push and Pop implement heap.Interface.
+
+func (p *frequencyPolicy) Len() int { return len(p.entries) }
+
+func (p *frequencyPolicy) Less(i, j int) bool {
+	a, b := p.entries[i], p.entries[j]
+	if a.frequency != b.frequency {
+		return (a.frequency < b.frequency) != p.mostFrequent
+	}
+	return a.lastAccess < b.lastAccess
+}
+
+func (p *frequencyPolicy) Swap(i, j int) {
+	p.entries[i], p.entries[j] = p.entries[j], p.entries[i]
+	p.entries[i].index = i
+	p.entries[j].index = j
+}
+
+func (p *frequencyPolicy) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(p.entries)
+	p.entries = append(p.entries, e)
+}
+
+func (p *frequencyPolicy) Pop() interface{} {
+	last := len(p.entries) - 1
+	e := p.entries[last]
+	p.entries[last] = nil
+	p.entries = p.entries[:last]
+	return e
+}
@@ -0,0 +1,40 @@
+package memory
+
+import "testing"
+
+func TestFrequencyPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		mostFrequent bool
+		want         []string
+	}{
+		{"least frequently used first", false, []string{"c", "a", "b"}},
+		{"most frequently used first", true, []string{"b", "a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &frequencyPolicy{mostFrequent: tt.mostFrequent}
+			entries := make(map[string]*entry)
+			for _, key := range []string{"a", "b", "c", "d"} {
+				entries[key] = &entry{key: key}
+				p.add(entries[key])
+			}
+			p.access(entries["a"])
+			p.access(entries["b"])
+			p.access(entries["b"])
+			p.access(entries["d"])
+			p.remove(entries["d"])
+
+			for _, want := range tt.want {
+				e := p.victim()
+				if e == nil || e.key != want {
+					t.Fatalf("frequencyPolicy.victim() = %v, want %v", e, want)
+				}
+				p.remove(e)
+			}
+			if p.victim() != nil || p.len() != 0 {
+				t.Error("frequencyPolicy.victim() returned an entry from an empty policy")
+			}
+		})
+	}
+}
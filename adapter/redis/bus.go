@@ -0,0 +1,91 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package redis
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/Columbus-internet/http-cache/adapter/tiered"
+	"github.com/go-redis/redis"
+)
+
+// Bus is a tiered adapter Bus over Redis pub/sub.
+type Bus struct {
+	ring    *redis.Ring
+	channel string
+	pubsub  *redis.PubSub
+}
+
+// Publish implements the tiered Bus interface Publish method.
+func (b *Bus) Publish(inv tiered.Invalidation) error {
+	msg, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	return b.ring.Publish(b.channel, msg).Err()
+}
+
+// Subscribe implements the tiered Bus interface Subscribe method. It can
+// only be called once.
+func (b *Bus) Subscribe(handler func(inv tiered.Invalidation)) error {
+	if b.pubsub != nil {
+		return errors.New("redis bus is already subscribed")
+	}
+	pubsub := b.ring.Subscribe(b.channel)
+	// wait for the subscription to be confirmed
+	if _, err := pubsub.Receive(); err != nil {
+		pubsub.Close()
+		return err
+	}
+	b.pubsub = pubsub
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			var inv tiered.Invalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &inv); err == nil {
+				handler(inv)
+			}
+		}
+	}()
+	return nil
+}
+
+// Close unsubscribes and closes the connections to the Redis servers.
+func (b *Bus) Close() error {
+	if b.pubsub != nil {
+		b.pubsub.Close()
+	}
+	return b.ring.Close()
+}
+
+// NewBus initializes a Redis bus publishing on the given channel.
+func NewBus(opt *RingOptions, channel string) *Bus {
+	ropt := redis.RingOptions(*opt)
+	return &Bus{
+		ring:    redis.NewRing(&ropt),
+		channel: channel,
+	}
+}
@@ -0,0 +1,41 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Columbus-internet/http-cache/adapter/tiered"
+)
+
+func TestBus(t *testing.T) {
+	opt := &RingOptions{
+		Addrs: map[string]string{
+			"server": ":6379",
+		},
+	}
+	publisher := NewBus(opt, "http-cache-test")
+	defer publisher.Close()
+	subscriber := NewBus(opt, "http-cache-test")
+	defer subscriber.Close()
+
+	received := make(chan tiered.Invalidation, 1)
+	if err := subscriber.Subscribe(func(inv tiered.Invalidation) { received <- inv }); err != nil {
+		t.Fatal(err)
+	}
+	if err := subscriber.Subscribe(func(tiered.Invalidation) {}); err == nil {
+		t.Error("redis.Bus.Subscribe() subscribed twice")
+	}
+
+	want := tiered.Invalidation{Op: tiered.InvalidateKey, Prefix: "/a", Key: "1", Node: "node"}
+	if err := publisher.Publish(want); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if got != want {
+			t.Errorf("redis.Bus received %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Error("redis.Bus received nothing")
+	}
+}
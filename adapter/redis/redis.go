@@ -25,72 +25,364 @@ SOFTWARE.
 package redis
 
 import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	cache "github.com/Columbus-internet/http-cache"
 	"github.com/go-redis/redis"
 )
 
-// Adapter is the memory adapter data structure.
+// Adapter is the Redis adapter data structure.
 type Adapter struct {
-	ring *redis.Ring
+	ring      *redis.Ring
+	timeout   time.Duration
+	namespace string
 }
 
 // RingOptions exports go-redis RingOptions type.
 type RingOptions redis.RingOptions
 
+// AdapterOption is used to set Adapter settings.
+type AdapterOption func(a *Adapter)
+
+// scanCount is the number of keys asked per SCAN call.
+const scanCount = 100
+
 // Get implements the cache Adapter interface Get method.
 func (a *Adapter) Get(prefix, key string) ([]byte, bool) {
-	if c, err := a.ring.HGet(prefix, key).Bytes(); err == nil {
+	if c, err := a.ring.Get(a.storeKey(prefix, key)).Bytes(); err == nil {
 		return c, true
 	}
 	return nil, false
 }
 
-// Exists ...
+// Exists implements the cache Adapter interface Exists method.
 func (a *Adapter) Exists(prefix, key string) bool {
-	if c, err := a.ring.HExists(prefix, key).Result(); err == nil {
-		return c
+	if n, err := a.ring.Exists(a.storeKey(prefix, key)).Result(); err == nil {
+		return n > 0
 	}
 	return false
 }
 
 // Set implements the cache Adapter interface Set method.
 func (a *Adapter) Set(prefix, key string, response []byte) {
-	a.ring.HSet(prefix, key, response)
+	a.ring.Set(a.storeKey(prefix, key), response, 0)
 }
 
-// Release implements the cache Adapter interface Release method.
-func (a *Adapter) Release(prefix, key string) {
-	a.ring.HDel(prefix, key)
+// SetWithTTL implements the cache TTLSetter interface SetWithTTL method,
+// letting Redis expire the cached response.
+func (a *Adapter) SetWithTTL(prefix, key string, response []byte, ttl time.Duration) {
+	a.ring.Set(a.storeKey(prefix, key), response, ttl)
+}
+
+// Peek implements the cache Peeker interface Peek method, reading the
+// start of the cached response and its length in a single round trip.
+func (a *Adapter) Peek(prefix, key string, n int) ([]byte, int, bool) {
+	if n <= 0 {
+		return nil, 0, false
+	}
+	var (
+		head   *redis.StringCmd
+		length *redis.IntCmd
+	)
+	k := a.storeKey(prefix, key)
+	_, err := a.ring.Pipelined(func(pipe redis.Pipeliner) error {
+		head = pipe.GetRange(k, 0, int64(n-1))
+		length = pipe.StrLen(k)
+		return nil
+	})
+	// cached responses are never empty, so a zero length is a miss
+	if err != nil || length.Val() == 0 {
+		return nil, 0, false
+	}
+	return []byte(head.Val()), int(length.Val()), true
+}
+
+// GetChecked implements the cache CheckedAdapter interface GetChecked
+// method, telling a missing response from a failed lookup.
+func (a *Adapter) GetChecked(prefix, key string) ([]byte, bool, error) {
+	c, err := a.ring.Get(a.storeKey(prefix, key)).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return c, true, nil
 }
 
-// ReleasePrefix ...
-func (a *Adapter) ReleasePrefix(prefix string) {
-	a.ring.Del(prefix)
+// ExistsChecked implements the cache CheckedAdapter interface
+// ExistsChecked method.
+func (a *Adapter) ExistsChecked(prefix, key string) (bool, error) {
+	n, err := a.ring.Exists(a.storeKey(prefix, key)).Result()
+	return n > 0, err
 }
 
-// ReleaseIfStartsWith ...
-func (a *Adapter) ReleaseIfStartsWith(key string) {
+// SetChecked implements the cache CheckedAdapter interface SetChecked
+// method.
+func (a *Adapter) SetChecked(prefix, key string, response []byte, ttl time.Duration) error {
+	return a.ring.Set(a.storeKey(prefix, key), response, ttl).Err()
+}
 
-	for {
-		var keys []string
-		var cursor uint64
-		//var err error
-		keys, cursor, _ = a.ring.Scan(cursor, key+"*", 100).Result()
+// GetContext implements the cache ContextAdapter interface GetContext
+// method.
+func (a *Adapter) GetContext(ctx context.Context, prefix, key string) ([]byte, bool, error) {
+	r := a.do(ctx, func() result {
+		b, ok, err := a.GetChecked(prefix, key)
+		return result{b: b, ok: ok, err: err}
+	})
+	return r.b, r.ok, r.err
+}
 
-		for idx := range keys {
-			a.ring.Del(keys[idx])
-		}
+// ExistsContext implements the cache ContextAdapter interface
+// ExistsContext method.
+func (a *Adapter) ExistsContext(ctx context.Context, prefix, key string) (bool, error) {
+	r := a.do(ctx, func() result {
+		ok, err := a.ExistsChecked(prefix, key)
+		return result{ok: ok, err: err}
+	})
+	return r.ok, r.err
+}
+
+// SetContext implements the cache ContextAdapter interface SetContext
+// method.
+func (a *Adapter) SetContext(ctx context.Context, prefix, key string, response []byte, ttl time.Duration) error {
+	return a.do(ctx, func() result {
+		return result{err: a.SetChecked(prefix, key, response, ttl)}
+	}).err
+}
+
+// ReleaseContext implements the cache ContextAdapter interface
+// ReleaseContext method.
+func (a *Adapter) ReleaseContext(ctx context.Context, prefix, key string) (int, error) {
+	r := a.do(ctx, func() result {
+		n, err := a.Release(prefix, key)
+		return result{n: n, err: err}
+	})
+	return r.n, r.err
+}
+
+// ReleasePrefixContext implements the cache ContextAdapter interface
+// ReleasePrefixContext method.
+func (a *Adapter) ReleasePrefixContext(ctx context.Context, prefix string) (int, error) {
+	r := a.do(ctx, func() result {
+		n, err := a.ReleasePrefix(prefix)
+		return result{n: n, err: err}
+	})
+	return r.n, r.err
+}
+
+// ReleaseIfStartsWithContext implements the cache ContextAdapter interface
+// ReleaseIfStartsWithContext method.
+func (a *Adapter) ReleaseIfStartsWithContext(ctx context.Context, key string) (int, error) {
+	r := a.do(ctx, func() result {
+		n, err := a.ReleaseIfStartsWith(key)
+		return result{n: n, err: err}
+	})
+	return r.n, r.err
+}
+
+// result holds the outcome of an operation run by do.
+type result struct {
+	b   []byte
+	ok  bool
+	n   int
+	err error
+}
 
-		if cursor == 0 {
-			break
+// do runs the operation until the context is done or the adapter timeout
+// is over, whichever comes first. The go-redis version in use does not
+// watch contexts, so an abandoned operation still runs to completion in
+// the background, bounded by the connection timeouts.
+func (a *Adapter) do(ctx context.Context, op func() result) result {
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+	}
+	if ctx.Done() == nil {
+		return op()
+	}
+	if err := ctx.Err(); err != nil {
+		return result{err: err}
+	}
+
+	done := make(chan result, 1)
+	go func() { done <- op() }()
+	select {
+	case r := <-done:
+		return r
+	case <-ctx.Done():
+		return result{err: ctx.Err()}
+	}
+}
+
+// Keys implements the cache KeyLister interface Keys method, scanning
+// every shard.
+func (a *Adapter) Keys(prefix string) []string {
+	var (
+		mutex sync.Mutex
+		keys  []string
+	)
+	a.ring.ForEachShard(func(client *redis.Client) error {
+		var cursor uint64
+		for {
+			found, next, err := client.Scan(cursor, escapePattern(a.namespace+prefix)+":*", scanCount).Result()
+			if err != nil {
+				return err
+			}
+			mutex.Lock()
+			for _, key := range found {
+				keys = append(keys, strings.TrimPrefix(key, a.namespace+prefix+":"))
+			}
+			mutex.Unlock()
+			if next == 0 {
+				return nil
+			}
+			cursor = next
 		}
+	})
+	return keys
+}
+
+// Release implements the cache Adapter interface Release method.
+func (a *Adapter) Release(prefix, key string) (int, error) {
+	n, err := a.ring.Del(a.storeKey(prefix, key)).Result()
+	return int(n), err
+}
+
+// ReleasePrefix implements the cache Adapter interface ReleasePrefix method.
+func (a *Adapter) ReleasePrefix(prefix string) (int, error) {
+	return a.releaseMatching(escapePattern(a.namespace+prefix) + ":*")
+}
+
+// ReleaseIfStartsWith implements the cache Adapter interface
+// ReleaseIfStartsWith method.
+func (a *Adapter) ReleaseIfStartsWith(key string) (int, error) {
+	return a.releaseMatching(escapePattern(a.namespace+key) + "*")
+}
+
+// Flush implements the cache Flusher interface Flush method. Rather than
+// flushing the database, it deletes the keys of the adapter namespace, tag
+// sets included. Without a namespace, it deletes every key of the
+// database, which should then hold nothing but the cache.
+func (a *Adapter) Flush() (int, error) {
+	return a.releaseMatching(escapePattern(a.namespace) + "*")
+}
+
+// AddTags implements the cache TagStore interface AddTags method. Each
+// tag is a Redis set of the keys of the responses carrying it, where the
+// keys of expired responses are left until the tag is released.
+func (a *Adapter) AddTags(prefix, key string, tags []string) {
+	for _, tag := range tags {
+		a.ring.SAdd(a.tagKey(tag), a.storeKey(prefix, key))
+	}
+}
+
+// ReleaseTag implements the cache TagStore interface ReleaseTag method.
+func (a *Adapter) ReleaseTag(tag string) {
+	keys, err := a.ring.SMembers(a.tagKey(tag)).Result()
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		a.ring.Del(key)
 	}
+	a.ring.Del(a.tagKey(tag))
 }
 
+// Close closes the connections to the Redis servers. It lets the cache
+// client close the adapter along with itself.
+func (a *Adapter) Close() error {
+	return a.ring.Close()
+}
+
+// releaseMatching deletes the keys matching the pattern on every shard,
+// using SCAN so that Redis is never blocked, and returns how many were
+// deleted.
+func (a *Adapter) releaseMatching(pattern string) (int, error) {
+	var released int64
+	err := a.ring.ForEachShard(func(client *redis.Client) error {
+		var cursor uint64
+		for {
+			keys, next, err := client.Scan(cursor, pattern, scanCount).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				n, err := client.Del(keys...).Result()
+				if err != nil {
+					return err
+				}
+				atomic.AddInt64(&released, n)
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	})
+	return int(released), err
+}
+
+// storeKey returns the Redis key of a cached response.
+func (a *Adapter) storeKey(prefix, key string) string {
+	return a.namespace + prefix + ":" + key
+}
+
+// tagKey returns the Redis key of the set of keys carrying a tag. Cache
+// prefixes are paths, so it never collides with a cached response key.
+func (a *Adapter) tagKey(tag string) string {
+	return a.namespace + "tag:" + tag
+}
+
+// escapePattern escapes the glob-style special characters of a SCAN
+// pattern.
+func escapePattern(s string) string {
+	return patternEscaper.Replace(s)
+}
+
+var patternEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"*", `\*`,
+	"?", `\?`,
+	"[", `\[`,
+	"]", `\]`,
+)
+
 // NewAdapter initializes Redis adapter.
-func NewAdapter(opt *RingOptions) cache.Adapter {
+func NewAdapter(opt *RingOptions, opts ...AdapterOption) cache.Adapter {
 	ropt := redis.RingOptions(*opt)
-	return &Adapter{
+	a := &Adapter{
 		ring: redis.NewRing(&ropt),
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// AdapterWithTimeout sets the maximum duration of each operation made
+// through the cache ContextAdapter interface, on top of the deadline of
+// the context it is given. Zero, the default, sets no maximum. Optional
+// setting.
+func AdapterWithTimeout(timeout time.Duration) AdapterOption {
+	return func(a *Adapter) {
+		a.timeout = timeout
+	}
+}
+
+// AdapterWithNamespace sets the string starting every Redis key set by the
+// adapter, e.g. "http-cache:", so that the cached responses are kept apart
+// from the other data of the database and Flush only deletes them. There
+// is none by default, so that the responses cached by former versions are
+// still found. Adapters sharing a database should each have their own
+// namespace. Optional setting.
+func AdapterWithNamespace(namespace string) AdapterOption {
+	return func(a *Adapter) {
+		a.namespace = namespace
+	}
 }
@@ -1,7 +1,10 @@
 package redis
 
 import (
+	"context"
+	"net"
 	"reflect"
+	"sort"
 	"testing"
 	"time"
 
@@ -19,11 +22,13 @@ func TestSet(t *testing.T) {
 
 	tests := []struct {
 		name     string
+		prefix   string
 		key      string
 		response []byte
 	}{
 		{
 			"sets a response cache",
+			"/test",
 			"1",
 			cache.Response{
 				Value:      []byte("value 1"),
@@ -32,6 +37,7 @@ func TestSet(t *testing.T) {
 		},
 		{
 			"sets a response cache",
+			"/test",
 			"2",
 			cache.Response{
 				Value:      []byte("value 2"),
@@ -40,6 +46,7 @@ func TestSet(t *testing.T) {
 		},
 		{
 			"sets a response cache",
+			"/test-other",
 			"3",
 			cache.Response{
 				Value:      []byte("value 3"),
@@ -49,32 +56,36 @@ func TestSet(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			a.Set(tt.key, tt.response, time.Now().Add(1*time.Minute))
+			a.Set(tt.prefix, tt.key, tt.response)
 		})
 	}
 }
 
 func TestGet(t *testing.T) {
 	tests := []struct {
-		name string
-		key  string
-		want []byte
-		ok   bool
+		name   string
+		prefix string
+		key    string
+		want   []byte
+		ok     bool
 	}{
 		{
 			"returns right response",
+			"/test",
 			"1",
 			[]byte("value 1"),
 			true,
 		},
 		{
 			"returns right response",
+			"/test",
 			"2",
 			[]byte("value 2"),
 			true,
 		},
 		{
 			"key does not exist",
+			"/test",
 			"4",
 			nil,
 			false,
@@ -82,47 +93,290 @@ func TestGet(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			b, ok := a.Get(tt.key)
+			b, ok := a.Get(tt.prefix, tt.key)
 			if ok != tt.ok {
-				t.Errorf("memory.Get() ok = %v, tt.ok %v", ok, tt.ok)
+				t.Errorf("redis.Get() ok = %v, tt.ok %v", ok, tt.ok)
 				return
 			}
-			got := cache.BytesToResponse(b).Value
+			if a.Exists(tt.prefix, tt.key) != tt.ok {
+				t.Errorf("redis.Exists() = %v, want %v", !tt.ok, tt.ok)
+			}
+			response, _ := cache.BytesToResponse(b)
+			got := response.Value
 			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("memory.Get() = %v, want %v", string(got), string(tt.want))
+				t.Errorf("redis.Get() = %v, want %v", string(got), string(tt.want))
 			}
 		})
 	}
 }
 
+func TestSetWithTTL(t *testing.T) {
+	a.(cache.TTLSetter).SetWithTTL("/ttl", "1", []byte("value"), 1*time.Second)
+	if _, ok := a.Get("/ttl", "1"); !ok {
+		t.Fatal("redis.SetWithTTL() did not store the response")
+	}
+	ttl, err := a.(*Adapter).ring.TTL(a.(*Adapter).storeKey("/ttl", "1")).Result()
+	if err != nil || ttl <= 0 || ttl > 1*time.Second {
+		t.Errorf("redis.SetWithTTL() ttl = %v, %v, want 1s", ttl, err)
+	}
+}
+
+func TestChecked(t *testing.T) {
+	c := a.(cache.CheckedAdapter)
+	if err := c.SetChecked("/checked", "1", []byte("value"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if b, ok, err := c.GetChecked("/checked", "1"); err != nil || !ok || string(b) != "value" {
+		t.Errorf("redis.GetChecked() = %v, %v, %v, want value", string(b), ok, err)
+	}
+	if _, ok, err := c.GetChecked("/checked", "2"); err != nil || ok {
+		t.Errorf("redis.GetChecked() = %v, %v, want a miss", ok, err)
+	}
+	if ok, err := c.ExistsChecked("/checked", "1"); err != nil || !ok {
+		t.Errorf("redis.ExistsChecked() = %v, %v, want true", ok, err)
+	}
+	a.Release("/checked", "1")
+
+	down := NewAdapter(&RingOptions{
+		Addrs: map[string]string{
+			"server": "127.0.0.1:1",
+		},
+	}).(cache.CheckedAdapter)
+	if _, _, err := down.GetChecked("/checked", "1"); err == nil {
+		t.Error("redis.GetChecked() error = nil, want an error on an unreachable server")
+	}
+	if err := down.SetChecked("/checked", "1", []byte("value"), 0); err == nil {
+		t.Error("redis.SetChecked() error = nil, want an error on an unreachable server")
+	}
+}
+
+func TestContext(t *testing.T) {
+	c := a.(cache.ContextAdapter)
+	if err := c.SetContext(context.Background(), "/context", "1", []byte("value"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if b, ok, err := c.GetContext(context.Background(), "/context", "1"); err != nil || !ok || string(b) != "value" {
+		t.Errorf("redis.GetContext() = %v, %v, %v, want value", string(b), ok, err)
+	}
+	if n, err := c.ReleaseContext(context.Background(), "/context", "1"); err != nil || n != 1 {
+		t.Errorf("redis.ReleaseContext() = %v, %v, want 1", n, err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := c.GetContext(canceled, "/context", "1"); err != context.Canceled {
+		t.Errorf("redis.GetContext() error = %v, want %v", err, context.Canceled)
+	}
+
+	// the server accepts connections, but never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	slow := NewAdapter(&RingOptions{
+		Addrs: map[string]string{
+			"server": l.Addr().String(),
+		},
+	}, AdapterWithTimeout(10*time.Millisecond)).(cache.ContextAdapter)
+	if _, _, err := slow.GetContext(context.Background(), "/context", "1"); err != context.DeadlineExceeded {
+		t.Errorf("redis.GetContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
 func TestRelease(t *testing.T) {
 	tests := []struct {
-		name string
-		key  string
+		name        string
+		prefix      string
+		key         string
+		wantRemoved int
 	}{
 		{
 			"removes cached response from store",
+			"/test",
 			"1",
-		},
-		{
-			"removes cached response from store",
-			"2",
-		},
-		{
-			"removes cached response from store",
-			"3",
+			1,
 		},
 		{
 			"key does not exist",
+			"/test",
 			"4",
+			0,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			a.Release(tt.key)
-			if _, ok := a.Get(tt.key); ok {
-				t.Errorf("memory.Release() error; key %v should not be found", tt.key)
+			removed, err := a.Release(tt.prefix, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("redis.Release() = %v, want %v", removed, tt.wantRemoved)
+			}
+			if _, ok := a.Get(tt.prefix, tt.key); ok {
+				t.Errorf("redis.Release() error; key %v should not be found", tt.key)
 			}
 		})
 	}
 }
+
+func TestReleasePrefix(t *testing.T) {
+	a.Set("/test", "1", []byte("1"))
+	if n, err := a.ReleasePrefix("/test"); err != nil || n != 2 {
+		t.Errorf("redis.ReleasePrefix() = %v, %v, want 2", n, err)
+	}
+
+	if a.Exists("/test", "1") || a.Exists("/test", "2") {
+		t.Error("redis.ReleasePrefix() error; prefix /test should not be found")
+	}
+	if !a.Exists("/test-other", "3") {
+		t.Error("redis.ReleasePrefix() error; prefix /test-other should be found")
+	}
+}
+
+func TestReleaseIfStartsWith(t *testing.T) {
+	a.Set("/test", "1", []byte("1"))
+	a.Set("/other", "1", []byte("1"))
+	a.ReleaseIfStartsWith("/test")
+
+	if a.Exists("/test", "1") || a.Exists("/test-other", "3") {
+		t.Error("redis.ReleaseIfStartsWith() error; prefixes starting with /test should not be found")
+	}
+	if !a.Exists("/other", "1") {
+		t.Error("redis.ReleaseIfStartsWith() error; prefix /other should be found")
+	}
+	a.ReleasePrefix("/other")
+}
+
+func TestReleaseTag(t *testing.T) {
+	a.Set("/products/42", "1", []byte("1"))
+	a.Set("/home", "2", []byte("2"))
+	a.Set("/categories/8", "3", []byte("3"))
+	s := a.(cache.TagStore)
+	s.AddTags("/products/42", "1", []string{"product-42", "category-7"})
+	s.AddTags("/home", "2", []string{"product-42"})
+	s.AddTags("/categories/8", "3", []string{"category-8"})
+
+	s.ReleaseTag("product-42")
+
+	tests := []struct {
+		prefix string
+		key    string
+		want   bool
+	}{
+		{"/products/42", "1", false},
+		{"/home", "2", false},
+		{"/categories/8", "3", true},
+	}
+	for _, tt := range tests {
+		if got := a.Exists(tt.prefix, tt.key); got != tt.want {
+			t.Errorf("redis.Exists(%v, %v) = %v, want %v", tt.prefix, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	a.Set("/keys", "1", []byte("1"))
+	a.Set("/keys", "2", []byte("2"))
+	a.Set("/keys-other", "3", []byte("3"))
+
+	got := a.(cache.KeyLister).Keys("/keys")
+	sort.Strings(got)
+	if want := []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("redis.Keys() = %v, want %v", got, want)
+	}
+}
+
+func TestEscapePattern(t *testing.T) {
+	if got, want := escapePattern(`/a*[b]?\`), `/a\*\[b\]\?\\`; got != want {
+		t.Errorf("escapePattern() = %v, want %v", got, want)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	a := NewAdapter(&RingOptions{
+		Addrs: map[string]string{
+			"server": ":6379",
+		},
+	}, AdapterWithNamespace("http-cache:"))
+	f := a.(cache.Flusher)
+	if _, err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	a.Set("/flush", "1", []byte("1"))
+	a.Set("/flush-other", "2", []byte("2"))
+	ring := a.(*Adapter).ring
+	if err := ring.Set("other-app:key", "value", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	defer ring.Del("other-app:key")
+
+	n, err := f.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("redis.Flush() = %v, want 2", n)
+	}
+	if a.Exists("/flush", "1") || a.Exists("/flush-other", "2") {
+		t.Error("redis.Flush() error; no response should be found")
+	}
+	if v, err := ring.Get("other-app:key").Result(); err != nil || v != "value" {
+		t.Errorf("redis.Flush() removed a key of another application: %q, %v", v, err)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	other := NewAdapter(&RingOptions{
+		Addrs: map[string]string{
+			"server": ":6379",
+		},
+	}, AdapterWithNamespace("other:"))
+	a.Set("/namespace", "1", []byte("1"))
+	other.Set("/namespace", "1", []byte("2"))
+	defer a.Release("/namespace", "1")
+	defer other.Release("/namespace", "1")
+
+	if b, _ := a.Get("/namespace", "1"); string(b) != "1" {
+		t.Errorf("redis.Get() = %q, want the response of its own namespace", b)
+	}
+	if keys := other.(cache.KeyLister).Keys("/namespace"); !reflect.DeepEqual(keys, []string{"1"}) {
+		t.Errorf("redis.Keys() = %v, want [1]", keys)
+	}
+	if _, err := other.(cache.Flusher).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Exists("/namespace", "1") {
+		t.Error("redis.Flush() removed a response of another namespace")
+	}
+	// without a namespace, the keys are the ones of former versions
+	if v, err := a.(*Adapter).ring.Get("/namespace:1").Result(); err != nil || v != "1" {
+		t.Errorf("redis.Set() key layout changed: %q, %v", v, err)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	p := a.(cache.Peeker)
+	a.Set("/peek", "1", []byte("0123456789"))
+	defer a.Release("/peek", "1")
+
+	head, size, ok := p.Peek("/peek", "1", 4)
+	if !ok || string(head) != "0123" || size != 10 {
+		t.Errorf("redis.Peek() = %q, %v, %v, want 0123, 10, true", head, size, ok)
+	}
+	if head, size, ok = p.Peek("/peek", "1", 20); !ok || string(head) != "0123456789" || size != 10 {
+		t.Errorf("redis.Peek() past the end = %q, %v, %v, want the whole response", head, size, ok)
+	}
+	if _, _, ok = p.Peek("/peek", "2", 4); ok {
+		t.Error("redis.Peek() of a missing key = true, want false")
+	}
+}
@@ -0,0 +1,51 @@
+package ristretto
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/memory"
+)
+
+const benchmarkKeys = 1 << 12
+
+// benchmarkReadWrite runs 90% of Gets and 10% of Sets of 1 KB responses
+// in parallel.
+func benchmarkReadWrite(b *testing.B, a cache.Adapter) {
+	value := make([]byte, 1024)
+	keys := make([]string, benchmarkKeys)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		a.Set("/benchmark", keys[i], value)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			key := keys[r.Intn(benchmarkKeys)]
+			if r.Intn(10) == 0 {
+				a.Set("/benchmark", key, value)
+			} else {
+				a.Get("/benchmark", key)
+			}
+		}
+	})
+}
+
+func BenchmarkRistrettoAdapterReadWrite(b *testing.B) {
+	a := newTestAdapter(b)
+	defer a.Close()
+	benchmarkReadWrite(b, a)
+}
+
+func BenchmarkMemoryAdapterReadWrite(b *testing.B) {
+	a, err := memory.NewAdapter(memory.AdapterWithCapacity(benchmarkKeys))
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkReadWrite(b, a)
+}
@@ -0,0 +1,253 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package ristretto
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/dgraph-io/ristretto"
+)
+
+// Adapter is the ristretto adapter data structure. Ristretto cannot list
+// its keys, so the adapter indexes them by prefix to release prefixes.
+type Adapter struct {
+	cache       *ristretto.Cache
+	capacity    int64
+	numCounters int64
+
+	// prefixes maps each prefix to its *prefixIndex
+	prefixes sync.Map
+}
+
+// prefixIndex holds the entries cached under a prefix.
+type prefixIndex struct {
+	sync.Mutex
+	entries map[string]*entry
+}
+
+// entry is a cached response along with the prefix and key it is indexed
+// by, so that evictions can be removed from the index.
+type entry struct {
+	prefix   string
+	key      string
+	response []byte
+}
+
+// AdapterOption is used to set Adapter settings.
+type AdapterOption func(a *Adapter) error
+
+// Get implements the cache Adapter interface Get method.
+func (a *Adapter) Get(prefix, key string) ([]byte, bool) {
+	if v, ok := a.cache.Get(storeKey(prefix, key)); ok {
+		return v.(*entry).response, true
+	}
+	return nil, false
+}
+
+// Exists implements the cache Adapter interface Exists method.
+func (a *Adapter) Exists(prefix, key string) bool {
+	_, ok := a.cache.Get(storeKey(prefix, key))
+	return ok
+}
+
+// Set implements the cache Adapter interface Set method. Ristretto applies
+// sets asynchronously, so it waits for the response to be visible.
+func (a *Adapter) Set(prefix, key string, response []byte) {
+	a.SetWithTTL(prefix, key, response, 0)
+}
+
+// SetWithTTL implements the cache TTLSetter interface SetWithTTL method,
+// letting ristretto expire the cached response.
+func (a *Adapter) SetWithTTL(prefix, key string, response []byte, ttl time.Duration) {
+	e := &entry{prefix: prefix, key: key, response: response}
+	a.index(e)
+	if !a.cache.SetWithTTL(storeKey(prefix, key), e, int64(len(response)), ttl) {
+		a.unindex(e)
+		return
+	}
+	a.cache.Wait()
+}
+
+// Release implements the cache Adapter interface Release method.
+func (a *Adapter) Release(prefix, key string) (int, error) {
+	v, ok := a.cache.Get(storeKey(prefix, key))
+	if !ok {
+		return 0, nil
+	}
+	a.cache.Del(storeKey(prefix, key))
+	a.unindex(v.(*entry))
+	return 1, nil
+}
+
+// ReleasePrefix implements the cache Adapter interface ReleasePrefix method.
+func (a *Adapter) ReleasePrefix(prefix string) (int, error) {
+	v, ok := a.prefixes.Load(prefix)
+	if !ok {
+		return 0, nil
+	}
+	return a.releaseIndex(prefix, v.(*prefixIndex)), nil
+}
+
+// ReleaseIfStartsWith implements the cache Adapter interface
+// ReleaseIfStartsWith method.
+func (a *Adapter) ReleaseIfStartsWith(key string) (int, error) {
+	n := 0
+	a.prefixes.Range(func(k, v interface{}) bool {
+		if prefix := k.(string); strings.HasPrefix(prefix, key) {
+			n += a.releaseIndex(prefix, v.(*prefixIndex))
+		}
+		return true
+	})
+	return n, nil
+}
+
+// Flush implements the cache Flusher interface Flush method.
+func (a *Adapter) Flush() (int, error) {
+	return a.ReleaseIfStartsWith("")
+}
+
+// Close stops the ristretto goroutines.
+func (a *Adapter) Close() error {
+	a.cache.Close()
+	return nil
+}
+
+// releaseIndex deletes the entries indexed under a prefix and returns how
+// many were still cached.
+func (a *Adapter) releaseIndex(prefix string, index *prefixIndex) int {
+	index.Lock()
+	entries := index.entries
+	index.entries = make(map[string]*entry)
+	index.Unlock()
+
+	n := 0
+	for key := range entries {
+		if _, ok := a.cache.Get(storeKey(prefix, key)); ok {
+			n++
+		}
+		a.cache.Del(storeKey(prefix, key))
+	}
+	return n
+}
+
+// index adds the entry to the prefix index.
+func (a *Adapter) index(e *entry) {
+	v, _ := a.prefixes.LoadOrStore(e.prefix, &prefixIndex{entries: make(map[string]*entry)})
+	index := v.(*prefixIndex)
+	index.Lock()
+	index.entries[e.key] = e
+	index.Unlock()
+}
+
+// unindex removes the entry from the prefix index, unless it was replaced
+// by a newer one.
+func (a *Adapter) unindex(e *entry) {
+	v, ok := a.prefixes.Load(e.prefix)
+	if !ok {
+		return
+	}
+	index := v.(*prefixIndex)
+	index.Lock()
+	if index.entries[e.key] == e {
+		delete(index.entries, e.key)
+	}
+	index.Unlock()
+}
+
+// evicted removes the entry of an evicted or rejected item from the index.
+func (a *Adapter) evicted(item *ristretto.Item) {
+	if e, ok := item.Value.(*entry); ok {
+		a.unindex(e)
+	}
+}
+
+// storeKey returns the ristretto key of a cached response.
+func storeKey(prefix, key string) string {
+	return prefix + "\x00" + key
+}
+
+// NewAdapter initializes ristretto adapter.
+func NewAdapter(opts ...AdapterOption) (cache.Adapter, error) {
+	a := &Adapter{}
+
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.capacity < 1 {
+		return nil, errors.New("ristretto adapter capacity is not set")
+	}
+	if a.numCounters == 0 {
+		// ten counters per response, assuming responses of 1 KB on average
+		a.numCounters = a.capacity / 100
+		if a.numCounters < 1000 {
+			a.numCounters = 1000
+		}
+	}
+
+	c, err := ristretto.NewCache(&ristretto.Config{
+		NumCounters: a.numCounters,
+		MaxCost:     a.capacity,
+		BufferItems: 64,
+		OnEvict:     a.evicted,
+		OnReject:    a.evicted,
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.cache = c
+	return a, nil
+}
+
+// AdapterWithCapacity sets the maximum total size in bytes of the cached
+// responses.
+func AdapterWithCapacity(capacity int64) AdapterOption {
+	return func(a *Adapter) error {
+		if capacity <= 1 {
+			return errors.New("ristretto adapter requires a capacity greater than 1")
+		}
+		a.capacity = capacity
+		return nil
+	}
+}
+
+// AdapterWithNumCounters sets the number of access frequency counters,
+// ideally ten times the number of responses expected when the cache is
+// full. Optional setting.
+func AdapterWithNumCounters(n int64) AdapterOption {
+	return func(a *Adapter) error {
+		if n < 1 {
+			return errors.New("ristretto adapter requires a positive number of counters")
+		}
+		a.numCounters = n
+		return nil
+	}
+}
@@ -0,0 +1,147 @@
+package ristretto
+
+import (
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+)
+
+func newTestAdapter(t testing.TB) *Adapter {
+	a, err := NewAdapter(AdapterWithCapacity(1 << 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.(*Adapter)
+}
+
+func TestGet(t *testing.T) {
+	a := newTestAdapter(t)
+	defer a.Close()
+	a.Set("/a", "1", []byte("value 1"))
+
+	tests := []struct {
+		name   string
+		prefix string
+		key    string
+		want   string
+		ok     bool
+	}{
+		{"returns right response", "/a", "1", "value 1", true},
+		{"key does not exist", "/a", "2", "", false},
+		{"prefix does not exist", "/b", "1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := a.Get(tt.prefix, tt.key)
+			if ok != tt.ok || string(got) != tt.want {
+				t.Errorf("ristretto.Get() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+			if got := a.Exists(tt.prefix, tt.key); got != tt.ok {
+				t.Errorf("ristretto.Exists() = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSetWithTTL(t *testing.T) {
+	a := newTestAdapter(t)
+	defer a.Close()
+	a.SetWithTTL("/a", "1", []byte("1"), time.Millisecond)
+
+	time.Sleep(10 * time.Millisecond)
+	if a.Exists("/a", "1") {
+		t.Error("ristretto.SetWithTTL() response did not expire")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		name        string
+		release     func(a cache.Adapter) (int, error)
+		want        map[string]bool
+		wantRemoved int
+	}{
+		{
+			"releases a key",
+			func(a cache.Adapter) (int, error) { return a.Release("/a", "1") },
+			map[string]bool{"/a 1": false, "/a 2": true, "/ab 1": true, "/b 1": true},
+			1,
+		},
+		{
+			"releases a missing key",
+			func(a cache.Adapter) (int, error) { return a.Release("/a", "3") },
+			map[string]bool{"/a 1": true, "/a 2": true, "/ab 1": true, "/b 1": true},
+			0,
+		},
+		{
+			"releases a prefix",
+			func(a cache.Adapter) (int, error) { return a.ReleasePrefix("/a") },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": true, "/b 1": true},
+			2,
+		},
+		{
+			"releases prefixes starting with",
+			func(a cache.Adapter) (int, error) { return a.ReleaseIfStartsWith("/a") },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": false, "/b 1": true},
+			3,
+		},
+		{
+			"flushes",
+			func(a cache.Adapter) (int, error) { return a.(cache.Flusher).Flush() },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": false, "/b 1": false},
+			4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAdapter(t)
+			defer a.Close()
+			a.Set("/a", "1", []byte("1"))
+			a.Set("/a", "2", []byte("2"))
+			a.Set("/ab", "1", []byte("3"))
+			a.Set("/b", "1", []byte("4"))
+
+			removed, err := tt.release(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("ristretto release removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			for _, prefix := range []string{"/a", "/ab", "/b"} {
+				for _, key := range []string{"1", "2"} {
+					want := tt.want[prefix+" "+key]
+					if got := a.Exists(prefix, key); got != want {
+						t.Errorf("ristretto.Exists(%v, %v) = %v, want %v", prefix, key, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewAdapter(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []AdapterOption
+		wantErr bool
+	}{
+		{"returns new adapter", []AdapterOption{AdapterWithCapacity(1 << 20)}, false},
+		{"returns new adapter with counters", []AdapterOption{AdapterWithCapacity(1 << 20), AdapterWithNumCounters(100)}, false},
+		{"requires a capacity", nil, true},
+		{"rejects a capacity of one", []AdapterOption{AdapterWithCapacity(1)}, true},
+		{"rejects no counters", []AdapterOption{AdapterWithCapacity(1 << 20), AdapterWithNumCounters(0)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAdapter(tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAdapter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				a.(*Adapter).Close()
+			}
+		})
+	}
+}
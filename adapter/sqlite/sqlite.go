@@ -0,0 +1,312 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	// registers the sqlite driver, written in pure Go
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// driverName is the database/sql driver the adapter opens.
+	driverName = "sqlite"
+
+	// defaultBusyTimeout is how long a writer waits for the others.
+	defaultBusyTimeout = 5 * time.Second
+)
+
+// schema creates the table of the cached responses. Being clustered by
+// prefix and key, the table covers the lookups and prefix releases by
+// itself, while the expiration index serves the sweeps.
+const schema = `
+CREATE TABLE IF NOT EXISTS cache_entries (
+	prefix     TEXT NOT NULL,
+	key        TEXT NOT NULL,
+	value      BLOB NOT NULL,
+	expires_at INTEGER,
+	PRIMARY KEY (prefix, key)
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS cache_entries_expires_at ON cache_entries (expires_at);
+`
+
+// Adapter is the SQLite adapter data structure. Cached responses are kept
+// in the cache_entries table of a database file, so that they survive
+// restarts. Responses cached with a TTL get an expires_at column, in Unix
+// nanoseconds, which Sweep releases them by.
+//
+// The database is opened in WAL mode, so that lookups never wait for the
+// writes. SQLite still allows a single writer at a time: concurrent
+// writers, within the process or not, wait for each other up to the busy
+// timeout, then fail.
+type Adapter struct {
+	db          *sql.DB
+	busyTimeout time.Duration
+
+	get    *sql.Stmt
+	exists *sql.Stmt
+	set    *sql.Stmt
+}
+
+// AdapterOption is used to set Adapter settings.
+type AdapterOption func(a *Adapter) error
+
+// Get implements the cache Adapter interface Get method.
+func (a *Adapter) Get(prefix, key string) ([]byte, bool) {
+	b, ok, _ := a.GetContext(context.Background(), prefix, key)
+	return b, ok
+}
+
+// Exists implements the cache Adapter interface Exists method.
+func (a *Adapter) Exists(prefix, key string) bool {
+	ok, _ := a.ExistsContext(context.Background(), prefix, key)
+	return ok
+}
+
+// Set implements the cache Adapter interface Set method.
+func (a *Adapter) Set(prefix, key string, response []byte) {
+	a.SetContext(context.Background(), prefix, key, response, 0)
+}
+
+// SetWithTTL implements the cache TTLSetter interface SetWithTTL method.
+func (a *Adapter) SetWithTTL(prefix, key string, response []byte, ttl time.Duration) {
+	a.SetContext(context.Background(), prefix, key, response, ttl)
+}
+
+// GetChecked implements the cache CheckedAdapter interface GetChecked
+// method.
+func (a *Adapter) GetChecked(prefix, key string) ([]byte, bool, error) {
+	return a.GetContext(context.Background(), prefix, key)
+}
+
+// ExistsChecked implements the cache CheckedAdapter interface
+// ExistsChecked method.
+func (a *Adapter) ExistsChecked(prefix, key string) (bool, error) {
+	return a.ExistsContext(context.Background(), prefix, key)
+}
+
+// SetChecked implements the cache CheckedAdapter interface SetChecked
+// method.
+func (a *Adapter) SetChecked(prefix, key string, response []byte, ttl time.Duration) error {
+	return a.SetContext(context.Background(), prefix, key, response, ttl)
+}
+
+// GetContext implements the cache ContextAdapter interface GetContext
+// method.
+func (a *Adapter) GetContext(ctx context.Context, prefix, key string) ([]byte, bool, error) {
+	var response []byte
+	err := a.get.QueryRowContext(ctx, prefix, key, time.Now().UnixNano()).Scan(&response)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return response, true, nil
+}
+
+// ExistsContext implements the cache ContextAdapter interface
+// ExistsContext method.
+func (a *Adapter) ExistsContext(ctx context.Context, prefix, key string) (bool, error) {
+	var one int
+	err := a.exists.QueryRowContext(ctx, prefix, key, time.Now().UnixNano()).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SetContext implements the cache ContextAdapter interface SetContext
+// method.
+func (a *Adapter) SetContext(ctx context.Context, prefix, key string, response []byte, ttl time.Duration) error {
+	var expiresAt interface{}
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixNano()
+	}
+	_, err := a.set.ExecContext(ctx, prefix, key, response, expiresAt)
+	return err
+}
+
+// Release implements the cache Adapter interface Release method.
+func (a *Adapter) Release(prefix, key string) (int, error) {
+	return a.ReleaseContext(context.Background(), prefix, key)
+}
+
+// ReleasePrefix implements the cache Adapter interface ReleasePrefix method.
+func (a *Adapter) ReleasePrefix(prefix string) (int, error) {
+	return a.ReleasePrefixContext(context.Background(), prefix)
+}
+
+// ReleaseIfStartsWith implements the cache Adapter interface
+// ReleaseIfStartsWith method.
+func (a *Adapter) ReleaseIfStartsWith(key string) (int, error) {
+	return a.ReleaseIfStartsWithContext(context.Background(), key)
+}
+
+// ReleaseContext implements the cache ContextAdapter interface
+// ReleaseContext method.
+func (a *Adapter) ReleaseContext(ctx context.Context, prefix, key string) (int, error) {
+	return a.release(ctx, `DELETE FROM cache_entries WHERE prefix = ? AND key = ?`, prefix, key)
+}
+
+// ReleasePrefixContext implements the cache ContextAdapter interface
+// ReleasePrefixContext method.
+func (a *Adapter) ReleasePrefixContext(ctx context.Context, prefix string) (int, error) {
+	return a.release(ctx, `DELETE FROM cache_entries WHERE prefix = ?`, prefix)
+}
+
+// ReleaseIfStartsWithContext implements the cache ContextAdapter interface
+// ReleaseIfStartsWithContext method.
+func (a *Adapter) ReleaseIfStartsWithContext(ctx context.Context, key string) (int, error) {
+	return a.release(ctx, `DELETE FROM cache_entries WHERE prefix LIKE ? ESCAPE '\'`, escapeLike(key)+"%")
+}
+
+// Flush implements the cache Flusher interface Flush method.
+func (a *Adapter) Flush() (int, error) {
+	return a.release(context.Background(), `DELETE FROM cache_entries`)
+}
+
+// Sweep implements the cache Sweeper interface Sweep method, releasing
+// the responses whose expiration has passed, including the ones a client
+// would still serve stale.
+func (a *Adapter) Sweep(now time.Time) int {
+	n, _ := a.release(context.Background(), `DELETE FROM cache_entries WHERE expires_at <= ?`, now.UnixNano())
+	return n
+}
+
+// Close closes the database.
+func (a *Adapter) Close() error {
+	for _, stmt := range []*sql.Stmt{a.get, a.exists, a.set} {
+		stmt.Close()
+	}
+	return a.db.Close()
+}
+
+// release runs the delete statement in a transaction and returns the
+// number of responses it removed.
+func (a *Adapter) release(ctx context.Context, query string, args ...interface{}) (int, error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// dsn returns the data source name of the database at the given path,
+// enabling WAL mode and case sensitive LIKE patterns, so that prefixes
+// are matched exactly and through the primary key, and taking the write
+// lock at the start of transactions, so that they wait for the others
+// rather than fail on their first write.
+func dsn(path string, busyTimeout time.Duration) string {
+	return "file:" + path +
+		"?_pragma=journal_mode(WAL)" +
+		"&_pragma=busy_timeout(" + strconv.FormatInt(int64(busyTimeout/time.Millisecond), 10) + ")" +
+		"&_pragma=case_sensitive_like(1)" +
+		"&_txlock=immediate"
+}
+
+// NewAdapter opens or creates the SQLite database at the given path and
+// initializes SQLite adapter, releasing the responses which expired while
+// the database was closed. Close the adapter to close the database.
+func NewAdapter(path string, opts ...AdapterOption) (cache.Adapter, error) {
+	if path == "" {
+		return nil, errors.New("sqlite adapter path is not set")
+	}
+	a := &Adapter{
+		busyTimeout: defaultBusyTimeout,
+	}
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open(driverName, dsn(path, a.busyTimeout))
+	if err != nil {
+		return nil, err
+	}
+	a.db = db
+	if err := a.prepare(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	a.Sweep(time.Now())
+	return a, nil
+}
+
+// prepare creates the schema and prepares the statements of the lookups
+// and stores.
+func (a *Adapter) prepare() (err error) {
+	if _, err = a.db.Exec(schema); err != nil {
+		return err
+	}
+	if a.get, err = a.db.Prepare(`SELECT value FROM cache_entries WHERE prefix = ? AND key = ? AND (expires_at IS NULL OR expires_at > ?)`); err != nil {
+		return err
+	}
+	if a.exists, err = a.db.Prepare(`SELECT 1 FROM cache_entries WHERE prefix = ? AND key = ? AND (expires_at IS NULL OR expires_at > ?)`); err != nil {
+		return err
+	}
+	a.set, err = a.db.Prepare(`INSERT OR REPLACE INTO cache_entries (prefix, key, value, expires_at) VALUES (?, ?, ?, ?)`)
+	return err
+}
+
+// AdapterWithBusyTimeout sets how long a write waits for the other
+// writers before failing. Default is 5 seconds. Optional setting.
+func AdapterWithBusyTimeout(timeout time.Duration) AdapterOption {
+	return func(a *Adapter) error {
+		if timeout <= 0 {
+			return errors.New("sqlite adapter busy timeout must be positive")
+		}
+		a.busyTimeout = timeout
+		return nil
+	}
+}
@@ -0,0 +1,280 @@
+package sqlite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/cachetest"
+)
+
+func tempPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "http-cache-sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "cache.db")
+}
+
+func newTestAdapter(t *testing.T, path string) *Adapter {
+	a, err := NewAdapter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.(*Adapter)
+}
+
+func TestConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "http-cache-sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	n := 0
+	cachetest.TestAdapter(t, func() cache.Adapter {
+		n++
+		return newTestAdapter(t, filepath.Join(dir, fmt.Sprintf("cache-%d.db", n)))
+	})
+}
+
+func TestGet(t *testing.T) {
+	path := tempPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	a := newTestAdapter(t, path)
+	defer a.Close()
+	a.Set("/a", "1", []byte("value 1"))
+	a.SetWithTTL("/a", "2", []byte("value 2"), time.Minute)
+	a.SetWithTTL("/a", "3", []byte("value 3"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	tests := []struct {
+		name   string
+		prefix string
+		key    string
+		want   string
+		ok     bool
+	}{
+		{"returns right response", "/a", "1", "value 1", true},
+		{"returns right response with ttl", "/a", "2", "value 2", true},
+		{"response has expired", "/a", "3", "", false},
+		{"key does not exist", "/a", "4", "", false},
+		{"prefix does not exist", "/b", "1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := a.Get(tt.prefix, tt.key)
+			if ok != tt.ok || string(got) != tt.want {
+				t.Errorf("sqlite.Get() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+			if got := a.Exists(tt.prefix, tt.key); got != tt.ok {
+				t.Errorf("sqlite.Exists() = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		name        string
+		release     func(a cache.Adapter) (int, error)
+		want        map[string]bool
+		wantRemoved int
+	}{
+		{
+			"releases a key",
+			func(a cache.Adapter) (int, error) { return a.Release("/a", "1") },
+			map[string]bool{"/a 1": false, "/a 2": true, "/ab 1": true, "/A 1": true, "/a_ 1": true, "/b 1": true},
+			1,
+		},
+		{
+			"releases a missing key",
+			func(a cache.Adapter) (int, error) { return a.Release("/a", "3") },
+			map[string]bool{"/a 1": true, "/a 2": true, "/ab 1": true, "/A 1": true, "/a_ 1": true, "/b 1": true},
+			0,
+		},
+		{
+			"releases a prefix",
+			func(a cache.Adapter) (int, error) { return a.ReleasePrefix("/a") },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": true, "/A 1": true, "/a_ 1": true, "/b 1": true},
+			2,
+		},
+		{
+			"releases a missing prefix",
+			func(a cache.Adapter) (int, error) { return a.ReleasePrefix("/c") },
+			map[string]bool{"/a 1": true, "/a 2": true, "/ab 1": true, "/A 1": true, "/a_ 1": true, "/b 1": true},
+			0,
+		},
+		{
+			"releases prefixes starting with",
+			func(a cache.Adapter) (int, error) { return a.ReleaseIfStartsWith("/a") },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": false, "/A 1": true, "/a_ 1": false, "/b 1": true},
+			4,
+		},
+		{
+			"matches wildcards literally",
+			func(a cache.Adapter) (int, error) { return a.ReleaseIfStartsWith("/a_") },
+			map[string]bool{"/a 1": true, "/a 2": true, "/ab 1": true, "/A 1": true, "/a_ 1": false, "/b 1": true},
+			1,
+		},
+		{
+			"flushes",
+			func(a cache.Adapter) (int, error) { return a.(cache.Flusher).Flush() },
+			map[string]bool{"/a 1": false, "/a 2": false, "/ab 1": false, "/A 1": false, "/a_ 1": false, "/b 1": false},
+			6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tempPath(t)
+			defer os.RemoveAll(filepath.Dir(path))
+			a := newTestAdapter(t, path)
+			defer a.Close()
+			a.Set("/a", "1", []byte("1"))
+			a.Set("/a", "2", []byte("2"))
+			a.Set("/ab", "1", []byte("3"))
+			a.Set("/A", "1", []byte("4"))
+			a.Set("/a_", "1", []byte("5"))
+			a.Set("/b", "1", []byte("6"))
+
+			removed, err := tt.release(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("sqlite release removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			for entry, want := range tt.want {
+				var prefix, key string
+				fmt.Sscan(entry, &prefix, &key)
+				if got := a.Exists(prefix, key); got != want {
+					t.Errorf("sqlite.Exists(%v, %v) = %v, want %v", prefix, key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := tempPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	now := time.Now()
+
+	a := newTestAdapter(t, path)
+	a.SetWithTTL("/a", "fresh", []byte("1"), time.Minute)
+	a.SetWithTTL("/a", "expired", []byte("2"), time.Nanosecond)
+	a.Set("/a", "forever", []byte("3"))
+	time.Sleep(time.Millisecond)
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopening sweeps the responses which expired in the meantime
+	a = newTestAdapter(t, path)
+	defer a.Close()
+	var n int
+	if err := a.db.QueryRow(`SELECT COUNT(*) FROM cache_entries`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("sqlite.NewAdapter() kept %v responses, want 2", n)
+	}
+
+	a.SetWithTTL("/a", "later", []byte("4"), time.Hour)
+	if n := a.Sweep(now.Add(2 * time.Minute)); n != 1 {
+		t.Errorf("sqlite.Sweep() = %v, want 1", n)
+	}
+	for _, key := range []string{"later", "forever"} {
+		if !a.Exists("/a", key) {
+			t.Errorf("sqlite.Sweep() released the %v response", key)
+		}
+	}
+}
+
+func TestWALMode(t *testing.T) {
+	path := tempPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	a := newTestAdapter(t, path)
+	defer a.Close()
+
+	var mode string
+	if err := a.db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %v, want wal", mode)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	path := tempPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	a := newTestAdapter(t, path)
+	defer a.Close()
+
+	// a second adapter stands for another process sharing the file
+	b := newTestAdapter(t, path)
+	defer b.Close()
+
+	errs := make(chan error, 20*30)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			adapter := a
+			if i%2 == 1 {
+				adapter = b
+			}
+			prefix := fmt.Sprintf("/%d", i%4)
+			for j := 0; j < 10; j++ {
+				key := fmt.Sprint(j)
+				if err := adapter.SetChecked(prefix, key, []byte(key), time.Minute); err != nil {
+					errs <- err
+				}
+				if _, _, err := adapter.GetChecked(prefix, key); err != nil {
+					errs <- err
+				}
+				if _, err := adapter.ReleasePrefix(prefix); err != nil {
+					errs <- err
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent access error = %v", err)
+	}
+}
+
+func TestNewAdapter(t *testing.T) {
+	path := tempPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	tests := []struct {
+		name    string
+		path    string
+		opts    []AdapterOption
+		wantErr bool
+	}{
+		{"opens the database", path, nil, false},
+		{"path is not set", "", nil, true},
+		{"busy timeout is not positive", path, []AdapterOption{AdapterWithBusyTimeout(0)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAdapter(tt.path, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAdapter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				a.(*Adapter).Close()
+			}
+		})
+	}
+}
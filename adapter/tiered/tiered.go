@@ -0,0 +1,262 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tiered
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+)
+
+// Adapter is the tiered adapter data structure. It keeps short lived
+// copies of the responses of a shared L2 adapter, e.g. Redis, in a local
+// L1 adapter, e.g. memory.
+//
+// A node may serve an L1 copy replaced or released in L2 by another node
+// for up to the L1 TTL. With a Bus, the stores and releases of a node are
+// broadcast to the others, which drop their L1 copies right away.
+type Adapter struct {
+	l1    cache.Adapter
+	l2    cache.Adapter
+	l1TTL time.Duration
+	bus   Bus
+	node  string
+}
+
+// Operations of an Invalidation.
+const (
+	InvalidateKey          = "key"
+	InvalidatePrefix       = "prefix"
+	InvalidateIfStartsWith = "starts-with"
+	InvalidateAll          = "all"
+)
+
+// Invalidation is a store or release broadcast to the other nodes, which
+// drop the matching L1 copies.
+type Invalidation struct {
+	Op     string `json:"op"`
+	Prefix string `json:"prefix,omitempty"`
+	Key    string `json:"key,omitempty"`
+	Node   string `json:"node"`
+}
+
+// Bus broadcasts invalidations among the nodes sharing an L2 adapter.
+type Bus interface {
+	// Publish sends the invalidation to every subscribed node, the
+	// publishing one included.
+	Publish(inv Invalidation) error
+
+	// Subscribe calls the handler with every invalidation published.
+	Subscribe(handler func(inv Invalidation)) error
+}
+
+// AdapterOption is used to set Adapter settings.
+type AdapterOption func(a *Adapter) error
+
+// Get implements the cache Adapter interface Get method, populating L1
+// on an L2 hit.
+func (a *Adapter) Get(prefix, key string) ([]byte, bool) {
+	if response, ok := a.l1.Get(prefix, key); ok {
+		return response, true
+	}
+	response, ok := a.l2.Get(prefix, key)
+	if ok {
+		a.setL1(prefix, key, response, a.l1TTL)
+	}
+	return response, ok
+}
+
+// Exists implements the cache Adapter interface Exists method.
+func (a *Adapter) Exists(prefix, key string) bool {
+	return a.l1.Exists(prefix, key) || a.l2.Exists(prefix, key)
+}
+
+// Set implements the cache Adapter interface Set method.
+func (a *Adapter) Set(prefix, key string, response []byte) {
+	a.l2.Set(prefix, key, response)
+	a.setL1(prefix, key, response, a.l1TTL)
+	a.publish(InvalidateKey, prefix, key)
+}
+
+// SetWithTTL implements the cache TTLSetter interface SetWithTTL method.
+// The L1 copy expires after the shortest of the TTL and the L1 TTL.
+func (a *Adapter) SetWithTTL(prefix, key string, response []byte, ttl time.Duration) {
+	if s, ok := a.l2.(cache.TTLSetter); ok {
+		s.SetWithTTL(prefix, key, response, ttl)
+	} else {
+		a.l2.Set(prefix, key, response)
+	}
+	if ttl > a.l1TTL {
+		ttl = a.l1TTL
+	}
+	a.setL1(prefix, key, response, ttl)
+	a.publish(InvalidateKey, prefix, key)
+}
+
+// Release implements the cache Adapter interface Release method. L2 is
+// released first, so that L1 is not populated again from it meanwhile,
+// and it tells how many responses were released.
+func (a *Adapter) Release(prefix, key string) (int, error) {
+	n, err := a.l2.Release(prefix, key)
+	a.l1.Release(prefix, key)
+	a.publish(InvalidateKey, prefix, key)
+	return n, err
+}
+
+// ReleasePrefix implements the cache Adapter interface ReleasePrefix method.
+func (a *Adapter) ReleasePrefix(prefix string) (int, error) {
+	n, err := a.l2.ReleasePrefix(prefix)
+	a.l1.ReleasePrefix(prefix)
+	a.publish(InvalidatePrefix, prefix, "")
+	return n, err
+}
+
+// ReleaseIfStartsWith implements the cache Adapter interface
+// ReleaseIfStartsWith method.
+func (a *Adapter) ReleaseIfStartsWith(key string) (int, error) {
+	n, err := a.l2.ReleaseIfStartsWith(key)
+	a.l1.ReleaseIfStartsWith(key)
+	a.publish(InvalidateIfStartsWith, key, "")
+	return n, err
+}
+
+// Flush implements the cache Flusher interface Flush method.
+func (a *Adapter) Flush() (int, error) {
+	n, err := flush(a.l2)
+	flush(a.l1)
+	a.publish(InvalidateAll, "", "")
+	return n, err
+}
+
+// Close closes the adapters and the bus implementing io.Closer, returning
+// the first error.
+func (a *Adapter) Close() error {
+	var first error
+	for _, v := range []interface{}{a.bus, a.l1, a.l2} {
+		if closer, ok := v.(io.Closer); ok {
+			if err := closer.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// setL1 copies the response to L1 for the given TTL.
+func (a *Adapter) setL1(prefix, key string, response []byte, ttl time.Duration) {
+	if s, ok := a.l1.(cache.TTLSetter); ok {
+		s.SetWithTTL(prefix, key, response, ttl)
+		return
+	}
+	a.l1.Set(prefix, key, response)
+}
+
+// publish broadcasts an invalidation to the other nodes.
+func (a *Adapter) publish(op, prefix, key string) {
+	if a.bus == nil {
+		return
+	}
+	a.bus.Publish(Invalidation{Op: op, Prefix: prefix, Key: key, Node: a.node})
+}
+
+// invalidate drops the L1 copies matching an invalidation published by
+// another node.
+func (a *Adapter) invalidate(inv Invalidation) {
+	if inv.Node == a.node {
+		return
+	}
+	switch inv.Op {
+	case InvalidateKey:
+		a.l1.Release(inv.Prefix, inv.Key)
+	case InvalidatePrefix:
+		a.l1.ReleasePrefix(inv.Prefix)
+	case InvalidateIfStartsWith:
+		a.l1.ReleaseIfStartsWith(inv.Prefix)
+	case InvalidateAll:
+		flush(a.l1)
+	}
+}
+
+// flush releases every response of the adapter.
+func flush(a cache.Adapter) (int, error) {
+	if f, ok := a.(cache.Flusher); ok {
+		return f.Flush()
+	}
+	return a.ReleaseIfStartsWith("")
+}
+
+// NewAdapter initializes tiered adapter, keeping L1 copies of the L2
+// responses for up to the l1TTL. The L1 adapter should implement
+// cache.TTLSetter, as the memory adapter does, or its copies only leave it
+// when evicted or released.
+func NewAdapter(l1, l2 cache.Adapter, l1TTL time.Duration, opts ...AdapterOption) (cache.Adapter, error) {
+	if l1 == nil || l2 == nil {
+		return nil, errors.New("tiered adapter requires both an L1 and an L2 adapter")
+	}
+	if l1TTL <= 0 {
+		return nil, errors.New("tiered adapter requires a positive L1 TTL")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	a := &Adapter{
+		l1:    l1,
+		l2:    l2,
+		l1TTL: l1TTL,
+		node:  hex.EncodeToString(id),
+	}
+
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.bus != nil {
+		if err := a.bus.Subscribe(a.invalidate); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// AdapterWithBus sets the bus the stores and releases are broadcast on,
+// so that every node drops its outdated L1 copies. Optional setting.
+func AdapterWithBus(bus Bus) AdapterOption {
+	return func(a *Adapter) error {
+		if bus == nil {
+			return errors.New("tiered adapter bus is not set")
+		}
+		a.bus = bus
+		return nil
+	}
+}
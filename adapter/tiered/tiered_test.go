@@ -0,0 +1,186 @@
+package tiered
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/cachetest"
+	"github.com/Columbus-internet/http-cache/adapter/memory"
+)
+
+// busMock delivers invalidations synchronously to every subscriber.
+type busMock struct {
+	sync.Mutex
+	handlers []func(inv Invalidation)
+}
+
+func (b *busMock) Publish(inv Invalidation) error {
+	b.Lock()
+	handlers := b.handlers
+	b.Unlock()
+	for _, handler := range handlers {
+		handler(inv)
+	}
+	return nil
+}
+
+func (b *busMock) Subscribe(handler func(inv Invalidation)) error {
+	b.Lock()
+	defer b.Unlock()
+	b.handlers = append(b.handlers, handler)
+	return nil
+}
+
+func newMemoryAdapter(t *testing.T) cache.Adapter {
+	a, err := memory.NewAdapter(memory.AdapterWithCapacity(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// newNode returns a tiered adapter with its own L1 in front of the l2.
+func newNode(t *testing.T, l2 cache.Adapter, opts ...AdapterOption) (cache.Adapter, cache.Adapter) {
+	l1 := newMemoryAdapter(t)
+	a, err := NewAdapter(l1, l2, time.Minute, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, l1
+}
+
+func TestConformance(t *testing.T) {
+	cachetest.TestAdapter(t, func() cache.Adapter {
+		a, _ := newNode(t, newMemoryAdapter(t))
+		return a
+	})
+}
+
+func TestGet(t *testing.T) {
+	l2 := newMemoryAdapter(t)
+	a, l1 := newNode(t, l2)
+	l2.Set("/a", "1", []byte("1"))
+	l1.Set("/a", "2", []byte("local"))
+
+	tests := []struct {
+		name string
+		key  string
+		want string
+		ok   bool
+		inL1 bool
+	}{
+		{"populates L1 from L2", "1", "1", true, true},
+		{"serves L1 first", "2", "local", true, true},
+		{"misses both", "3", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := a.Get("/a", tt.key)
+			if ok != tt.ok || string(got) != tt.want {
+				t.Errorf("tiered.Get() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+			if got := l1.Exists("/a", tt.key); got != tt.inL1 {
+				t.Errorf("tiered.Get() L1 copy = %v, want %v", got, tt.inL1)
+			}
+		})
+	}
+}
+
+func TestSetWithTTL(t *testing.T) {
+	l2 := newMemoryAdapter(t)
+	a, l1 := newNode(t, l2)
+	a.(cache.TTLSetter).SetWithTTL("/a", "1", []byte("1"), time.Hour)
+
+	if !l1.Exists("/a", "1") || !l2.Exists("/a", "1") {
+		t.Error("tiered.SetWithTTL() did not write both tiers")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		name        string
+		release     func(a cache.Adapter) (int, error)
+		wantRemoved int
+	}{
+		{"releases a key", func(a cache.Adapter) (int, error) { return a.Release("/a", "1") }, 1},
+		{"releases a prefix", func(a cache.Adapter) (int, error) { return a.ReleasePrefix("/a") }, 1},
+		{"releases prefixes starting with", func(a cache.Adapter) (int, error) { return a.ReleaseIfStartsWith("/") }, 1},
+		{"flushes", func(a cache.Adapter) (int, error) { return a.(cache.Flusher).Flush() }, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l2 := newMemoryAdapter(t)
+			bus := &busMock{}
+			a, l1 := newNode(t, l2, AdapterWithBus(bus))
+			b, otherL1 := newNode(t, l2, AdapterWithBus(bus))
+			a.Set("/a", "1", []byte("1"))
+			b.Get("/a", "1")
+
+			removed, err := tt.release(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("tiered release removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			for name, tier := range map[string]cache.Adapter{"L1": l1, "L2": l2, "other node L1": otherL1} {
+				if tier.Exists("/a", "1") {
+					t.Errorf("tiered release kept the %v response", name)
+				}
+			}
+		})
+	}
+}
+
+func TestDisagreement(t *testing.T) {
+	l2 := newMemoryAdapter(t)
+	a, _ := newNode(t, l2)
+	b, otherL1 := newNode(t, l2)
+	a.Set("/a", "1", []byte("1"))
+	b.Get("/a", "1")
+
+	// without a bus, the other node keeps its copy for the L1 TTL
+	a.Set("/a", "1", []byte("2"))
+	if got, _ := b.Get("/a", "1"); string(got) != "1" {
+		t.Errorf("tiered.Get() = %q, want the L1 copy", got)
+	}
+
+	// with one, the other node drops it
+	bus := &busMock{}
+	a, _ = newNode(t, l2, AdapterWithBus(bus))
+	b, err := NewAdapter(otherL1, l2, time.Minute, AdapterWithBus(bus))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Set("/a", "1", []byte("3"))
+	if got, _ := b.Get("/a", "1"); string(got) != "3" {
+		t.Errorf("tiered.Get() = %q, want the new L2 response", got)
+	}
+}
+
+func TestNewAdapter(t *testing.T) {
+	l := newMemoryAdapter(t)
+	tests := []struct {
+		name    string
+		l1, l2  cache.Adapter
+		l1TTL   time.Duration
+		opts    []AdapterOption
+		wantErr bool
+	}{
+		{"returns new adapter", l, l, time.Minute, nil, false},
+		{"returns new adapter with bus", l, l, time.Minute, []AdapterOption{AdapterWithBus(&busMock{})}, false},
+		{"requires L1", nil, l, time.Minute, nil, true},
+		{"requires L2", l, nil, time.Minute, nil, true},
+		{"requires L1 TTL", l, l, 0, nil, true},
+		{"requires bus", l, l, time.Minute, []AdapterOption{AdapterWithBus(nil)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewAdapter(tt.l1, tt.l2, tt.l1TTL, tt.opts...); (err != nil) != tt.wantErr {
+				t.Errorf("NewAdapter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// KeyLister is implemented by adapters able to list the keys of the
+// cached responses, which the admin handler needs to inspect the cache.
+type KeyLister interface {
+	// Keys returns the keys of the responses cached under a given prefix.
+	Keys(prefix string) []string
+}
+
+// StatsReporter is implemented by adapters able to report the size of the
+// cache, which the admin handler serves.
+type StatsReporter interface {
+	// Stats returns the current size of the cache.
+	Stats() AdapterStats
+}
+
+// AdapterStats is the size of the cache reported by an adapter.
+type AdapterStats struct {
+	// Entries is the number of cached responses.
+	Entries int `json:"entries"`
+
+	// Bytes is the size of the cached responses.
+	Bytes int64 `json:"bytes"`
+}
+
+// adminEntry is the admin handler description of a cached response.
+type adminEntry struct {
+	Prefix     string    `json:"prefix"`
+	Key        string    `json:"key"`
+	Size       int       `json:"size"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// AdminHandler returns an HTTP handler to inspect and purge the cache,
+// answering in JSON:
+//
+//	GET /keys?prefix=/api/products lists the cached responses of a prefix
+//	DELETE /keys?uri=/api/products/42 releases the response to a URI
+//	DELETE /keys?uri=/api/products/42&soft=1 marks it stale instead
+//	DELETE /all releases every cached response
+//	GET /stats reports the number and size of the cached responses
+//
+// Routes are matched on the last element of the path, so the handler can
+// be mounted under any path. Listing keys requires the adapter to
+// implement KeyLister, and reporting stats StatsReporter.
+func (c *Client) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.isAdminAuthorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		switch route := path.Base(r.URL.Path); {
+		case route == "keys" && r.Method == http.MethodGet:
+			c.adminKeys(w, r)
+		case route == "keys" && r.Method == http.MethodDelete:
+			uri := r.URL.Query().Get("uri")
+			if uri == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "uri is required"})
+				return
+			}
+			release := c.Release
+			if r.URL.Query().Get("soft") == "1" {
+				release = c.SoftRelease
+			}
+			n, err := release(uri)
+			writeReleased(w, n, err)
+		case route == "all" && r.Method == http.MethodDelete:
+			n, err := c.ReleaseAll()
+			writeReleased(w, n, err)
+		case route == "stats" && r.Method == http.MethodGet:
+			reporter, ok := c.optional().(StatsReporter)
+			if !ok {
+				writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "the adapter cannot report stats"})
+				return
+			}
+			writeJSON(w, http.StatusOK, reporter.Stats())
+		case route == "keys" || route == "all" || route == "stats":
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		default:
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		}
+	})
+}
+
+// adminKeys lists the cached responses of the requested prefix.
+func (c *Client) adminKeys(w http.ResponseWriter, r *http.Request) {
+	lister, ok := c.optional().(KeyLister)
+	if !ok {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "the adapter cannot list keys"})
+		return
+	}
+	prefix := r.URL.Query().Get("prefix")
+	entries := []adminEntry{}
+	for _, key := range lister.Keys(prefix) {
+		b, ok := c.get(r.Context(), r, c.log, prefix, key)
+		if !ok {
+			continue
+		}
+		entry := adminEntry{Prefix: prefix, Key: key, Size: len(b)}
+		if response, err := c.codec.Unmarshal(b); err == nil {
+			entry.Expiration = response.Expiration
+		}
+		entries = append(entries, entry)
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// isAdminAuthorized reports whether the request carries the admin bearer
+// token, when one is set.
+func (c *Client) isAdminAuthorized(r *http.Request) bool {
+	if c.adminToken == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.adminToken)) == 1
+}
+
+// writeReleased answers with the number of released responses, or with
+// the release error.
+func writeReleased(w http.ResponseWriter, n int, err error) {
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"released": n})
+}
+
+// writeJSON writes the value as a JSON response with the status code.
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
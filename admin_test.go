@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+)
+
+type listerAdapter struct {
+	*adapterMock
+}
+
+func (a listerAdapter) Keys(prefix string) []string {
+	a.Lock()
+	defer a.Unlock()
+	var keys []string
+	for key := range a.store[prefix] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestAdminHandler(t *testing.T) {
+	adapter := listerAdapter{&adapterMock{}}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithAdminToken("token"),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("value"))
+	}))
+	for _, uri := range []string{"http://foo.bar/products?id=1", "http://foo.bar/products?id=2", "http://foo.bar/home"} {
+		r, _ := http.NewRequest("GET", uri, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	admin := http.StripPrefix("/admin", client.AdminHandler())
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		token      string
+		wantStatus int
+		wantKeys   int
+	}{
+		{"rejects missing token", "GET", "/admin/keys?prefix=/products", "", http.StatusUnauthorized, 0},
+		{"rejects wrong token", "GET", "/admin/keys?prefix=/products", "guess", http.StatusUnauthorized, 0},
+		{"lists keys", "GET", "/admin/keys?prefix=/products", "token", http.StatusOK, 2},
+		{"requires uri", "DELETE", "/admin/keys", "token", http.StatusBadRequest, 0},
+		{"releases uri", "DELETE", "/admin/keys?uri=" + url.QueryEscape("http://foo.bar/products?id=1"), "token", http.StatusOK, 0},
+		{"lists remaining keys", "GET", "/admin/keys?prefix=/products", "token", http.StatusOK, 1},
+		{"rejects other methods", "POST", "/admin/all", "token", http.StatusMethodNotAllowed, 0},
+		{"releases all", "DELETE", "/admin/all", "token", http.StatusOK, 0},
+		{"lists no keys", "GET", "/admin/keys?prefix=/home", "token", http.StatusOK, 0},
+		{"rejects unknown routes", "GET", "/admin/unknown", "token", http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(tt.method, tt.url, nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			admin.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("AdminHandler() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.method != "GET" || w.Code != http.StatusOK {
+				return
+			}
+			var entries []adminEntry
+			if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.wantKeys {
+				t.Errorf("AdminHandler() keys = %v, want %v", len(entries), tt.wantKeys)
+			}
+			for _, e := range entries {
+				if e.Size == 0 || e.Expiration.IsZero() {
+					t.Errorf("AdminHandler() entry = %+v, want size and expiration", e)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminHandlerWithoutKeyLister(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+	)
+	r, _ := http.NewRequest("GET", "/keys?prefix=/", nil)
+	w := httptest.NewRecorder()
+	client.AdminHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("AdminHandler() status = %v, want %v", w.Code, http.StatusNotImplemented)
+	}
+}
+
+type statsAdapter struct {
+	*adapterMock
+}
+
+func (a statsAdapter) Stats() AdapterStats {
+	var stats AdapterStats
+	for _, entries := range a.store {
+		for _, b := range entries {
+			stats.Entries++
+			stats.Bytes += int64(len(b))
+		}
+	}
+	return stats
+}
+
+func TestAdminHandlerStats(t *testing.T) {
+	tests := []struct {
+		name       string
+		adapter    Adapter
+		method     string
+		wantStatus int
+	}{
+		{"reports adapter stats", statsAdapter{&adapterMock{store: map[string]map[string][]byte{"/a": {"1": []byte("12"), "2": []byte("345")}}}}, "GET", http.StatusOK},
+		{"rejects other methods", statsAdapter{&adapterMock{}}, "DELETE", http.StatusMethodNotAllowed},
+		{"requires stats reporter", &adapterMock{}, "GET", http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := NewClient(
+				ClientWithAdapter(tt.adapter),
+				ClientWithTTL(1*time.Minute),
+			)
+			r, _ := http.NewRequest(tt.method, "/admin/stats", nil)
+			w := httptest.NewRecorder()
+			client.AdminHandler().ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("AdminHandler() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var stats AdapterStats
+			if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+				t.Fatal(err)
+			}
+			if want := (AdapterStats{Entries: 2, Bytes: 5}); stats != want {
+				t.Errorf("AdminHandler() stats = %+v, want %+v", stats, want)
+			}
+		})
+	}
+}
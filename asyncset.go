@@ -0,0 +1,105 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import "sync/atomic"
+
+const (
+	// asyncSetQueueSize is the number of writes the asynchronous write
+	// queue holds before dropping new ones.
+	asyncSetQueueSize = 1024
+
+	// asyncSetWorkers is the number of goroutines writing to the adapter.
+	asyncSetWorkers = 4
+)
+
+// startAsyncSet starts the workers writing the queued responses to the
+// adapter.
+func (c *Client) startAsyncSet() {
+	c.setQueue = make(chan func(), asyncSetQueueSize)
+	for i := 0; i < asyncSetWorkers; i++ {
+		c.goAsync(c.runSets)
+	}
+}
+
+// runSets runs the queued writes until the client is closed, then drains
+// the queue. Close stops waiting for it at its timeout.
+func (c *Client) runSets() {
+	for {
+		select {
+		case write := <-c.setQueue:
+			c.runSet(write)
+		case <-c.ctx.Done():
+			for {
+				select {
+				case write := <-c.setQueue:
+					c.runSet(write)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// runSet runs a queued write, so that a panicking adapter does not take
+// the worker down.
+func (c *Client) runSet(write func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			c.log.Errorf("asynchronous cache write panicked: %v", err)
+			atomic.AddUint64(&c.stats.errors, 1)
+		}
+	}()
+	write()
+}
+
+// enqueueSet queues a write without blocking. It reports false and
+// counts the write as dropped when the queue is full or the client is
+// closed.
+func (c *Client) enqueueSet(write func()) bool {
+	if c.ctx.Err() == nil {
+		select {
+		case c.setQueue <- write:
+			return true
+		default:
+		}
+	}
+	atomic.AddUint64(&c.stats.droppedWrites, 1)
+	return false
+}
+
+// ClientWithAsyncSet sets whether responses are written to the adapter in
+// the background, so that a slow adapter does not delay the responses to
+// cache misses. Writes are queued for a few workers, and dropped when the
+// queue is full rather than blocking the request; see Stats.DroppedWrites.
+// Close waits for the queue to drain up to its timeout. Default is false.
+// Optional setting.
+func ClientWithAsyncSet(async bool) ClientOption {
+	return func(c *Client) error {
+		c.asyncSet = async
+		return nil
+	}
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type panickingAdapterMock struct {
+	adapterMock
+	once sync.Once
+}
+
+func (a *panickingAdapterMock) Set(prefix, key string, response []byte) {
+	a.once.Do(func() { panic("set failed") })
+	a.adapterMock.Set(prefix, key, response)
+}
+
+func TestMiddlewareAsyncSet(t *testing.T) {
+	adapter := &panickingAdapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithAsyncSet(true),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("value"))
+	}))
+
+	for _, path := range []string{"/panics", "/async"} {
+		r, _ := http.NewRequest("GET", "http://foo.bar"+path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Body.String() != "value" {
+			t.Errorf("*Client.Middleware() body = %v, want value", w.Body.String())
+		}
+	}
+
+	// Close drains the queue
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(adapter.store["/async"]) == 0 {
+		t.Error("*Client.Middleware() did not store the response in the background")
+	}
+	if got := client.Stats().Errors; got != 1 {
+		t.Errorf("*Client.Stats() errors = %v, want the panic counted", got)
+	}
+}
+
+func TestEnqueueSet(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+	)
+	// no worker reads the queue, so it fills up
+	client.setQueue = make(chan func(), 1)
+
+	if !client.enqueueSet(func() {}) {
+		t.Error("*Client.enqueueSet() = false, want the write queued")
+	}
+	if client.enqueueSet(func() {}) {
+		t.Error("*Client.enqueueSet() = true, want the write dropped on a full queue")
+	}
+	<-client.setQueue
+	client.Close()
+	if client.enqueueSet(func() {}) {
+		t.Error("*Client.enqueueSet() = true, want the write dropped once closed")
+	}
+	if got := client.Stats().DroppedWrites; got != 2 {
+		t.Errorf("*Client.Stats() dropped writes = %v, want 2", got)
+	}
+}
@@ -0,0 +1,158 @@
+package cache_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/memory"
+)
+
+// The benchmarks and the stress test only use the public API, through
+// the in-process memory adapter.
+
+var benchmarkSizes = []struct {
+	name string
+	size int
+}{
+	{"1KB", 1 << 10},
+	{"100KB", 100 << 10},
+	{"5MB", 5 << 20},
+}
+
+func newBenchmarkClient(tb testing.TB, body []byte) (*cache.Client, http.Handler) {
+	adapter, err := memory.NewAdapter(memory.AdapterWithCapacity(16))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	client, err := cache.NewClient(
+		cache.ClientWithAdapter(adapter),
+		cache.ClientWithTTL(time.Minute),
+	)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(body)
+	}))
+	return client, handler
+}
+
+func BenchmarkMiddlewareHit(b *testing.B) {
+	for _, s := range benchmarkSizes {
+		b.Run(s.name, func(b *testing.B) {
+			_, handler := newBenchmarkClient(b, bytes.Repeat([]byte("a"), s.size))
+			r := httptest.NewRequest("GET", "http://foo.bar/hit", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			b.SetBytes(int64(s.size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				handler.ServeHTTP(&discardWriter{header: http.Header{}}, r)
+			}
+		})
+	}
+}
+
+func BenchmarkMiddlewareMiss(b *testing.B) {
+	for _, s := range benchmarkSizes {
+		b.Run(s.name, func(b *testing.B) {
+			_, handler := newBenchmarkClient(b, bytes.Repeat([]byte("a"), s.size))
+			requests := make([]*http.Request, b.N)
+			for i := range requests {
+				requests[i] = httptest.NewRequest("GET", fmt.Sprintf("http://foo.bar/miss?n=%d", i), nil)
+			}
+
+			b.SetBytes(int64(s.size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				handler.ServeHTTP(&discardWriter{header: http.Header{}}, requests[i])
+			}
+		})
+	}
+}
+
+func BenchmarkReleasePrefix(b *testing.B) {
+	for _, s := range benchmarkSizes {
+		b.Run(s.name, func(b *testing.B) {
+			client, handler := newBenchmarkClient(b, bytes.Repeat([]byte("a"), s.size))
+			r := httptest.NewRequest("GET", "http://foo.bar/release", nil)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				handler.ServeHTTP(&discardWriter{header: http.Header{}}, r)
+				b.StartTimer()
+				if n, err := client.ReleaseURI("/release"); n != 1 || err != nil {
+					b.Fatalf("ReleaseURI() = %v, %v, want 1, nil", n, err)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the stress test in short mode")
+	}
+	body := bytes.Repeat([]byte("a"), 1<<10)
+	client, handler := newBenchmarkClient(t, body)
+
+	done := make(chan struct{})
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				client.Release("http://foo.bar/stress")
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest("GET", "http://foo.bar/stress", nil))
+				if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), body) {
+					t.Errorf("response = %v, %v bytes, want 200 and the body", w.Code, w.Body.Len())
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-released
+}
+
+// discardWriter is a ResponseWriter dropping what it is given, so that
+// the benchmarks measure the middleware alone.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(int) {}
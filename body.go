@@ -0,0 +1,76 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// defaultBodyLimit is the default size limit of the request bodies read
+// to generate cache keys.
+const defaultBodyLimit = 1 << 20
+
+// readCloser reads from a reader and closes the original request body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// hasBody reports whether the request has a body to key the cached
+// response by.
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody
+}
+
+// readBody reads the request body up to the body limit and restores it,
+// so the handler still sees it. It returns false when the body exceeds
+// the limit or cannot be read.
+func (c *Client) readBody(r *http.Request) ([]byte, bool) {
+	if !hasBody(r) {
+		return nil, true
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, c.bodyLimit+1))
+	if err != nil || int64(len(b)) > c.bodyLimit {
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+		return nil, false
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, true
+}
+
+// isCacheableMethod reports whether responses to requests with the
+// method may be cached. By default, only GET requests are.
+func (c *Client) isCacheableMethod(method string) bool {
+	if method == "" {
+		method = http.MethodGet
+	}
+	if c.cacheableMethods == nil {
+		return method == http.MethodGet
+	}
+	return c.cacheableMethods[method]
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareCacheableMethods(t *testing.T) {
+	calls := 0
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + string(body)))
+	})
+
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithCacheableMethods("GET", "POST"),
+		ClientWithRequestBodyLimit(8),
+		ClientWithCacheStatusHeader("X-Cache"),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	tests := []struct {
+		name      string
+		method    string
+		body      string
+		want      string
+		wantCache string
+		wantCalls int
+	}{
+		{
+			"stores POST response",
+			"POST",
+			"query a",
+			"POST query a",
+			"MISS",
+			1,
+		},
+		{
+			"serves POST response with the same body",
+			"POST",
+			"query a",
+			"POST query a",
+			"HIT",
+			1,
+		},
+		{
+			"keys POST response by body",
+			"POST",
+			"query b",
+			"POST query b",
+			"MISS",
+			2,
+		},
+		{
+			"keeps GET response apart",
+			"GET",
+			"",
+			"GET ",
+			"MISS",
+			3,
+		},
+		{
+			"bypasses body over the limit",
+			"POST",
+			"query over",
+			"POST query over",
+			"BYPASS",
+			4,
+		},
+		{
+			"bypasses body over the limit again",
+			"POST",
+			"query over",
+			"POST query over",
+			"BYPASS",
+			5,
+		},
+		{
+			"bypasses other methods",
+			"PUT",
+			"query a",
+			"PUT query a",
+			"BYPASS",
+			6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(tt.method, "http://foo.bar/graphql", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("*Client.Middleware() = %v, want %v", got, tt.want)
+			}
+			if got := w.Header().Get("X-Cache"); got != tt.wantCache {
+				t.Errorf("*Client.Middleware() X-Cache = %v, want %v", got, tt.wantCache)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("*Client.Middleware() handler calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClientWithCacheableMethods(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     ClientOption
+		wantErr bool
+	}{
+		{"accepts methods", ClientWithCacheableMethods("GET", "POST"), false},
+		{"rejects empty method", ClientWithCacheableMethods("GET", ""), true},
+		{"accepts body limit", ClientWithRequestBodyLimit(1), false},
+		{"rejects invalid body limit", ClientWithRequestBodyLimit(0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(1*time.Minute), tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CircuitState is the state of the circuit breaker around the adapter.
+type CircuitState int
+
+// Circuit breaker states.
+const (
+	// CircuitClosed is the normal state: the adapter is called.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen is the state after too many adapter failures: the
+	// adapter is not called and requests go straight to the handler.
+	CircuitOpen
+
+	// CircuitHalfOpen is the state after the cool-down: a single probe
+	// calls the adapter, whose outcome closes or opens the circuit again.
+	CircuitHalfOpen
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitCollector is implemented by collectors tracking the state of
+// the circuit breaker.
+type CircuitCollector interface {
+	// SetCircuitState records the state the circuit went to.
+	SetCircuitState(state CircuitState)
+}
+
+// breaker stops the calls to a failing adapter. After threshold
+// consecutive failures, none more than cooldown apart, the circuit opens
+// for cooldown; a single call then probes the adapter.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mutex       sync.Mutex
+	state       CircuitState
+	failures    int
+	lastFailure time.Time
+	openedAt    time.Time
+	probing     bool
+}
+
+// allow reports whether the adapter may be called. When it returns true,
+// the outcome of the call must be reported with done.
+func (b *breaker) allow() (ok bool, from, to CircuitState) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	from = b.state
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false, from, b.state
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true, from, b.state
+	case CircuitHalfOpen:
+		if b.probing {
+			return false, from, b.state
+		}
+		b.probing = true
+	}
+	return true, from, b.state
+}
+
+// done records the outcome of an adapter call and returns the state
+// transition it caused, if any.
+func (b *breaker) done(failed bool) (from, to CircuitState) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	from = b.state
+	now := b.now()
+	switch {
+	case b.state == CircuitHalfOpen && failed:
+		b.state = CircuitOpen
+		b.openedAt = now
+		b.probing = false
+	case b.state == CircuitHalfOpen:
+		b.state = CircuitClosed
+		b.failures = 0
+		b.probing = false
+	case b.state == CircuitClosed && failed:
+		if now.Sub(b.lastFailure) > b.cooldown {
+			b.failures = 0
+		}
+		b.failures++
+		b.lastFailure = now
+		if b.failures >= b.threshold {
+			b.state = CircuitOpen
+			b.openedAt = now
+		}
+	case b.state == CircuitClosed:
+		b.failures = 0
+	}
+	return from, b.state
+}
+
+// abort ends an adapter call whose outcome says nothing about the
+// adapter, e.g. a canceled or panicking one, leaving the state as is.
+func (b *breaker) abort() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.probing = false
+}
+
+// callAdapter runs the adapter call unless the circuit breaker is open,
+// reporting whether it ran. The call returns the adapter error, which
+// leaves the circuit as is when the request was canceled.
+func (c *Client) callAdapter(ctx context.Context, r *http.Request, call func() error) bool {
+	if c.breaker == nil {
+		call()
+		return true
+	}
+	ok, from, to := c.breaker.allow()
+	c.circuitChanged(r, from, to)
+	if !ok {
+		atomic.AddUint64(&c.stats.circuitSkips, 1)
+		return false
+	}
+	reported := false
+	defer func() {
+		// a panicking call must not leave the circuit probing forever
+		if !reported {
+			c.breaker.abort()
+		}
+	}()
+	err := call()
+	if err != nil && ctx.Err() != nil {
+		return true
+	}
+	reported = true
+	from, to = c.breaker.done(err != nil)
+	c.circuitChanged(r, from, to)
+	return true
+}
+
+// circuitChanged logs and reports a state transition of the circuit
+// breaker.
+func (c *Client) circuitChanged(r *http.Request, from, to CircuitState) {
+	if from == to {
+		return
+	}
+	if to == CircuitOpen {
+		c.log.Errorf("cache circuit open: adapter calls stopped for %v", c.breaker.cooldown)
+	} else {
+		c.log.Debugf("cache circuit %v", to)
+	}
+	if cc, ok := c.metrics.(CircuitCollector); ok {
+		cc.SetCircuitState(to)
+	}
+	if c.hooks.OnCircuitChange != nil {
+		c.runHook("OnCircuitChange", func() { c.hooks.OnCircuitChange(r, from, to) })
+	}
+}
+
+// CircuitState returns the state of the circuit breaker, always closed
+// when it is not enabled.
+func (c *Client) CircuitState() CircuitState {
+	if c.breaker == nil {
+		return CircuitClosed
+	}
+	c.breaker.mutex.Lock()
+	defer c.breaker.mutex.Unlock()
+	return c.breaker.state
+}
+
+// ClientWithCircuitBreaker stops calling the adapter after threshold
+// consecutive failures, none more than cooldown apart, e.g. so that an
+// unreachable Redis does not add a connect timeout to every request.
+// Requests then go straight to the handler for the cooldown, after which
+// a single request probes the adapter: its success closes the circuit,
+// its failure opens it again. Only adapters implementing CheckedAdapter
+// or ContextAdapter report failures. Optional setting.
+func ClientWithCircuitBreaker(threshold int, cooldown time.Duration) ClientOption {
+	return func(c *Client) error {
+		if threshold < 1 {
+			return errors.New("cache client circuit breaker threshold must be positive")
+		}
+		if cooldown <= 0 {
+			return errors.New("cache client circuit breaker cooldown must be positive")
+		}
+		c.breaker = &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+		return nil
+	}
+}
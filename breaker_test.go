@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := &breaker{threshold: 2, cooldown: time.Minute, now: func() time.Time { return now }}
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		call    bool // ask to call the adapter, else report an outcome
+		failed  bool
+		wantOK  bool
+		want    CircuitState
+	}{
+		{"closed allows", 0, true, false, true, CircuitClosed},
+		{"first failure", 0, false, true, false, CircuitClosed},
+		{"failure outside the window", 2 * time.Minute, false, true, false, CircuitClosed},
+		{"second failure opens", time.Second, false, true, false, CircuitOpen},
+		{"open denies", 30 * time.Second, true, false, false, CircuitOpen},
+		{"half-open after the cooldown", 30 * time.Second, true, false, true, CircuitHalfOpen},
+		{"a single probe", 0, true, false, false, CircuitHalfOpen},
+		{"failed probe opens", 0, false, true, false, CircuitOpen},
+		{"probe again", time.Minute, true, false, true, CircuitHalfOpen},
+		{"successful probe closes", 0, false, false, false, CircuitClosed},
+		{"success resets the failures", 0, false, true, false, CircuitClosed},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		var got CircuitState
+		if step.call {
+			var ok bool
+			ok, _, got = b.allow()
+			if ok != step.wantOK {
+				t.Errorf("%v: breaker.allow() = %v, want %v", step.name, ok, step.wantOK)
+			}
+		} else {
+			_, got = b.done(step.failed)
+		}
+		if got != step.want {
+			t.Errorf("%v: breaker state = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestCallAdapterAbort(t *testing.T) {
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"canceled call", func() error { return context.Canceled }},
+		{"panicking call", func() error { panic("adapter failure") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(time.Minute),
+				ClientWithCircuitBreaker(1, time.Minute),
+			)
+			client.breaker.state = CircuitHalfOpen
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			func() {
+				defer func() { recover() }()
+				client.callAdapter(ctx, nil, tt.call)
+			}()
+
+			if got := client.CircuitState(); got != CircuitHalfOpen {
+				t.Errorf("*Client.CircuitState() = %v, want %v", got, CircuitHalfOpen)
+			}
+			if ok, _, _ := client.breaker.allow(); !ok {
+				t.Errorf("breaker.allow() = %v, want %v", ok, true)
+			}
+		})
+	}
+}
+
+type countingCheckedAdapter struct {
+	checkedAdapterMock
+	calls int
+}
+
+func (a *countingCheckedAdapter) GetChecked(prefix, key string) ([]byte, bool, error) {
+	a.calls++
+	return a.checkedAdapterMock.GetChecked(prefix, key)
+}
+
+func (a *countingCheckedAdapter) SetChecked(prefix, key string, response []byte, ttl time.Duration) error {
+	a.calls++
+	return a.checkedAdapterMock.SetChecked(prefix, key, response, ttl)
+}
+
+func TestMiddlewareCircuitBreaker(t *testing.T) {
+	adapter := &countingCheckedAdapter{checkedAdapterMock: checkedAdapterMock{err: errors.New("connection refused")}}
+	var transitions []string
+	client, err := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(time.Minute),
+		ClientWithCircuitBreaker(2, time.Minute),
+		ClientWithHooks(Hooks{OnCircuitChange: func(r *http.Request, from, to CircuitState) {
+			transitions = append(transitions, from.String()+" -> "+to.String())
+		}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+	calls := 0
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("value"))
+	}))
+	serve := func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "http://foo.bar/circuit", nil))
+		if w.Body.String() != "value" {
+			t.Errorf("response body = %q, want value", w.Body.String())
+		}
+	}
+
+	// the failed get and set open the circuit
+	serve()
+	if got := client.CircuitState(); got != CircuitOpen {
+		t.Fatalf("CircuitState() = %v, want open", got)
+	}
+	adapter.calls = 0
+	serve()
+	if adapter.calls != 0 {
+		t.Errorf("adapter calls with the circuit open = %v, want 0", adapter.calls)
+	}
+	if got := client.Stats().CircuitSkips; got != 2 {
+		t.Errorf("Stats().CircuitSkips = %v, want 2", got)
+	}
+
+	// the adapter is back: the probe closes the circuit
+	adapter.err = nil
+	now = now.Add(time.Minute)
+	serve()
+	serve()
+	if got := client.CircuitState(); got != CircuitClosed {
+		t.Errorf("CircuitState() = %v, want closed", got)
+	}
+	if calls != 3 {
+		t.Errorf("handler calls = %v, want 3", calls)
+	}
+	want := []string{"closed -> open", "open -> half-open", "half-open -> closed"}
+	if !reflect.DeepEqual(transitions, want) {
+		t.Errorf("OnCircuitChange transitions = %v, want %v", transitions, want)
+	}
+}
+
+func TestClientWithCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		cooldown  time.Duration
+		wantErr   bool
+	}{
+		{"valid", 5, time.Second, false},
+		{"zero threshold", 0, time.Second, true},
+		{"zero cooldown", 5, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(time.Minute),
+				ClientWithCircuitBreaker(tt.threshold, tt.cooldown),
+			)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ClientWithCircuitBreaker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
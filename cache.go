@@ -25,20 +25,24 @@ SOFTWARE.
 package cache
 
 import (
-	"bytes"
+	"context"
+	"crypto/subtle"
 	"encoding/gob"
 	"errors"
 	"fmt"
 	"hash/fnv"
 	"net/http"
-	"net/http/httptest"
 	"net/url"
-	"sort"
+	"path"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/sync/singleflight"
 )
 
 // Response is the cached response data structure.
@@ -49,6 +53,10 @@ type Response struct {
 	// Header is the cached response header.
 	Header http.Header
 
+	// StatusCode is the cached response status code. Entries stored
+	// before it was introduced decode as zero and are served as 200.
+	StatusCode int
+
 	// Expiration is the cached response expiration date.
 	Expiration time.Time
 
@@ -60,20 +68,125 @@ type Response struct {
 	// Used for LFU and MFU algorithms.
 	Frequency int
 
+	// Vary lists the request headers the response varies on. An entry
+	// with Vary set holds no response itself: it points to the variants
+	// stored under keys derived from the request values of those headers.
+	Vary []string
+
+	// CachedAt is the date the response was stored. Used to compute
+	// the Age header.
 	CachedAt time.Time
+
+	// Compression is the algorithm Value is compressed with. Entries
+	// stored before it was introduced decode as NoCompression.
+	Compression Compression
 }
 
+// Values of the cache status header.
+const (
+	cacheStatusHit    = "HIT"
+	cacheStatusMiss   = "MISS"
+	cacheStatusBypass = "BYPASS"
+	cacheStatusStale  = "STALE"
+)
+
 // Client data structure for HTTP cache middleware.
 type Client struct {
 	adapter    Adapter
 	ttl        time.Duration
 	refreshKey string
-	log        *log.Logger
+	log        Logger
+
+	refreshSecret       string
+	refreshResponseMode RefreshResponseMode
+
+	sharedCache       bool
+	identityFunc      func(r *http.Request) string
+	respectMaxAge     bool
+	respectDirectives bool
+	ttlJitter         float64
+	rangeSupport      bool
+	version           atomic.Value
+	cacheStatusHeader string
+	ttlHeader         string
+	keyHeader         string
+	ignoredHeaders    map[string]bool
+	cacheSetCookie    bool
+	headerPrecedence  HeaderPrecedence
+	cacheAuthorized   bool
+	cookiePolicy      CookiePolicy
+	flight            *singleflight.Group
+	accessTracking    bool
+	keyGenerator      KeyGenerator
+	prefixFunc        func(r *http.Request) string
+	ignoredParams     []string
+	hostInKey         bool
+	lowercaseHost     bool
+	pathNormalization PathNormalization
+	hashFunc          HashFunc
+	ttlFunc           func(r *http.Request) time.Duration
+	skipFunc          func(r *http.Request) bool
+	metrics           Collector
+	stats             *stats
+	debugOutput       bool
+	headAsGet         bool
+	cacheableMethods  map[string]bool
+	bodyLimit         int64
+	maxBodySize       int64
+
+	staleWhileRevalidate time.Duration
+	revalidating         map[string]bool
+	revalidateMutex      sync.Mutex
+	earlyRefresh         float64
+	earlyRefreshes       map[string]time.Time
+	staleIfError         time.Duration
+
+	fetchLimit       *semaphore.Weighted
+	prefixFetchLimit int
+	prefixFetches    map[string]*prefixSemaphore
+	fetchMutex       sync.Mutex
+	shedStatus       int
+
+	invalidateOnWrite  bool
+	invalidatePrefixes func(r *http.Request) []string
+	tagHeader          string
+	adminToken         string
+	purgeMethod        bool
+	purgeAuthorizer    func(r *http.Request) bool
+	skipCacheOnCancel  bool
+	strippedHeaders    []string
+	cachedHeaders      map[string]bool
+	breaker            *breaker
+	hooks              Hooks
+	tracer             Tracer
+	asyncSet           bool
+	codec              Codec
+	compression        Compression
+	compressionMinSize int
+	setQueue           chan func()
+
+	cacheableStatusCodes map[int]bool
+	statusCodeTTLs       map[int]time.Duration
+	negativeStatusCodes  map[int]bool
+
+	janitorInterval time.Duration
+
+	ctx          context.Context
+	cancel       context.CancelFunc
+	closeTimeout time.Duration
+	asyncMutex   sync.Mutex
+	workers      sync.WaitGroup
+	closeOnce    sync.Once
+	closeErr     error
 }
 
 // ClientOption is used to set Client settings.
 type ClientOption func(c *Client) error
 
+// KeyGenerator returns the prefix and key a response to the request is
+// cached by.
+type KeyGenerator func(r *http.Request) (prefix, key string)
+
 // Adapter interface for HTTP cache middleware client.
 type Adapter interface {
 	// Get retrieves the cached response by a given key. It also
@@ -84,164 +197,932 @@ type Adapter interface {
 
 	Set(prefix, key string, response []byte)
 
-	// Release frees cache for a given key.
-	Release(prefix, key string)
+	// Release frees cache for a given key. It returns the number of
+	// released responses, or ReleasedUnknown when it cannot tell, as
+	// the release methods below do.
+	Release(prefix, key string) (int, error)
+
+	// ReleasePrefix frees the cached responses of a given prefix.
+	ReleasePrefix(prefix string) (int, error)
+
+	// ReleaseIfStartsWith frees the cached responses of the prefixes
+	// starting with a given string.
+	ReleaseIfStartsWith(key string) (int, error)
+}
 
-	ReleasePrefix(prefix string)
-	ReleaseIfStartsWith(key string)
+// TTLSetter is implemented by adapters able to expire cached responses
+// natively. The client prefers it over the Adapter Set method.
+type TTLSetter interface {
+	// SetWithTTL caches the response by a given key for the given
+	// duration.
+	SetWithTTL(prefix, key string, response []byte, ttl time.Duration)
+}
+
+// Flusher is implemented by adapters able to release every cached
+// response at once. When the adapter does not implement it, the client
+// releases them through ReleaseIfStartsWith.
+type Flusher interface {
+	// Flush frees the whole cache and returns the number of released
+	// responses.
+	Flush() (int, error)
+}
+
+// Toucher is implemented by adapters able to record an access to a cached
+// response without rewriting the whole entry. When the adapter does not
+// implement it, accesses are not tracked: the entries keep the last access
+// date and frequency they were stored with.
+type Toucher interface {
+	// Touch updates the last access date and frequency of the cached
+	// response by a given key.
+	Touch(prefix, key string)
 }
 
 // Middleware is the HTTP cache middleware handler.
 func (c *Client) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" || r.Method == "" {
+		atomic.AddUint64(&c.stats.requests, 1)
+		if r.Method == methodPurge && c.purgeMethod {
+			c.servePurge(w, r)
+			return
+		}
+		if r.Method == http.MethodHead && c.isCacheable(r) {
+			c.serveHead(next, w, r)
+			return
+		}
+		if c.isCacheableMethod(r.Method) && c.isCacheable(r) {
+			start := time.Now()
+			values, refresh := c.stripRefreshKey(r)
 			prefix, key := c.GeneratePrefixAndKey(r)
-			ctxlog := c.log.WithFields(log.Fields{"prefix": prefix, "key": key})
-			params := r.URL.Query()
-			if _, ok := params[c.refreshKey]; ok {
-				ctxlog.Debug("refresh key found, releasing")
-				delete(params, c.refreshKey)
-
-				r.URL.RawQuery = params.Encode()
-				key = generateKey(r.URL.String())
-
-				c.adapter.Release(prefix, key)
+			ctxlog := c.requestLog(prefix, key)
+			c.setKeyHeader(w, key)
+			status := cacheStatusMiss
+			timing := Timing{Prefix: prefix, Key: key, Status: status}
+			defer c.finishTiming(r, &timing, start)
+			var fallback *Response
+			if refresh && c.isRefreshAuthorized(values) {
+				ctxlog.Debugf("refresh key found, releasing")
+				atomic.AddUint64(&c.stats.refreshes, 1)
+				n, _ := c.release(r.Context(), prefix, key)
+				if c.refreshResponseMode == ServeStatus {
+					c.serveRefreshStatus(next, w, r, ctxlog, prefix, key, n > 0, &timing)
+					return
+				}
+				status = cacheStatusBypass
 			} else {
-				b, ok := c.adapter.Get(prefix, key)
-				response := BytesToResponse(b)
-				if ok {
-					if response.Expiration.After(time.Now()) {
-						ctxlog.Debug("serving from cache")
-						response.LastAccess = time.Now()
-						response.Frequency++
-						c.adapter.Set(prefix, key, response.Bytes())
-
-						//w.WriteHeader(http.StatusNotModified)
-						for k, v := range response.Header {
-							w.Header().Set(k, strings.Join(v, ","))
-						}
-						w.Header().Set("X-Cached-At", response.CachedAt.Format(time.RFC822Z))
-						w.Write(response.Value)
+				if refresh {
+					ctxlog.Debugf("refresh key value is not authorized, ignoring")
+				}
+				cc := c.requestDirectives(r)
+				switch {
+				case cc.has("no-store"):
+					ctxlog.Debugf("the request forbids storing, bypassing cache")
+					c.setCacheStatus(w, cacheStatusBypass)
+					c.countStatus(prefix, cacheStatusBypass)
+					timing.Status = cacheStatusBypass
+					c.passThrough(next, w, r, prefix, &timing)
+					return
+				case cc.has("no-cache"):
+					ctxlog.Debugf("the request forbids cached responses, taking it from DB")
+					status = cacheStatusBypass
+				default:
+					var served bool
+					if served, fallback = c.serveFromCache(next, w, r, ctxlog, prefix, key, &timing); served {
+						return
+					}
+					if cc.has("only-if-cached") {
+						ctxlog.Debugf("requested object is not in cache - answering only-if-cached request")
+						c.setCacheStatus(w, cacheStatusMiss)
+						w.WriteHeader(http.StatusGatewayTimeout)
 						return
 					}
-					ctxlog.Debug("requested object is in cache, but expried - releasing")
-					c.adapter.Release(prefix, key)
 				}
 			}
-			ctxlog.Debug("requested object is not in cache or expired - taking it from DB")
-			response, value := c.PutItemToCache(next, r, prefix, key)
-			for k, v := range response.Header {
-				w.Header().Set(k, strings.Join(v, ","))
+			ctxlog.Debugf("requested object is not in cache or expired - taking it from DB")
+			if fallback != nil {
+				c.fetchWithFallback(next, w, r, ctxlog, prefix, key, *fallback, &timing)
+				return
+			}
+			if status == cacheStatusMiss {
+				atomic.AddUint64(&c.stats.misses, 1)
+				c.hookMiss(r)
 			}
 			w.Header().Set("X-Cached-At", time.Now().Format(time.RFC822Z))
-			w.WriteHeader(response.StatusCode)
-			w.Write(value)
+			c.setCacheStatus(w, status)
+			c.countStatus(prefix, status)
+			timing.Status = status
+			if isRanged(r) {
+				c.fetchRange(next, w, r, ctxlog, prefix, key, &timing)
+				return
+			}
+			response, value, written := c.fetch(next, w, r, prefix, key, &timing)
+			if !written && !canceled(ctxlog, r) {
+				c.writeHeader(w.Header(), response.Header)
+				w.WriteHeader(response.StatusCode)
+				w.Write(value)
+			}
 			return
 		}
-		next.ServeHTTP(w, r)
+		c.setCacheStatus(w, cacheStatusBypass)
+		c.countStatus(r.URL.Path, cacheStatusBypass)
+		statusCode := c.passThrough(next, w, r, r.URL.Path, nil)
+		if c.invalidateOnWrite && isWriteMethod(r.Method) && statusCode >= 200 && statusCode <= 299 {
+			c.invalidate(r)
+		}
 	})
 }
 
-// GeneratePrefixAndKey ...
+// serveHead answers a HEAD request from the response cached for the same
+// GET request. On a miss, the request goes to the handler, either as is
+// or as a GET request populating the cache when enabled.
+func (c *Client) serveHead(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	prefix, key := c.GeneratePrefixAndKey(r)
+	ctxlog := c.requestLog(prefix, key)
+	c.setKeyHeader(w, key)
+	timing := Timing{Prefix: prefix, Key: key, Status: cacheStatusMiss}
+	defer c.finishTiming(r, &timing, start)
+	if served, _ := c.serveFromCache(next, w, r, ctxlog, prefix, key, &timing); served {
+		return
+	}
+
+	atomic.AddUint64(&c.stats.misses, 1)
+	c.hookMiss(r)
+	c.setCacheStatus(w, cacheStatusMiss)
+	c.countStatus(prefix, cacheStatusMiss)
+	if !c.headAsGet {
+		ctxlog.Debugf("requested object is not in cache - passing the HEAD request through")
+		c.passThrough(next, w, r, prefix, &timing)
+		return
+	}
+
+	ctxlog.Debugf("requested object is not in cache - taking it from DB as a GET request")
+	get := r.WithContext(r.Context())
+	get.Method = http.MethodGet
+	response, value, _ := c.fetch(next, nil, get, prefix, key, &timing)
+	c.writeHeader(w.Header(), response.Header)
+	w.Header().Set("X-Cached-At", time.Now().Format(time.RFC822Z))
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	w.WriteHeader(response.StatusCode)
+}
+
+// serveFromCache serves the cached response to the request when it is
+// fresh, or stale within the stale-while-revalidate window, in which case
+// it is refreshed in the background. It reports whether it served the
+// response. Otherwise, a response stale within the stale-if-error window
+// is returned as a fallback, and older responses are released.
+func (c *Client) serveFromCache(next http.Handler, w http.ResponseWriter, r *http.Request, ctxlog Logger, prefix, key string, t *Timing) (bool, *Response) {
+	response, entryKey, ok := c.lookupResponse(ctxlog, r, prefix, key, t)
+	if !ok {
+		return false, nil
+	}
+	if maxAge, ok := c.requestDirectives(r).maxAge(); ok && time.Since(response.CachedAt) > maxAge {
+		ctxlog.Debugf("requested object is older than the request max-age - taking it from DB")
+		return false, nil
+	}
+	now := time.Now()
+	if response.Expiration.After(now) {
+		ctxlog.Debugf("serving from cache")
+		c.trackAccess(prefix, entryKey)
+		c.refreshEarly(ctxlog, next, r, prefix, key, response, now)
+		t.Status = cacheStatusHit
+		c.serveHit(w, r, ctxlog, prefix, entryKey, response, cacheStatusHit)
+		return true, nil
+	}
+	if !refreshesInBackground(r.Context()) && response.Expiration.Add(c.staleRetention()).After(now) {
+		ctxlog.Debugf("requested object is stale - keeping it in case of error")
+		return false, &response
+	}
+	if response.Expiration.Add(c.staleWhileRevalidate).After(now) {
+		ctxlog.Debugf("requested object is stale - serving it while revalidating")
+		c.revalidate(ctxlog, next, r, prefix, key)
+		w.Header().Set("Warning", staleWarning)
+		t.Status = cacheStatusStale
+		c.serveHit(w, r, ctxlog, prefix, entryKey, response, cacheStatusStale)
+		return true, nil
+	}
+	if response.Expiration.Add(c.staleIfError).After(now) {
+		ctxlog.Debugf("requested object is stale - keeping it in case of error")
+		return false, &response
+	}
+	ctxlog.Debugf("requested object is in cache, but expried - releasing")
+	c.release(r.Context(), prefix, entryKey)
+	return false, nil
+}
+
+// lookupResponse returns the cached response to the request, fresh or
+// not, along with the key it is stored by.
+func (c *Client) lookupResponse(ctxlog Logger, r *http.Request, prefix, key string, t *Timing) (Response, string, bool) {
+	entryKey := key
+	response, ok := c.getResponse(r.Context(), r, ctxlog, prefix, entryKey, t)
+	if ok && len(response.Vary) > 0 {
+		entryKey = c.variantKey(key, response.Vary, r)
+		response, ok = c.getResponse(r.Context(), r, ctxlog, prefix, entryKey, t)
+	}
+	if !ok {
+		return Response{}, "", false
+	}
+	if isPartial(response.statusCode(), response.Header) {
+		// stored by a former version, or by an adapter written to directly
+		ctxlog.Debugf("the cached response is partial, ignoring it")
+		return Response{}, "", false
+	}
+	return response, entryKey, true
+}
+
+// serveHit writes the cached response, leaving out the body for HEAD
+// requests.
+func (c *Client) serveHit(w http.ResponseWriter, r *http.Request, ctxlog Logger, prefix, key string, response Response, status string) {
+	if !response.CachedAt.IsZero() {
+		w.Header().Set("Age", strconv.FormatInt(response.age(), 10))
+	}
+	c.setCacheStatus(w, status)
+	c.countStatus(prefix, status)
+	if c.ttlHeader != "" {
+		setTTLHeader(w.Header(), c.ttlHeader, time.Until(response.Expiration))
+	}
+	atomic.AddUint64(&c.stats.hits, 1)
+	c.hookHit(r, prefix, key, response)
+	if notModified(r, response) {
+		ctxlog.Debugf("client copy is up to date")
+		c.writeValidators(w.Header(), response.Header)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	c.stripHeaders(response.Header)
+	c.writeHeader(w.Header(), response.Header)
+	w.Header().Set("X-Cached-At", response.CachedAt.Format(time.RFC822Z))
+	// the stored length may predate a transformation of the body, and
+	// without one the body would be chunked
+	if statusCode := response.statusCode(); statusCode >= 200 && statusCode != http.StatusNoContent && statusCode != http.StatusNotModified {
+		w.Header().Set("Content-Length", strconv.Itoa(len(response.Value)))
+	} else {
+		w.Header().Del("Content-Length")
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(response.statusCode())
+		return
+	}
+	if isRanged(r) && response.statusCode() == http.StatusOK {
+		serveRange(w, r, response.Value)
+		atomic.AddUint64(&c.stats.bytesServed, uint64(len(response.Value)))
+		return
+	}
+	w.WriteHeader(response.statusCode())
+	w.Write(response.Value)
+	atomic.AddUint64(&c.stats.bytesServed, uint64(len(response.Value)))
+}
+
+// stripRefreshKey removes the refresh key from the request query, so that
+// neither the cache key nor the handler see it, and returns its values.
+func (c *Client) stripRefreshKey(r *http.Request) ([]string, bool) {
+	if c.refreshKey == "" {
+		return nil, false
+	}
+	params := r.URL.Query()
+	values, ok := params[c.refreshKey]
+	if !ok {
+		return nil, false
+	}
+	delete(params, c.refreshKey)
+	r.URL.RawQuery = params.Encode()
+	return values, true
+}
+
+// isRefreshAuthorized reports whether the refresh key values allow to
+// free the cached response, which is always the case unless a secret
+// value is set.
+func (c *Client) isRefreshAuthorized(values []string) bool {
+	if c.refreshSecret == "" {
+		return true
+	}
+	for _, v := range values {
+		if subtle.ConstantTimeCompare([]byte(v), []byte(c.refreshSecret)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// setCacheStatus writes the cache status header when it is enabled.
+func (c *Client) setCacheStatus(w http.ResponseWriter, status string) {
+	c.setCacheStatusHeader(w.Header(), status)
+}
+
+// setCacheStatusHeader sets the cache status header when it is enabled.
+func (c *Client) setCacheStatusHeader(header http.Header, status string) {
+	if c.cacheStatusHeader != "" {
+		header.Set(c.cacheStatusHeader, status)
+	}
+}
+
+// getResponse retrieves and decodes the cached response, releasing
+// entries that cannot be decoded.
+func (c *Client) getResponse(ctx context.Context, r *http.Request, ctxlog Logger, prefix, key string, t *Timing) (Response, bool) {
+	ctx, span := c.startSpan(ctx, "cache.get", prefix, key)
+	defer span.end()
+	start := time.Now()
+	b, ok := c.get(ctx, r, ctxlog, prefix, key)
+	c.observe(t, prefix, opGet, start)
+	span.setHit(ok)
+	if !ok {
+		return Response{}, false
+	}
+	span.setSize(len(b))
+	start = time.Now()
+	response, err := c.codec.Unmarshal(b)
+	if err == nil {
+		response, err = decompressResponse(response)
+	}
+	c.observe(t, prefix, opDecode, start)
+	if err != nil {
+		ctxlog.Debugf("cached response is corrupt - releasing: %v", err)
+		atomic.AddUint64(&c.stats.errors, 1)
+		c.hookError(r, err)
+		span.recordError(err)
+		c.release(ctx, prefix, key)
+		return Response{}, false
+	}
+	if c.maxBodySize > 0 && int64(len(response.Value)) > c.maxBodySize {
+		ctxlog.Errorf("cached response body exceeds the max size (%d bytes)", len(response.Value))
+		atomic.AddUint64(&c.stats.errors, 1)
+	}
+	return response, true
+}
+
+// setResponse encodes and stores the response.
+func (c *Client) setResponse(ctx context.Context, r *http.Request, ctxlog Logger, prefix, key string, response Response, t *Timing) {
+	ctx, span := c.startSpan(ctx, "cache.set", prefix, key)
+	defer span.end()
+	start := time.Now()
+	response, err := c.compressResponse(response)
+	if err != nil {
+		ctxlog.Errorf("failed to compress response: %v", err)
+		atomic.AddUint64(&c.stats.errors, 1)
+		c.hookError(r, err)
+		span.recordError(err)
+		return
+	}
+	b, err := c.codec.Marshal(response)
+	c.observe(t, prefix, opEncode, start)
+	if err != nil {
+		ctxlog.Errorf("failed to encode response: %v", err)
+		atomic.AddUint64(&c.stats.errors, 1)
+		c.hookError(r, err)
+		span.recordError(err)
+		return
+	}
+	span.setSize(len(b))
+	var ttl time.Duration
+	if c.expiresNatively() {
+		ttl = time.Until(response.Expiration) + c.staleRetention()
+		if ttl <= 0 {
+			return
+		}
+	}
+	start = time.Now()
+	c.set(ctx, r, ctxlog, prefix, key, b, ttl)
+	c.observe(t, prefix, opSet, start)
+}
+
+// trackAccess records the access to a cached response in the background,
+// so the hit never waits for the adapter. The entry is never rewritten,
+// which would bring it back if it were released in the meantime.
+func (c *Client) trackAccess(prefix, key string) {
+	if !c.accessTracking {
+		return
+	}
+	if t, ok := c.optional().(Toucher); ok {
+		c.goAsync(func() { t.Touch(prefix, key) })
+	}
+}
+
+// isCacheable reports whether the request may be served from and stored
+// in the cache.
+func (c *Client) isCacheable(r *http.Request) bool {
+	if Bypassed(r.Context()) {
+		c.log.Debugf("the request context bypasses cache (resource=%q)", r.URL.String())
+		return false
+	}
+	if c.skipFunc != nil && c.skipFunc(r) {
+		c.log.Debugf("skip function matched, bypassing cache (resource=%q)", r.URL.String())
+		return false
+	}
+	if r.Header.Get("Authorization") != "" && !c.cacheAuthorized {
+		c.log.Debugf("request is authorized, bypassing cache (resource=%q)", r.URL.String())
+		return false
+	}
+	if c.cookiePolicy.bypasses(r) {
+		c.log.Debugf("request carries cookies, bypassing cache (resource=%q)", r.URL.String())
+		return false
+	}
+	if isRanged(r) && !c.rangeSupport {
+		c.log.Debugf("request asks for a range, bypassing cache (resource=%q)", r.URL.String())
+		return false
+	}
+	if _, ok := c.readBody(r); !ok {
+		c.log.Debugf("request body exceeds the limit, bypassing cache (resource=%q)", r.URL.String())
+		return false
+	}
+	return true
+}
+
+// GeneratePrefixAndKey returns the prefix and key the response to the
+// request is cached by, using the client key generator when set.
 func (c *Client) GeneratePrefixAndKey(r *http.Request) (prefix, key string) {
-	sortURLParams(r.URL)
-	prefix = r.URL.Path
-	key = generateKey(r.URL.String())
+	id := c.identity(r)
+	if c.keyGenerator != nil {
+		prefix, key = c.keyGenerator(r)
+		if id != "" {
+			prefix = c.identityPrefix(id) + prefix
+		}
+		if cookies := c.cookieKey(r); cookies != "" {
+			key = c.hash(key + cookies)
+		}
+		return prefix, c.versionKey(key)
+	}
+	u := c.keyURL(r.URL, requestHost(r))
+	prefix = c.routePrefix(r, u.Path)
+	uri := u.String()
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		// keep responses to different principals apart
+		uri += "\n" + auth
+	}
+	// keep responses to different sessions apart
+	uri += c.cookieKey(r)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != "" {
+		// keep responses to other methods and request bodies apart
+		uri += "\n" + r.Method
+		if body, ok := c.readBody(r); ok && len(body) > 0 {
+			uri += "\n" + c.hash(string(body))
+		}
+	}
+	if id != "" {
+		// keep responses to different users apart
+		prefix = c.identityPrefix(id) + prefix
+		uri += "\nuser " + id
+	}
+	key = c.versionKey(c.hash(uri))
 	return
 }
 
-// PutItemToCache ...
+// requestPrefix returns the prefix the response to the request is cached
+// by, as GeneratePrefixAndKey generates it, e.g. to release the responses
+// of the resource a write request modified.
+func (c *Client) requestPrefix(r *http.Request) string {
+	var prefix string
+	if c.keyGenerator != nil {
+		prefix, _ = c.keyGenerator(r)
+	} else {
+		prefix = c.routePrefix(r, c.keyURL(r.URL, requestHost(r)).Path)
+	}
+	if id := c.identity(r); id != "" {
+		prefix = c.identityPrefix(id) + prefix
+	}
+	return prefix
+}
+
+// routePrefix returns the prefix set on the request context, else the one
+// returned by the prefix function, else the normalized request path.
+func (c *Client) routePrefix(r *http.Request, path string) string {
+	if p, _ := r.Context().Value(prefixKey{}).(string); p != "" {
+		return p
+	}
+	if c.prefixFunc != nil {
+		if p := c.prefixFunc(r); p != "" {
+			return p
+		}
+	}
+	return path
+}
+
+// requestHost returns the host the request is made to.
+func requestHost(r *http.Request) string {
+	if r.Host != "" {
+		return r.Host
+	}
+	return r.URL.Host
+}
+
+// keyURL returns a canonical copy of the URL, with a normalized path and
+// sorted query parameters, without the ignored ones and the fragment, as
+// used to generate keys, so that equivalent URLs share their responses.
+// When the host is part of the key, the scheme is dropped and the given
+// host is used.
+func (c *Client) keyURL(u *url.URL, host string) *url.URL {
+	keyURL := *u
+	if c.hostInKey {
+		keyURL.Scheme = ""
+		keyURL.Host = host
+	}
+	if c.lowercaseHost {
+		keyURL.Host = strings.ToLower(keyURL.Host)
+	}
+	canonicalizePath(&keyURL)
+	c.pathNormalization.normalizePath(&keyURL)
+	keyURL.RawQuery = canonicalQuery(keyURL.RawQuery, c.isIgnoredParam)
+	keyURL.ForceQuery = false
+	keyURL.Fragment = ""
+	return &keyURL
+}
+
+// isIgnoredParam reports whether the query parameter matches one of the
+// ignored parameter patterns.
+func (c *Client) isIgnoredParam(name string) bool {
+	for _, pattern := range c.ignoredParams {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PutItemToCache calls the handler and caches its response by the given
+// prefix and key when it is cacheable, returning the response.
 func (c *Client) PutItemToCache(next http.Handler, r *http.Request, prefix, key string) (result *http.Response, value []byte) {
-	ctxlog := c.log.WithFields(log.Fields{"prefix": prefix, "key": key, "resource": r.URL.String()})
-	ctxlog.Trace("calling http recorder")
-	rec := httptest.NewRecorder()
-	next.ServeHTTP(rec, r)
-	result = rec.Result()
+	result, value, _ = c.put(next, nil, r, prefix, key, nil)
+	return result, value
+}
+
+// put calls the handler, writing its response through to w when it is
+// not nil, and caches the response when it is cacheable, reporting
+// whether it did. The response is nil when the handler hijacked the
+// connection or the body written to w exceeded the max body size, as it
+// was not kept. The handler gets the request without its conditional
+// headers, so that it answers in full rather than with a 304; a
+// conditional request is then answered once the response is complete.
+// With a ttl header, the response is not written through either, as the
+// header is only known once the response is stored.
+func (c *Client) put(next http.Handler, w http.ResponseWriter, r *http.Request, prefix, key string, t *Timing) (result *http.Response, value []byte, stored bool) {
+	ctxlog := c.requestLog(prefix, key)
+	release, ok := c.acquireFetch(r.Context(), prefix)
+	if !ok {
+		result = c.shed(ctxlog, prefix)
+		if w != nil {
+			copyHeader(w.Header(), result.Header)
+			w.WriteHeader(result.StatusCode)
+		}
+		return result, nil, false
+	}
+	defer release()
+	var buffered http.ResponseWriter
+	if stripped := withoutConditionals(r); stripped != r || (w != nil && c.ttlHeader != "") {
+		if w != nil {
+			origin := r
+			defer func() {
+				if result != nil {
+					c.replyConditional(buffered, origin, result, value)
+				}
+			}()
+		}
+		buffered, w, r = w, nil, stripped
+	}
+	ctxlog.Debugf("calling handler for %v", r.URL)
+	capture, cw := newResponseCapture(w)
+	capture.hidden = c.tagHeader
+	capture.writeField = c.writeField
+	if w != nil {
+		capture.body.limit = c.maxBodySize
+	}
+	defer func() {
+		// the partial response is dropped and the panic left to the
+		// outer recovery middlewares
+		if p := recover(); p != nil {
+			if p != http.ErrAbortHandler {
+				ctxlog.Errorf("the handler panicked, skipping cache: %v", p)
+			}
+			c.metrics.IncStoreSkip(prefix)
+			panic(p)
+		}
+	}()
+	c.serveOrigin(next, cw, r, prefix, key, t)
+	if capture.hijacked {
+		ctxlog.Debugf("the connection was hijacked, skipping cache")
+		c.metrics.IncStoreSkip(prefix)
+		return nil, nil, false
+	}
+	if capture.body.overflow {
+		ctxlog.Debugf("the response body exceeds the max size, skipping cache")
+		c.metrics.IncStoreSkip(prefix)
+		return nil, nil, false
+	}
+	result = capture.result()
+	value = capture.body.Bytes()
+	ttl := c.store(ctxlog, r, prefix, key, result, value, t)
+	if ttl <= 0 {
+		return result, value, false
+	}
+	if c.ttlHeader != "" {
+		// the cached header is left as is
+		header := make(http.Header, len(result.Header)+1)
+		copyHeader(header, result.Header)
+		setTTLHeader(header, c.ttlHeader, ttl)
+		result.Header = header
+	}
+	return result, value, true
+}
+
+// cacheTTL decides whether the response to the request is cacheable,
+// returning the ttl it is cached for, or zero along with the reason it is
+// not.
+func (c *Client) cacheTTL(r *http.Request, statusCode int, header http.Header, ctl responseControl, size int64) (time.Duration, string) {
+	switch {
+	case isPartial(statusCode, header):
+		return 0, "the response is partial"
+	case statusCode == http.StatusNotModified:
+		return 0, "the response is a 304 without a body"
+	case statusCode >= 400 && isEarlyRefresh(r):
+		return 0, fmt.Sprintf("the early refresh got error status %d, keeping the cached response", statusCode)
+	case !c.isCacheableStatus(statusCode) && statusCode >= 400:
+		return 0, fmt.Sprintf("got error status %d", statusCode)
+	case !c.isCacheableStatus(statusCode):
+		return 0, fmt.Sprintf("the status code %d is not cacheable", statusCode)
+	case ctl.noStore:
+		return 0, "the handler forbids storing"
+	case c.maxBodySize > 0 && size > c.maxBodySize:
+		return 0, "the response body exceeds the max size"
+	}
+	cc := parseCacheControl(header)
+	if cc.has("no-store") || (cc.has("private") && !c.storesPrivate(r)) {
+		return 0, "the response forbids storing"
+	}
+	if !c.cacheSetCookie && len(header["Set-Cookie"]) > 0 {
+		return 0, "the response sets cookies"
+	}
+	if varyAll(parseVary(header)) {
+		return 0, "the response varies on every request"
+	}
+	ttl := ctl.ttl
+	if !ctl.hasTTL {
+		ttl = c.responseTTL(r, statusCode, header, cc)
+	}
+	if ttl <= 0 {
+		return 0, "the response is not fresh"
+	}
+	return ttl, ""
+}
+
+// store caches the response to the request by the given prefix and key
+// when it is cacheable, returning the ttl it is cached for, or zero when
+// it is not.
+func (c *Client) store(ctxlog Logger, r *http.Request, prefix, key string, result *http.Response, value []byte, t *Timing) time.Duration {
+	tags := c.takeTags(result.Header)
+	ctl := takeControl(result.Header)
+	c.stripHeaders(result.Header)
+
+	if c.skipCacheOnCancel && r.Context().Err() != nil {
+		ctxlog.Debugf("the request was canceled, skipping cache")
+		c.metrics.IncStoreSkip(prefix)
+		return 0
+	}
+	// the response is stored even when the client has gone in the
+	// meantime
+	ctx := detach(r.Context())
 
 	statusCode := result.StatusCode
-	ctxlog.Data["status"] = statusCode
+	ttl, reason := c.cacheTTL(r, statusCode, result.Header, ctl, int64(len(value)))
+	if ttl <= 0 {
+		if statusCode == http.StatusNotFound && !c.isCacheableStatus(statusCode) && !isEarlyRefresh(r) {
+			ctxlog.Debugf("the item is NotFound now, removing it from cache")
+			c.release(ctx, prefix, key)
+		} else {
+			ctxlog.Debugf("%s, skipping cache", reason)
+		}
+		c.metrics.IncStoreSkip(prefix)
+		return 0
+	}
+	vary := parseVary(result.Header)
+	ctxlog.Debugf("all fine")
+	now := time.Now()
 
-	if result.StatusCode == http.StatusNotFound {
-		ctxlog.Trace("the item is NotFound now, removing it from cache")
-		c.adapter.Release(prefix, key)
-		return
+	if statusCode == http.StatusOK && result.Header.Get("ETag") == "" {
+		result.Header.Set("ETag", weakETag(value))
 	}
-	value = rec.Body.Bytes()
-	if statusCode < 400 {
-		ctxlog.Trace("all fine")
-		now := time.Now()
 
-		response := Response{
-			Value:      value,
-			Header:     result.Header,
-			Expiration: now.Add(c.ttl),
-			LastAccess: now,
-			Frequency:  1,
-			CachedAt:   now,
+	response := Response{
+		Value:      value,
+		Header:     c.cachedHeader(result.Header),
+		StatusCode: statusCode,
+		Expiration: now.Add(ttl),
+		LastAccess: now,
+		Frequency:  1,
+		CachedAt:   now,
+	}
+	entryKey := key
+	if len(vary) > 0 {
+		entryKey = c.variantKey(key, vary, r)
+	}
+	if c.asyncSet {
+		// the timing is over by the time the response is written
+		t = nil
+	}
+	write := func() {
+		if len(vary) > 0 {
+			marker := Response{
+				Vary:       vary,
+				Expiration: response.Expiration,
+				CachedAt:   now,
+			}
+			c.setResponse(ctx, r, ctxlog, prefix, key, marker, t)
+			c.addTags(ctxlog, prefix, key, tags)
+		}
+		c.setResponse(ctx, r, ctxlog, prefix, entryKey, response, t)
+		c.addTags(ctxlog, prefix, entryKey, tags)
+	}
+	if c.asyncSet {
+		if !c.enqueueSet(write) {
+			ctxlog.Debugf("the write queue is full, skipping cache")
+			c.metrics.IncStoreSkip(prefix)
+			return 0
 		}
-		c.adapter.Set(prefix, key, response.Bytes())
 	} else {
-		ctxlog.Data["value"] = string(value)
-		ctxlog.Trace("got error")
+		write()
 	}
-	return
+	c.metrics.IncStore(prefix)
+	c.hookStore(r, prefix, entryKey, response)
+	return ttl
+}
+
+// serveOrigin calls the handler, observing its latency and tracing it
+// when enabled.
+func (c *Client) serveOrigin(next http.Handler, w http.ResponseWriter, r *http.Request, prefix, key string, t *Timing) {
+	ctx, span := c.startSpan(r.Context(), "cache.origin", prefix, key)
+	defer span.end()
+	if span.span != nil {
+		r = r.WithContext(ctx)
+	}
+	start := time.Now()
+	next.ServeHTTP(w, r)
+	d := time.Since(start)
+	c.metrics.ObserveOriginLatency(prefix, d)
+	if t != nil {
+		t.Origin += d
+	}
+}
+
+// isCacheableStatus reports whether responses with the status code may be
+// cached. By default, any status code below 400 is.
+func (c *Client) isCacheableStatus(statusCode int) bool {
+	if c.negativeStatusCodes[statusCode] {
+		return true
+	}
+	if c.cacheableStatusCodes == nil {
+		return statusCode < 400
+	}
+	return c.cacheableStatusCodes[statusCode]
+}
+
+// responseTTL returns how long a response should be cached, honoring its
+// max-age and s-maxage directives, or its Expires header, when the client
+// is configured to. A zero ttl means the response is not cached.
+func (c *Client) responseTTL(r *http.Request, statusCode int, header http.Header, cc cacheControl) time.Duration {
+	if ttl, ok := TTLFromContext(r.Context()); ok {
+		return ttl
+	}
+	ttl := c.ttl
+	if c.ttlFunc != nil {
+		if ttl = c.ttlFunc(r); ttl <= 0 {
+			return 0
+		}
+	}
+	if statusTTL, ok := c.statusCodeTTLs[statusCode]; ok {
+		ttl = statusTTL
+	}
+	if c.respectMaxAge {
+		if maxAge, ok := cc.maxAge(); ok {
+			return c.jitter(maxAge, false)
+		}
+		if expires, ok := expiresTTL(header); ok {
+			return c.jitter(expires, false)
+		}
+	}
+	return c.jitter(ttl, true)
 }
 
 // Exists ...
 func (c *Client) Exists(uri string) bool {
-	url, _ := url.Parse(uri)
-	sortURLParams(url)
-	prefix := url.Path
-	key := generateKey(url.String())
+	prefix, key, err := c.uriPrefixAndKey(uri)
+	if err != nil {
+		return false
+	}
+	return c.exists(c.background(), nil, c.log, prefix, key)
+}
 
-	return c.adapter.Exists(prefix, key)
+// ReleaseURI frees the cached responses of the given path and returns
+// how many were released.
+func (c *Client) ReleaseURI(uri string) (int, error) {
+	n, err := c.releasePrefix(c.background(), uri)
+	c.logRelease(uri, "", n, err)
+	return n, err
 }
 
-// ReleaseURI ...
-func (c *Client) ReleaseURI(uri string) {
-	c.adapter.ReleasePrefix(uri)
+// ReleaseIfStartsWith frees the cached responses of the paths starting
+// with the given one and returns how many were released.
+func (c *Client) ReleaseIfStartsWith(uri string) (int, error) {
+	n, err := c.releaseIfStartsWith(c.background(), uri)
+	c.logRelease(uri, "", n, err)
+	return n, err
 }
 
-// ReleaseIfStartsWith ...
-func (c *Client) ReleaseIfStartsWith(uri string) {
-	c.adapter.ReleaseIfStartsWith(uri)
+// ReleaseAll frees every cached response, e.g. after a deploy changing
+// the responses, and returns how many were released.
+func (c *Client) ReleaseAll() (int, error) {
+	if flusher, ok := c.optional().(Flusher); ok {
+		return flusher.Flush()
+	}
+	return c.releaseIfStartsWith(c.background(), "")
 }
 
-// Release ...
-func (c *Client) Release(uri string) {
-	url, _ := url.Parse(uri)
-	sortURLParams(url)
-	prefix := url.Path
-	key := generateKey(url.String())
-	c.adapter.Release(prefix, key)
+// ReleaseRequest frees the cached response to the given request, using
+// the same prefix and key generation as the middleware, and returns how
+// many responses were released.
+func (c *Client) ReleaseRequest(r *http.Request) (int, error) {
+	prefix, key := c.GeneratePrefixAndKey(r)
+	n, err := c.release(r.Context(), prefix, key)
+	c.logRelease(prefix, key, n, err)
+	return n, err
 }
 
-// BytesToResponse converts bytes array into Response data structure.
-func BytesToResponse(b []byte) Response {
+// Release frees the cached response to the given URI and returns how many
+// responses were released. When the host is part of the key, the URI must
+// be absolute, e.g. "http://example.com/a".
+func (c *Client) Release(uri string) (int, error) {
+	prefix, key, err := c.uriPrefixAndKey(uri)
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.release(c.background(), prefix, key)
+	c.logRelease(prefix, key, n, err)
+	return n, err
+}
+
+// logRelease logs the outcome of a release, so that a URI not matching
+// any cached response does not go unnoticed.
+func (c *Client) logRelease(prefix, key string, n int, err error) {
+	ctxlog := c.requestLog(prefix, key)
+	switch {
+	case err != nil:
+		ctxlog.Errorf("failed to release the cached responses: %v", err)
+	case n == ReleasedUnknown:
+		ctxlog.Debugf("released the cached responses, the adapter does not count them")
+	case n == 0:
+		ctxlog.Debugf("nothing to release")
+	default:
+		ctxlog.Debugf("released %d cached responses", n)
+	}
+}
+
+// BytesToResponse converts bytes array into Response data structure. It
+// reads the gob encoded entries stored by earlier versions too. The
+// response Value shares the bytes.
+func BytesToResponse(b []byte) (Response, error) {
+	if isFramed(b) {
+		return unmarshalFrame(b)
+	}
 	var r Response
-	dec := gob.NewDecoder(bytes.NewReader(b))
-	dec.Decode(&r)
+	reader := getReader(b)
+	defer putReader(reader)
+	dec := gob.NewDecoder(reader)
+	err := dec.Decode(&r)
+
+	return r, err
+}
+
+// statusCode returns the status code to replay for the cached response.
+func (r Response) statusCode() int {
+	if r.StatusCode == 0 {
+		return http.StatusOK
+	}
+	return r.StatusCode
+}
 
-	return r
+// age returns the number of seconds since the response was stored.
+func (r Response) age() int64 {
+	age := int64(time.Since(r.CachedAt) / time.Second)
+	if age < 0 {
+		return 0
+	}
+	return age
 }
 
-// Bytes converts Response data structure into bytes array.
+// Bytes converts Response data structure into bytes array, in a framed
+// format whose metadata is read without decoding the body.
 func (r Response) Bytes() []byte {
-	var b bytes.Buffer
-	enc := gob.NewEncoder(&b)
-	enc.Encode(&r)
+	return marshalFrame(r)
+}
 
-	return b.Bytes()
+// copyHeader adds every value of src to dst, keeping multi-value headers
+// such as Set-Cookie as separate lines.
+func copyHeader(dst, src http.Header) {
+	for k, v := range src {
+		for _, vv := range v {
+			dst.Add(k, vv)
+		}
+	}
 }
 
+// sortURLParams canonicalizes the URL query, see canonicalQuery.
 func sortURLParams(URL *url.URL) {
-	params := URL.Query()
-	for _, param := range params {
-		sort.Slice(param, func(i, j int) bool {
-			return param[i] < param[j]
-		})
-	}
-	URL.RawQuery = params.Encode()
+	URL.RawQuery = canonicalQuery(URL.RawQuery, nil)
 }
 
 func generateKey(URL string) string {
@@ -255,7 +1136,12 @@ func generateKey(URL string) string {
 // options.
 func NewClient(opts ...ClientOption) (*Client, error) {
 	c := &Client{}
-	c.log = log.StandardLogger()
+	c.accessTracking = true
+	c.metrics = nopCollector{}
+	c.codec = FrameCodec{}
+	c.stats = &stats{}
+	c.bodyLimit = defaultBodyLimit
+	c.closeTimeout = defaultCloseTimeout
 
 	for _, opt := range opts {
 		if err := opt(c); err != nil {
@@ -263,6 +1149,13 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 		}
 	}
 
+	if c.log == nil {
+		c.log = log.StandardLogger()
+		if c.debugOutput {
+			c.log = debugLogger()
+		}
+	}
+
 	if c.adapter == nil {
 		return nil, errors.New("cache client adapter is not set")
 	}
@@ -270,6 +1163,18 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 		return nil, errors.New("cache client ttl is not set")
 	}
 
+	if c.ctx == nil {
+		c.ctx = context.Background()
+	}
+	c.ctx, c.cancel = context.WithCancel(c.ctx)
+
+	if c.janitorInterval > 0 {
+		c.startJanitor()
+	}
+	if c.asyncSet {
+		c.startAsyncSet()
+	}
+
 	return c, nil
 }
 
@@ -295,6 +1200,16 @@ func ClientWithTTL(ttl time.Duration) ClientOption {
 	}
 }
 
+// ClientWithTTLFunc sets a function returning how long the response to
+// each request is going to be cached, e.g. depending on its route. A zero
+// duration means the response is not cached. Optional setting.
+func ClientWithTTLFunc(ttlFunc func(r *http.Request) time.Duration) ClientOption {
+	return func(c *Client) error {
+		c.ttlFunc = ttlFunc
+		return nil
+	}
+}
+
 // ClientWithRefreshKey sets the parameter key used to free a request
 // cached response. Optional setting.
 func ClientWithRefreshKey(refreshKey string) ClientOption {
@@ -304,10 +1219,419 @@ func ClientWithRefreshKey(refreshKey string) ClientOption {
 	}
 }
 
-// ClientWithLogger ...
-func ClientWithLogger(logger *log.Logger) ClientOption {
+// ClientWithRefreshKeyValue sets the parameter key used to free a request
+// cached response, along with the secret value it must have to do so.
+// The parameter is left out of the cache key whatever its value, so
+// unauthorized refreshes are served from the cache. Optional setting.
+func ClientWithRefreshKeyValue(refreshKey, secret string) ClientOption {
 	return func(c *Client) error {
+		if refreshKey == "" || secret == "" {
+			return errors.New("cache client refresh key and secret must not be empty")
+		}
+		c.refreshKey = refreshKey
+		c.refreshSecret = secret
+		return nil
+	}
+}
+
+// ClientWithLogger sets the logger the client writes its messages to,
+// the logrus standard logger by default. Optional setting.
+func ClientWithLogger(logger Logger) ClientOption {
+	return func(c *Client) error {
+		if logger == nil {
+			return errors.New("cache client logger is not set")
+		}
 		c.log = logger
 		return nil
 	}
 }
+
+// ClientWithDebugOutput makes the client write its debug messages to the
+// standard error when no logger is set. Optional setting.
+func ClientWithDebugOutput(debug bool) ClientOption {
+	return func(c *Client) error {
+		c.debugOutput = debug
+		return nil
+	}
+}
+
+// ClientWithSharedCache makes the client behave as a shared cache, which
+// does not store responses marked with Cache-Control: private. Optional
+// setting.
+func ClientWithSharedCache(shared bool) ClientOption {
+	return func(c *Client) error {
+		c.sharedCache = shared
+		return nil
+	}
+}
+
+// ClientWithRespectMaxAge makes the response s-maxage and max-age
+// directives take precedence over the client ttl, and, without them, the
+// Expires header. A zero max-age, or an Expires date invalid or past,
+// means the response is not cached. Optional setting.
+func ClientWithRespectMaxAge(respect bool) ClientOption {
+	return func(c *Client) error {
+		c.respectMaxAge = respect
+		return nil
+	}
+}
+
+// ClientWithCacheStatusHeader sets the name of a response header telling
+// whether the response was a cache HIT, MISS or BYPASS. Optional setting.
+func ClientWithCacheStatusHeader(name string) ClientOption {
+	return func(c *Client) error {
+		c.cacheStatusHeader = name
+		return nil
+	}
+}
+
+// ClientWithCacheSetCookie allows caching responses that set cookies,
+// which are skipped by default as they are usually per user. Optional
+// setting.
+func ClientWithCacheSetCookie(cacheSetCookie bool) ClientOption {
+	return func(c *Client) error {
+		c.cacheSetCookie = cacheSetCookie
+		return nil
+	}
+}
+
+// ClientWithCacheAuthorizedRequests allows caching responses to requests
+// carrying an Authorization header, which bypass the cache by default.
+// Each principal gets its own cache entries. Optional setting.
+func ClientWithCacheAuthorizedRequests(cacheAuthorized bool) ClientOption {
+	return func(c *Client) error {
+		c.cacheAuthorized = cacheAuthorized
+		return nil
+	}
+}
+
+// ClientWithRequestCoalescing makes concurrent requests missing the same
+// key share a single origin handler execution. Optional setting.
+func ClientWithRequestCoalescing(coalescing bool) ClientOption {
+	return func(c *Client) error {
+		c.flight = nil
+		if coalescing {
+			c.flight = &singleflight.Group{}
+		}
+		return nil
+	}
+}
+
+// ClientWithAccessTracking sets whether hits update the cached response
+// last access date and frequency, for adapters implementing Toucher.
+// Enabled by default. Optional setting.
+func ClientWithAccessTracking(tracking bool) ClientOption {
+	return func(c *Client) error {
+		c.accessTracking = tracking
+		return nil
+	}
+}
+
+// ClientWithKeyGenerator sets a function generating the prefix and key
+// each response is cached by, replacing the default based on the request
+// path and sorted URL. Optional setting.
+func ClientWithKeyGenerator(generator KeyGenerator) ClientOption {
+	return func(c *Client) error {
+		c.keyGenerator = generator
+		return nil
+	}
+}
+
+// ClientWithPrefixFunc sets a function returning the prefix the response
+// to the request is cached by, in place of its path, e.g. the matched
+// route pattern "/users/{id}", so that ReleaseURI("/users/{id}") releases
+// the responses of every user at once. The key is still generated from
+// the request URL. An empty prefix falls back to the path. It does not
+// apply to a key generator. Release, Exists, Peek and SoftRelease call it
+// with a bare GET request for their URI, so a function reading what the
+// router attaches to the request, e.g. its route context, falls back to
+// the path there and they find nothing: use ReleaseURI with the route
+// pattern, or ReleaseRequest, instead. Optional setting.
+func ClientWithPrefixFunc(fn func(r *http.Request) string) ClientOption {
+	return func(c *Client) error {
+		if fn == nil {
+			return errors.New("cache client prefix function is not set")
+		}
+		c.prefixFunc = fn
+		return nil
+	}
+}
+
+// ClientWithIgnoredQueryParams sets query parameters left out of the
+// cache key, such as tracking parameters. Each name may be a pattern as
+// accepted by path.Match, e.g. "utm_*". Optional setting.
+func ClientWithIgnoredQueryParams(params ...string) ClientOption {
+	return func(c *Client) error {
+		for _, pattern := range params {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("cache client ignored query param %v is invalid", pattern)
+			}
+		}
+
+		c.ignoredParams = append(c.ignoredParams, params...)
+
+		return nil
+	}
+}
+
+// ClientWithLowercaseHost lowercases the host of the URLs the cache keys
+// are generated from, since host names are case insensitive. Optional
+// setting.
+func ClientWithLowercaseHost(lowercase bool) ClientOption {
+	return func(c *Client) error {
+		c.lowercaseHost = lowercase
+		return nil
+	}
+}
+
+// ClientWithHostInKey makes the request host part of the cache key, so
+// virtual hosts served by the same handler don't share responses.
+// Optional setting.
+func ClientWithHostInKey(hostInKey bool) ClientOption {
+	return func(c *Client) error {
+		c.hostInKey = hostInKey
+		return nil
+	}
+}
+
+// ClientWithSkipFunc sets a function telling whether a request bypasses
+// the cache, going straight to the handler with neither lookup nor store.
+// Optional setting.
+func ClientWithSkipFunc(skipFunc func(r *http.Request) bool) ClientOption {
+	return func(c *Client) error {
+		c.skipFunc = skipFunc
+		return nil
+	}
+}
+
+// ClientWithCacheableStatusCodes sets the exact status codes of the
+// responses that get cached, replacing the default of any status code
+// below 400. Optional setting.
+func ClientWithCacheableStatusCodes(statusCodes ...int) ClientOption {
+	return func(c *Client) error {
+		c.cacheableStatusCodes = make(map[int]bool, len(statusCodes))
+		for _, code := range statusCodes {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("cache client status code %v is invalid", code)
+			}
+			c.cacheableStatusCodes[code] = true
+		}
+		return nil
+	}
+}
+
+// ClientWithStatusCodeTTL sets how long responses with the given status
+// code are going to be cached, overriding the client ttl. Optional
+// setting.
+func ClientWithStatusCodeTTL(statusCode int, ttl time.Duration) ClientOption {
+	return func(c *Client) error {
+		if int64(ttl) < 1 {
+			return fmt.Errorf("cache client ttl %v is invalid", ttl)
+		}
+		if c.statusCodeTTLs == nil {
+			c.statusCodeTTLs = make(map[int]time.Duration)
+		}
+		c.statusCodeTTLs[statusCode] = ttl
+		return nil
+	}
+}
+
+// ClientWithNegativeCache caches the error responses with the given status
+// codes, 404 Not Found when none is given, for the given ttl, usually
+// shorter than the client one, so that requests for missing resources
+// stop reaching the handler. Optional setting.
+func ClientWithNegativeCache(ttl time.Duration, statusCodes ...int) ClientOption {
+	return func(c *Client) error {
+		if int64(ttl) < 1 {
+			return fmt.Errorf("cache client negative ttl %v is invalid", ttl)
+		}
+		if len(statusCodes) == 0 {
+			statusCodes = []int{http.StatusNotFound}
+		}
+		if c.negativeStatusCodes == nil {
+			c.negativeStatusCodes = make(map[int]bool, len(statusCodes))
+		}
+		if c.statusCodeTTLs == nil {
+			c.statusCodeTTLs = make(map[int]time.Duration, len(statusCodes))
+		}
+		for _, code := range statusCodes {
+			if code < 400 || code > 599 {
+				return fmt.Errorf("cache client status code %v is not an error", code)
+			}
+			c.negativeStatusCodes[code] = true
+			c.statusCodeTTLs[code] = ttl
+		}
+		return nil
+	}
+}
+
+// ClientWithMetrics sets the collector receiving the cache hits, misses,
+// bypasses, stores and origin latencies. Optional setting.
+func ClientWithMetrics(collector Collector) ClientOption {
+	return func(c *Client) error {
+		if collector == nil {
+			return errors.New("cache client metrics collector is not set")
+		}
+		c.metrics = collector
+		return nil
+	}
+}
+
+// ClientWithHeadAsGet makes HEAD requests missing the cache go to the
+// handler as GET requests, so that their response gets cached. HEAD
+// requests are always answered from the cached GET responses. Optional
+// setting.
+func ClientWithHeadAsGet(headAsGet bool) ClientOption {
+	return func(c *Client) error {
+		c.headAsGet = headAsGet
+		return nil
+	}
+}
+
+// ClientWithCacheableMethods sets the methods of the requests whose
+// responses get cached, replacing the default of GET only. Responses to
+// requests with a body, such as POST requests, are keyed by their body
+// too. HEAD requests are always answered from cached GET responses.
+// Optional setting.
+func ClientWithCacheableMethods(methods ...string) ClientOption {
+	return func(c *Client) error {
+		c.cacheableMethods = make(map[string]bool, len(methods))
+		for _, method := range methods {
+			if method == "" {
+				return errors.New("cache client method is empty")
+			}
+			c.cacheableMethods[method] = true
+		}
+		return nil
+	}
+}
+
+// ClientWithRequestBodyLimit sets the size limit of the request bodies
+// read to generate cache keys, 1 MiB by default. Requests with a larger
+// body bypass the cache. Optional setting.
+func ClientWithRequestBodyLimit(limit int64) ClientOption {
+	return func(c *Client) error {
+		if limit < 1 {
+			return fmt.Errorf("cache client request body limit %v is invalid", limit)
+		}
+		c.bodyLimit = limit
+		return nil
+	}
+}
+
+// ClientWithMaxBodySize sets the size limit of the response bodies that
+// get cached, in bytes. Larger responses are still streamed to the client,
+// but neither kept in memory nor stored. There is no limit by default.
+// Optional setting.
+func ClientWithMaxBodySize(size int64) ClientOption {
+	return func(c *Client) error {
+		if size < 1 {
+			return fmt.Errorf("cache client max body size %v is invalid", size)
+		}
+		c.maxBodySize = size
+		return nil
+	}
+}
+
+// ClientWithStaleWhileRevalidate sets how long after their expiration
+// cached responses are still served, while a single background request
+// to the handler refreshes them. Optional setting.
+func ClientWithStaleWhileRevalidate(window time.Duration) ClientOption {
+	return func(c *Client) error {
+		if int64(window) < 1 {
+			return fmt.Errorf("cache client stale while revalidate window %v is invalid", window)
+		}
+		c.staleWhileRevalidate = window
+		return nil
+	}
+}
+
+// ClientWithStaleIfError sets how long after their expiration cached
+// responses are served instead of the handler response when the handler
+// fails with a 5xx status code or panics. Optional setting.
+func ClientWithStaleIfError(window time.Duration) ClientOption {
+	return func(c *Client) error {
+		if int64(window) < 1 {
+			return fmt.Errorf("cache client stale if error window %v is invalid", window)
+		}
+		c.staleIfError = window
+		return nil
+	}
+}
+
+// ClientWithInvalidateOnWrite makes POST, PUT, PATCH and DELETE requests
+// completing with a 2xx status code release the cached responses of
+// their prefix, i.e. of the GET requests of the same path, unless their
+// method is cacheable. Optional setting.
+func ClientWithInvalidateOnWrite(invalidate bool) ClientOption {
+	return func(c *Client) error {
+		c.invalidateOnWrite = invalidate
+		return nil
+	}
+}
+
+// ClientWithInvalidatePrefixes sets a function returning the prefixes to
+// release along with the path of a successful write request, e.g. the
+// collection path of an item. It enables the invalidation on write.
+// Optional setting.
+func ClientWithInvalidatePrefixes(prefixes func(r *http.Request) []string) ClientOption {
+	return func(c *Client) error {
+		if prefixes == nil {
+			return errors.New("cache client invalidate prefixes function is not set")
+		}
+		c.invalidateOnWrite = true
+		c.invalidatePrefixes = prefixes
+		return nil
+	}
+}
+
+// ClientWithTagHeader sets the name of a response header listing comma
+// separated tags the handler attaches to the response, which can then be
+// released with ReleaseTag. The header is never sent to the client.
+// Optional setting.
+func ClientWithTagHeader(name string) ClientOption {
+	return func(c *Client) error {
+		if name == "" {
+			return errors.New("cache client tag header is empty")
+		}
+		c.tagHeader = http.CanonicalHeaderKey(name)
+		return nil
+	}
+}
+
+// ClientWithAdminToken sets the bearer token requests to the admin
+// handler must carry. Optional setting.
+func ClientWithAdminToken(token string) ClientOption {
+	return func(c *Client) error {
+		if token == "" {
+			return errors.New("cache client admin token is empty")
+		}
+		c.adminToken = token
+		return nil
+	}
+}
+
+// ClientWithPurgeMethod makes PURGE requests release the response cached
+// for the GET request to the same URL instead of reaching the handler.
+// PURGE requests are denied unless ClientWithPurgeAuthorizer allows them.
+// Optional setting.
+func ClientWithPurgeMethod(purge bool) ClientOption {
+	return func(c *Client) error {
+		c.purgeMethod = purge
+		return nil
+	}
+}
+
+// ClientWithPurgeAuthorizer sets a function telling whether a PURGE
+// request is allowed, e.g. by checking its source address or a token.
+// Other PURGE requests are answered 403. Required for PURGE requests to
+// release anything.
+func ClientWithPurgeAuthorizer(authorizer func(r *http.Request) bool) ClientOption {
+	return func(c *Client) error {
+		if authorizer == nil {
+			return errors.New("cache client purge authorizer is not set")
+		}
+		c.purgeAuthorizer = authorizer
+		return nil
+	}
+}
@@ -6,151 +6,1758 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
-type adapterMock struct {
-	sync.Mutex
-	store map[string][]byte
+type adapterMock struct {
+	sync.Mutex
+	store map[string]map[string][]byte
+}
+
+func (a *adapterMock) Get(prefix, key string) ([]byte, bool) {
+	a.Lock()
+	defer a.Unlock()
+	if b, ok := a.store[prefix][key]; ok {
+		return b, true
+	}
+	return nil, false
+}
+
+func (a *adapterMock) Exists(prefix, key string) bool {
+	_, ok := a.Get(prefix, key)
+	return ok
+}
+
+func (a *adapterMock) Set(prefix, key string, response []byte) {
+	a.Lock()
+	defer a.Unlock()
+	if a.store == nil {
+		a.store = map[string]map[string][]byte{}
+	}
+	if a.store[prefix] == nil {
+		a.store[prefix] = map[string][]byte{}
+	}
+	a.store[prefix][key] = response
+}
+
+func (a *adapterMock) Touch(prefix, key string) {}
+
+func (a *adapterMock) Release(prefix, key string) (int, error) {
+	a.Lock()
+	defer a.Unlock()
+	if _, ok := a.store[prefix][key]; !ok {
+		return 0, nil
+	}
+	delete(a.store[prefix], key)
+	return 1, nil
+}
+
+func (a *adapterMock) ReleasePrefix(prefix string) (int, error) {
+	a.Lock()
+	defer a.Unlock()
+	n := len(a.store[prefix])
+	delete(a.store, prefix)
+	return n, nil
+}
+
+func (a *adapterMock) ReleaseIfStartsWith(key string) (int, error) {
+	a.Lock()
+	defer a.Unlock()
+	n := 0
+	for prefix, entries := range a.store {
+		if strings.HasPrefix(prefix, key) {
+			n += len(entries)
+			delete(a.store, prefix)
+		}
+	}
+	return n, nil
+}
+
+func TestMiddleware(t *testing.T) {
+	counter := 0
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf("new value %v", counter)))
+	})
+
+	adapter := &adapterMock{
+		store: map[string]map[string][]byte{
+			"/test-1": {
+				"14974843192121052621": Response{
+					Value:      []byte("value 1"),
+					Expiration: time.Now().Add(1 * time.Minute),
+				}.Bytes(),
+			},
+			"/test-2": {
+				"14974839893586167988": Response{
+					Value:      []byte("value 2"),
+					Expiration: time.Now().Add(1 * time.Minute),
+				}.Bytes(),
+			},
+			"/test-3": {
+				"14974840993097796199": Response{
+					Value:      []byte("value 3"),
+					Expiration: time.Now().Add(-1 * time.Minute),
+				}.Bytes(),
+			},
+		},
+	}
+
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithRefreshKey("rk"),
+	)
+
+	handler := client.Middleware(httpTestHandler)
+
+	tests := []struct {
+		name     string
+		url      string
+		method   string
+		wantBody string
+		wantCode int
+	}{
+		{
+			"returns cached response",
+			"http://foo.bar/test-1",
+			"GET",
+			"value 1",
+			200,
+		},
+		{
+			"returns new response",
+			"http://foo.bar/test-2",
+			"POST",
+			"new value 2",
+			200,
+		},
+		{
+			"returns cached response",
+			"http://foo.bar/test-2",
+			"GET",
+			"value 2",
+			200,
+		},
+		{
+			"returns new response",
+			"http://foo.bar/test-3?zaz=baz&baz=zaz",
+			"GET",
+			"new value 4",
+			200,
+		},
+		{
+			"returns cached response",
+			"http://foo.bar/test-3?baz=zaz&zaz=baz",
+			"GET",
+			"new value 4",
+			200,
+		},
+		{
+			"cache expired",
+			"http://foo.bar/test-3",
+			"GET",
+			"new value 6",
+			200,
+		},
+		{
+			"releases cached response and returns new response",
+			"http://foo.bar/test-2?rk=true",
+			"GET",
+			"new value 7",
+			200,
+		},
+		{
+			"returns new cached response",
+			"http://foo.bar/test-2",
+			"GET",
+			"new value 7",
+			200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter++
+
+			r, err := http.NewRequest(tt.method, tt.url, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if !reflect.DeepEqual(w.Code, tt.wantCode) {
+				t.Errorf("*Client.Middleware() = %v, want %v", w.Code, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(w.Body.String(), tt.wantBody) {
+				t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMiddlewareStatusCode(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+
+	adapter := &adapterMock{
+		store: map[string]map[string][]byte{
+			"/legacy": {
+				generateKey("http://foo.bar/legacy"): Response{
+					Value:      []byte("legacy"),
+					Expiration: time.Now().Add(1 * time.Minute),
+				}.Bytes(),
+			},
+		},
+	}
+
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+	)
+
+	handler := client.Middleware(httpTestHandler)
+
+	tests := []struct {
+		name     string
+		url      string
+		wantBody string
+		wantCode int
+	}{
+		{
+			"returns origin status code",
+			"http://foo.bar/created",
+			"created",
+			201,
+		},
+		{
+			"replays cached status code",
+			"http://foo.bar/created",
+			"created",
+			201,
+		},
+		{
+			"serves entries without status code as 200",
+			"http://foo.bar/legacy",
+			"legacy",
+			200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest("GET", tt.url, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("*Client.Middleware() code = %v, want %v", w.Code, tt.wantCode)
+				return
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMiddlewareMultiValueHeaders(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "a", Value: "1"})
+		http.SetCookie(w, &http.Cookie{Name: "b", Value: "2"})
+		w.Write([]byte("cookies"))
+	})
+
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithCacheSetCookie(true),
+	)
+
+	handler := client.Middleware(httpTestHandler)
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{
+			"returns every cookie on the origin response",
+			[]string{"a=1", "b=2"},
+		},
+		{
+			"returns every cookie on the cached response",
+			[]string{"a=1", "b=2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest("GET", "http://foo.bar/cookies", nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if got := w.Header()["Set-Cookie"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("*Client.Middleware() Set-Cookie = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareCacheControl(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		shared       bool
+		wantCalls    int
+	}{
+		{
+			"caches responses without cache control",
+			"",
+			false,
+			1,
+		},
+		{
+			"does not cache no-store responses",
+			"no-store",
+			false,
+			2,
+		},
+		{
+			"caches private responses in a private cache",
+			"private, max-age=60",
+			false,
+			1,
+		},
+		{
+			"does not cache private responses in a shared cache",
+			"private, max-age=60",
+			true,
+			2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if tt.cacheControl != "" {
+					w.Header().Set("Cache-Control", tt.cacheControl)
+				}
+				w.Write([]byte("value"))
+			})
+
+			client, _ := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithSharedCache(tt.shared),
+			)
+			handler := client.Middleware(httpTestHandler)
+
+			for i := 0; i < 2; i++ {
+				r, _ := http.NewRequest("GET", "http://foo.bar/cache-control", nil)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Body.String() != "value" {
+					t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), "value")
+				}
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("*Client.Middleware() origin calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRespectMaxAge(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		respect      bool
+		wantStored   bool
+		wantTTL      time.Duration
+	}{
+		{
+			"uses client ttl when not respecting max-age",
+			"max-age=10",
+			false,
+			true,
+			time.Minute,
+		},
+		{
+			"uses max-age",
+			"max-age=10",
+			true,
+			true,
+			10 * time.Second,
+		},
+		{
+			"prefers s-maxage over max-age",
+			"max-age=10, s-maxage=20",
+			true,
+			true,
+			20 * time.Second,
+		},
+		{
+			"falls back to client ttl without max-age",
+			"public",
+			true,
+			true,
+			time.Minute,
+		},
+		{
+			"falls back to client ttl on malformed max-age",
+			"max-age=ten",
+			true,
+			true,
+			time.Minute,
+		},
+		{
+			"does not cache zero max-age",
+			"max-age=0",
+			true,
+			false,
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", tt.cacheControl)
+				w.Write([]byte("value"))
+			})
+
+			adapter := &adapterMock{}
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Minute),
+				ClientWithRespectMaxAge(tt.respect),
+			)
+
+			r, _ := http.NewRequest("GET", "http://foo.bar/max-age", nil)
+			start := time.Now()
+			client.Middleware(httpTestHandler).ServeHTTP(httptest.NewRecorder(), r)
+
+			b, ok := adapter.Get("/max-age", generateKey("http://foo.bar/max-age"))
+			if ok != tt.wantStored {
+				t.Errorf("*Client.Middleware() stored = %v, want %v", ok, tt.wantStored)
+				return
+			}
+			if !ok {
+				return
+			}
+			response, _ := BytesToResponse(b)
+			ttl := response.Expiration.Sub(start)
+			if ttl < tt.wantTTL || ttl > tt.wantTTL+time.Second {
+				t.Errorf("*Client.Middleware() ttl = %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestMiddlewareCacheStatusHeader(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("value"))
+	})
+
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithRefreshKey("rk"),
+		ClientWithCacheStatusHeader("X-Cache"),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	tests := []struct {
+		name   string
+		url    string
+		method string
+		want   string
+	}{
+		{
+			"miss",
+			"http://foo.bar/status",
+			"GET",
+			"MISS",
+		},
+		{
+			"hit",
+			"http://foo.bar/status",
+			"GET",
+			"HIT",
+		},
+		{
+			"bypass on refresh key",
+			"http://foo.bar/status?rk=1",
+			"GET",
+			"BYPASS",
+		},
+		{
+			"bypass on non cacheable method",
+			"http://foo.bar/status",
+			"POST",
+			"BYPASS",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(tt.method, tt.url, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if got := w.Header().Get("X-Cache"); got != tt.want {
+				t.Errorf("*Client.Middleware() X-Cache = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	client, _ = NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+	)
+	r, _ := http.NewRequest("GET", "http://foo.bar/status", nil)
+	w := httptest.NewRecorder()
+	client.Middleware(httpTestHandler).ServeHTTP(w, r)
+	if _, ok := w.Header()["X-Cache"]; ok {
+		t.Error("*Client.Middleware() sets X-Cache when disabled")
+	}
+}
+
+func TestMiddlewareHead(t *testing.T) {
+	var calls []string
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method)
+		w.Header().Set("X-Origin", "yes")
+		w.Write([]byte("value"))
+	})
+
+	tests := []struct {
+		name      string
+		headAsGet bool
+		requests  []string
+		wantCalls []string
+		wantCache string
+	}{
+		{
+			"answers HEAD from the GET response",
+			false,
+			[]string{"GET", "HEAD"},
+			[]string{"GET"},
+			"HIT",
+		},
+		{
+			"passes HEAD through on a miss",
+			false,
+			[]string{"HEAD", "HEAD"},
+			[]string{"HEAD", "HEAD"},
+			"MISS",
+		},
+		{
+			"populates the cache with a GET on a miss",
+			true,
+			[]string{"HEAD", "HEAD", "GET"},
+			[]string{"GET"},
+			"HIT",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			client, _ := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithCacheStatusHeader("X-Cache"),
+				ClientWithHeadAsGet(tt.headAsGet),
+			)
+			handler := client.Middleware(httpTestHandler)
+
+			var w *httptest.ResponseRecorder
+			for _, method := range tt.requests {
+				r, _ := http.NewRequest(method, "http://foo.bar/head", nil)
+				w = httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if method != "HEAD" || calls[len(calls)-1] == "HEAD" {
+					continue
+				}
+				if w.Body.Len() != 0 {
+					t.Errorf("*Client.Middleware() HEAD body = %v, want empty", w.Body.String())
+				}
+				if got := w.Header().Get("Content-Length"); got != "5" {
+					t.Errorf("*Client.Middleware() HEAD Content-Length = %v, want 5", got)
+				}
+				if got := w.Header().Get("X-Origin"); got != "yes" {
+					t.Errorf("*Client.Middleware() HEAD X-Origin = %v, want yes", got)
+				}
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("*Client.Middleware() handler calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if got := w.Header().Get("X-Cache"); got != tt.wantCache {
+				t.Errorf("*Client.Middleware() X-Cache = %v, want %v", got, tt.wantCache)
+			}
+		})
+	}
+}
+
+func TestMiddlewareMaxBodySize(t *testing.T) {
+	calls := 0
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(strings.Repeat("a", 8)))
+		w.Write([]byte(strings.Repeat("b", 8)))
+	})
+
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithMaxBodySize(10),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	for i := 1; i <= 2; i++ {
+		r, _ := http.NewRequest("GET", "http://foo.bar/export", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if got := w.Body.Len(); got != 16 {
+			t.Errorf("*Client.Middleware() body length = %v, want 16", got)
+		}
+		if calls != i {
+			t.Errorf("*Client.Middleware() handler calls = %v, want %v", calls, i)
+		}
+	}
+
+	// oversized entries stored by other means are still served
+	key := generateKey("http://foo.bar/big")
+	adapter.Set("/big", key, Response{
+		Value:      []byte(strings.Repeat("a", 16)),
+		Expiration: time.Now().Add(1 * time.Minute),
+	}.Bytes())
+	r, _ := http.NewRequest("GET", "http://foo.bar/big", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Body.Len(); got != 16 {
+		t.Errorf("*Client.Middleware() cached body length = %v, want 16", got)
+	}
+	if got := client.Stats().Errors; got != 1 {
+		t.Errorf("*Client.Stats() errors = %v, want 1", got)
+	}
+}
+
+func TestMiddlewareRefreshKey(t *testing.T) {
+	calls := 0
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-Query", r.URL.RawQuery)
+		w.Write([]byte(fmt.Sprintf("value %d", calls)))
+	})
+
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithRefreshKey("rk"),
+		ClientWithCacheStatusHeader("X-Cache"),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	tests := []struct {
+		name      string
+		url       string
+		want      string
+		wantCache string
+	}{
+		{
+			"stores response",
+			"http://foo.bar/refresh?a=1&b=2",
+			"value 1",
+			"MISS",
+		},
+		{
+			"refreshes response",
+			"http://foo.bar/refresh?a=1&rk=1&b=2",
+			"value 2",
+			"BYPASS",
+		},
+		{
+			"serves refreshed response",
+			"http://foo.bar/refresh?a=1&b=2",
+			"value 2",
+			"HIT",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("*Client.Middleware() = %v, want %v", got, tt.want)
+			}
+			if got := w.Header().Get("X-Cache"); got != tt.wantCache {
+				t.Errorf("*Client.Middleware() X-Cache = %v, want %v", got, tt.wantCache)
+			}
+			if got := w.Header().Get("X-Query"); got != "a=1&b=2" {
+				t.Errorf("*Client.Middleware() handler query = %v, want a=1&b=2", got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRefreshKeyValue(t *testing.T) {
+	calls := 0
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(fmt.Sprintf("value %d", calls)))
+	})
+
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithRefreshKeyValue("rk", "secret"),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			"stores response",
+			"http://foo.bar/refresh",
+			"value 1",
+		},
+		{
+			"ignores refresh key without value",
+			"http://foo.bar/refresh?rk",
+			"value 1",
+		},
+		{
+			"ignores refresh key with wrong value",
+			"http://foo.bar/refresh?rk=guess",
+			"value 1",
+		},
+		{
+			"refreshes with secret value",
+			"http://foo.bar/refresh?rk=secret",
+			"value 2",
+		},
+		{
+			"serves refreshed response",
+			"http://foo.bar/refresh",
+			"value 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("*Client.Middleware() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(1*time.Minute), ClientWithRefreshKeyValue("rk", "")); err == nil {
+		t.Error("NewClient() with empty refresh secret error = nil, want error")
+	}
+}
+
+func TestMiddlewareAge(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("value"))
+	})
+
+	adapter := &adapterMock{
+		store: map[string]map[string][]byte{
+			"/aged": {
+				generateKey("http://foo.bar/aged"): Response{
+					Value:      []byte("value"),
+					Expiration: time.Now().Add(1 * time.Minute),
+					CachedAt:   time.Now().Add(-30 * time.Second),
+				}.Bytes(),
+			},
+			"/legacy": {
+				generateKey("http://foo.bar/legacy"): Response{
+					Value:      []byte("value"),
+					Expiration: time.Now().Add(1 * time.Minute),
+				}.Bytes(),
+			},
+		},
+	}
+
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	tests := []struct {
+		name string
+		url  string
+		want []string
+	}{
+		{
+			"sets age on cached response",
+			"http://foo.bar/aged",
+			[]string{"30"},
+		},
+		{
+			"omits age when storage date is unknown",
+			"http://foo.bar/legacy",
+			nil,
+		},
+		{
+			"omits age on origin response",
+			"http://foo.bar/fresh",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if got := w.Header()["Age"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("*Client.Middleware() Age = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareSetCookie(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		cacheSetCookie bool
+		wantCalls      int
+	}{
+		{
+			"does not cache responses setting cookies",
+			"http://foo.bar/login",
+			false,
+			2,
+		},
+		{
+			"caches responses without cookies",
+			"http://foo.bar/home",
+			false,
+			1,
+		},
+		{
+			"caches responses setting cookies when allowed",
+			"http://foo.bar/login",
+			true,
+			1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if r.URL.Path == "/login" {
+					http.SetCookie(w, &http.Cookie{Name: "session", Value: fmt.Sprint(calls)})
+				}
+				w.Write([]byte("value"))
+			})
+
+			client, _ := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithCacheSetCookie(tt.cacheSetCookie),
+			)
+			handler := client.Middleware(httpTestHandler)
+
+			for i := 0; i < 2; i++ {
+				r, _ := http.NewRequest("GET", tt.url, nil)
+				handler.ServeHTTP(httptest.NewRecorder(), r)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("*Client.Middleware() origin calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestMiddlewareAuthorization(t *testing.T) {
+	tests := []struct {
+		name            string
+		cacheAuthorized bool
+		authorization   []string
+		wantCalls       int
+	}{
+		{
+			"does not cache authorized requests",
+			false,
+			[]string{"Bearer a", "Bearer a", ""},
+			3,
+		},
+		{
+			"caches authorized requests per principal when allowed",
+			true,
+			[]string{"Bearer a", "Bearer a", "Bearer b", ""},
+			3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Write([]byte(r.Header.Get("Authorization")))
+			})
+
+			client, _ := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithCacheAuthorizedRequests(tt.cacheAuthorized),
+			)
+			handler := client.Middleware(httpTestHandler)
+
+			for _, auth := range tt.authorization {
+				r, _ := http.NewRequest("GET", "http://foo.bar/private", nil)
+				if auth != "" {
+					r.Header.Set("Authorization", auth)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Body.String() != auth {
+					t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), auth)
+				}
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("*Client.Middleware() origin calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestMiddlewareKeyGenerator(t *testing.T) {
+	calls := 0
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(r.Header.Get("X-Tenant")))
+	})
+
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithKeyGenerator(func(r *http.Request) (string, string) {
+			return r.URL.Path, r.Header.Get("X-Tenant")
+		}),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	tests := []struct {
+		name      string
+		url       string
+		tenant    string
+		wantCalls int
+	}{
+		{
+			"stores by generated key",
+			"http://foo.bar/tenant?utm_source=a",
+			"a",
+			1,
+		},
+		{
+			"serves by generated key",
+			"http://foo.bar/tenant?utm_source=b",
+			"a",
+			1,
+		},
+		{
+			"stores other generated key",
+			"http://foo.bar/tenant",
+			"b",
+			2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", tt.url, nil)
+			r.Header.Set("X-Tenant", tt.tenant)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Body.String() != tt.tenant {
+				t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), tt.tenant)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("*Client.Middleware() origin calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+
+	r, _ := http.NewRequest("GET", "http://foo.bar/tenant", nil)
+	r.Header.Set("X-Tenant", "a")
+	client.ReleaseRequest(r)
+	if adapter.Exists("/tenant", "a") {
+		t.Error("*Client.ReleaseRequest() error; key a should not be found")
+	}
+	if !adapter.Exists("/tenant", "b") {
+		t.Error("*Client.ReleaseRequest() error; key b should be found")
+	}
+}
+
+func TestMiddlewarePrefixFunc(t *testing.T) {
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithPrefixFunc(func(r *http.Request) string {
+			if strings.HasPrefix(r.URL.Path, "/users/") {
+				return "/users/{id}"
+			}
+			return ""
+		}),
+	)
+	calls := 0
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(r.URL.Path))
+	}))
+	serve := func(path string) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Body.String() != path {
+			t.Errorf("*Client.Middleware() body = %v, want %v", w.Body.String(), path)
+		}
+	}
+
+	for _, path := range []string{"/users/1", "/users/2", "/users/1", "/users/2", "/groups/1"} {
+		serve(path)
+	}
+	if calls != 3 {
+		t.Errorf("handler calls = %v, want 3", calls)
+	}
+	if n := len(adapter.store["/users/{id}"]); n != 2 {
+		t.Errorf("*Client.Middleware() cached %v responses by the route prefix, want 2", n)
+	}
+	if n := len(adapter.store["/groups/1"]); n != 1 {
+		t.Errorf("*Client.Middleware() cached %v responses by the path, want 1", n)
+	}
+
+	if n, _ := client.ReleaseURI("/users/{id}"); n != 2 {
+		t.Errorf("*Client.ReleaseURI() = %v, want 2", n)
+	}
+	serve("/users/1")
+	if calls != 4 {
+		t.Errorf("handler calls = %v, want 4", calls)
+	}
+	if !client.Exists("/users/1") {
+		t.Error("*Client.Exists() of a response cached by the route prefix = false, want true")
+	}
+	if n, _ := client.Release("/users/1"); n != 1 {
+		t.Errorf("*Client.Release() of a response cached by the route prefix = %v, want 1", n)
+	}
+
+	if _, err := NewClient(ClientWithAdapter(adapter), ClientWithTTL(time.Minute), ClientWithPrefixFunc(nil)); err == nil {
+		t.Error("ClientWithPrefixFunc(nil) error = nil, want an error")
+	}
+}
+
+func TestMiddlewareIgnoredQueryParams(t *testing.T) {
+	calls := 0
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(r.URL.RawQuery))
+	})
+
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithRefreshKey("rk"),
+		ClientWithIgnoredQueryParams("utm_*", "fbclid"),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	tests := []struct {
+		name      string
+		url       string
+		wantBody  string
+		wantCalls int
+	}{
+		{
+			"handler sees ignored params",
+			"http://foo.bar/page?id=1&utm_source=a&fbclid=x",
+			"id=1&utm_source=a&fbclid=x",
+			1,
+		},
+		{
+			"ignored params do not change the key",
+			"http://foo.bar/page?utm_campaign=b&id=1",
+			"id=1&utm_source=a&fbclid=x",
+			1,
+		},
+		{
+			"other params change the key",
+			"http://foo.bar/page?id=2&utm_source=a",
+			"id=2&utm_source=a",
+			2,
+		},
+		{
+			"refresh key releases the filtered key",
+			"http://foo.bar/page?id=1&rk=1&utm_source=c",
+			"id=1&utm_source=c",
+			3,
+		},
+		{
+			"serves the refreshed response",
+			"http://foo.bar/page?id=1",
+			"id=1&utm_source=c",
+			3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), tt.wantBody)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("*Client.Middleware() origin calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+
+	if _, err := NewClient(ClientWithIgnoredQueryParams("[")); err == nil {
+		t.Error("ClientWithIgnoredQueryParams() error = nil, want error on bad pattern")
+	}
+}
+
+func TestMiddlewareHostInKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		hostInKey bool
+		want      []string
+	}{
+		{
+			"hosts share responses by default",
+			false,
+			[]string{"a.example.com", "a.example.com", "a.example.com"},
+		},
+		{
+			"hosts have their own responses",
+			true,
+			[]string{"a.example.com", "b.example.com", "a.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Host))
+			})
+
+			client, _ := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithHostInKey(tt.hostInKey),
+			)
+			handler := client.Middleware(httpTestHandler)
+
+			for i, host := range []string{"a.example.com", "b.example.com", "a.example.com"} {
+				r := httptest.NewRequest("GET", "/index", nil)
+				r.Host = host
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Body.String() != tt.want[i] {
+					t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), tt.want[i])
+				}
+			}
+
+			if !tt.hostInKey {
+				return
+			}
+			client.Release("http://a.example.com/index")
+			if client.Exists("https://a.example.com/index") {
+				t.Error("*Client.Release() error; host a.example.com should not be found")
+			}
+			if !client.Exists("http://b.example.com/index") {
+				t.Error("*Client.Release() error; host b.example.com should be found")
+			}
+		})
+	}
+}
+
+func TestMiddlewareTTLFunc(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		cacheControl string
+		wantStored   bool
+		wantTTL      time.Duration
+	}{
+		{
+			"uses route ttl",
+			"http://foo.bar/api/prices",
+			"",
+			true,
+			5 * time.Second,
+		},
+		{
+			"uses client ttl through the function",
+			"http://foo.bar/api/config",
+			"",
+			true,
+			time.Hour,
+		},
+		{
+			"max-age takes precedence over route ttl",
+			"http://foo.bar/api/prices",
+			"max-age=10",
+			true,
+			10 * time.Second,
+		},
+		{
+			"does not cache zero route ttl",
+			"http://foo.bar/api/live",
+			"max-age=10",
+			false,
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.cacheControl != "" {
+					w.Header().Set("Cache-Control", tt.cacheControl)
+				}
+				w.Write([]byte("value"))
+			})
+
+			adapter := &adapterMock{}
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Hour),
+				ClientWithRespectMaxAge(true),
+				ClientWithTTLFunc(func(r *http.Request) time.Duration {
+					switch r.URL.Path {
+					case "/api/prices":
+						return 5 * time.Second
+					case "/api/live":
+						return 0
+					}
+					return time.Hour
+				}),
+			)
+
+			r, _ := http.NewRequest("GET", tt.url, nil)
+			start := time.Now()
+			client.Middleware(httpTestHandler).ServeHTTP(httptest.NewRecorder(), r)
+
+			prefix, key := client.GeneratePrefixAndKey(r)
+			b, ok := adapter.Get(prefix, key)
+			if ok != tt.wantStored {
+				t.Errorf("*Client.Middleware() stored = %v, want %v", ok, tt.wantStored)
+				return
+			}
+			if !ok {
+				return
+			}
+			response, _ := BytesToResponse(b)
+			if ttl := response.Expiration.Sub(start); ttl < tt.wantTTL || ttl > tt.wantTTL+time.Second {
+				t.Errorf("*Client.Middleware() ttl = %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestMiddlewareSkipFunc(t *testing.T) {
+	calls := 0
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(fmt.Sprint(calls)))
+	})
+
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithCacheStatusHeader("X-Cache"),
+		ClientWithSkipFunc(func(r *http.Request) bool {
+			return r.Header.Get("X-Debug") != ""
+		}),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	tests := []struct {
+		name       string
+		debug      bool
+		wantBody   string
+		wantStatus string
+	}{
+		{
+			"skipped request is not stored",
+			true,
+			"1",
+			"BYPASS",
+		},
+		{
+			"request is stored",
+			false,
+			"2",
+			"MISS",
+		},
+		{
+			"skipped request is not served from cache",
+			true,
+			"3",
+			"BYPASS",
+		},
+		{
+			"request is served from cache",
+			false,
+			"2",
+			"HIT",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "http://foo.bar/skip", nil)
+			if tt.debug {
+				r.Header.Set("X-Debug", "1")
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), tt.wantBody)
+			}
+			if got := w.Header().Get("X-Cache"); got != tt.wantStatus {
+				t.Errorf("*Client.Middleware() X-Cache = %v, want %v", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestMiddlewareCacheableStatusCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []ClientOption
+		statusCode int
+		wantStored bool
+		wantTTL    time.Duration
+	}{
+		{
+			"caches status below 400 by default",
+			nil,
+			http.StatusMovedPermanently,
+			true,
+			time.Minute,
+		},
+		{
+			"does not cache not found by default",
+			nil,
+			http.StatusNotFound,
+			false,
+			0,
+		},
+		{
+			"does not cache status outside the set",
+			[]ClientOption{ClientWithCacheableStatusCodes(200, 404)},
+			http.StatusMovedPermanently,
+			false,
+			0,
+		},
+		{
+			"caches status in the set",
+			[]ClientOption{ClientWithCacheableStatusCodes(200, 404)},
+			http.StatusNotFound,
+			true,
+			time.Minute,
+		},
+		{
+			"caches status with its own ttl",
+			[]ClientOption{ClientWithCacheableStatusCodes(200, 404), ClientWithStatusCodeTTL(404, 10*time.Second)},
+			http.StatusNotFound,
+			true,
+			10 * time.Second,
+		},
+		{
+			"caches not found with the negative ttl",
+			[]ClientOption{ClientWithNegativeCache(10 * time.Second)},
+			http.StatusNotFound,
+			true,
+			10 * time.Second,
+		},
+		{
+			"caches the given negative status codes",
+			[]ClientOption{ClientWithNegativeCache(10*time.Second, 410, 451)},
+			http.StatusGone,
+			true,
+			10 * time.Second,
+		},
+		{
+			"does not cache server errors with the negative cache",
+			[]ClientOption{ClientWithNegativeCache(10 * time.Second)},
+			http.StatusInternalServerError,
+			false,
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte("value"))
+			})
+
+			adapter := &adapterMock{}
+			opts := append([]ClientOption{ClientWithAdapter(adapter), ClientWithTTL(1 * time.Minute)}, tt.opts...)
+			client, _ := NewClient(opts...)
+
+			r, _ := http.NewRequest("GET", "http://foo.bar/status-code", nil)
+			start := time.Now()
+			w := httptest.NewRecorder()
+			client.Middleware(httpTestHandler).ServeHTTP(w, r)
+			if w.Code != tt.statusCode || w.Body.String() != "value" {
+				t.Errorf("*Client.Middleware() = %v %v, want %v %v", w.Code, w.Body.String(), tt.statusCode, "value")
+			}
+
+			b, ok := adapter.Get("/status-code", generateKey("http://foo.bar/status-code"))
+			if ok != tt.wantStored {
+				t.Errorf("*Client.Middleware() stored = %v, want %v", ok, tt.wantStored)
+				return
+			}
+			if !ok {
+				return
+			}
+			response, _ := BytesToResponse(b)
+			if ttl := response.Expiration.Sub(start); ttl < tt.wantTTL || ttl > tt.wantTTL+time.Second {
+				t.Errorf("*Client.Middleware() ttl = %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+
+	if _, err := NewClient(ClientWithCacheableStatusCodes(1000)); err == nil {
+		t.Error("ClientWithCacheableStatusCodes() error = nil, want error on invalid status code")
+	}
+	if _, err := NewClient(ClientWithNegativeCache(time.Second, 200)); err == nil {
+		t.Error("ClientWithNegativeCache() error = nil, want error on a success status code")
+	}
+	if _, err := NewClient(ClientWithNegativeCache(0)); err == nil {
+		t.Error("ClientWithNegativeCache() error = nil, want error on a zero ttl")
+	}
 }
 
-func (a *adapterMock) Get(key string) ([]byte, bool) {
-	a.Lock()
-	defer a.Unlock()
-	if _, ok := a.store[key]; ok {
-		return a.store[key], true
+func TestMiddlewareNegativeCache(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithNegativeCache(10*time.Second),
+		ClientWithRefreshKey("rk"),
+	)
+	calls := 0
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.NotFound(w, r)
+	}))
+
+	for i, tt := range []struct {
+		url       string
+		wantCalls int
+	}{
+		{"http://foo.bar/missing", 1},
+		{"http://foo.bar/missing", 1},
+		{"http://foo.bar/missing?rk=true", 2},
+		{"http://foo.bar/missing", 2},
+	} {
+		r, _ := http.NewRequest("GET", tt.url, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("request %d: *Client.Middleware() code = %v, want %v", i, w.Code, http.StatusNotFound)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("request %d: handler calls = %v, want %v", i, calls, tt.wantCalls)
+		}
 	}
-	return nil, false
 }
 
-func (a *adapterMock) Set(key string, response []byte, expiration time.Time) {
-	a.Lock()
-	defer a.Unlock()
-	a.store[key] = response
+type ttlAdapter struct {
+	adapterMock
+	ttl time.Duration
 }
 
-func (a *adapterMock) Release(key string) {
-	a.Lock()
-	defer a.Unlock()
-	delete(a.store, key)
+func (a *ttlAdapter) SetWithTTL(prefix, key string, response []byte, ttl time.Duration) {
+	a.ttl = ttl
+	a.adapterMock.Set(prefix, key, response)
 }
 
-func TestMiddleware(t *testing.T) {
-	counter := 0
+func TestMiddlewareSetWithTTL(t *testing.T) {
 	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(fmt.Sprintf("new value %v", counter)))
+		w.Header().Set("Cache-Control", "max-age=10")
+		w.Write([]byte("value"))
 	})
 
-	adapter := &adapterMock{
-		store: map[string][]byte{
-			"14974843192121052621": Response{
-				Value:      []byte("value 1"),
-				Expiration: time.Now().Add(1 * time.Minute),
-			}.Bytes(),
-			"14974839893586167988": Response{
-				Value:      []byte("value 2"),
-				Expiration: time.Now().Add(1 * time.Minute),
-			}.Bytes(),
-			"14974840993097796199": Response{
-				Value:      []byte("value 3"),
-				Expiration: time.Now().Add(-1 * time.Minute),
-			}.Bytes(),
-		},
-	}
-
+	adapter := &ttlAdapter{}
 	client, _ := NewClient(
 		ClientWithAdapter(adapter),
 		ClientWithTTL(1*time.Minute),
-		ClientWithRefreshKey("rk"),
+		ClientWithRespectMaxAge(true),
 	)
 
-	handler := client.Middleware(httpTestHandler)
+	r, _ := http.NewRequest("GET", "http://foo.bar/ttl", nil)
+	client.Middleware(httpTestHandler).ServeHTTP(httptest.NewRecorder(), r)
+
+	if adapter.ttl <= 9*time.Second || adapter.ttl > 10*time.Second {
+		t.Errorf("*Client.Middleware() ttl = %v, want %v", adapter.ttl, 10*time.Second)
+	}
+}
+
+// blockingAdapter hides any optional capability of the wrapped adapter
+// and reports every Set.
+type blockingAdapter struct {
+	Adapter
+	sets    chan string
+	touches chan string
+}
+
+func (a *blockingAdapter) Set(prefix, key string, response []byte) {
+	if a.sets != nil {
+		a.sets <- key
+	}
+	a.Adapter.Set(prefix, key, response)
+}
+
+type touchingAdapter struct {
+	blockingAdapter
+}
+
+func (a *touchingAdapter) Touch(prefix, key string) {
+	a.touches <- key
+}
+
+func TestMiddlewareAccessTracking(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new value"))
+	})
+	key := generateKey("http://foo.bar/tracked")
+	entry := Response{
+		Value:      []byte("value"),
+		Expiration: time.Now().Add(1 * time.Minute),
+		Frequency:  1,
+	}.Bytes()
 
 	tests := []struct {
 		name     string
-		url      string
-		method   string
-		wantBody string
-		wantCode int
+		adapter  Adapter
+		tracking bool
+		wantSet  bool
 	}{
 		{
-			"returns cached response",
-			"http://foo.bar/test-1",
-			"GET",
-			"value 1",
-			200,
-		},
-		{
-			"returns new response",
-			"http://foo.bar/test-2",
-			"POST",
-			"new value 2",
-			200,
-		},
-		{
-			"returns cached response",
-			"http://foo.bar/test-2",
-			"GET",
-			"value 2",
-			200,
-		},
-		{
-			"returns new response",
-			"http://foo.bar/test-3?zaz=baz&baz=zaz",
-			"GET",
-			"new value 4",
-			200,
-		},
-		{
-			"returns cached response",
-			"http://foo.bar/test-3?baz=zaz&zaz=baz",
-			"GET",
-			"new value 4",
-			200,
-		},
-		{
-			"cache expired",
-			"http://foo.bar/test-3",
-			"GET",
-			"new value 6",
-			200,
+			"does not rewrite the entry",
+			&blockingAdapter{sets: make(chan string)},
+			true,
+			false,
 		},
 		{
-			"releases cached response and returns new response",
-			"http://foo.bar/test-2?rk=true",
-			"GET",
-			"new value 7",
-			200,
+			"touches the entry when supported",
+			&touchingAdapter{blockingAdapter{sets: make(chan string), touches: make(chan string, 1)}},
+			true,
+			false,
 		},
 		{
-			"returns new cached response",
-			"http://foo.bar/test-2",
-			"GET",
-			"new value 7",
-			200,
+			"does not track access when disabled",
+			&blockingAdapter{sets: make(chan string)},
+			false,
+			false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			counter++
+			store := &adapterMock{store: map[string]map[string][]byte{"/tracked": {key: entry}}}
+			var sets chan string
+			var touches chan string
+			switch a := tt.adapter.(type) {
+			case *blockingAdapter:
+				a.Adapter = store
+				sets = a.sets
+			case *touchingAdapter:
+				a.Adapter = store
+				sets, touches = a.sets, a.touches
+			}
 
-			r, err := http.NewRequest(tt.method, tt.url, nil)
-			if err != nil {
-				t.Error(err)
-				return
+			client, _ := NewClient(
+				ClientWithAdapter(tt.adapter),
+				ClientWithTTL(1*time.Minute),
+				ClientWithAccessTracking(tt.tracking),
+			)
+
+			r, _ := http.NewRequest("GET", "http://foo.bar/tracked", nil)
+			w := httptest.NewRecorder()
+			client.Middleware(httpTestHandler).ServeHTTP(w, r)
+			if w.Body.String() != "value" {
+				t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), "value")
+			}
+
+			select {
+			case <-sets:
+				if !tt.wantSet {
+					t.Error("*Client.Middleware() rewrote the entry")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantSet {
+					t.Error("*Client.Middleware() did not rewrite the entry")
+				}
+			}
+			if touches != nil {
+				select {
+				case <-touches:
+				case <-time.After(100 * time.Millisecond):
+					t.Error("*Client.Middleware() did not touch the entry")
+				}
 			}
+		})
+	}
+}
+
+func TestMiddlewareReleaseDuringHits(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new value"))
+	})
+	key := generateKey("http://foo.bar/released")
+	store := &adapterMock{store: map[string]map[string][]byte{"/released": {key: Response{
+		Value:      []byte("value"),
+		Expiration: time.Now().Add(1 * time.Minute),
+	}.Bytes()}}}
+	// holds any write of the hits until the release is done
+	adapter := &blockingAdapter{Adapter: store, sets: make(chan string)}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithAccessTracking(true),
+	)
+	handler := client.Middleware(httpTestHandler)
 
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _ := http.NewRequest("GET", "http://foo.bar/released", nil)
 			w := httptest.NewRecorder()
 			handler.ServeHTTP(w, r)
+			if w.Body.String() != "value" {
+				t.Errorf("*Client.Middleware() = %v, want value", w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
 
-			if !reflect.DeepEqual(w.Code, tt.wantCode) {
-				t.Errorf("*Client.Middleware() = %v, want %v", w.Code, tt.wantCode)
-				return
+	if n, err := client.ReleaseURI("/released"); n != 1 || err != nil {
+		t.Fatalf("*Client.ReleaseURI() = %v, %v, want 1, nil", n, err)
+	}
+	for done := false; !done; {
+		select {
+		case <-adapter.sets:
+		case <-time.After(100 * time.Millisecond):
+			done = true
+		}
+	}
+	if store.Exists("/released", key) {
+		t.Error("*Client.Middleware() brought a released entry back")
+	}
+}
+
+func TestClientRelease(t *testing.T) {
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("value"))
+	}))
+	r, _ := http.NewRequest("GET", "http://foo.bar/release?a=1", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	tests := []struct {
+		name    string
+		release func() (int, error)
+		want    int
+	}{
+		{"releases a non-existent key", func() (int, error) { return client.Release("http://foo.bar/release?a=2") }, 0},
+		{"releases a cached response", func() (int, error) { return client.Release("http://foo.bar/release?a=1") }, 1},
+		{"releases it again", func() (int, error) { return client.Release("http://foo.bar/release?a=1") }, 0},
+		{"releases an empty prefix", func() (int, error) { return client.ReleaseURI("/release") }, 0},
+		{"rejects an invalid URI", func() (int, error) { return client.Release("%") }, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := tt.release()
+			if got != tt.want {
+				t.Errorf("*Client release = %v, want %v", got, tt.want)
 			}
-			if !reflect.DeepEqual(w.Body.String(), tt.wantBody) {
-				t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), tt.wantBody)
+		})
+	}
+	if _, err := client.Release("%"); err == nil {
+		t.Error("*Client.Release() with an invalid URI returned no error")
+	}
+}
+
+// flusherMock is an adapterMock implementing the Flusher interface.
+type flusherMock struct {
+	adapterMock
+}
+
+func (a *flusherMock) Flush() (int, error) {
+	a.Lock()
+	defer a.Unlock()
+	n := 0
+	for _, entries := range a.store {
+		n += len(entries)
+	}
+	a.store = nil
+	return n, nil
+}
+
+func TestClientReleaseAll(t *testing.T) {
+	tests := []struct {
+		name    string
+		adapter Adapter
+		want    int
+	}{
+		{"flushes the adapter", &flusherMock{}, 2},
+		{"releases through ReleaseIfStartsWith", &adapterMock{}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := NewClient(
+				ClientWithAdapter(tt.adapter),
+				ClientWithTTL(1*time.Minute),
+			)
+			tt.adapter.Set("/a", "1", []byte("1"))
+			tt.adapter.Set("/b", "2", []byte("2"))
+
+			got, err := client.ReleaseAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("*Client.ReleaseAll() = %v, want %v", got, tt.want)
+			}
+			if tt.adapter.Exists("/a", "1") || tt.adapter.Exists("/b", "2") {
+				t.Error("*Client.ReleaseAll() left cached responses")
 			}
 		})
 	}
@@ -163,22 +1770,41 @@ func TestBytesToResponse(t *testing.T) {
 		Frequency:  0,
 		LastAccess: time.Time{},
 	}
+	b := r.Bytes()
 
 	tests := []struct {
 		name      string
 		b         []byte
 		wantValue string
+		wantErr   bool
 	}{
 
 		{
 			"convert bytes array to response",
-			r.Bytes(),
+			b,
 			"value 1",
+			false,
+		},
+		{
+			"returns error on truncated bytes array",
+			b[:len(b)/2],
+			"",
+			true,
+		},
+		{
+			"returns error on empty bytes array",
+			nil,
+			"",
+			true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := BytesToResponse(tt.b)
+			got, err := BytesToResponse(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("BytesToResponse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
 			if string(got.Value) != tt.wantValue {
 				t.Errorf("BytesToResponse() Value = %v, want %v", got, tt.wantValue)
 				return
@@ -187,6 +1813,124 @@ func TestBytesToResponse(t *testing.T) {
 	}
 }
 
+func TestMiddlewareCorruptEntry(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new value"))
+	})
+
+	key := generateKey("http://foo.bar/corrupt")
+	adapter := &adapterMock{
+		store: map[string]map[string][]byte{
+			"/corrupt": {
+				key: []byte("corrupt"),
+			},
+		},
+	}
+
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+	)
+
+	r, _ := http.NewRequest("GET", "http://foo.bar/corrupt", nil)
+	w := httptest.NewRecorder()
+	client.Middleware(httpTestHandler).ServeHTTP(w, r)
+
+	if w.Body.String() != "new value" {
+		t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), "new value")
+	}
+	b, ok := adapter.Get("/corrupt", key)
+	if !ok {
+		t.Fatal("*Client.Middleware() did not store the new response")
+	}
+	if _, err := BytesToResponse(b); err != nil {
+		t.Errorf("*Client.Middleware() stored a corrupt response: %v", err)
+	}
+}
+
+func TestMiddlewareContentLength(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		body       string
+		wantLength int64
+	}{
+		{"sets the length of large bodies", http.StatusOK, http.Header{}, strings.Repeat("a", 64<<10), 64 << 10},
+		{"replaces a stale stored length", http.StatusOK, http.Header{"Content-Length": []string{"3"}}, "value", 5},
+		{"leaves it out of bodiless responses", http.StatusNoContent, http.Header{}, "", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(1*time.Minute))
+			server := httptest.NewServer(client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("handler called, want a hit")
+			})))
+			defer server.Close()
+			r := httptest.NewRequest("GET", "/length", nil)
+			if err := client.Store(r, &http.Response{StatusCode: tt.status, Header: tt.header}, []byte(tt.body)); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := http.Get(server.URL + "/length")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if len(resp.TransferEncoding) > 0 {
+				t.Errorf("*Client.Middleware() Transfer-Encoding = %v, want none", resp.TransferEncoding)
+			}
+			if tt.wantLength >= 0 && resp.ContentLength != tt.wantLength {
+				t.Errorf("*Client.Middleware() Content-Length = %v, want %v", resp.ContentLength, tt.wantLength)
+			}
+			if tt.wantLength < 0 && resp.Header.Get("Content-Length") != "" {
+				t.Errorf("*Client.Middleware() Content-Length = %v, want none", resp.Header.Get("Content-Length"))
+			}
+		})
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ClientOption
+		p    interface{}
+	}{
+		{"drops the partial response", nil, "handler failed"},
+		{"drops the coalesced partial response", []ClientOption{ClientWithRequestCoalescing(true)}, "handler failed"},
+		{"drops aborted responses", nil, http.ErrAbortHandler},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			collector := &collectorMock{events: make(map[string]int)}
+			opts := append([]ClientOption{ClientWithAdapter(adapter), ClientWithTTL(1 * time.Minute), ClientWithMetrics(collector)}, tt.opts...)
+			client, _ := NewClient(opts...)
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("partial"))
+				panic(tt.p)
+			}))
+
+			func() {
+				defer func() {
+					if p := recover(); p != tt.p {
+						t.Errorf("*Client.Middleware() panic = %v, want %v", p, tt.p)
+					}
+				}()
+				r, _ := http.NewRequest("GET", "http://foo.bar/panic", nil)
+				handler.ServeHTTP(httptest.NewRecorder(), r)
+			}()
+
+			if _, ok := adapter.Get("/panic", generateKey("http://foo.bar/panic")); ok {
+				t.Error("*Client.Middleware() cached the response of a panicking handler")
+			}
+			if skips := collector.events["skip /panic"]; skips != 1 {
+				t.Errorf("*Client.Middleware() store skips = %v, want 1", skips)
+			}
+		})
+	}
+}
+
 func TestResponseToBytes(t *testing.T) {
 	r := Response{
 		Value:      nil,
@@ -206,8 +1950,7 @@ func TestResponseToBytes(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			b := tt.response.Bytes()
-			if b == nil || len(b) == 0 {
+			if b := tt.response.Bytes(); len(b) == 0 {
 				t.Error("Bytes() failed to convert")
 				return
 			}
@@ -289,6 +2032,14 @@ func TestNewClient(t *testing.T) {
 				adapter:    adapter,
 				ttl:        1 * time.Millisecond,
 				refreshKey: "",
+				log:        log.StandardLogger(),
+
+				accessTracking: true,
+				metrics:        nopCollector{},
+				stats:          &stats{},
+				bodyLimit:      defaultBodyLimit,
+				closeTimeout:   defaultCloseTimeout,
+				codec:          FrameCodec{},
 			},
 			false,
 		},
@@ -303,6 +2054,14 @@ func TestNewClient(t *testing.T) {
 				adapter:    adapter,
 				ttl:        1 * time.Millisecond,
 				refreshKey: "rk",
+				log:        log.StandardLogger(),
+
+				accessTracking: true,
+				metrics:        nopCollector{},
+				stats:          &stats{},
+				bodyLimit:      defaultBodyLimit,
+				closeTimeout:   defaultCloseTimeout,
+				codec:          FrameCodec{},
 			},
 			false,
 		},
@@ -341,6 +2100,10 @@ func TestNewClient(t *testing.T) {
 				t.Errorf("NewClient() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if got != nil {
+				// the client context cannot be compared
+				got.ctx, got.cancel = nil, nil
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewClient() = %v, want %v", got, tt.want)
 			}
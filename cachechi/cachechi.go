@@ -0,0 +1,63 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package cachechi caches the responses of chi handlers with a cache client.
+package cachechi
+
+import (
+	"net/http"
+	"strings"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/go-chi/chi/v5"
+)
+
+// Middleware returns a chi middleware caching the responses of the
+// handlers after it with the client. The responses are grouped by the
+// matched route pattern, e.g. /users/{id}, rather than by the request path.
+// chi only knows the pattern once the request is routed, so the middleware
+// is meant for the routes, e.g. through With or Group; before routing, e.g.
+// with Use on a router, the responses are grouped by the request path.
+func Middleware(client *cache.Client) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		cached := client.Middleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := routePattern(r); route != "" {
+				r = r.WithContext(cache.WithPrefix(r.Context(), route))
+			}
+			cached.ServeHTTP(w, r)
+		})
+	}
+}
+
+// routePattern returns the route pattern matched by the request, or an
+// empty string when it is not routed yet, in which case the pattern is
+// either empty or ends with the wildcard of a mounted router.
+func routePattern(r *http.Request) string {
+	route := chi.RouteContext(r.Context()).RoutePattern()
+	if strings.HasSuffix(route, "*") {
+		return ""
+	}
+	return route
+}
@@ -0,0 +1,83 @@
+package cachechi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/memory"
+	"github.com/go-chi/chi/v5"
+)
+
+type prefixAdapter struct {
+	cache.Adapter
+	mu       sync.Mutex
+	prefixes []string
+}
+
+func (a *prefixAdapter) Set(prefix, key string, response []byte) {
+	a.mu.Lock()
+	a.prefixes = append(a.prefixes, prefix)
+	a.mu.Unlock()
+	a.Adapter.Set(prefix, key, response)
+}
+
+func TestMiddleware(t *testing.T) {
+	memoryAdapter, _ := memory.NewAdapter(memory.AdapterWithCapacity(10))
+	adapter := &prefixAdapter{Adapter: memoryAdapter}
+	client, err := cache.NewClient(
+		cache.ClientWithAdapter(adapter),
+		cache.ClientWithTTL(time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("user " + chi.URLParam(r, "id")))
+	}
+	router := chi.NewRouter()
+	router.With(Middleware(client)).Get("/users/{id}", handler)
+	router.Route("/api", func(r chi.Router) {
+		r.Use(Middleware(client))
+		r.Get("/users/{id}", handler)
+	})
+
+	tests := []struct {
+		name       string
+		url        string
+		wantCalls  int
+		wantBody   string
+		wantPrefix string
+	}{
+		{"caches the response", "/users/1", 1, "user 1", "/users/{id}"},
+		{"serves it from the cache", "/users/1", 1, "user 1", "/users/{id}"},
+		{"caches the other paths apart", "/users/2", 2, "user 2", "/users/{id}"},
+		{"falls back to the path before routing", "/api/users/1", 3, "user 1", "/api/users/1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if calls != tt.wantCalls {
+				t.Errorf("handler calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %v, want %v", got, tt.wantBody)
+			}
+			adapter.mu.Lock()
+			defer adapter.mu.Unlock()
+			if len(adapter.prefixes) == 0 {
+				t.Fatalf("no response stored")
+			}
+			if got := adapter.prefixes[len(adapter.prefixes)-1]; got != tt.wantPrefix {
+				t.Errorf("prefix = %v, want %v", got, tt.wantPrefix)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl holds the parsed directives of a Cache-Control header.
+// Directive names are lower-cased; directives without a value map to "".
+type cacheControl map[string]string
+
+// parseCacheControl parses every Cache-Control line of the given header.
+func parseCacheControl(h http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, line := range h["Cache-Control"] {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, value := part, ""
+			if i := strings.IndexByte(part, '='); i >= 0 {
+				name, value = part[:i], strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+	return cc
+}
+
+// has reports whether the directive is present.
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// maxAge returns the freshness lifetime given by s-maxage, or by max-age
+// when s-maxage is absent. Malformed values are ignored. Requests only use
+// max-age.
+func (cc cacheControl) maxAge() (time.Duration, bool) {
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		v, ok := cc[directive]
+		if !ok {
+			continue
+		}
+		if seconds, err := strconv.ParseInt(v, 10, 64); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// expiresTTL returns the freshness lifetime given by the Expires header,
+// counted from the Date header when valid, and whether the header is
+// present. Invalid and past dates give a zero lifetime.
+func expiresTTL(h http.Header) (time.Duration, bool) {
+	v, ok := h["Expires"]
+	if !ok || len(v) == 0 {
+		return 0, false
+	}
+	expires, err := http.ParseTime(strings.TrimSpace(v[0]))
+	if err != nil {
+		return 0, true
+	}
+	date, err := http.ParseTime(h.Get("Date"))
+	if err != nil {
+		date = time.Now()
+	}
+	if ttl := expires.Sub(date); ttl > 0 {
+		return ttl, true
+	}
+	return 0, true
+}
+
+// requestDirectives returns the Cache-Control directives of the request
+// when the client respects them, or none. Without a Cache-Control header,
+// Pragma: no-cache stands for no-cache.
+func (c *Client) requestDirectives(r *http.Request) cacheControl {
+	if !c.respectDirectives {
+		return nil
+	}
+	cc := parseCacheControl(r.Header)
+	if len(r.Header["Cache-Control"]) == 0 {
+		for _, v := range r.Header["Pragma"] {
+			if strings.EqualFold(strings.TrimSpace(v), "no-cache") {
+				cc["no-cache"] = ""
+			}
+		}
+	}
+	return cc
+}
+
+// ClientWithRespectClientDirectives makes the client honor the request
+// Cache-Control directives: no-cache takes the response from the handler
+// and stores it, no-store bypasses the cache, max-age=N does not serve
+// responses cached more than N seconds ago and only-if-cached answers
+// with 504 Gateway Timeout when no fresh response is cached. Off by
+// default, as it lets anyone bust the cache. Optional setting.
+func ClientWithRespectClientDirectives(respect bool) ClientOption {
+	return func(c *Client) error {
+		c.respectDirectives = respect
+		return nil
+	}
+}
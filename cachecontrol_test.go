@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   cacheControl
+	}{
+		{
+			"no header",
+			http.Header{},
+			cacheControl{},
+		},
+		{
+			"directives with and without values",
+			http.Header{"Cache-Control": {`Public, max-age=60, no-cache="Set-Cookie"`}},
+			cacheControl{"public": "", "max-age": "60", "no-cache": "Set-Cookie"},
+		},
+		{
+			"multiple header lines",
+			http.Header{"Cache-Control": {"no-store", " private ,"}},
+			cacheControl{"no-store": "", "private": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCacheControl(tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCacheControl() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheControlMaxAge(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		wantOk bool
+	}{
+		{
+			"no directives",
+			"public",
+			0,
+			false,
+		},
+		{
+			"max-age",
+			"max-age=60",
+			60 * time.Second,
+			true,
+		},
+		{
+			"s-maxage",
+			"s-maxage=30",
+			30 * time.Second,
+			true,
+		},
+		{
+			"s-maxage takes precedence over max-age",
+			"max-age=60, s-maxage=30",
+			30 * time.Second,
+			true,
+		},
+		{
+			"zero max-age",
+			"max-age=0",
+			0,
+			true,
+		},
+		{
+			"malformed s-maxage falls back to max-age",
+			"s-maxage=soon, max-age=60",
+			60 * time.Second,
+			true,
+		},
+		{
+			"malformed max-age",
+			"max-age=-1",
+			0,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := parseCacheControl(http.Header{"Cache-Control": {tt.header}})
+			got, ok := cc.maxAge()
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("cacheControl.maxAge() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestExpiresTTL(t *testing.T) {
+	date := time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		expires []string
+		want    time.Duration
+		wantOk  bool
+	}{
+		{"no header", nil, 0, false},
+		{"RFC 1123 date", []string{"Mon, 02 Jan 2006 15:05:05 GMT"}, time.Minute, true},
+		{"RFC 850 date", []string{"Monday, 02-Jan-06 15:05:05 GMT"}, time.Minute, true},
+		{"ANSI C date", []string{"Mon Jan  2 15:05:05 2006"}, time.Minute, true},
+		{"past date", []string{"Mon, 02 Jan 2006 15:03:05 GMT"}, 0, true},
+		{"malformed date", []string{"tomorrow"}, 0, true},
+		{"zero", []string{"0"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{"Date": {date.Format(http.TimeFormat)}}
+			if tt.expires != nil {
+				h["Expires"] = tt.expires
+			}
+			got, ok := expiresTTL(h)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("expiresTTL() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestMiddlewareExpires(t *testing.T) {
+	inMinutes := func(n int) string {
+		return time.Now().Add(time.Duration(n) * time.Minute).UTC().Format(http.TimeFormat)
+	}
+	tests := []struct {
+		name         string
+		cacheControl string
+		expires      string
+		wantStored   bool
+		wantTTL      time.Duration
+	}{
+		{"uses Expires", "", inMinutes(10), true, 10 * time.Minute},
+		{"prefers max-age over Expires", "max-age=60", inMinutes(10), true, time.Minute},
+		{"does not cache a past date", "", inMinutes(-10), false, 0},
+		{"does not cache a malformed date", "", "Thu, 31 Feb 2006", false, 0},
+		{"max-age overrides a past date", "max-age=60", inMinutes(-10), true, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(time.Hour),
+				ClientWithRespectMaxAge(true),
+			)
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.cacheControl != "" {
+					w.Header().Set("Cache-Control", tt.cacheControl)
+				}
+				w.Header().Set("Expires", tt.expires)
+				w.Write([]byte("value"))
+			}))
+
+			start := time.Now()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://foo.bar/expires", nil))
+
+			b, ok := adapter.Get("/expires", generateKey("http://foo.bar/expires"))
+			if ok != tt.wantStored {
+				t.Fatalf("*Client.Middleware() stored = %v, want %v", ok, tt.wantStored)
+			}
+			if !ok {
+				return
+			}
+			response, _ := BytesToResponse(b)
+			// Expires has a one second resolution
+			if ttl := response.Expiration.Sub(start); ttl < tt.wantTTL-time.Second || ttl > tt.wantTTL+time.Second {
+				t.Errorf("*Client.Middleware() ttl = %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestRespectClientDirectives(t *testing.T) {
+	tests := []struct {
+		name       string
+		respect    bool
+		header     http.Header
+		populate   bool
+		wantStatus int
+		wantBody   string
+		wantCached string
+	}{
+		{"ignores directives by default", false, http.Header{"Cache-Control": []string{"no-cache"}}, true, http.StatusOK, "value 1", "value 1"},
+		{"no-cache refreshes the cache", true, http.Header{"Cache-Control": []string{"no-cache"}}, true, http.StatusOK, "value 2", "value 2"},
+		{"Pragma no-cache refreshes the cache", true, http.Header{"Pragma": []string{"no-cache"}}, true, http.StatusOK, "value 2", "value 2"},
+		{"Cache-Control takes precedence over Pragma", true, http.Header{"Cache-Control": []string{"max-age=60"}, "Pragma": []string{"no-cache"}}, true, http.StatusOK, "value 1", "value 1"},
+		{"no-store bypasses the cache", true, http.Header{"Cache-Control": []string{"no-store"}}, true, http.StatusOK, "value 2", "value 1"},
+		{"max-age=0 skips cached responses", true, http.Header{"Cache-Control": []string{"max-age=0"}}, true, http.StatusOK, "value 2", "value 2"},
+		{"max-age serves recent responses", true, http.Header{"Cache-Control": []string{"max-age=60"}}, true, http.StatusOK, "value 1", "value 1"},
+		{"only-if-cached serves cached responses", true, http.Header{"Cache-Control": []string{"only-if-cached"}}, true, http.StatusOK, "value 1", "value 1"},
+		{"only-if-cached answers 504 on a miss", true, http.Header{"Cache-Control": []string{"only-if-cached"}}, false, http.StatusGatewayTimeout, "", "value 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithRespectClientDirectives(tt.respect),
+			)
+			calls := 0
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				fmt.Fprintf(w, "value %d", calls)
+			}))
+			serve := func(header http.Header) *httptest.ResponseRecorder {
+				r, _ := http.NewRequest("GET", "http://foo.bar/directives", nil)
+				r.Header = header
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				return w
+			}
+
+			if tt.populate {
+				serve(http.Header{})
+			}
+			w := serve(tt.header)
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Errorf("*Client.Middleware() = %v %q, want %v %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+			if got := serve(http.Header{}).Body.String(); got != tt.wantCached {
+				t.Errorf("*Client.Middleware() cached body = %q, want %q", got, tt.wantCached)
+			}
+		})
+	}
+}
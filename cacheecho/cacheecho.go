@@ -0,0 +1,64 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package cacheecho caches the responses of echo handlers with a cache client.
+package cacheecho
+
+import (
+	"net/http"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware returns an echo middleware caching the responses of the
+// handlers after it with the client. The responses are grouped by the
+// matched route pattern, e.g. /users/:id, rather than by the request path.
+// The errors returned by the handlers are written by the echo error handler
+// beforehand, so that error responses are cached like the others. The echo
+// context is reused once the request is over, so the responses are never
+// refreshed in the background: a stale response is refreshed by the
+// request itself.
+func Middleware(client *cache.Client) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+			r = r.WithContext(cache.WithoutBackgroundRefresh(r.Context()))
+			if route := c.Path(); route != "" {
+				r = r.WithContext(cache.WithPrefix(r.Context(), route))
+			}
+
+			response := c.Response()
+			defer c.SetResponse(response)
+			client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c.SetRequest(r)
+				c.SetResponse(echo.NewResponse(w, c.Echo()))
+				if err := next(c); err != nil {
+					c.Error(err)
+				}
+			})).ServeHTTP(response, r)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package cacheecho
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/memory"
+	"github.com/labstack/echo/v4"
+)
+
+type prefixAdapter struct {
+	cache.Adapter
+	mu       sync.Mutex
+	prefixes []string
+}
+
+func (a *prefixAdapter) Set(prefix, key string, response []byte) {
+	a.mu.Lock()
+	a.prefixes = append(a.prefixes, prefix)
+	a.mu.Unlock()
+	a.Adapter.Set(prefix, key, response)
+}
+
+func TestMiddleware(t *testing.T) {
+	memoryAdapter, _ := memory.NewAdapter(memory.AdapterWithCapacity(10))
+	adapter := &prefixAdapter{Adapter: memoryAdapter}
+	client, err := cache.NewClient(
+		cache.ClientWithAdapter(adapter),
+		cache.ClientWithTTL(time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	calls := 0
+	e := echo.New()
+	e.Use(Middleware(client))
+	e.GET("/users/:id", func(c echo.Context) error {
+		calls++
+		c.Response().Header().Set("X-User", c.Param("id"))
+		return c.String(http.StatusCreated, "user "+c.Param("id"))
+	})
+
+	tests := []struct {
+		name      string
+		url       string
+		wantCalls int
+		wantBody  string
+	}{
+		{"caches the response", "/users/1", 1, "user 1"},
+		{"serves it from the cache", "/users/1", 1, "user 1"},
+		{"caches the other paths apart", "/users/2", 2, "user 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if calls != tt.wantCalls {
+				t.Errorf("handler calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if w.Code != http.StatusCreated {
+				t.Errorf("status = %v, want %v", w.Code, http.StatusCreated)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %v, want %v", got, tt.wantBody)
+			}
+			if got := w.Header().Get("X-User"); got != tt.url[len("/users/"):] {
+				t.Errorf("X-User = %v, want %v", got, tt.url[len("/users/"):])
+			}
+		})
+	}
+
+	adapter.mu.Lock()
+	defer adapter.mu.Unlock()
+	if len(adapter.prefixes) == 0 {
+		t.Errorf("no response stored")
+	}
+	for _, prefix := range adapter.prefixes {
+		if prefix != "/users/:id" {
+			t.Errorf("prefix = %v, want /users/:id", prefix)
+		}
+	}
+}
+
+func TestMiddlewareStaleWhileRevalidate(t *testing.T) {
+	adapter, _ := memory.NewAdapter(memory.AdapterWithCapacity(10))
+	client, _ := cache.NewClient(
+		cache.ClientWithAdapter(adapter),
+		cache.ClientWithTTL(10*time.Millisecond),
+		cache.ClientWithStaleWhileRevalidate(time.Minute),
+		cache.ClientWithEarlyRefresh(0.9),
+	)
+
+	calls := 0
+	e := echo.New()
+	e.Use(Middleware(client))
+	e.GET("/stale", func(c echo.Context) error {
+		calls++
+		return c.String(http.StatusOK, fmt.Sprintf("value %d", calls))
+	})
+
+	for i, want := range []string{"value 1", "value 2"} {
+		if i > 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", "/stale", nil))
+		if got := w.Body.String(); got != want {
+			t.Errorf("request %v body = %v, want %v", i, got, want)
+		}
+	}
+	client.Close()
+	if calls != 2 {
+		t.Errorf("handler calls = %v, want 2", calls)
+	}
+}
+
+func TestMiddlewareError(t *testing.T) {
+	adapter, _ := memory.NewAdapter(memory.AdapterWithCapacity(10))
+	client, _ := cache.NewClient(
+		cache.ClientWithAdapter(adapter),
+		cache.ClientWithTTL(time.Minute),
+		cache.ClientWithNegativeCache(time.Minute),
+	)
+
+	calls := 0
+	e := echo.New()
+	e.Use(Middleware(client))
+	e.GET("/missing", func(c echo.Context) error {
+		calls++
+		return echo.ErrNotFound
+	})
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("status = %v, want %v", w.Code, http.StatusNotFound)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler calls = %v, want 1", calls)
+	}
+}
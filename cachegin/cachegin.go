@@ -0,0 +1,144 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package cachegin caches the responses of gin handlers with a cache client.
+package cachegin
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware returns a gin middleware caching the responses of the
+// handlers after it with the client. The responses are grouped by the
+// matched route pattern, e.g. /users/:id, rather than by the request path.
+// The gin context is reused once the request is over, so the responses are
+// never refreshed in the background: a stale response is refreshed by the
+// request itself.
+func Middleware(client *cache.Client) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		r := ctx.Request.WithContext(cache.WithoutBackgroundRefresh(ctx.Request.Context()))
+		if route := ctx.FullPath(); route != "" {
+			r = r.WithContext(cache.WithPrefix(r.Context(), route))
+		}
+		ctx.Request = r
+
+		writer := ctx.Writer
+		defer func() { ctx.Writer = writer }()
+		client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Request = r
+			rw := &responseWriter{ResponseWriter: writer, w: w, status: http.StatusOK, size: -1}
+			ctx.Writer = rw
+			ctx.Next()
+			if !rw.hijacked {
+				rw.WriteHeaderNow()
+			}
+		})).ServeHTTP(writer, ctx.Request)
+		ctx.Abort()
+	}
+}
+
+// responseWriter is the gin.ResponseWriter given to the handlers, writing
+// through the cache middleware. Like gin's own writer, it delays the status
+// until the body is written, so that handlers may change it.
+type responseWriter struct {
+	gin.ResponseWriter
+	w        http.ResponseWriter
+	status   int
+	size     int
+	hijacked bool
+}
+
+func (rw *responseWriter) Header() http.Header {
+	return rw.w.Header()
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if code > 0 && !rw.Written() {
+		rw.status = code
+	}
+}
+
+func (rw *responseWriter) WriteHeaderNow() {
+	if !rw.Written() {
+		rw.size = 0
+		rw.w.WriteHeader(rw.status)
+	}
+}
+
+func (rw *responseWriter) Write(data []byte) (int, error) {
+	rw.WriteHeaderNow()
+	n, err := rw.w.Write(data)
+	rw.size += n
+	return n, err
+}
+
+func (rw *responseWriter) WriteString(s string) (int, error) {
+	rw.WriteHeaderNow()
+	n, err := io.WriteString(rw.w, s)
+	rw.size += n
+	return n, err
+}
+
+func (rw *responseWriter) Status() int {
+	return rw.status
+}
+
+func (rw *responseWriter) Size() int {
+	return rw.size
+}
+
+func (rw *responseWriter) Written() bool {
+	return rw.size != -1
+}
+
+func (rw *responseWriter) Flush() {
+	rw.WriteHeaderNow()
+	if f, ok := rw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the connection through the cache middleware, so that
+// the response to the hijacked request is not cached.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("cachegin: the response writer does not implement http.Hijacker")
+	}
+	conn, brw, err := h.Hijack()
+	if err == nil {
+		rw.hijacked = true
+		if rw.size < 0 {
+			rw.size = 0
+		}
+	}
+	return conn, brw, err
+}
@@ -0,0 +1,192 @@
+package cachegin
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/memory"
+	"github.com/gin-gonic/gin"
+)
+
+type prefixAdapter struct {
+	cache.Adapter
+	mu       sync.Mutex
+	prefixes []string
+}
+
+func (a *prefixAdapter) Set(prefix, key string, response []byte) {
+	a.mu.Lock()
+	a.prefixes = append(a.prefixes, prefix)
+	a.mu.Unlock()
+	a.Adapter.Set(prefix, key, response)
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	memoryAdapter, _ := memory.NewAdapter(memory.AdapterWithCapacity(10))
+	adapter := &prefixAdapter{Adapter: memoryAdapter}
+	client, err := cache.NewClient(
+		cache.ClientWithAdapter(adapter),
+		cache.ClientWithTTL(time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	calls := 0
+	router := gin.New()
+	router.Use(Middleware(client))
+	router.GET("/users/:id", func(ctx *gin.Context) {
+		calls++
+		ctx.Header("X-User", ctx.Param("id"))
+		ctx.String(http.StatusCreated, "user %s", ctx.Param("id"))
+	})
+
+	tests := []struct {
+		name      string
+		url       string
+		wantCalls int
+		wantBody  string
+	}{
+		{"caches the response", "/users/1", 1, "user 1"},
+		{"serves it from the cache", "/users/1", 1, "user 1"},
+		{"caches the other paths apart", "/users/2", 2, "user 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if calls != tt.wantCalls {
+				t.Errorf("handler calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if w.Code != http.StatusCreated {
+				t.Errorf("status = %v, want %v", w.Code, http.StatusCreated)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %v, want %v", got, tt.wantBody)
+			}
+			if got := w.Header().Get("X-User"); got != tt.url[len("/users/"):] {
+				t.Errorf("X-User = %v, want %v", got, tt.url[len("/users/"):])
+			}
+		})
+	}
+
+	adapter.mu.Lock()
+	defer adapter.mu.Unlock()
+	if len(adapter.prefixes) == 0 {
+		t.Errorf("no response stored")
+	}
+	for _, prefix := range adapter.prefixes {
+		if prefix != "/users/:id" {
+			t.Errorf("prefix = %v, want /users/:id", prefix)
+		}
+	}
+}
+
+func TestMiddlewareStaleWhileRevalidate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	adapter, _ := memory.NewAdapter(memory.AdapterWithCapacity(10))
+	client, _ := cache.NewClient(
+		cache.ClientWithAdapter(adapter),
+		cache.ClientWithTTL(10*time.Millisecond),
+		cache.ClientWithStaleWhileRevalidate(time.Minute),
+		cache.ClientWithEarlyRefresh(0.9),
+	)
+
+	calls := 0
+	router := gin.New()
+	router.Use(Middleware(client))
+	router.GET("/stale", func(ctx *gin.Context) {
+		calls++
+		ctx.String(http.StatusOK, "value %d", calls)
+	})
+
+	for i, want := range []string{"value 1", "value 2"} {
+		if i > 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/stale", nil))
+		if got := w.Body.String(); got != want {
+			t.Errorf("request %v body = %v, want %v", i, got, want)
+		}
+	}
+	client.Close()
+	if calls != 2 {
+		t.Errorf("handler calls = %v, want 2", calls)
+	}
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (r hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	server, client := net.Pipe()
+	client.Close()
+	return server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)), nil
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	adapter, _ := memory.NewAdapter(memory.AdapterWithCapacity(10))
+	client, _ := cache.NewClient(
+		cache.ClientWithAdapter(adapter),
+		cache.ClientWithTTL(time.Minute),
+	)
+
+	calls := 0
+	router := gin.New()
+	router.Use(Middleware(client))
+	router.GET("/ws", func(ctx *gin.Context) {
+		calls++
+		conn, _, err := ctx.Writer.Hijack()
+		if err != nil {
+			t.Fatalf("Hijack() error = %v", err)
+		}
+		conn.Close()
+	})
+
+	for i := 0; i < 2; i++ {
+		router.ServeHTTP(hijackRecorder{httptest.NewRecorder()}, httptest.NewRequest("GET", "/ws", nil))
+	}
+	if calls != 2 {
+		t.Errorf("handler calls = %v, want 2", calls)
+	}
+	if client.Exists("http://example.com/ws") {
+		t.Errorf("the response to the hijacked request is cached")
+	}
+}
+
+func TestMiddlewareAbort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	adapter, _ := memory.NewAdapter(memory.AdapterWithCapacity(10))
+	client, _ := cache.NewClient(
+		cache.ClientWithAdapter(adapter),
+		cache.ClientWithTTL(time.Minute),
+	)
+
+	calls := 0
+	router := gin.New()
+	router.Use(Middleware(client))
+	router.GET("/forbidden", func(ctx *gin.Context) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+	}, func(ctx *gin.Context) {
+		calls++
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/forbidden", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %v, want %v", w.Code, http.StatusForbidden)
+	}
+	if calls != 0 {
+		t.Errorf("handler calls = %v, want 0", calls)
+	}
+}
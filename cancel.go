@@ -0,0 +1,47 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import "net/http"
+
+// canceled reports whether the client gave up on the request, in which
+// case the response is not worth writing.
+func canceled(ctxlog Logger, r *http.Request) bool {
+	if err := r.Context().Err(); err != nil {
+		ctxlog.Debugf("the request was canceled (%v), skipping the response write", err)
+		return true
+	}
+	return false
+}
+
+// ClientWithSkipCacheOnCancel makes the client not cache the responses to
+// canceled requests, which handlers may have cut short. By default they
+// are cached for the next requests. Optional setting.
+func ClientWithSkipCacheOnCancel(skip bool) ClientOption {
+	return func(c *Client) error {
+		c.skipCacheOnCancel = skip
+		return nil
+	}
+}
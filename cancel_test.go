@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareCanceledRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		skip       bool
+		wantCached bool
+	}{
+		{"caches the response to a canceled request", false, true},
+		{"skips caching the response to a canceled request", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Minute),
+				ClientWithSkipCacheOnCancel(tt.skip),
+			)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// the client disconnects while the handler is working
+				cancel()
+				w.Write([]byte("value"))
+			}))
+
+			r, _ := http.NewRequest("GET", "http://foo.bar/canceled", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(ctx))
+
+			if got := len(adapter.store["/canceled"]) > 0; got != tt.wantCached {
+				t.Errorf("*Client.Middleware() cached = %v, want %v", got, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestCanceled(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	expiredCtx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want bool
+	}{
+		{"live request", context.Background(), false},
+		{"canceled request", canceledCtx, true},
+		{"timed out request", expiredCtx, true},
+	}
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "http://foo.bar/", nil)
+			if got := canceled(client.log, r.WithContext(tt.ctx)); got != tt.want {
+				t.Errorf("canceled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// PathNormalization holds the optional normalizations of the URL paths
+// the cache keys are generated from, for routers treating the paths the
+// normalizations merge as one. Duplicate slashes are always collapsed.
+type PathNormalization struct {
+	// LowercasePath lowercases the ASCII letters of the path, e.g. so
+	// that /Products and /products share their responses.
+	LowercasePath bool
+
+	// StripTrailingSlash removes the trailing slash of the path but the
+	// root, e.g. so that /products/ and /products share their responses.
+	StripTrailingSlash bool
+}
+
+// normalizePath applies the normalizations to the canonical URL path.
+func (n PathNormalization) normalizePath(u *url.URL) {
+	if n.LowercasePath {
+		u.Path, u.RawPath = lowerASCII(u.Path), lowerASCII(u.RawPath)
+	}
+	if n.StripTrailingSlash && len(u.Path) > 1 && strings.HasSuffix(u.Path, "/") {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = strings.TrimSuffix(u.RawPath, "/")
+	}
+}
+
+// lowerASCII lowercases the ASCII letters of s, but the ones of the
+// percent-encodings, which stay uppercase.
+func lowerASCII(s string) string {
+	b := []byte(s)
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '%':
+			i += 2
+		case 'A' <= b[i] && b[i] <= 'Z':
+			b[i] += 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// ClientWithPathNormalization merges the paths the normalizations make
+// equal into the same prefix and key, both in the middleware and in
+// Client.Release, e.g. when the router serves /Products/ and /products
+// alike. The request passed to the handler is left untouched. Optional
+// setting.
+func ClientWithPathNormalization(n PathNormalization) ClientOption {
+	return func(c *Client) error {
+		if n == (PathNormalization{}) {
+			return errors.New("cache client path normalization is not set")
+		}
+		c.pathNormalization = n
+		return nil
+	}
+}
+
+// queryParam is a decoded query parameter.
+type queryParam struct {
+	name, value string
+}
+
+// canonicalQuery returns the query decoded and encoded again the way
+// url.Values.Encode does, so that e.g. "%2f" and "%2F", or "+" and "%20",
+// give the same query, with the parameters sorted by name, then by value,
+// and a parameter without a value given an empty one. Unlike url.Values,
+// it keeps the parameters it cannot decode, as they are. The parameters
+// whose name matches skip are left out.
+func canonicalQuery(rawQuery string, skip func(name string) bool) string {
+	var params []queryParam
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value := pair, ""
+		if i := strings.Index(pair, "="); i >= 0 {
+			name, value = pair[:i], pair[i+1:]
+		}
+		name, value = unescapeQuery(name), unescapeQuery(value)
+		if skip != nil && skip(name) {
+			continue
+		}
+		params = append(params, queryParam{name, value})
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i].name != params[j].name {
+			return params[i].name < params[j].name
+		}
+		return params[i].value < params[j].value
+	})
+
+	var b bytes.Buffer
+	for i, p := range params {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(p.name))
+		b.WriteByte('=')
+		b.WriteString(url.QueryEscape(p.value))
+	}
+	return b.String()
+}
+
+// unescapeQuery decodes a query component, or returns it as it is when it
+// is not validly encoded.
+func unescapeQuery(s string) string {
+	if unescaped, err := url.QueryUnescape(s); err == nil {
+		return unescaped
+	}
+	return s
+}
+
+// canonicalizePath normalizes the URL path: the percent-encodings are
+// uppercased, the unreserved characters decoded, the duplicate slashes
+// collapsed and the dot segments resolved, keeping any trailing slash.
+func canonicalizePath(u *url.URL) {
+	p := u.EscapedPath()
+	if !strings.HasPrefix(p, "/") {
+		return
+	}
+	p = normalizeEscapes(p)
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	unescaped, err := url.PathUnescape(cleaned)
+	if err != nil {
+		return
+	}
+	u.Path, u.RawPath = unescaped, cleaned
+}
+
+// normalizeEscapes uppercases the percent-encodings of s and decodes the
+// ones of unreserved characters, which never need to be encoded.
+func normalizeEscapes(s string) string {
+	if strings.IndexByte(s, '%') < 0 {
+		return s
+	}
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// isUnreserved reports whether c is an unreserved character of RFC 3986.
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawQuery string
+		want     string
+	}{
+		{"sorts names", "b=1&a=2", "a=2&b=1"},
+		{"sorts values", "a=2&a=1", "a=1&a=2"},
+		{"uppercases escapes", "a=%2f", "a=%2F"},
+		{"encodes slashes", "a=/", "a=%2F"},
+		{"encodes spaces alike", "a=%20b&c=+d", "a=+b&c=+d"},
+		{"decodes unreserved characters", "%61=%7E", "a=~"},
+		{"gives an empty value", "a", "a="},
+		{"keeps empty values", "a=", "a="},
+		{"drops empty pairs", "&a=1&&", "a=1"},
+		{"splits at the first equal sign", "a=b=c", "a=b%3Dc"},
+		{"keeps invalid escapes", "a=%zz", "a=%25zz"},
+		{"keeps semicolons", "a=1;b=2", "a=1%3Bb%3D2"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canonicalQuery(tt.rawQuery, nil); got != tt.want {
+				t.Errorf("canonicalQuery(%q) = %q, want %q", tt.rawQuery, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		want     string
+		wantPath string
+	}{
+		{"leaves a clean path", "/a/b", "/a/b", "/a/b"},
+		{"collapses duplicate slashes", "//a///b", "/a/b", "/a/b"},
+		{"resolves dot segments", "/a/./b/../c", "/a/c", "/a/c"},
+		{"does not go above the root", "/../a", "/a", "/a"},
+		{"keeps the trailing slash", "/a/b/", "/a/b/", "/a/b/"},
+		{"keeps the root", "/", "/", "/"},
+		{"uppercases escapes", "/a%2fb", "/a%2Fb", "/a/b"},
+		{"decodes unreserved characters", "/%7Euser/%61", "/~user/a", "/~user/a"},
+		{"resolves encoded dot segments", "/a/%2E%2E/b", "/b", "/b"},
+		{"keeps encoded slashes apart", "/a%2F..%2Fb", "/a%2F..%2Fb", "/a/../b"},
+		{"keeps spaces encoded", "/a%20b", "/a%20b", "/a b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse("http://foo.bar" + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			canonicalizePath(u)
+			if got := u.EscapedPath(); got != tt.want {
+				t.Errorf("canonicalizePath(%q) escaped path = %q, want %q", tt.path, got, tt.want)
+			}
+			if u.Path != tt.wantPath {
+				t.Errorf("canonicalizePath(%q) path = %q, want %q", tt.path, u.Path, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestGeneratePrefixAndKeyCanonical(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithLowercaseHost(true),
+	)
+	tests := []struct {
+		name string
+		url  string
+		same string
+	}{
+		{"escape case", "http://foo.bar/a?p=%2f", "http://foo.bar/a?p=%2F"},
+		{"space encodings", "http://foo.bar/a?p=x+y", "http://foo.bar/a?p=x%20y"},
+		{"empty values", "http://foo.bar/a?p", "http://foo.bar/a?p="},
+		{"parameter order", "http://foo.bar/a?q=1&p=2", "http://foo.bar/a?p=2&q=1"},
+		{"duplicate slashes", "http://foo.bar//a", "http://foo.bar/a"},
+		{"dot segments", "http://foo.bar/b/../a", "http://foo.bar/a"},
+		{"empty query", "http://foo.bar/a?", "http://foo.bar/a"},
+		{"host case", "http://FOO.bar/a", "http://foo.bar/a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix, key := client.GeneratePrefixAndKey(httptest.NewRequest("GET", tt.url, nil))
+			samePrefix, sameKey := client.GeneratePrefixAndKey(httptest.NewRequest("GET", tt.same, nil))
+			if prefix != samePrefix || key != sameKey {
+				t.Errorf("*Client.GeneratePrefixAndKey(%v) = %v, %v, want %v, %v", tt.url, prefix, key, samePrefix, sameKey)
+			}
+
+			adapter := &adapterMock{store: map[string]map[string][]byte{samePrefix: {sameKey: []byte("value")}}}
+			client.adapter = adapter
+			if n, _ := client.Release(tt.url); n != 1 {
+				t.Errorf("*Client.Release(%v) = %v, want 1", tt.url, n)
+			}
+		})
+	}
+
+	prefix, key := client.GeneratePrefixAndKey(httptest.NewRequest("GET", "http://foo.bar/a", nil))
+	client.adapter = &adapterMock{store: map[string]map[string][]byte{prefix: {key: []byte("value")}}}
+	if n, _ := client.Release("http://foo.bar/a#top"); n != 1 {
+		t.Errorf("*Client.Release() with a fragment = %v, want 1", n)
+	}
+}
+
+func TestPathNormalization(t *testing.T) {
+	tests := []struct {
+		name          string
+		normalization PathNormalization
+		url           string
+		same          string
+		wantSame      bool
+	}{
+		{"case variants are apart by default", PathNormalization{StripTrailingSlash: true}, "http://foo.bar/Products", "http://foo.bar/products", false},
+		{"lowercases the path", PathNormalization{LowercasePath: true}, "http://foo.bar/Products", "http://foo.bar/products", true},
+		{"keeps the escapes uppercase", PathNormalization{LowercasePath: true}, "http://foo.bar/A%2fB", "http://foo.bar/a%2Fb", true},
+		{"keeps encoded slashes apart", PathNormalization{LowercasePath: true}, "http://foo.bar/a%2Fb", "http://foo.bar/a/b", false},
+		{"leaves the query case", PathNormalization{LowercasePath: true}, "http://foo.bar/a?p=X", "http://foo.bar/a?p=x", false},
+		{"trailing slash variants are apart by default", PathNormalization{LowercasePath: true}, "http://foo.bar/products/", "http://foo.bar/products", false},
+		{"strips the trailing slash", PathNormalization{StripTrailingSlash: true}, "http://foo.bar/products/", "http://foo.bar/products", true},
+		{"strips collapsed trailing slashes", PathNormalization{StripTrailingSlash: true}, "http://foo.bar/products//", "http://foo.bar/products", true},
+		{"keeps the root", PathNormalization{StripTrailingSlash: true}, "http://foo.bar/", "http://foo.bar/", true},
+		{"both", PathNormalization{LowercasePath: true, StripTrailingSlash: true}, "http://foo.bar/Products/", "http://foo.bar/products", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithPathNormalization(tt.normalization),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prefix, key := client.GeneratePrefixAndKey(httptest.NewRequest("GET", tt.url, nil))
+			samePrefix, sameKey := client.GeneratePrefixAndKey(httptest.NewRequest("GET", tt.same, nil))
+			if got := prefix == samePrefix && key == sameKey; got != tt.wantSame {
+				t.Errorf("*Client.GeneratePrefixAndKey(%v) = %v, %v and (%v) = %v, %v, want same %v", tt.url, prefix, key, tt.same, samePrefix, sameKey, tt.wantSame)
+			}
+			if !tt.wantSame {
+				return
+			}
+
+			client.adapter = &adapterMock{store: map[string]map[string][]byte{samePrefix: {sameKey: []byte("value")}}}
+			if n, _ := client.Release(tt.url); n != 1 {
+				t.Errorf("*Client.Release(%v) = %v, want 1", tt.url, n)
+			}
+		})
+	}
+
+	if _, err := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithPathNormalization(PathNormalization{}),
+	); err == nil {
+		t.Error("ClientWithPathNormalization() without normalization error = nil, want an error")
+	}
+}
+
+func TestMiddlewarePathNormalization(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithPathNormalization(PathNormalization{LowercasePath: true, StripTrailingSlash: true}),
+	)
+	var paths []string
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte("value"))
+	}))
+	for _, path := range []string{"/Products/", "/products", "/PRODUCTS"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "http://foo.bar"+path, nil))
+		if w.Body.String() != "value" {
+			t.Errorf("response to %v = %q, want value", path, w.Body.String())
+		}
+	}
+	if want := []string{"/Products/"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("handler paths = %v, want %v: the request must be left untouched", paths, want)
+	}
+	if !client.Exists("http://foo.bar/Products/") {
+		t.Error("*Client.Exists() of a path to normalize = false, want true")
+	}
+	if meta, ok := client.Peek("http://foo.bar/PRODUCTS"); !ok || meta.Prefix != "/products" {
+		t.Errorf("*Client.Peek() of a path to normalize = %v, %v, want the prefix /products", meta.Prefix, ok)
+	}
+	if n, err := client.Release("http://foo.bar/products/"); n != 1 || err != nil {
+		t.Errorf("*Client.Release() of a path to normalize = %v, %v, want 1, nil", n, err)
+	}
+}
@@ -0,0 +1,325 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// responseCapture is the http.ResponseWriter given to the handler on a
+// miss. It writes the response through to the client as it comes while
+// keeping a copy of the status code, header and body to cache once the
+// handler returns. Without a client writer, it only keeps the copy. The
+// hidden header and the control headers are kept but not written to the
+// client; the other fields are written through the writeField function
+// when set, else replace the fields already set.
+type responseCapture struct {
+	w           http.ResponseWriter
+	hidden      string
+	writeField  func(dst http.Header, k string, v []string)
+	header      http.Header
+	snapshot    http.Header
+	status      int
+	wroteHeader bool
+	hijacked    bool
+	body        captureBuffer
+}
+
+// captureBuffer keeps the copy of the response body, up to a size limit.
+// Once the body exceeds the limit, the copy is dropped. A zero limit
+// means no limit.
+type captureBuffer struct {
+	bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+// Write implements the io.Writer interface Write method.
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	if b.overflow {
+		return len(p), nil
+	}
+	if b.limit > 0 && int64(b.Len()+len(p)) > b.limit {
+		b.overflow = true
+		b.Buffer = bytes.Buffer{}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// captureWriter is the responseCapture along with its Unwrap method, so
+// that http.ResponseController reaches the client writer.
+type captureWriter interface {
+	http.ResponseWriter
+	Unwrap() http.ResponseWriter
+}
+
+// The optional interfaces of the client writer a responseCapture passes
+// through.
+type (
+	captureFlusher    struct{ *responseCapture }
+	captureHijacker   struct{ *responseCapture }
+	captureReaderFrom struct{ *responseCapture }
+	capturePusher     struct{ *responseCapture }
+)
+
+// newResponseCapture returns the capture along with the writer to give to
+// the handler, which implements http.Flusher, http.Hijacker, io.ReaderFrom
+// and http.Pusher when w does, and unwraps to w.
+func newResponseCapture(w http.ResponseWriter) (*responseCapture, http.ResponseWriter) {
+	c := &responseCapture{w: w, header: make(http.Header)}
+
+	var (
+		f             = captureFlusher{c}
+		h             = captureHijacker{c}
+		rf            = captureReaderFrom{c}
+		p             = capturePusher{c}
+		_, flusher    = w.(http.Flusher)
+		_, hijack     = w.(http.Hijacker)
+		_, readerFrom = w.(io.ReaderFrom)
+		_, pusher     = w.(http.Pusher)
+	)
+	switch {
+	case flusher && hijack && readerFrom && pusher:
+		return c, struct {
+			captureWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{c, f, h, rf, p}
+	case hijack && readerFrom && pusher && !flusher:
+		return c, struct {
+			captureWriter
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{c, h, rf, p}
+	case flusher && readerFrom && pusher && !hijack:
+		return c, struct {
+			captureWriter
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+		}{c, f, rf, p}
+	case readerFrom && pusher && !flusher && !hijack:
+		return c, struct {
+			captureWriter
+			io.ReaderFrom
+			http.Pusher
+		}{c, rf, p}
+	case flusher && hijack && pusher && !readerFrom:
+		return c, struct {
+			captureWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{c, f, h, p}
+	case hijack && pusher && !flusher && !readerFrom:
+		return c, struct {
+			captureWriter
+			http.Hijacker
+			http.Pusher
+		}{c, h, p}
+	case flusher && pusher && !hijack && !readerFrom:
+		return c, struct {
+			captureWriter
+			http.Flusher
+			http.Pusher
+		}{c, f, p}
+	case pusher && !flusher && !hijack && !readerFrom:
+		return c, struct {
+			captureWriter
+			http.Pusher
+		}{c, p}
+	case flusher && hijack && readerFrom && !pusher:
+		return c, struct {
+			captureWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{c, f, h, rf}
+	case hijack && readerFrom && !flusher && !pusher:
+		return c, struct {
+			captureWriter
+			http.Hijacker
+			io.ReaderFrom
+		}{c, h, rf}
+	case flusher && readerFrom && !hijack && !pusher:
+		return c, struct {
+			captureWriter
+			http.Flusher
+			io.ReaderFrom
+		}{c, f, rf}
+	case readerFrom && !flusher && !hijack && !pusher:
+		return c, struct {
+			captureWriter
+			io.ReaderFrom
+		}{c, rf}
+	case flusher && hijack && !readerFrom && !pusher:
+		return c, struct {
+			captureWriter
+			http.Flusher
+			http.Hijacker
+		}{c, f, h}
+	case hijack && !flusher && !readerFrom && !pusher:
+		return c, struct {
+			captureWriter
+			http.Hijacker
+		}{c, h}
+	case flusher && !hijack && !readerFrom && !pusher:
+		return c, struct {
+			captureWriter
+			http.Flusher
+		}{c, f}
+	}
+	return c, c
+}
+
+// Header implements the http.ResponseWriter interface Header method. The
+// handler gets its own header, so that headers set by the middleware are
+// not cached.
+func (c *responseCapture) Header() http.Header {
+	return c.header
+}
+
+// Unwrap returns the client writer, so that http.ResponseController can
+// reach its deadlines and other features.
+func (c *responseCapture) Unwrap() http.ResponseWriter {
+	return c.w
+}
+
+// WriteHeader implements the http.ResponseWriter interface WriteHeader
+// method.
+func (c *responseCapture) WriteHeader(statusCode int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	c.status = statusCode
+	c.snapshot = make(http.Header, len(c.header))
+	for k, v := range c.header {
+		c.snapshot[k] = append([]string(nil), v...)
+	}
+	if c.w != nil {
+		for k, v := range c.header {
+			switch {
+			case k == c.hidden || isControlHeader(k):
+			case c.writeField != nil:
+				c.writeField(c.w.Header(), k, v)
+			default:
+				c.w.Header()[k] = v
+			}
+		}
+		c.w.WriteHeader(statusCode)
+	}
+}
+
+// Write implements the http.ResponseWriter interface Write method.
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		if c.header.Get("Content-Type") == "" {
+			c.header.Set("Content-Type", http.DetectContentType(b))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	c.body.Write(b)
+	if c.w != nil {
+		return c.w.Write(b)
+	}
+	return len(b), nil
+}
+
+// Flush implements the http.Flusher interface Flush method.
+func (c captureFlusher) Flush() {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	c.w.(http.Flusher).Flush()
+}
+
+// Hijack implements the http.Hijacker interface Hijack method. The
+// response to a hijacked request is never cached.
+func (c captureHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := c.w.(http.Hijacker).Hijack()
+	if err == nil {
+		c.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// ReadFrom implements the io.ReaderFrom interface ReadFrom method.
+func (c captureReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	return c.w.(io.ReaderFrom).ReadFrom(io.TeeReader(src, &c.body))
+}
+
+// Push implements the http.Pusher interface Push method.
+func (c capturePusher) Push(target string, opts *http.PushOptions) error {
+	return c.w.(http.Pusher).Push(target, opts)
+}
+
+// result returns the captured response, writing the header when the
+// handler wrote nothing.
+func (c *responseCapture) result() *http.Response {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	return &http.Response{
+		StatusCode: c.status,
+		Header:     c.snapshot,
+	}
+}
+
+// passThrough serves the request from the handler without caching the
+// response, returning its status code, or zero when the handler hijacked
+// the connection. The handler gets a capture of w keeping the status code
+// only, so that the internal headers are left out.
+func (c *Client) passThrough(next http.Handler, w http.ResponseWriter, r *http.Request, prefix string, t *Timing) int {
+	start := time.Now()
+	defer func() {
+		d := time.Since(start)
+		c.metrics.ObserveOriginLatency(prefix, d)
+		if t != nil {
+			t.Origin += d
+		}
+	}()
+	capture, cw := newResponseCapture(w)
+	capture.hidden = c.tagHeader
+	// keep the status code only
+	capture.body.overflow = true
+	next.ServeHTTP(cw, r)
+	if capture.hijacked {
+		return 0
+	}
+	return capture.result().StatusCode
+}
@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseCapture(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("X-Middleware", "yes")
+	capture, w := newResponseCapture(rec)
+
+	w.Header().Set("X-Origin", "yes")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("a"))
+	w.(http.Flusher).Flush()
+	if got := rec.Body.String(); got != "a" {
+		t.Errorf("responseCapture client body = %v, want a", got)
+	}
+	if !rec.Flushed {
+		t.Error("responseCapture did not flush the client writer")
+	}
+	w.Header().Set("X-Late", "yes")
+	w.Write([]byte("b"))
+
+	result := capture.result()
+	if result.StatusCode != http.StatusCreated || rec.Code != http.StatusCreated {
+		t.Errorf("responseCapture status = %v, client status = %v, want %v", result.StatusCode, rec.Code, http.StatusCreated)
+	}
+	if got := capture.body.String(); got != "ab" {
+		t.Errorf("responseCapture body = %v, want ab", got)
+	}
+	if got := rec.Header().Get("X-Origin"); got != "yes" {
+		t.Errorf("responseCapture client X-Origin = %v, want yes", got)
+	}
+	if got := result.Header.Get("X-Origin"); got != "yes" {
+		t.Errorf("responseCapture X-Origin = %v, want yes", got)
+	}
+	if _, ok := result.Header["X-Middleware"]; ok {
+		t.Error("responseCapture captured a middleware header")
+	}
+	if _, ok := result.Header["X-Late"]; ok {
+		t.Error("responseCapture captured a header set after WriteHeader")
+	}
+}
+
+func TestResponseCaptureWithoutClient(t *testing.T) {
+	capture, w := newResponseCapture(nil)
+	if _, ok := w.(http.Flusher); ok {
+		t.Error("responseCapture without client writer implements http.Flusher")
+	}
+	w.Write([]byte("<html></html>"))
+
+	result := capture.result()
+	if result.StatusCode != http.StatusOK {
+		t.Errorf("responseCapture status = %v, want %v", result.StatusCode, http.StatusOK)
+	}
+	if got := result.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("responseCapture Content-Type = %v, want text/html; charset=utf-8", got)
+	}
+}
+
+func TestMiddlewareStreaming(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+	)
+
+	rec := httptest.NewRecorder()
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("event: 1\n"))
+		w.(http.Flusher).Flush()
+		if got := rec.Body.String(); got != "event: 1\n" {
+			t.Errorf("*Client.Middleware() streamed body = %v, want event: 1", got)
+		}
+		w.Write([]byte("event: 2\n"))
+	}))
+
+	r, _ := http.NewRequest("GET", "http://foo.bar/stream", nil)
+	handler.ServeHTTP(rec, r)
+
+	r, _ = http.NewRequest("GET", "http://foo.bar/stream", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Body.String(); got != "event: 1\nevent: 2\n" {
+		t.Errorf("*Client.Middleware() cached body = %v, want both events", got)
+	}
+}
+
+type flusherWriter struct{ *httptest.ResponseRecorder }
+
+type hijackerWriter struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (w *hijackerWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+type readerFromWriter struct {
+	*httptest.ResponseRecorder
+	read int64
+}
+
+func (w *readerFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	n, err := io.Copy(w.ResponseRecorder, src)
+	w.read += n
+	return n, err
+}
+
+type pusherWriter struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (w *pusherWriter) Push(target string, opts *http.PushOptions) error {
+	w.pushed = append(w.pushed, target)
+	return nil
+}
+
+type allWriter struct {
+	*hijackerWriter
+	*readerFromWriter
+	*pusherWriter
+}
+
+func (w allWriter) Header() http.Header         { return w.hijackerWriter.Header() }
+func (w allWriter) Write(b []byte) (int, error) { return w.hijackerWriter.Write(b) }
+func (w allWriter) WriteHeader(statusCode int)  { w.hijackerWriter.WriteHeader(statusCode) }
+func (w allWriter) Flush()                      { w.hijackerWriter.Flush() }
+
+func TestResponseCaptureInterfaces(t *testing.T) {
+	tests := []struct {
+		name           string
+		w              http.ResponseWriter
+		wantFlusher    bool
+		wantHijacker   bool
+		wantReaderFrom bool
+		wantPusher     bool
+	}{
+		{"plain", struct{ http.ResponseWriter }{httptest.NewRecorder()}, false, false, false, false},
+		{"flusher", flusherWriter{httptest.NewRecorder()}, true, false, false, false},
+		{"hijacker", struct {
+			http.ResponseWriter
+			http.Hijacker
+		}{httptest.NewRecorder(), &hijackerWriter{}}, false, true, false, false},
+		{"reader from", struct {
+			http.ResponseWriter
+			io.ReaderFrom
+		}{httptest.NewRecorder(), &readerFromWriter{}}, false, false, true, false},
+		{"pusher", struct {
+			http.ResponseWriter
+			http.Pusher
+		}{httptest.NewRecorder(), &pusherWriter{}}, false, false, false, true},
+		{"all", allWriter{
+			&hijackerWriter{ResponseRecorder: httptest.NewRecorder()},
+			&readerFromWriter{ResponseRecorder: httptest.NewRecorder()},
+			&pusherWriter{ResponseRecorder: httptest.NewRecorder()},
+		}, true, true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, w := newResponseCapture(tt.w)
+			if _, ok := w.(http.Flusher); ok != tt.wantFlusher {
+				t.Errorf("responseCapture implements http.Flusher = %v, want %v", ok, tt.wantFlusher)
+			}
+			if _, ok := w.(http.Hijacker); ok != tt.wantHijacker {
+				t.Errorf("responseCapture implements http.Hijacker = %v, want %v", ok, tt.wantHijacker)
+			}
+			if _, ok := w.(io.ReaderFrom); ok != tt.wantReaderFrom {
+				t.Errorf("responseCapture implements io.ReaderFrom = %v, want %v", ok, tt.wantReaderFrom)
+			}
+			if _, ok := w.(http.Pusher); ok != tt.wantPusher {
+				t.Errorf("responseCapture implements http.Pusher = %v, want %v", ok, tt.wantPusher)
+			}
+			if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() != tt.w {
+				t.Errorf("responseCapture does not unwrap to the client writer")
+			}
+		})
+	}
+}
+
+func TestResponseCapturePassThrough(t *testing.T) {
+	all := allWriter{
+		&hijackerWriter{ResponseRecorder: httptest.NewRecorder()},
+		&readerFromWriter{ResponseRecorder: httptest.NewRecorder()},
+		&pusherWriter{ResponseRecorder: httptest.NewRecorder()},
+	}
+	capture, w := newResponseCapture(all)
+
+	w.(http.Pusher).Push("/style.css", nil)
+	if !reflect.DeepEqual(all.pusherWriter.pushed, []string{"/style.css"}) {
+		t.Errorf("responseCapture pushed = %v, want [/style.css]", all.pusherWriter.pushed)
+	}
+
+	w.(io.ReaderFrom).ReadFrom(strings.NewReader("value"))
+	if all.readerFromWriter.read != 5 {
+		t.Errorf("responseCapture client read = %v, want 5", all.readerFromWriter.read)
+	}
+	if got := capture.body.String(); got != "value" {
+		t.Errorf("responseCapture body = %v, want value", got)
+	}
+
+	w.(http.Hijacker).Hijack()
+	if !all.hijackerWriter.hijacked || !capture.hijacked {
+		t.Error("responseCapture did not hijack the client connection")
+	}
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Hijacker).Hijack()
+	}))
+
+	r, _ := http.NewRequest("GET", "http://foo.bar/ws", nil)
+	handler.ServeHTTP(&hijackerWriter{ResponseRecorder: httptest.NewRecorder()}, r)
+
+	if len(adapter.store) > 0 {
+		t.Errorf("*Client.Middleware() cached a hijacked response: %v", adapter.store)
+	}
+}
+
+func TestCaptureBuffer(t *testing.T) {
+	b := &captureBuffer{limit: 4}
+	b.Write([]byte("ab"))
+	b.Write([]byte("cd"))
+	if b.overflow || b.String() != "abcd" {
+		t.Errorf("captureBuffer = %v, overflow %v, want abcd", b.String(), b.overflow)
+	}
+	b.Write([]byte("e"))
+	if !b.overflow || b.Len() != 0 {
+		t.Errorf("captureBuffer = %v, overflow %v, want empty overflow", b.String(), b.overflow)
+	}
+}
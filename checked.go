@@ -0,0 +1,178 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// CheckedAdapter is implemented by adapters able to report their
+// failures, e.g. a lost connection, rather than passing them off as
+// misses. The client prefers it over the Adapter Get, Exists and Set
+// methods and the TTLSetter SetWithTTL method, unless the adapter is a
+// ContextAdapter.
+type CheckedAdapter interface {
+	// GetChecked retrieves the cached response by a given key. The
+	// error is only set when the adapter failed to look it up.
+	GetChecked(prefix, key string) ([]byte, bool, error)
+
+	// ExistsChecked reports whether the response by a given key is
+	// cached.
+	ExistsChecked(prefix, key string) (bool, error)
+
+	// SetChecked caches the response by a given key for the given
+	// duration. Adapters unable to expire responses natively may ignore
+	// the ttl.
+	SetChecked(prefix, key string, response []byte, ttl time.Duration) error
+}
+
+// AdapterError is the error reported to the OnError hook when an adapter
+// operation fails.
+type AdapterError struct {
+	// Op is the failed operation, e.g. "get" or "set".
+	Op string
+
+	Prefix string
+	Key    string
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *AdapterError) Error() string {
+	return fmt.Sprintf("cache adapter %s %s %s: %v", e.Op, e.Prefix, e.Key, e.Err)
+}
+
+// Unwrap returns the adapter error.
+func (e *AdapterError) Unwrap() error {
+	return e.Err
+}
+
+// get retrieves the cached response by a given key, reporting the
+// adapter failures. The lookup misses while the circuit breaker is open.
+func (c *Client) get(ctx context.Context, r *http.Request, ctxlog Logger, prefix, key string) ([]byte, bool) {
+	var (
+		b   []byte
+		ok  bool
+		err error
+	)
+	switch a := c.optional().(type) {
+	case ContextAdapter:
+		c.callAdapter(ctx, r, func() error {
+			b, ok, err = a.GetContext(ctx, prefix, key)
+			return err
+		})
+	case CheckedAdapter:
+		c.callAdapter(ctx, r, func() error {
+			b, ok, err = a.GetChecked(prefix, key)
+			return err
+		})
+	default:
+		return c.adapter.Get(prefix, key)
+	}
+	if err != nil {
+		c.adapterFailed(r, ctxlog, &AdapterError{Op: "get", Prefix: prefix, Key: key, Err: err})
+		return nil, false
+	}
+	return b, ok
+}
+
+// exists reports whether the response by a given key is cached, reporting
+// the adapter failures.
+func (c *Client) exists(ctx context.Context, r *http.Request, ctxlog Logger, prefix, key string) bool {
+	var (
+		ok  bool
+		err error
+	)
+	switch a := c.optional().(type) {
+	case ContextAdapter:
+		c.callAdapter(ctx, r, func() error {
+			ok, err = a.ExistsContext(ctx, prefix, key)
+			return err
+		})
+	case CheckedAdapter:
+		c.callAdapter(ctx, r, func() error {
+			ok, err = a.ExistsChecked(prefix, key)
+			return err
+		})
+	default:
+		return c.adapter.Exists(prefix, key)
+	}
+	if err != nil {
+		c.adapterFailed(r, ctxlog, &AdapterError{Op: "exists", Prefix: prefix, Key: key, Err: err})
+		return false
+	}
+	return ok
+}
+
+// set caches the response by a given key, reporting the adapter failures.
+// A zero ttl keeps it until it is released or evicted.
+func (c *Client) set(ctx context.Context, r *http.Request, ctxlog Logger, prefix, key string, response []byte, ttl time.Duration) {
+	var err error
+	switch a := c.optional().(type) {
+	case ContextAdapter:
+		c.callAdapter(ctx, r, func() error {
+			err = a.SetContext(ctx, prefix, key, response, ttl)
+			return err
+		})
+	case CheckedAdapter:
+		c.callAdapter(ctx, r, func() error {
+			err = a.SetChecked(prefix, key, response, ttl)
+			return err
+		})
+	case TTLSetter:
+		if ttl > 0 {
+			a.SetWithTTL(prefix, key, response, ttl)
+			return
+		}
+		c.adapter.Set(prefix, key, response)
+	default:
+		c.adapter.Set(prefix, key, response)
+	}
+	if err != nil {
+		c.adapterFailed(r, ctxlog, &AdapterError{Op: "set", Prefix: prefix, Key: key, Err: err})
+	}
+}
+
+// expiresNatively reports whether the adapter is given the ttl of the
+// responses it stores.
+func (c *Client) expiresNatively() bool {
+	switch c.optional().(type) {
+	case TTLSetter, CheckedAdapter, ContextAdapter:
+		return true
+	}
+	return false
+}
+
+// adapterFailed logs, counts and reports an adapter failure. The request
+// is nil when the failure happened in the background.
+func (c *Client) adapterFailed(r *http.Request, ctxlog Logger, err *AdapterError) {
+	ctxlog.Errorf("%v", err)
+	atomic.AddUint64(&c.stats.errors, 1)
+	c.hookError(r, err)
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type checkedAdapterMock struct {
+	adapterMock
+	err error
+	ttl time.Duration
+}
+
+func (a *checkedAdapterMock) GetChecked(prefix, key string) ([]byte, bool, error) {
+	if a.err != nil {
+		return nil, false, a.err
+	}
+	b, ok := a.Get(prefix, key)
+	return b, ok, nil
+}
+
+func (a *checkedAdapterMock) ExistsChecked(prefix, key string) (bool, error) {
+	if a.err != nil {
+		return false, a.err
+	}
+	return a.Exists(prefix, key), nil
+}
+
+func (a *checkedAdapterMock) SetChecked(prefix, key string, response []byte, ttl time.Duration) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.ttl = ttl
+	a.Set(prefix, key, response)
+	return nil
+}
+
+func TestMiddlewareCheckedAdapter(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCached bool
+		wantCalls  int
+		wantOps    []string
+	}{
+		{"caches through the checked adapter", nil, true, 1, nil},
+		{"serves failed lookups as misses and reports them", errors.New("connection refused"), false, 2, []string{"get", "set", "get", "set"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mutex sync.Mutex
+				ops   []string
+			)
+			adapter := &checkedAdapterMock{err: tt.err}
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Minute),
+				ClientWithHooks(Hooks{OnError: func(r *http.Request, err error) {
+					mutex.Lock()
+					defer mutex.Unlock()
+					adapterErr, ok := err.(*AdapterError)
+					if !ok || adapterErr.Err != tt.err {
+						t.Errorf("OnError() err = %v, want an *AdapterError wrapping %v", err, tt.err)
+						return
+					}
+					if r == nil {
+						t.Error("OnError() request = nil, want the request served")
+					}
+					ops = append(ops, adapterErr.Op)
+				}}),
+			)
+			calls := 0
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Write([]byte("value"))
+			}))
+
+			for i := 0; i < 2; i++ {
+				r, _ := http.NewRequest("GET", "http://foo.bar/checked", nil)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Body.String() != "value" {
+					t.Errorf("*Client.Middleware() body = %v, want value", w.Body.String())
+				}
+			}
+
+			if got := len(adapter.store["/checked"]) > 0; got != tt.wantCached {
+				t.Errorf("*Client.Middleware() cached = %v, want %v", got, tt.wantCached)
+			}
+			if tt.wantCached && (adapter.ttl <= 0 || adapter.ttl > time.Minute) {
+				t.Errorf("CheckedAdapter.SetChecked() ttl = %v, want up to 1m", adapter.ttl)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if !reflect.DeepEqual(ops, tt.wantOps) {
+				t.Errorf("OnError() ops = %v, want %v", ops, tt.wantOps)
+			}
+			if got := client.Stats().Errors; got != uint64(len(tt.wantOps)) {
+				t.Errorf("*Client.Stats() errors = %v, want %v", got, len(tt.wantOps))
+			}
+		})
+	}
+}
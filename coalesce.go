@@ -0,0 +1,84 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import "net/http"
+
+// fetchResult is the origin response shared by coalesced requests.
+type fetchResult struct {
+	response *http.Response
+	value    []byte
+	stored   bool
+	request  *http.Request
+	panic    interface{}
+}
+
+// fetch takes the response from the origin handler, sharing a single
+// handler execution among concurrent requests for the same key when
+// request coalescing is enabled, whether the key expired or was never
+// cached. The request executing the handler gets the response written
+// through to w, when it is not nil, and written is true; the other
+// requests sharing it must write it themselves. They only share a
+// response that was cached, and otherwise call the handler themselves, so
+// that an error of the handler is not served to all of them.
+func (c *Client) fetch(next http.Handler, w http.ResponseWriter, r *http.Request, prefix, key string, t *Timing) (response *http.Response, value []byte, written bool) {
+	if c.flight == nil {
+		response, value, _ = c.put(next, w, r, prefix, key, t)
+		return response, value, w != nil
+	}
+
+	v, _, _ := c.flight.Do(prefix+"\x00"+key, func() (v interface{}, err error) {
+		defer func() {
+			// the handler panic is passed on as is, rather than wrapped
+			if p := recover(); p != nil {
+				v = fetchResult{request: r, panic: p}
+			}
+		}()
+		written = w != nil
+		response, value, stored := c.put(next, w, r, prefix, key, t)
+		return fetchResult{response: response, value: value, stored: stored, request: r}, nil
+	})
+	result := v.(fetchResult)
+	if result.request == r {
+		if result.panic != nil {
+			panic(result.panic)
+		}
+		return result.response, result.value, written
+	}
+
+	// a failed or uncacheable response, e.g. an error, is not shared, nor
+	// is the response to a hijacked connection, which leaves none
+	if !result.stored {
+		response, value, _ = c.put(next, w, r, prefix, key, t)
+		return response, value, w != nil
+	}
+	// a request selecting another variant can't reuse the shared response
+	if vary := parseVary(result.response.Header); len(vary) > 0 &&
+		c.variantKey(key, vary, r) != c.variantKey(key, vary, result.request) {
+		response, value, _ = c.put(next, w, r, prefix, key, t)
+		return response, value, w != nil
+	}
+	return result.response, result.value, false
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareRequestCoalescing(t *testing.T) {
+	var calls int32
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("X-Origin", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("value"))
+	})
+
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithRequestCoalescing(true),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _ := http.NewRequest("GET", "http://foo.bar/coalesced", nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != http.StatusCreated || w.Header().Get("X-Origin") != "yes" || w.Body.String() != "value" {
+				t.Errorf("*Client.Middleware() = %v %v %v", w.Code, w.Header(), w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("*Client.Middleware() origin calls = %v, want 1", calls)
+	}
+}
+
+func TestMiddlewareRequestCoalescingUncacheable(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		header    string
+		wantCalls int32
+	}{
+		{"shares the cached response of a cold key", http.StatusOK, "", 1},
+		{"does not share errors", http.StatusInternalServerError, "", 20},
+		{"does not share no-store responses", http.StatusOK, "no-store", 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			client, _ := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithRequestCoalescing(true),
+			)
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&calls, 1)
+				time.Sleep(50 * time.Millisecond)
+				if tt.header != "" {
+					w.Header().Set("Cache-Control", tt.header)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprintf(w, "value %d", n)
+			}))
+
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					r, _ := http.NewRequest("GET", "http://foo.bar/cold", nil)
+					w := httptest.NewRecorder()
+					handler.ServeHTTP(w, r)
+					if w.Code != tt.status || !strings.HasPrefix(w.Body.String(), "value ") {
+						t.Errorf("*Client.Middleware() = %v %v", w.Code, w.Body.String())
+					}
+				}()
+			}
+			wg.Wait()
+
+			if calls != tt.wantCalls {
+				t.Errorf("*Client.Middleware() origin calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRequestCoalescingVary(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	})
+
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithRequestCoalescing(true),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		language := []string{"en", "pt"}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _ := http.NewRequest("GET", "http://foo.bar/coalesced-vary", nil)
+			r.Header.Set("Accept-Language", language)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Body.String() != language {
+				t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), language)
+			}
+		}()
+	}
+	wg.Wait()
+}
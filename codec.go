@@ -0,0 +1,92 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// Codec serializes the responses stored in the adapter.
+type Codec interface {
+	// Marshal encodes the response.
+	Marshal(r Response) ([]byte, error)
+
+	// Unmarshal decodes a response encoded by Marshal.
+	Unmarshal(b []byte) (Response, error)
+}
+
+// ExpirationReader is implemented by codecs able to read the expiration
+// of an encoded response without decoding it whole, e.g. for adapters
+// sweeping expired responses.
+type ExpirationReader interface {
+	// Expiration returns the expiration of the encoded response.
+	Expiration(b []byte) (time.Time, error)
+}
+
+// FrameCodec is the default Codec, encoding responses in the framed binary
+// format of Response.Bytes, whose metadata is read without decoding the
+// body, and decoding them as BytesToResponse does, gob entries stored by
+// earlier versions included.
+type FrameCodec struct{}
+
+// GobCodec is the former name of FrameCodec. It encodes the responses in
+// the framed binary format, not with gob, which it only decodes.
+//
+// Deprecated: use FrameCodec.
+type GobCodec = FrameCodec
+
+// Marshal implements the Codec interface Marshal method.
+func (FrameCodec) Marshal(r Response) ([]byte, error) {
+	return r.Bytes(), nil
+}
+
+// Unmarshal implements the Codec interface Unmarshal method.
+func (FrameCodec) Unmarshal(b []byte) (Response, error) {
+	return BytesToResponse(b)
+}
+
+// Expiration implements the ExpirationReader interface Expiration method.
+func (FrameCodec) Expiration(b []byte) (time.Time, error) {
+	if isFramed(b) {
+		return frameExpiration(b)
+	}
+	r, err := BytesToResponse(b)
+	return r.Expiration, err
+}
+
+// ClientWithCodec sets the codec serializing the cached responses, e.g.
+// to share them with programs not written in Go. Entries stored with
+// another codec cannot be decoded and are released on their next lookup.
+// Default is FrameCodec. Optional setting.
+func ClientWithCodec(codec Codec) ClientOption {
+	return func(c *Client) error {
+		if codec == nil {
+			return errors.New("cache client codec is not set")
+		}
+		c.codec = codec
+		return nil
+	}
+}
@@ -0,0 +1,77 @@
+package json
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+)
+
+func testResponse(size int) cache.Response {
+	now := time.Now().Round(0)
+	return cache.Response{
+		Value:      bytes.Repeat([]byte("a"), size),
+		Header:     http.Header{"Content-Type": {"application/json"}, "Set-Cookie": {"a=1", "b=2"}},
+		StatusCode: http.StatusCreated,
+		Expiration: now.Add(time.Minute),
+		LastAccess: now,
+		Frequency:  3,
+		Vary:       []string{"Accept"},
+		CachedAt:   now,
+	}
+}
+
+func TestCodec(t *testing.T) {
+	want := testResponse(16)
+	b, err := Codec{}.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Codec{}.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Expiration.Equal(want.Expiration) || !got.CachedAt.Equal(want.CachedAt) || !got.LastAccess.Equal(want.LastAccess) {
+		t.Errorf("Codec.Unmarshal() dates = %v, %v, %v, want %v, %v, %v", got.Expiration, got.CachedAt, got.LastAccess, want.Expiration, want.CachedAt, want.LastAccess)
+	}
+	got.Expiration, got.CachedAt, got.LastAccess = want.Expiration, want.CachedAt, want.LastAccess
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Codec.Unmarshal() = %+v, want %+v", got, want)
+	}
+
+	if _, err := (Codec{}).Unmarshal([]byte("corrupt")); err == nil {
+		t.Error("Codec.Unmarshal() error = nil, want an error on corrupt data")
+	}
+}
+
+func benchmarkCodec(b *testing.B, codec cache.Codec) {
+	response := testResponse(100 << 10)
+	encoded, err := codec.Marshal(response)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("Marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			codec.Marshal(response)
+		}
+	})
+	b.Run("Unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			codec.Unmarshal(encoded)
+		}
+	})
+}
+
+func BenchmarkCodec(b *testing.B) {
+	benchmarkCodec(b, Codec{})
+}
+
+func BenchmarkFrameCodec(b *testing.B) {
+	benchmarkCodec(b, cache.FrameCodec{})
+}
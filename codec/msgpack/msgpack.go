@@ -0,0 +1,47 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package msgpack provides a cache.Codec encoding responses as
+// MessagePack, a compact binary format with libraries for most languages.
+package msgpack
+
+import (
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/vmihailenco/msgpack"
+)
+
+// Codec is the MessagePack codec.
+type Codec struct{}
+
+// Marshal implements the cache Codec interface Marshal method.
+func (Codec) Marshal(r cache.Response) ([]byte, error) {
+	return msgpack.Marshal(&r)
+}
+
+// Unmarshal implements the cache Codec interface Unmarshal method.
+func (Codec) Unmarshal(b []byte) (cache.Response, error) {
+	var r cache.Response
+	err := msgpack.Unmarshal(b, &r)
+	return r, err
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// prefixCodec wraps the default codec with a marker, so that entries it
+// encoded are told apart.
+type prefixCodec struct{}
+
+func (prefixCodec) Marshal(r Response) ([]byte, error) {
+	b, err := FrameCodec{}.Marshal(r)
+	return append([]byte("prefix:"), b...), err
+}
+
+func (prefixCodec) Unmarshal(b []byte) (Response, error) {
+	return FrameCodec{}.Unmarshal(bytes.TrimPrefix(b, []byte("prefix:")))
+}
+
+func TestMiddlewareCodec(t *testing.T) {
+	adapter := &adapterMock{}
+	client, err := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithCodec(prefixCodec{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("value"))
+	}))
+
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "http://foo.bar/codec", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Body.String() != "value" {
+			t.Errorf("*Client.Middleware() body = %v, want value", w.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler calls = %v, want the second response served from the cache", calls)
+	}
+	for _, b := range adapter.store["/codec"] {
+		if !bytes.HasPrefix(b, []byte("prefix:")) {
+			t.Error("*Client.Middleware() did not encode the response with the codec")
+		}
+	}
+
+	if _, err := NewClient(ClientWithAdapter(adapter), ClientWithTTL(time.Minute), ClientWithCodec(nil)); err == nil {
+		t.Error("ClientWithCodec(nil) error = nil, want an error")
+	}
+}
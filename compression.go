@@ -0,0 +1,170 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the algorithm cached bodies are compressed with.
+type Compression uint8
+
+const (
+	// NoCompression leaves cached bodies as they are.
+	NoCompression Compression = iota
+
+	// Gzip compresses cached bodies with gzip.
+	Gzip
+
+	// Snappy compresses cached bodies with Snappy, faster than gzip but
+	// with a lower ratio.
+	Snappy
+
+	// Zstd compresses cached bodies with Zstandard.
+	Zstd
+)
+
+var (
+	gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+	gzipReaders sync.Pool
+
+	// the zstd encoder and decoder are safe for concurrent use through
+	// EncodeAll and DecodeAll
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compress returns the body compressed with the algorithm.
+func (alg Compression) compress(value []byte) ([]byte, error) {
+	switch alg {
+	case Gzip:
+		var b bytes.Buffer
+		w := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(w)
+		w.Reset(&b)
+		if _, err := w.Write(value); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	case Snappy:
+		return snappy.Encode(nil, value), nil
+	case Zstd:
+		return zstdEncoder.EncodeAll(value, nil), nil
+	}
+	return nil, fmt.Errorf("unknown compression %d", alg)
+}
+
+// decompress returns the body compressed with the algorithm as it was
+// before.
+func (alg Compression) decompress(value []byte) ([]byte, error) {
+	switch alg {
+	case Gzip:
+		var (
+			r   *gzip.Reader
+			err error
+		)
+		if pooled, ok := gzipReaders.Get().(*gzip.Reader); ok {
+			r, err = pooled, pooled.Reset(bytes.NewReader(value))
+		} else {
+			r, err = gzip.NewReader(bytes.NewReader(value))
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReaders.Put(r)
+		var b bytes.Buffer
+		b.Grow(4 * len(value))
+		if _, err := io.Copy(&b, r); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	case Snappy:
+		return snappy.Decode(nil, value)
+	case Zstd:
+		return zstdDecoder.DecodeAll(value, nil)
+	}
+	return nil, fmt.Errorf("unknown compression %d", alg)
+}
+
+// compressResponse compresses the body of the response to be stored, when
+// it is large enough and not compressed already.
+func (c *Client) compressResponse(response Response) (Response, error) {
+	if c.compression == NoCompression || len(response.Value) == 0 || len(response.Value) < c.compressionMinSize ||
+		response.Header.Get("Content-Encoding") != "" {
+		return response, nil
+	}
+	value, err := c.compression.compress(response.Value)
+	if err != nil {
+		return response, err
+	}
+	response.Value = value
+	response.Compression = c.compression
+	return response, nil
+}
+
+// decompressResponse restores the body of a cached response. Entries
+// stored uncompressed are returned as they are, whatever the client
+// compression, so that old and new entries can be mixed.
+func decompressResponse(response Response) (Response, error) {
+	if response.Compression == NoCompression {
+		return response, nil
+	}
+	value, err := response.Compression.decompress(response.Value)
+	if err != nil {
+		return response, err
+	}
+	response.Value = value
+	response.Compression = NoCompression
+	return response, nil
+}
+
+// ClientWithCompression sets the algorithm the bodies of at least minSize
+// bytes are compressed with before they are stored, to save adapter
+// memory at the cost of some CPU on every hit. Bodies the handler already
+// encoded, i.e. with a Content-Encoding header, are stored as they are.
+// Default is NoCompression. Optional setting.
+func ClientWithCompression(alg Compression, minSize int) ClientOption {
+	return func(c *Client) error {
+		if alg > Zstd {
+			return fmt.Errorf("cache client compression %d is invalid", alg)
+		}
+		if minSize < 0 {
+			return fmt.Errorf("cache client compression min size %v is invalid", minSize)
+		}
+		c.compression = alg
+		c.compressionMinSize = minSize
+		return nil
+	}
+}
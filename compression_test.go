@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCompression(t *testing.T) {
+	value := bytes.Repeat([]byte("compressible "), 100)
+	for _, alg := range []Compression{Gzip, Snappy, Zstd} {
+		compressed, err := alg.compress(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(compressed) >= len(value) {
+			t.Errorf("Compression(%d).compress() = %v bytes, want less than %v", alg, len(compressed), len(value))
+		}
+		got, err := alg.decompress(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, value) {
+			t.Errorf("Compression(%d).decompress() did not restore the value", alg)
+		}
+		if _, err := alg.decompress([]byte("corrupt")); err == nil {
+			t.Errorf("Compression(%d).decompress() error = nil, want an error on corrupt data", alg)
+		}
+	}
+}
+
+func TestMiddlewareCompression(t *testing.T) {
+	body := bytes.Repeat([]byte("compressible "), 100)
+	tests := []struct {
+		name            string
+		path            string
+		contentEncoding string
+		minSize         int
+		want            Compression
+	}{
+		{"compresses large bodies", "/large", "", 100, Zstd},
+		{"leaves small bodies", "/small", "", 10000, NoCompression},
+		{"leaves encoded bodies", "/encoded", "br", 100, NoCompression},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Minute),
+				ClientWithCompression(Zstd, tt.minSize),
+			)
+			calls := 0
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if tt.contentEncoding != "" {
+					w.Header().Set("Content-Encoding", tt.contentEncoding)
+				}
+				w.Write(body)
+			}))
+
+			for i := 0; i < 2; i++ {
+				r, _ := http.NewRequest("GET", "http://foo.bar"+tt.path, nil)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if !bytes.Equal(w.Body.Bytes(), body) {
+					t.Errorf("*Client.Middleware() body = %v bytes, want %v", w.Body.Len(), len(body))
+				}
+			}
+			if calls != 1 {
+				t.Errorf("handler calls = %v, want 1", calls)
+			}
+			if len(adapter.store[tt.path]) == 0 {
+				t.Fatal("*Client.Middleware() did not store the response")
+			}
+			for _, b := range adapter.store[tt.path] {
+				response, _ := BytesToResponse(b)
+				if response.Compression != tt.want {
+					t.Errorf("stored response compression = %v, want %v", response.Compression, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareMixedCompression(t *testing.T) {
+	// an entry stored before compression was enabled
+	adapter := &adapterMock{
+		store: map[string]map[string][]byte{
+			"/old": {
+				generateKey("http://foo.bar/old"): Response{
+					Value:      []byte("old"),
+					Expiration: time.Now().Add(1 * time.Minute),
+				}.Bytes(),
+			},
+		},
+	}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithCompression(Gzip, 0),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new"))
+	}))
+
+	r, _ := http.NewRequest("GET", "http://foo.bar/old", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Body.String() != "old" {
+		t.Errorf("*Client.Middleware() body = %v, want old", w.Body.String())
+	}
+}
+
+func TestClientWithCompression(t *testing.T) {
+	for _, opt := range []ClientOption{ClientWithCompression(Zstd+1, 0), ClientWithCompression(Gzip, -1)} {
+		if _, err := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(time.Minute), opt); err == nil {
+			t.Error("ClientWithCompression() error = nil, want an error")
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// validatorHeaders are the cached headers sent along a 304 Not Modified.
+var validatorHeaders = []string{
+	"Cache-Control",
+	"Content-Location",
+	"Date",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+	"Vary",
+}
+
+// conditionalHeaders are the request headers the handler may answer with
+// a 304 Not Modified.
+var conditionalHeaders = []string{
+	"If-Modified-Since",
+	"If-None-Match",
+}
+
+// weakETag generates a weak entity tag from the response body.
+func weakETag(value []byte) string {
+	hash := fnv.New64a()
+	hash.Write(value)
+
+	return fmt.Sprintf(`W/"%x"`, hash.Sum64())
+}
+
+// notModified reports whether the request conditional headers are
+// satisfied by the cached response, so that a 304 can be served instead.
+func notModified(r *http.Request, response Response) bool {
+	if response.statusCode() != http.StatusOK {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, response.Header.Get("ETag"))
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified := response.CachedAt
+	if lm, err := http.ParseTime(response.Header.Get("Last-Modified")); err == nil {
+		modified = lm
+	}
+	if modified.IsZero() {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(ims)
+}
+
+// withoutConditionals returns a copy of the request without its
+// conditional headers, or the request itself when it has none.
+func withoutConditionals(r *http.Request) *http.Request {
+	conditional := false
+	for _, name := range conditionalHeaders {
+		if _, ok := r.Header[name]; ok {
+			conditional = true
+		}
+	}
+	if !conditional {
+		return r
+	}
+	stripped := r.WithContext(r.Context())
+	stripped.Header = make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		stripped.Header[k] = v
+	}
+	for _, name := range conditionalHeaders {
+		delete(stripped.Header, name)
+	}
+	return stripped
+}
+
+// replyConditional answers the conditional request with the handler
+// response, or with a 304 when the response satisfies its conditionals.
+func (c *Client) replyConditional(w http.ResponseWriter, r *http.Request, result *http.Response, value []byte) {
+	response := Response{Header: result.Header, StatusCode: result.StatusCode, CachedAt: time.Now()}
+	if notModified(r, response) {
+		c.writeValidators(w.Header(), result.Header)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	c.writeHeader(w.Header(), result.Header)
+	w.WriteHeader(result.StatusCode)
+	w.Write(value)
+}
+
+// etagMatches implements the weak comparison of an If-None-Match list
+// against the cached entity tag.
+func etagMatches(list, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeValidators copies the headers allowed on a 304 response.
+func (c *Client) writeValidators(dst, src http.Header) {
+	for _, name := range validatorHeaders {
+		if v := src[http.CanonicalHeaderKey(name)]; len(v) > 0 {
+			c.writeField(dst, http.CanonicalHeaderKey(name), v)
+		}
+	}
+}
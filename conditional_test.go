@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareConditional(t *testing.T) {
+	lastModified := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tagged" {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		}
+		w.Write([]byte("value"))
+	})
+
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	for _, u := range []string{"http://foo.bar/tagged", "http://foo.bar/untagged"} {
+		r, _ := http.NewRequest("GET", u, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		header   http.Header
+		wantCode int
+		wantBody string
+	}{
+		{
+			"matches upstream etag",
+			"http://foo.bar/tagged",
+			http.Header{"If-None-Match": {`"v0", "v1"`}},
+			304,
+			"",
+		},
+		{
+			"matches weak etag",
+			"http://foo.bar/tagged",
+			http.Header{"If-None-Match": {`W/"v1"`}},
+			304,
+			"",
+		},
+		{
+			"does not match etag",
+			"http://foo.bar/tagged",
+			http.Header{"If-None-Match": {`"v0"`}},
+			200,
+			"value",
+		},
+		{
+			"if-none-match takes precedence over if-modified-since",
+			"http://foo.bar/tagged",
+			http.Header{
+				"If-None-Match":     {`"v0"`},
+				"If-Modified-Since": {lastModified.Format(http.TimeFormat)},
+			},
+			200,
+			"value",
+		},
+		{
+			"not modified since last-modified",
+			"http://foo.bar/tagged",
+			http.Header{"If-Modified-Since": {lastModified.Format(http.TimeFormat)}},
+			304,
+			"",
+		},
+		{
+			"modified since",
+			"http://foo.bar/tagged",
+			http.Header{"If-Modified-Since": {lastModified.Add(-time.Hour).Format(http.TimeFormat)}},
+			200,
+			"value",
+		},
+		{
+			"matches generated etag",
+			"http://foo.bar/untagged",
+			http.Header{"If-None-Match": {weakETag([]byte("value"))}},
+			304,
+			"",
+		},
+		{
+			"not modified since entry creation",
+			"http://foo.bar/untagged",
+			http.Header{"If-Modified-Since": {time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}},
+			304,
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", tt.url, nil)
+			r.Header = tt.header
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("*Client.Middleware() code = %v, want %v", w.Code, tt.wantCode)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), tt.wantBody)
+			}
+			if w.Header().Get("ETag") == "" {
+				t.Error("*Client.Middleware() ETag is missing")
+			}
+		})
+	}
+}
+
+func TestMiddlewareConditionalMiss(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []ClientOption
+		header   http.Header
+		wantCode int
+		wantBody string
+		wantTTL  bool
+	}{
+		{
+			"answers 304 from the full response",
+			nil,
+			http.Header{"If-None-Match": {`"v1"`}},
+			304,
+			"",
+			false,
+		},
+		{
+			"answers the full response when modified",
+			nil,
+			http.Header{"If-None-Match": {`"v0"`}},
+			200,
+			"value",
+			false,
+		},
+		{
+			"answers 304 on if-modified-since",
+			nil,
+			http.Header{"If-Modified-Since": {time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)}},
+			304,
+			"",
+			false,
+		},
+		{
+			"sets the ttl header",
+			[]ClientOption{ClientWithTTLHeader("X-Cache-TTL")},
+			http.Header{"If-None-Match": {`"v0"`}},
+			200,
+			"value",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var conditionals []string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conditionals = append(conditionals, r.Header.Get("If-None-Match")+r.Header.Get("If-Modified-Since"))
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Last-Modified", time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat))
+				if r.Header.Get("If-None-Match") == `"v1"` || r.Header.Get("If-Modified-Since") != "" {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Write([]byte("value"))
+			})
+			opts := append([]ClientOption{ClientWithAdapter(&adapterMock{}), ClientWithTTL(1 * time.Minute)}, tt.opts...)
+			client, _ := NewClient(opts...)
+			cached := client.Middleware(handler)
+
+			r, _ := http.NewRequest("GET", "http://foo.bar/conditional", nil)
+			r.Header = tt.header
+			w := httptest.NewRecorder()
+			cached.ServeHTTP(w, r)
+			if w.Code != tt.wantCode {
+				t.Errorf("*Client.Middleware() code = %v, want %v", w.Code, tt.wantCode)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("*Client.Middleware() = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if got := w.Header().Get("ETag"); got != `"v1"` {
+				t.Errorf("*Client.Middleware() ETag = %q, want %q", got, `"v1"`)
+			}
+			if got := w.Header().Get("X-Cache-TTL") != ""; got != tt.wantTTL {
+				t.Errorf("*Client.Middleware() ttl header set = %v, want %v", got, tt.wantTTL)
+			}
+
+			// the full response was cached, rather than the 304
+			r, _ = http.NewRequest("GET", "http://foo.bar/conditional", nil)
+			w = httptest.NewRecorder()
+			cached.ServeHTTP(w, r)
+			if w.Code != 200 || w.Body.String() != "value" {
+				t.Errorf("*Client.Middleware() next = %v %q, want 200 %q", w.Code, w.Body.String(), "value")
+			}
+			if !reflect.DeepEqual(conditionals, []string{""}) {
+				t.Errorf("handler conditionals = %q, want a single unconditional call", conditionals)
+			}
+		})
+	}
+}
+
+func TestMiddlewareNotModifiedNotCached(t *testing.T) {
+	calls := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotModified)
+	})
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithCacheableStatusCodes(http.StatusOK, http.StatusNotModified),
+	)
+	cached := client.Middleware(handler)
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "http://foo.bar/304", nil)
+		cached.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if calls != 2 {
+		t.Errorf("handler calls = %v, want 2", calls)
+	}
+}
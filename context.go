@@ -0,0 +1,192 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// ContextAdapter is implemented by adapters taking the context of the
+// request they serve, e.g. to enforce timeouts, stop on cancellation or
+// trace their calls. The client prefers it over the Adapter methods and
+// the CheckedAdapter and TTLSetter ones. Requests pass their own context,
+// while background work, such as revalidations and the Client release
+// methods, passes the client context.
+type ContextAdapter interface {
+	// GetContext retrieves the cached response by a given key. The
+	// error is only set when the adapter failed to look it up.
+	GetContext(ctx context.Context, prefix, key string) ([]byte, bool, error)
+
+	// ExistsContext reports whether the response by a given key is
+	// cached.
+	ExistsContext(ctx context.Context, prefix, key string) (bool, error)
+
+	// SetContext caches the response by a given key for the given
+	// duration. Adapters unable to expire responses natively may ignore
+	// the ttl.
+	SetContext(ctx context.Context, prefix, key string, response []byte, ttl time.Duration) error
+
+	// ReleaseContext frees cache for a given key and returns the number
+	// of released responses.
+	ReleaseContext(ctx context.Context, prefix, key string) (int, error)
+
+	// ReleasePrefixContext frees the cached responses of a given prefix.
+	ReleasePrefixContext(ctx context.Context, prefix string) (int, error)
+
+	// ReleaseIfStartsWithContext frees the cached responses of the
+	// prefixes starting with a given string.
+	ReleaseIfStartsWithContext(ctx context.Context, key string) (int, error)
+}
+
+// release frees cache for a given key.
+func (c *Client) release(ctx context.Context, prefix, key string) (int, error) {
+	if a, ok := c.optional().(ContextAdapter); ok {
+		return a.ReleaseContext(ctx, prefix, key)
+	}
+	return c.adapter.Release(prefix, key)
+}
+
+// releasePrefix frees the cached responses of a given prefix.
+func (c *Client) releasePrefix(ctx context.Context, prefix string) (int, error) {
+	if a, ok := c.optional().(ContextAdapter); ok {
+		return a.ReleasePrefixContext(ctx, prefix)
+	}
+	return c.adapter.ReleasePrefix(prefix)
+}
+
+// releaseIfStartsWith frees the cached responses of the prefixes starting
+// with a given string.
+func (c *Client) releaseIfStartsWith(ctx context.Context, key string) (int, error) {
+	if a, ok := c.optional().(ContextAdapter); ok {
+		return a.ReleaseIfStartsWithContext(ctx, key)
+	}
+	return c.adapter.ReleaseIfStartsWith(key)
+}
+
+// background returns the context of the adapter calls made outside of a
+// request. It carries the client context values, but is never canceled,
+// so that the Client methods keep working after Close.
+func (c *Client) background() context.Context {
+	return detach(c.ctx)
+}
+
+// detach returns a context carrying the values of ctx, but neither its
+// deadline nor its cancellation, e.g. to store a response once the
+// request it answered is gone.
+func detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
+
+// detached is the context returned by detach.
+type detached struct {
+	parent context.Context
+}
+
+func (detached) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detached) Done() <-chan struct{}               { return nil }
+func (detached) Err() error                          { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// outliving returns a context carrying the values of the request context
+// ctx, e.g. its prefix, credentials or trace, but canceled along with the
+// client rather than the request, to refresh a response in the
+// background.
+func (c *Client) outliving(ctx context.Context) context.Context {
+	return rebound{Context: c.ctx, values: ctx}
+}
+
+// rebound is the context returned by outliving.
+type rebound struct {
+	context.Context
+	values context.Context
+}
+
+func (r rebound) Value(key interface{}) interface{} { return r.values.Value(key) }
+
+// prefixKey is the context key of the prefix set by WithPrefix.
+type prefixKey struct{}
+
+// WithPrefix returns a copy of the context making the middleware cache the
+// response to its request by the given prefix, in place of the request
+// path, e.g. the route pattern matched by a router. It takes precedence
+// over the prefix function, but not over a key generator. Release, Exists,
+// Peek and SoftRelease can't know it from their URI, so they find nothing:
+// use ReleaseURI with the prefix, or ReleaseRequest, instead.
+func WithPrefix(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, prefixKey{}, prefix)
+}
+
+// bypassKey is the context key of the flag set by WithBypass.
+type bypassKey struct{}
+
+// WithBypass returns a copy of the context making the middleware neither
+// serve the response to its request from the cache nor store it, as if
+// the request was not cacheable.
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// Bypassed reports whether the context was returned by WithBypass.
+func Bypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
+
+// foregroundKey is the context key of the flag set by
+// WithoutBackgroundRefresh.
+type foregroundKey struct{}
+
+// WithoutBackgroundRefresh returns a copy of the context keeping the
+// middleware from calling the handler for its request once the request is
+// over, e.g. for frameworks reusing their request state. A stale response
+// is then refreshed by the request itself, being served only when the
+// handler fails, and fresh responses are not refreshed early.
+func WithoutBackgroundRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, foregroundKey{}, true)
+}
+
+// refreshesInBackground reports whether the response to the request of
+// the context may be refreshed in the background.
+func refreshesInBackground(ctx context.Context) bool {
+	foreground, _ := ctx.Value(foregroundKey{}).(bool)
+	return !foreground
+}
+
+// ttlKey is the context key of the ttl set by WithTTL.
+type ttlKey struct{}
+
+// WithTTL returns a copy of the context making the middleware store the
+// response to its request for the given ttl, in place of the one the
+// client would assign it. The response may still forbid storing.
+func WithTTL(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, ttlKey{}, ttl)
+}
+
+// TTLFromContext returns the ttl set by WithTTL, if any.
+func TTLFromContext(ctx context.Context) (time.Duration, bool) {
+	ttl, ok := ctx.Value(ttlKey{}).(time.Duration)
+	return ttl, ok
+}
@@ -0,0 +1,278 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type contextKey string
+
+type contextAdapterMock struct {
+	adapterMock
+	mutex sync.Mutex
+	ctxs  map[string]context.Context
+}
+
+func (a *contextAdapterMock) record(op string, ctx context.Context) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.ctxs == nil {
+		a.ctxs = make(map[string]context.Context)
+	}
+	a.ctxs[op] = ctx
+}
+
+func (a *contextAdapterMock) ctx(op string) context.Context {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.ctxs[op]
+}
+
+func (a *contextAdapterMock) GetContext(ctx context.Context, prefix, key string) ([]byte, bool, error) {
+	a.record("get", ctx)
+	b, ok := a.Get(prefix, key)
+	return b, ok, nil
+}
+
+func (a *contextAdapterMock) ExistsContext(ctx context.Context, prefix, key string) (bool, error) {
+	a.record("exists", ctx)
+	return a.Exists(prefix, key), nil
+}
+
+func (a *contextAdapterMock) SetContext(ctx context.Context, prefix, key string, response []byte, ttl time.Duration) error {
+	a.record("set", ctx)
+	a.Set(prefix, key, response)
+	return nil
+}
+
+func (a *contextAdapterMock) ReleaseContext(ctx context.Context, prefix, key string) (int, error) {
+	a.record("release", ctx)
+	return a.Release(prefix, key)
+}
+
+func (a *contextAdapterMock) ReleasePrefixContext(ctx context.Context, prefix string) (int, error) {
+	a.record("releasePrefix", ctx)
+	return a.ReleasePrefix(prefix)
+}
+
+func (a *contextAdapterMock) ReleaseIfStartsWithContext(ctx context.Context, key string) (int, error) {
+	a.record("releaseIfStartsWith", ctx)
+	return a.ReleaseIfStartsWith(key)
+}
+
+func TestMiddlewareContextAdapter(t *testing.T) {
+	adapter := &contextAdapterMock{}
+	clientCtx := context.WithValue(context.Background(), contextKey("from"), "client")
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithContext(clientCtx),
+	)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey("from"), "request"))
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the client disconnects while the handler is working
+		cancel()
+		w.Write([]byte("value"))
+	}))
+	r, _ := http.NewRequest("GET", "http://foo.bar/context", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(ctx))
+
+	if got := adapter.ctx("get"); got == nil || got.Value(contextKey("from")) != "request" {
+		t.Errorf("ContextAdapter.GetContext() was not given the request context")
+	}
+	set := adapter.ctx("set")
+	if set == nil || set.Value(contextKey("from")) != "request" {
+		t.Fatalf("ContextAdapter.SetContext() was not given the request context")
+	}
+	if set.Err() != nil {
+		t.Errorf("ContextAdapter.SetContext() ctx.Err() = %v, want the store to outlive the request", set.Err())
+	}
+
+	client.Release("http://foo.bar/context")
+	client.ReleaseURI("/context")
+	for _, op := range []string{"release", "releasePrefix"} {
+		if got := adapter.ctx(op); got == nil || got.Value(contextKey("from")) != "client" {
+			t.Errorf("ContextAdapter %v was not given the client context", op)
+		}
+	}
+}
+
+func TestDetach(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.WithValue(context.Background(), contextKey("k"), "v"), time.Minute)
+	cancel()
+
+	ctx := detach(parent)
+	if ctx.Err() != nil || ctx.Done() != nil {
+		t.Errorf("detach() ctx.Err() = %v, want a context never done", ctx.Err())
+	}
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("detach() kept the parent deadline")
+	}
+	if got := ctx.Value(contextKey("k")); got != "v" {
+		t.Errorf("detach() ctx.Value() = %v, want v", got)
+	}
+}
+
+func TestOutliving(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+	)
+	parent, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey("k"), "v"))
+	cancel()
+
+	ctx := client.outliving(parent)
+	if ctx.Err() != nil {
+		t.Errorf("*Client.outliving() ctx.Err() = %v, want nil", ctx.Err())
+	}
+	if got := ctx.Value(contextKey("k")); got != "v" {
+		t.Errorf("*Client.outliving() ctx.Value() = %v, want v", got)
+	}
+	client.Close()
+	if ctx.Err() == nil {
+		t.Error("*Client.outliving() ctx is not canceled with the client")
+	}
+}
+
+func TestWithPrefix(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithPrefixFunc(func(r *http.Request) string { return "/func" }),
+	)
+	tests := []struct {
+		name   string
+		prefix string
+		want   string
+	}{
+		{"uses the context prefix", "/users/{id}", "/users/{id}"},
+		{"falls back to the prefix function", "", "/func"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/users/1", nil)
+			r = r.WithContext(WithPrefix(r.Context(), tt.prefix))
+			if prefix, _ := client.GeneratePrefixAndKey(r); prefix != tt.want {
+				t.Errorf("*Client.GeneratePrefixAndKey() prefix = %v, want %v", prefix, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareWithBypass(t *testing.T) {
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+	)
+	calls := 0
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("value"))
+	}))
+
+	// populate the cache, then bypass it
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/bypass", nil))
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "/bypass?fresh=1", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(WithBypass(r.Context())))
+	}
+	r := httptest.NewRequest("GET", "/bypass", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(WithBypass(r.Context())))
+
+	if calls != 4 {
+		t.Errorf("*Client.Middleware() called the handler %v times, want 4", calls)
+	}
+	if got := len(adapter.store["/bypass"]); got != 1 {
+		t.Errorf("*Client.Middleware() stored %v responses, want 1", got)
+	}
+}
+
+func TestMiddlewareWithoutBackgroundRefresh(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		want       string
+	}{
+		{"refreshes the stale response in the foreground", http.StatusOK, "new value"},
+		{"serves the stale response on server error", http.StatusInternalServerError, "old value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			adapter.Set("/foreground", generateKey("http://foo.bar/foreground"), Response{
+				Value:      []byte("old value"),
+				Expiration: time.Now().Add(-1 * time.Second),
+			}.Bytes())
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Minute),
+				ClientWithStaleWhileRevalidate(1*time.Minute),
+			)
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte("new value"))
+			}))
+
+			r := httptest.NewRequest("GET", "http://foo.bar/foreground", nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r.WithContext(WithoutBackgroundRefresh(r.Context())))
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("*Client.Middleware() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareWithTTL(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		set        bool
+		wantStored bool
+		wantTTL    time.Duration
+	}{
+		{"uses the client ttl", 0, false, true, 1 * time.Minute},
+		{"overrides the client ttl", 1 * time.Hour, true, true, 1 * time.Hour},
+		{"skips storing with a zero ttl", 0, true, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Minute),
+			)
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("value"))
+			}))
+			r := httptest.NewRequest("GET", "/ttl", nil)
+			if tt.set {
+				r = r.WithContext(WithTTL(r.Context(), tt.ttl))
+			}
+			start := time.Now()
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			var stored []byte
+			for _, b := range adapter.store["/ttl"] {
+				stored = b
+			}
+			if (stored != nil) != tt.wantStored {
+				t.Fatalf("*Client.Middleware() stored = %v, want %v", stored != nil, tt.wantStored)
+			}
+			if stored == nil {
+				return
+			}
+			response, _ := BytesToResponse(stored)
+			if ttl := response.Expiration.Sub(start); ttl < tt.wantTTL || ttl > tt.wantTTL+time.Second {
+				t.Errorf("*Client.Middleware() stored for %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
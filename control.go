@@ -0,0 +1,99 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The internal response headers by which the handler controls the caching
+// of its response: "X-Http-Cache: no-store" skips storing it, and
+// "X-Http-Cache-TTL: 30s" stores it for the given duration, or number of
+// seconds, in place of the ttl of the client. They are never written to
+// the client.
+const (
+	controlHeader    = "X-Http-Cache"
+	controlTTLHeader = "X-Http-Cache-Ttl"
+)
+
+// NoStore makes the middleware skip storing the response being written to
+// w, e.g. when the handler fell back to a degraded result. It must be
+// called before the header is written.
+func NoStore(w http.ResponseWriter) {
+	w.Header().Set(controlHeader, "no-store")
+}
+
+// StoreFor makes the middleware store the response being written to w for
+// the given ttl, in place of the one the client would assign it. It must
+// be called before the header is written.
+func StoreFor(w http.ResponseWriter, ttl time.Duration) {
+	w.Header().Set(controlTTLHeader, ttl.String())
+}
+
+// responseControl is the caching of a response set by its handler through
+// the control headers.
+type responseControl struct {
+	noStore bool
+	ttl     time.Duration
+	hasTTL  bool
+}
+
+// parseControl reads the control headers of h. A ttl that does not parse
+// is ignored.
+func parseControl(h http.Header) responseControl {
+	var ctl responseControl
+	for _, v := range h[controlHeader] {
+		for _, directive := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+				ctl.noStore = true
+			}
+		}
+	}
+	if v := strings.TrimSpace(h.Get(controlTTLHeader)); v != "" {
+		if ttl, err := time.ParseDuration(v); err == nil {
+			ctl.ttl, ctl.hasTTL = ttl, true
+		} else if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+			ctl.ttl, ctl.hasTTL = time.Duration(seconds)*time.Second, true
+		}
+	}
+	return ctl
+}
+
+// takeControl reads the control headers of h and removes them.
+func takeControl(h http.Header) responseControl {
+	ctl := parseControl(h)
+	h.Del(controlHeader)
+	h.Del(controlTTLHeader)
+	return ctl
+}
+
+// isControlHeader reports whether the canonical header name is one of the
+// control headers.
+func isControlHeader(name string) bool {
+	return name == controlHeader || name == controlTTLHeader
+}
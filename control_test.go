@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseControl(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   responseControl
+	}{
+		{"no header", http.Header{}, responseControl{}},
+		{"no-store", http.Header{"X-Http-Cache": {"No-Store"}}, responseControl{noStore: true}},
+		{"other directives", http.Header{"X-Http-Cache": {"private, no-store"}}, responseControl{noStore: true}},
+		{"duration", http.Header{"X-Http-Cache-Ttl": {"30s"}}, responseControl{ttl: 30 * time.Second, hasTTL: true}},
+		{"seconds", http.Header{"X-Http-Cache-Ttl": {"90"}}, responseControl{ttl: 90 * time.Second, hasTTL: true}},
+		{"invalid ttl", http.Header{"X-Http-Cache-Ttl": {"soon"}}, responseControl{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseControl(tt.header); got != tt.want {
+				t.Errorf("parseControl() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareControlHeaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		status     int
+		control    func(w http.ResponseWriter)
+		wantCalls  int
+		wantStored bool
+		wantTTL    time.Duration
+	}{
+		{"stores the response", "GET", http.StatusOK, nil, 1, true, 1 * time.Minute},
+		{"skips storing the response", "GET", http.StatusOK, NoStore, 2, false, 0},
+		{"overrides the ttl", "GET", http.StatusOK, func(w http.ResponseWriter) { StoreFor(w, 1*time.Hour) }, 1, true, 1 * time.Hour},
+		{"overrides the ttl in seconds", "GET", http.StatusOK, func(w http.ResponseWriter) { w.Header().Set("X-Http-Cache-TTL", "30") }, 1, true, 30 * time.Second},
+		{"keeps the status code rules", "GET", http.StatusInternalServerError, func(w http.ResponseWriter) { StoreFor(w, 1*time.Hour) }, 2, false, 0},
+		{"hides the headers on uncached requests", "POST", http.StatusOK, NoStore, 2, false, 0},
+		{"hides the ttl header on uncached requests", "POST", http.StatusOK, func(w http.ResponseWriter) { StoreFor(w, 1*time.Hour) }, 2, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Minute),
+			)
+			calls := 0
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if tt.control != nil {
+					tt.control(w)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte("value"))
+			}))
+
+			start := time.Now()
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(tt.method, "/control", nil))
+				for _, name := range []string{controlHeader, controlTTLHeader} {
+					if _, ok := w.Header()[name]; ok {
+						t.Errorf("*Client.Middleware() sent the %v header", name)
+					}
+				}
+				if w.Body.String() != "value" {
+					t.Errorf("*Client.Middleware() body = %q, want %q", w.Body.String(), "value")
+				}
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("*Client.Middleware() called the handler %v times, want %v", calls, tt.wantCalls)
+			}
+			var stored []byte
+			for _, b := range adapter.store["/control"] {
+				stored = b
+			}
+			if (stored != nil) != tt.wantStored {
+				t.Fatalf("*Client.Middleware() stored = %v, want %v", stored != nil, tt.wantStored)
+			}
+			if stored == nil {
+				return
+			}
+			response, _ := BytesToResponse(stored)
+			for _, name := range []string{controlHeader, controlTTLHeader} {
+				if _, ok := response.Header[name]; ok {
+					t.Errorf("*Client.Middleware() cached the %v header", name)
+				}
+			}
+			if ttl := response.Expiration.Sub(start); ttl < tt.wantTTL || ttl > tt.wantTTL+time.Second {
+				t.Errorf("*Client.Middleware() stored for %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+)
+
+// CookiePolicy sets how the requests carrying cookies are cached.
+type CookiePolicy struct {
+	bypass bool
+	named  bool
+	names  []string
+}
+
+var (
+	// IgnoreCookies caches the responses to requests carrying cookies
+	// along with the other ones. It is the default policy.
+	IgnoreCookies = CookiePolicy{}
+
+	// BypassCookies sends the requests carrying any cookie to the
+	// handler without caching their responses.
+	BypassCookies = CookiePolicy{bypass: true}
+)
+
+// KeyOnNamedCookies returns the policy keeping the responses to requests
+// carrying different values of the named cookies apart. The values are
+// hashed before being mixed into the keys.
+func KeyOnNamedCookies(names ...string) CookiePolicy {
+	return CookiePolicy{named: true, names: names}
+}
+
+// BypassOnNamedCookies returns the policy sending the requests carrying
+// any of the named cookies to the handler without caching their
+// responses.
+func BypassOnNamedCookies(names ...string) CookiePolicy {
+	return CookiePolicy{bypass: true, named: true, names: names}
+}
+
+// bypasses reports whether the request cookies make it skip the cache.
+func (p CookiePolicy) bypasses(r *http.Request) bool {
+	if !p.bypass {
+		return false
+	}
+	if !p.named {
+		return len(r.Cookies()) > 0
+	}
+	for _, name := range p.names {
+		if _, err := r.Cookie(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// cookieKey returns the part of the key made of the hashed values of the
+// named cookies the request carries, if any.
+func (c *Client) cookieKey(r *http.Request) string {
+	if c.cookiePolicy.bypass || !c.cookiePolicy.named {
+		return ""
+	}
+	var b bytes.Buffer
+	for _, name := range c.cookiePolicy.names {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			continue
+		}
+		b.WriteString("\ncookie ")
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(c.hash(cookie.Value))
+	}
+	return b.String()
+}
+
+// ClientWithCookiePolicy sets how the requests carrying cookies are
+// cached: along with the other ones by default, bypassing the cache, or
+// keyed on the values of some cookies, e.g. a session cookie. Responses
+// keyed on cookies share their prefix with the anonymous ones, so that
+// ReleasePrefix frees them all, whereas Release only frees the anonymous
+// one. Optional setting.
+func ClientWithCookiePolicy(policy CookiePolicy) ClientOption {
+	return func(c *Client) error {
+		if policy.named && len(policy.names) == 0 {
+			return errors.New("cache client cookie policy names are not set")
+		}
+		for _, name := range policy.names {
+			if name == "" {
+				return errors.New("cache client cookie policy name is empty")
+			}
+		}
+		c.cookiePolicy = policy
+		return nil
+	}
+}
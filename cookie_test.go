@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareCookiePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    CookiePolicy
+		cookies   []string
+		wantCalls int
+	}{
+		{
+			"ignores cookies by default",
+			IgnoreCookies,
+			[]string{"", "session=a", "session=b"},
+			1,
+		},
+		{
+			"bypasses requests with cookies",
+			BypassCookies,
+			[]string{"", "", "theme=dark", "theme=dark"},
+			3,
+		},
+		{
+			"keys on named cookies",
+			KeyOnNamedCookies("session"),
+			[]string{"", "session=a", "session=a; theme=dark", "session=b", "theme=dark", ""},
+			3,
+		},
+		{
+			"bypasses requests with named cookies",
+			BypassOnNamedCookies("session"),
+			[]string{"", "theme=dark", "session=a", "session=a"},
+			3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Write([]byte("value"))
+			})
+			client, err := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithCookiePolicy(tt.policy),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cached := client.Middleware(handler)
+			for _, cookie := range tt.cookies {
+				r, _ := http.NewRequest("GET", "http://foo.bar/page", nil)
+				if cookie != "" {
+					r.Header.Set("Cookie", cookie)
+				}
+				cached.ServeHTTP(httptest.NewRecorder(), r)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCookieKey(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithCookiePolicy(KeyOnNamedCookies("session")),
+		ClientWithKeyGenerator(func(r *http.Request) (string, string) { return "/page", "page" }),
+	)
+	r, _ := http.NewRequest("GET", "http://foo.bar/page", nil)
+	r.Header.Set("Cookie", "session=secret-token")
+
+	if part := client.cookieKey(r); part == "" || strings.Contains(part, "secret-token") {
+		t.Errorf("*Client.cookieKey() = %q, want the hashed session value", part)
+	}
+	if _, key := client.GeneratePrefixAndKey(r); key == "page" {
+		t.Errorf("*Client.GeneratePrefixAndKey() key = %q, want the generated key mixed with the cookie", key)
+	}
+}
+
+func TestClientWithCookiePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  CookiePolicy
+		wantErr bool
+	}{
+		{"accepts ignore", IgnoreCookies, false},
+		{"accepts bypass", BypassCookies, false},
+		{"accepts named cookies", KeyOnNamedCookies("session", "cart"), false},
+		{"requires names to key on", KeyOnNamedCookies(), true},
+		{"requires names to bypass on", BypassOnNamedCookies(), true},
+		{"rejects empty names", BypassOnNamedCookies("session", ""), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithCookiePolicy(tt.policy),
+			)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ClientWithCookiePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// earlyRefreshKey marks the background requests refreshing a response
+// before it expires.
+type earlyRefreshKey struct{}
+
+// isEarlyRefresh reports whether the request refreshes a response before
+// it expires.
+func isEarlyRefresh(r *http.Request) bool {
+	early, _ := r.Context().Value(earlyRefreshKey{}).(bool)
+	return early
+}
+
+// earlyRefreshPruning is the number of keys looked at on each early
+// refresh to forget the ones that may be refreshed again. Maps are ranged
+// over from a random key, so that the keys kept are at most about a third
+// more than the ones still rate limited.
+const earlyRefreshPruning = 4
+
+// refreshEarly refreshes the fresh cached response served to the request
+// in the background when it is about to expire, i.e. within the last
+// fraction of its ttl set by ClientWithEarlyRefresh. After an attempt,
+// the key is not refreshed again until half of the time left before the
+// expiration has passed, so that a failing handler is not called on every
+// hit.
+func (c *Client) refreshEarly(ctxlog Logger, next http.Handler, r *http.Request, prefix, key string, response Response, now time.Time) {
+	if c.earlyRefresh == 0 || !refreshesInBackground(r.Context()) {
+		return
+	}
+	ttl := response.Expiration.Sub(response.CachedAt)
+	left := response.Expiration.Sub(now)
+	if ttl <= 0 || float64(left) >= c.earlyRefresh*float64(ttl) {
+		return
+	}
+
+	id := prefix + "\x00" + key
+	c.revalidateMutex.Lock()
+	if after, ok := c.earlyRefreshes[id]; ok && now.Before(after) {
+		c.revalidateMutex.Unlock()
+		return
+	}
+	if c.earlyRefreshes == nil {
+		c.earlyRefreshes = make(map[string]time.Time)
+	}
+	// forget a few of the keys that may be refreshed again, rather than
+	// every key ever refreshed, in constant time under the lock
+	i := 0
+	for other, after := range c.earlyRefreshes {
+		if i == earlyRefreshPruning {
+			break
+		}
+		if !now.Before(after) {
+			delete(c.earlyRefreshes, other)
+		}
+		i++
+	}
+	c.earlyRefreshes[id] = now.Add(left / 2)
+	c.revalidateMutex.Unlock()
+
+	ctxlog.Debugf("requested object expires soon - refreshing it in the background")
+	ctx := context.WithValue(c.outliving(r.Context()), earlyRefreshKey{}, true)
+	c.refresh(ctxlog, next, r.WithContext(ctx), prefix, key)
+}
+
+// ClientWithEarlyRefresh refreshes the cached responses in the background
+// when they are served within the last fraction of their ttl, e.g. 0.1
+// for the last 10%, so that the requests to hot keys never wait for the
+// handler. Only requested keys are refreshed, by a single request at a
+// time, and a refresh failing with an error status code keeps the cached
+// response. Optional setting.
+func ClientWithEarlyRefresh(fraction float64) ClientOption {
+	return func(c *Client) error {
+		if fraction <= 0 || fraction >= 1 {
+			return fmt.Errorf("cache client early refresh fraction %v is invalid", fraction)
+		}
+		c.earlyRefresh = fraction
+		return nil
+	}
+}
@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareEarlyRefresh(t *testing.T) {
+	tests := []struct {
+		name       string
+		age        time.Duration
+		statusCode int
+		hits       int
+		wantCalls  int32
+		wantKept   bool
+	}{
+		{"refreshes within the last fraction of the ttl", 55 * time.Second, http.StatusOK, 1, 1, false},
+		{"does not refresh before", 30 * time.Second, http.StatusOK, 1, 0, true},
+		{"keeps the response on a failed refresh", 55 * time.Second, http.StatusNotFound, 1, 1, true},
+		{"keeps the response on a server error", 55 * time.Second, http.StatusInternalServerError, 1, 1, true},
+		{"rate limits the refreshes of a key", 55 * time.Second, http.StatusInternalServerError, 5, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			client, err := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(time.Minute),
+				ClientWithEarlyRefresh(0.1),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var calls int32
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte("fresh"))
+			}))
+
+			r := httptest.NewRequest("GET", "http://foo.bar/early", nil)
+			prefix, key := client.GeneratePrefixAndKey(r)
+			cachedAt := time.Now().Add(-tt.age)
+			expiration := cachedAt.Add(time.Minute)
+			adapter.Set(prefix, key, Response{
+				Value:      []byte("cached"),
+				StatusCode: http.StatusOK,
+				Expiration: expiration,
+				CachedAt:   cachedAt,
+			}.Bytes())
+
+			for i := 0; i < tt.hits; i++ {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Body.String() != "cached" {
+					t.Fatalf("hit %v body = %q, want cached", i, w.Body.String())
+				}
+				// let the refresh finish, so that only the rate limit
+				// keeps the next hits from refreshing again
+				waitRevalidations(t, client)
+			}
+			client.Close()
+
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("handler calls = %v, want %v", got, tt.wantCalls)
+			}
+			b, ok := adapter.Get(prefix, key)
+			if !ok {
+				t.Fatal("the cached response was released")
+			}
+			response, _ := BytesToResponse(b)
+			if kept := response.Expiration.Equal(expiration); kept != tt.wantKept {
+				t.Errorf("cached response kept = %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+// waitRevalidations waits for the background refreshes to finish.
+func waitRevalidations(t *testing.T, c *Client) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.revalidateMutex.Lock()
+		n := len(c.revalidating)
+		c.revalidateMutex.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("the background refreshes did not finish")
+}
+
+func TestMiddlewareEarlyRefreshContext(t *testing.T) {
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(time.Minute),
+		ClientWithEarlyRefresh(0.1),
+	)
+	var prefix atomic.Value
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := r.Context().Value(prefixKey{}).(string)
+		prefix.Store(p)
+		w.Write([]byte("fresh"))
+	}))
+
+	r := httptest.NewRequest("GET", "http://foo.bar/early", nil)
+	r = r.WithContext(WithPrefix(r.Context(), "/route"))
+	_, key := client.GeneratePrefixAndKey(r)
+	cachedAt := time.Now().Add(-55 * time.Second)
+	adapter.Set("/route", key, Response{
+		Value:      []byte("cached"),
+		StatusCode: http.StatusOK,
+		Expiration: cachedAt.Add(time.Minute),
+		CachedAt:   cachedAt,
+	}.Bytes())
+	client.earlyRefreshes = map[string]time.Time{"/gone\x00key": time.Now().Add(-time.Second)}
+
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	waitRevalidations(t, client)
+	client.Close()
+
+	if got, _ := prefix.Load().(string); got != "/route" {
+		t.Errorf("refresh request prefix = %q, want /route", got)
+	}
+	if _, ok := client.earlyRefreshes["/gone\x00key"]; ok {
+		t.Error("the key whose refresh is allowed again was kept")
+	}
+}
+
+func TestEarlyRefreshPruning(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(time.Minute),
+		ClientWithEarlyRefresh(0.1),
+	)
+	defer client.Close()
+	now := time.Now()
+	client.earlyRefreshes = make(map[string]time.Time)
+	for i := 0; i < 100; i++ {
+		client.earlyRefreshes[fmt.Sprintf("/gone\x00%d", i)] = now.Add(-time.Second)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	response := Response{CachedAt: now.Add(-55 * time.Second), Expiration: now.Add(5 * time.Second)}
+
+	for i := 0; i < 100; i++ {
+		r := httptest.NewRequest("GET", "/early", nil)
+		client.refreshEarly(client.log, handler, r, "/early", strconv.Itoa(i), response, now)
+		waitRevalidations(t, client)
+		if n := len(client.earlyRefreshes); n < 100-earlyRefreshPruning*(i+1)+i+1 {
+			t.Fatalf("refresh %v left %v keys, looking at more than %v", i, n, earlyRefreshPruning)
+		}
+	}
+	if n := len(client.earlyRefreshes); n > 150 {
+		t.Errorf("refreshes left %v keys, want the gone ones forgotten", n)
+	}
+}
+
+func TestClientWithEarlyRefresh(t *testing.T) {
+	for _, fraction := range []float64{0, -0.1, 1, 2} {
+		if _, err := NewClient(
+			ClientWithAdapter(&adapterMock{}),
+			ClientWithTTL(time.Minute),
+			ClientWithEarlyRefresh(fraction),
+		); err == nil {
+			t.Errorf("ClientWithEarlyRefresh(%v) error = nil, want an error", fraction)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// ShedCollector is implemented by collectors counting the requests shed
+// by the fetch limits.
+type ShedCollector interface {
+	// IncShed counts a request answered with the load shedding status
+	// instead of calling the handler.
+	IncShed(prefix string)
+}
+
+// prefixSemaphore is the fetch limit of a prefix, shared by the requests
+// holding or waiting for it.
+type prefixSemaphore struct {
+	sem  *semaphore.Weighted
+	refs int
+}
+
+// acquireFetch takes a slot of the fetch limits before calling the handler
+// on a miss, waiting for one until the request is done, unless load
+// shedding is enabled. It returns the function giving the slot back, or
+// false when the request got none.
+func (c *Client) acquireFetch(ctx context.Context, prefix string) (release func(), ok bool) {
+	if c.fetchLimit == nil && c.prefixFetchLimit == 0 {
+		return func() {}, true
+	}
+	var prefixSem *semaphore.Weighted
+	if c.prefixFetchLimit > 0 {
+		prefixSem = c.prefixSemaphore(prefix)
+		if !c.acquireSemaphore(ctx, prefixSem) {
+			c.putPrefixSemaphore(prefix)
+			return nil, false
+		}
+	}
+	if c.fetchLimit != nil && !c.acquireSemaphore(ctx, c.fetchLimit) {
+		if prefixSem != nil {
+			prefixSem.Release(1)
+			c.putPrefixSemaphore(prefix)
+		}
+		return nil, false
+	}
+	return func() {
+		if c.fetchLimit != nil {
+			c.fetchLimit.Release(1)
+		}
+		if prefixSem != nil {
+			prefixSem.Release(1)
+			c.putPrefixSemaphore(prefix)
+		}
+	}, true
+}
+
+// acquireSemaphore takes a slot of the semaphore, right away when load
+// shedding is enabled.
+func (c *Client) acquireSemaphore(ctx context.Context, sem *semaphore.Weighted) bool {
+	if c.shedStatus != 0 {
+		return sem.TryAcquire(1)
+	}
+	return sem.Acquire(ctx, 1) == nil
+}
+
+// prefixSemaphore returns the fetch limit of the prefix, holding a
+// reference to it until putPrefixSemaphore is called.
+func (c *Client) prefixSemaphore(prefix string) *semaphore.Weighted {
+	c.fetchMutex.Lock()
+	defer c.fetchMutex.Unlock()
+	s, ok := c.prefixFetches[prefix]
+	if !ok {
+		if c.prefixFetches == nil {
+			c.prefixFetches = make(map[string]*prefixSemaphore)
+		}
+		s = &prefixSemaphore{sem: semaphore.NewWeighted(int64(c.prefixFetchLimit))}
+		c.prefixFetches[prefix] = s
+	}
+	s.refs++
+	return s.sem
+}
+
+// putPrefixSemaphore drops a reference to the fetch limit of the prefix,
+// which is forgotten once no request holds it.
+func (c *Client) putPrefixSemaphore(prefix string) {
+	c.fetchMutex.Lock()
+	defer c.fetchMutex.Unlock()
+	if s := c.prefixFetches[prefix]; s != nil {
+		if s.refs--; s.refs == 0 {
+			delete(c.prefixFetches, prefix)
+		}
+	}
+}
+
+// shed counts a request denied a fetch slot and returns the response it
+// gets instead of the handler one.
+func (c *Client) shed(ctxlog Logger, prefix string) *http.Response {
+	ctxlog.Debugf("too many concurrent fetches, shedding the request")
+	atomic.AddUint64(&c.stats.shed, 1)
+	if s, ok := c.metrics.(ShedCollector); ok {
+		s.IncShed(prefix)
+	}
+	statusCode := c.shedStatus
+	if statusCode == 0 {
+		statusCode = http.StatusServiceUnavailable
+	}
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{"Retry-After": {"1"}},
+	}
+}
+
+// ClientWithMaxConcurrentFetches sets how many handler calls on misses may
+// run at once, so that a cold cache does not overload the origin. Requests
+// beyond the limit wait for their turn until they are done, or are shed
+// when load shedding is enabled. Optional setting.
+func ClientWithMaxConcurrentFetches(n int) ClientOption {
+	return func(c *Client) error {
+		if n < 1 {
+			return fmt.Errorf("cache client max concurrent fetches %v is invalid", n)
+		}
+		c.fetchLimit = semaphore.NewWeighted(int64(n))
+		return nil
+	}
+}
+
+// ClientWithMaxConcurrentFetchesPerPrefix sets how many handler calls on
+// misses may run at once for each prefix, on top of the overall limit set
+// by ClientWithMaxConcurrentFetches. Optional setting.
+func ClientWithMaxConcurrentFetchesPerPrefix(n int) ClientOption {
+	return func(c *Client) error {
+		if n < 1 {
+			return fmt.Errorf("cache client max concurrent fetches per prefix %v is invalid", n)
+		}
+		c.prefixFetchLimit = n
+		return nil
+	}
+}
+
+// ClientWithLoadSheddingStatus makes the requests beyond the fetch limits
+// get the status code, e.g. 503, with a Retry-After header right away,
+// instead of waiting for their turn. With a 5xx status code, requests
+// having a stale response kept for errors are served it instead. Optional
+// setting.
+func ClientWithLoadSheddingStatus(statusCode int) ClientOption {
+	return func(c *Client) error {
+		if statusCode < 100 || statusCode > 999 {
+			return fmt.Errorf("cache client load shedding status %v is invalid", statusCode)
+		}
+		c.shedStatus = statusCode
+		return nil
+	}
+}
@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type shedCollector struct {
+	nopCollector
+	shed int32
+}
+
+func (c *shedCollector) IncShed(prefix string) {
+	atomic.AddInt32(&c.shed, 1)
+}
+
+func TestMiddlewareMaxConcurrentFetches(t *testing.T) {
+	var running, maxRunning int32
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithMaxConcurrentFetches(2),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		w.Write([]byte("value"))
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/limit?id="+string(rune('a'+i)), nil))
+			if w.Code != http.StatusOK || w.Body.String() != "value" {
+				t.Errorf("*Client.Middleware() = %v %q, want 200 value", w.Code, w.Body.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&maxRunning); got != 2 {
+		t.Errorf("*Client.Middleware() concurrent fetches = %v, want 2", got)
+	}
+}
+
+func TestMiddlewareLoadShedding(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []ClientOption
+		path       string
+		wantStatus int
+	}{
+		{"sheds requests beyond the limit", []ClientOption{ClientWithMaxConcurrentFetches(1)}, "/a?id=2", http.StatusServiceUnavailable},
+		{"sheds requests beyond the prefix limit", []ClientOption{ClientWithMaxConcurrentFetchesPerPrefix(1)}, "/a?id=2", http.StatusServiceUnavailable},
+		{"serves other prefixes", []ClientOption{ClientWithMaxConcurrentFetchesPerPrefix(1)}, "/b", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := &shedCollector{}
+			client, _ := NewClient(append([]ClientOption{
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1 * time.Minute),
+				ClientWithMetrics(collector),
+				ClientWithLoadSheddingStatus(http.StatusServiceUnavailable),
+			}, tt.opts...)...)
+			started := make(chan struct{})
+			release := make(chan struct{})
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/a" && r.URL.Query().Get("id") == "1" {
+					close(started)
+					<-release
+				}
+				w.Write([]byte("value"))
+			}))
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a?id=1", nil))
+			}()
+			<-started
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			close(release)
+			<-done
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("*Client.Middleware() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			wantShed := 0
+			if tt.wantStatus == http.StatusServiceUnavailable {
+				wantShed = 1
+				if got := w.Header().Get("Retry-After"); got != "1" {
+					t.Errorf("*Client.Middleware() Retry-After = %q, want 1", got)
+				}
+			}
+			if got := client.Stats().Shed; got != uint64(wantShed) {
+				t.Errorf("*Client.Stats() Shed = %v, want %v", got, wantShed)
+			}
+			if got := atomic.LoadInt32(&collector.shed); got != int32(wantShed) {
+				t.Errorf("ShedCollector.IncShed() calls = %v, want %v", got, wantShed)
+			}
+			if len(client.prefixFetches) != 0 {
+				t.Errorf("*Client.Middleware() kept %v prefix limits", len(client.prefixFetches))
+			}
+		})
+	}
+}
+
+func TestMiddlewareMaxConcurrentFetchesCanceled(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithMaxConcurrentFetches(1),
+	)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") == "1" {
+			close(started)
+			<-release
+		}
+		w.Write([]byte("value"))
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a?id=1", nil))
+	}()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/a?id=2", nil).WithContext(ctx))
+	close(release)
+	<-done
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("*Client.Middleware() status = %v, want %v", w.Code, http.StatusServiceUnavailable)
+	}
+}
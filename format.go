@@ -0,0 +1,256 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// The responses are stored framed: a fixed-size header holding the
+// scalar fields at fixed offsets, so that the expiration is read without
+// decoding the rest, then the header fields and Vary list, then the body
+// as is, so that decoding never copies it.
+//
+//	offset  size  field
+//	0       1     frameMagic
+//	1       1     frameVersion
+//	2       8     Expiration, Unix nanoseconds, 0 when zero
+//	10      8     CachedAt
+//	18      8     LastAccess
+//	26      4     StatusCode
+//	30      4     Frequency
+//	34      1     Compression
+//	35      4     length of the metadata
+//	39            metadata: header fields and Vary list
+//	              body
+//
+// Gob streams start with a byte below 0x80 or above 0xF7, so entries
+// stored as gob by earlier versions are told apart by their first byte.
+// They are format version 0, still decoded into the current Response,
+// missing fields left zero. Entries of another version, e.g. written by a
+// newer release sharing the adapter, or without one, fail to decode and
+// are released as a miss. The frameVersion is bumped whenever the layout
+// changes, with the decoding of the former layouts kept.
+const (
+	frameMagic      = 0xC4
+	frameVersion    = 1
+	frameHeaderSize = 39
+)
+
+var errFrameTruncated = errors.New("cached response frame is truncated")
+
+// isFramed reports whether the bytes hold a framed response.
+func isFramed(b []byte) bool {
+	return len(b) > 0 && b[0] == frameMagic
+}
+
+// marshalFrame encodes the response in the framed format.
+func marshalFrame(r Response) []byte {
+	meta := 4
+	for k, v := range r.Header {
+		meta += 4 + len(k) + 4
+		for _, vv := range v {
+			meta += 4 + len(vv)
+		}
+	}
+	meta += 4
+	for _, v := range r.Vary {
+		meta += 4 + len(v)
+	}
+
+	b := make([]byte, frameHeaderSize, frameHeaderSize+meta+len(r.Value))
+	b[0] = frameMagic
+	b[1] = frameVersion
+	binary.BigEndian.PutUint64(b[2:], uint64(unixNano(r.Expiration)))
+	binary.BigEndian.PutUint64(b[10:], uint64(unixNano(r.CachedAt)))
+	binary.BigEndian.PutUint64(b[18:], uint64(unixNano(r.LastAccess)))
+	binary.BigEndian.PutUint32(b[26:], uint32(r.StatusCode))
+	binary.BigEndian.PutUint32(b[30:], uint32(r.Frequency))
+	b[34] = byte(r.Compression)
+	binary.BigEndian.PutUint32(b[35:], uint32(meta))
+
+	b = appendUint32(b, len(r.Header))
+	for k, v := range r.Header {
+		b = appendString(b, k)
+		b = appendUint32(b, len(v))
+		for _, vv := range v {
+			b = appendString(b, vv)
+		}
+	}
+	b = appendUint32(b, len(r.Vary))
+	for _, v := range r.Vary {
+		b = appendString(b, v)
+	}
+	return append(b, r.Value...)
+}
+
+// unmarshalFrame decodes a framed response. The body shares the bytes.
+func unmarshalFrame(b []byte) (Response, error) {
+	var r Response
+	if len(b) < frameHeaderSize {
+		return r, errFrameTruncated
+	}
+	if b[1] != frameVersion {
+		return r, fmt.Errorf("cached response frame version %d is unknown", b[1])
+	}
+	r.Expiration = fromUnixNano(int64(binary.BigEndian.Uint64(b[2:])))
+	r.CachedAt = fromUnixNano(int64(binary.BigEndian.Uint64(b[10:])))
+	r.LastAccess = fromUnixNano(int64(binary.BigEndian.Uint64(b[18:])))
+	r.StatusCode = int(binary.BigEndian.Uint32(b[26:]))
+	r.Frequency = int(binary.BigEndian.Uint32(b[30:]))
+	r.Compression = Compression(b[34])
+	meta := int(binary.BigEndian.Uint32(b[35:]))
+	if meta > len(b)-frameHeaderSize {
+		return r, errFrameTruncated
+	}
+
+	d := frameDecoder{b: b[frameHeaderSize : frameHeaderSize+meta]}
+	if n := d.uint32(); n > 0 {
+		r.Header = make(http.Header, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			k := d.string()
+			v := make([]string, d.uint32())
+			for j := range v {
+				v[j] = d.string()
+			}
+			r.Header[k] = v
+		}
+	}
+	if n := d.uint32(); n > 0 {
+		r.Vary = make([]string, n)
+		for i := range r.Vary {
+			r.Vary[i] = d.string()
+		}
+	}
+	if d.err != nil {
+		return Response{}, d.err
+	}
+	if body := b[frameHeaderSize+meta:]; len(body) > 0 {
+		r.Value = body[:len(body):len(body)]
+	}
+	return r, nil
+}
+
+// frameExpiration reads the expiration of a framed response.
+func frameExpiration(b []byte) (time.Time, error) {
+	if len(b) < frameHeaderSize {
+		return time.Time{}, errFrameTruncated
+	}
+	return fromUnixNano(int64(binary.BigEndian.Uint64(b[2:]))), nil
+}
+
+// frameMeta describes a framed response from its fixed-size header,
+// given the size of the whole frame, without decoding the rest.
+func frameMeta(head []byte, size int) (EntryMeta, error) {
+	if len(head) < frameHeaderSize {
+		return EntryMeta{}, errFrameTruncated
+	}
+	if head[1] != frameVersion {
+		return EntryMeta{}, fmt.Errorf("cached response frame version %d is unknown", head[1])
+	}
+	meta := int(binary.BigEndian.Uint32(head[35:]))
+	if meta > size-frameHeaderSize {
+		return EntryMeta{}, errFrameTruncated
+	}
+	return EntryMeta{
+		Size:       size - frameHeaderSize - meta,
+		Expiration: fromUnixNano(int64(binary.BigEndian.Uint64(head[2:]))),
+		Age:        time.Since(fromUnixNano(int64(binary.BigEndian.Uint64(head[10:])))),
+		LastAccess: fromUnixNano(int64(binary.BigEndian.Uint64(head[18:]))),
+		StatusCode: int(binary.BigEndian.Uint32(head[26:])),
+		Frequency:  int(binary.BigEndian.Uint32(head[30:])),
+	}, nil
+}
+
+// frameDecoder reads the metadata of a framed response, keeping the
+// first error.
+type frameDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *frameDecoder) uint32() int {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.b) < 4 {
+		d.err = errFrameTruncated
+		return 0
+	}
+	n := binary.BigEndian.Uint32(d.b)
+	d.b = d.b[4:]
+	if uint64(n) > uint64(len(d.b)) {
+		// every count and length is bounded by the bytes left, which
+		// keeps corrupt entries from allocating much
+		d.err = errFrameTruncated
+		return 0
+	}
+	return int(n)
+}
+
+func (d *frameDecoder) string() string {
+	n := d.uint32()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
+
+func appendUint32(b []byte, n int) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendUint32(b, len(s)), s...)
+}
+
+// unixNano returns the date as Unix nanoseconds, 0 for the zero date.
+// Dates out of the int64 range are clamped.
+func unixNano(t time.Time) int64 {
+	switch {
+	case t.IsZero():
+		return 0
+	case t.Year() < 1678:
+		return math.MinInt64
+	case t.Year() > 2261:
+		return math.MaxInt64
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano returns the date of Unix nanoseconds, the zero date for 0.
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func gobBytes(r Response) []byte {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(&r); err != nil {
+		panic(err)
+	}
+	return b.Bytes()
+}
+
+func equalResponses(a, b Response) bool {
+	if !a.Expiration.Equal(b.Expiration) || !a.CachedAt.Equal(b.CachedAt) || !a.LastAccess.Equal(b.LastAccess) {
+		return false
+	}
+	a.Expiration, a.CachedAt, a.LastAccess = b.Expiration, b.CachedAt, b.LastAccess
+	return reflect.DeepEqual(a, b)
+}
+
+func TestFrame(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		response Response
+	}{
+		{
+			"full response",
+			Response{
+				Value:       []byte("value"),
+				Header:      http.Header{"Content-Type": {"text/plain"}, "Set-Cookie": {"a=1", "b=2"}},
+				StatusCode:  http.StatusCreated,
+				Expiration:  now.Add(time.Minute),
+				LastAccess:  now,
+				Frequency:   7,
+				CachedAt:    now.Add(-time.Minute),
+				Compression: Zstd,
+			},
+		},
+		{
+			"vary marker",
+			Response{Vary: []string{"Accept", "Accept-Language"}, Expiration: now},
+		},
+		{
+			"empty response",
+			Response{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.response.Bytes()
+			if !isFramed(b) {
+				t.Fatal("Response.Bytes() did not write a framed response")
+			}
+			got, err := BytesToResponse(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalResponses(got, tt.response) {
+				t.Errorf("BytesToResponse() = %+v, want %+v", got, tt.response)
+			}
+			expiration, err := FrameCodec{}.Expiration(b)
+			if err != nil || !expiration.Equal(tt.response.Expiration) {
+				t.Errorf("FrameCodec.Expiration() = %v, %v, want %v", expiration, err, tt.response.Expiration)
+			}
+		})
+	}
+}
+
+func TestGobEntries(t *testing.T) {
+	// entries stored by earlier versions are gob streams
+	want := Response{
+		Value:      []byte("legacy"),
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Expiration: time.Now().Add(time.Minute),
+	}
+	b := gobBytes(want)
+	if isFramed(b) {
+		t.Fatal("isFramed() = true on a gob stream")
+	}
+	got, err := BytesToResponse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalResponses(got, want) {
+		t.Errorf("BytesToResponse() = %+v, want %+v", got, want)
+	}
+	expiration, err := FrameCodec{}.Expiration(b)
+	if err != nil || !expiration.Equal(want.Expiration) {
+		t.Errorf("FrameCodec.Expiration() = %v, %v, want %v", expiration, err, want.Expiration)
+	}
+}
+
+func TestCorruptFrame(t *testing.T) {
+	b := Response{
+		Value:  []byte("value"),
+		Header: http.Header{"Content-Type": {"text/plain"}},
+	}.Bytes()
+	unknown := append([]byte(nil), b...)
+	unknown[1] = frameVersion + 1
+	// the metadata claims a header field longer than the entry
+	corrupt := append([]byte(nil), b...)
+	corrupt[frameHeaderSize+7] = 0xFF
+
+	for name, b := range map[string][]byte{
+		"truncated header":   b[:frameHeaderSize-1],
+		"truncated metadata": b[:frameHeaderSize+6],
+		"unknown version":    unknown,
+		"corrupt metadata":   corrupt,
+	} {
+		if _, err := BytesToResponse(b); err == nil {
+			t.Errorf("BytesToResponse() error = nil on a %v, want an error", name)
+		}
+	}
+}
+
+func TestFrameVersions(t *testing.T) {
+	want := Response{
+		Value:      []byte("value"),
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		StatusCode: http.StatusOK,
+		Expiration: time.Unix(1700000060, 0),
+		CachedAt:   time.Unix(1700000000, 0),
+		Frequency:  1,
+	}
+	// the Response of the releases storing gob streams
+	type responseV0 struct {
+		Value      []byte
+		Header     http.Header
+		Expiration time.Time
+		LastAccess time.Time
+		Frequency  int
+	}
+	var v0 bytes.Buffer
+	if err := gob.NewEncoder(&v0).Encode(responseV0{
+		Value:      want.Value,
+		Header:     want.Header,
+		Expiration: want.Expiration,
+		Frequency:  want.Frequency,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// version 1 as written by Response.Bytes, pinned byte for byte
+	v1, _ := hex.DecodeString("c40117979d0c2e71580017979cfe362a00000000000000000000000000c8" +
+		"00000001000000002a000000010000000c436f6e74656e742d54797065000000010000000a746578742f706c61696e00000000" +
+		"76616c7565")
+
+	tests := []struct {
+		name    string
+		b       []byte
+		current bool
+		want    Response
+	}{
+		{"version 0", v0.Bytes(), false, Response{Value: want.Value, Header: want.Header, Expiration: want.Expiration, Frequency: 1}},
+		{"version 1", v1, true, want},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BytesToResponse(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalResponses(got, tt.want) {
+				t.Errorf("BytesToResponse() = %+v, want %+v", got, tt.want)
+			}
+			// the entries are written back in the current version
+			b := got.Bytes()
+			if current := bytes.Equal(b, tt.b); current != tt.current {
+				t.Errorf("Response.Bytes() kept the version = %v, want %v", current, tt.current)
+			}
+			if b[1] != frameVersion {
+				t.Errorf("Response.Bytes() version = %v, want %v", b[1], frameVersion)
+			}
+		})
+	}
+}
+
+func TestMiddlewareUnknownFormatVersion(t *testing.T) {
+	for name, b := range map[string][]byte{
+		"unknown version": append([]byte{frameMagic, frameVersion + 1}, make([]byte, frameHeaderSize)...),
+		"missing version": {frameMagic},
+	} {
+		t.Run(name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Minute),
+			)
+			r := httptest.NewRequest("GET", "/version", nil)
+			prefix, key := client.GeneratePrefixAndKey(r)
+			adapter.Set(prefix, key, b)
+
+			calls := 0
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Write([]byte("value"))
+			}))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if calls != 1 || w.Body.String() != "value" {
+				t.Errorf("*Client.Middleware() = %q with %v handler calls, want a miss", w.Body.String(), calls)
+			}
+			stored, _ := adapter.Get(prefix, key)
+			if len(stored) < 2 || stored[1] != frameVersion {
+				t.Errorf("*Client.Middleware() kept the entry of an unknown format")
+			}
+		})
+	}
+}
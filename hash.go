@@ -0,0 +1,71 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// HashFunc returns the cache key of a string, such as the canonical URL of
+// a request.
+type HashFunc func(s string) string
+
+// FNV64a is the default HashFunc, a fast 64-bit FNV-1a hash. With tens of
+// millions of distinct URLs, two of them may get the same key and share
+// their responses.
+func FNV64a(s string) string {
+	return generateKey(s)
+}
+
+// SHA256 is a collision resistant HashFunc, the hex encoded SHA-256 of the
+// string truncated to 128 bits.
+func SHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:16])
+}
+
+// hash returns the key of s with the client hash function.
+func (c *Client) hash(s string) string {
+	if c.hashFunc != nil {
+		return c.hashFunc(s)
+	}
+	return generateKey(s)
+}
+
+// ClientWithHashFunc sets the function the cache keys are hashed with,
+// e.g. SHA256 to rule out collisions between URLs. Changing it changes
+// every key, which misses the responses cached beforehand. Default is
+// FNV64a. Optional setting.
+func ClientWithHashFunc(fn HashFunc) ClientOption {
+	return func(c *Client) error {
+		if fn == nil {
+			return errors.New("cache client hash function is not set")
+		}
+		c.hashFunc = fn
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSHA256(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"hashes the empty string", "", "e3b0c44298fc1c149afbf4c8996fb924"},
+		{"hashes a url", "http://foo.bar/a", "2f7dbf4764c702adb0c9c266f56f5a11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SHA256(tt.s); got != tt.want {
+				t.Errorf("SHA256(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientWithHashFunc(t *testing.T) {
+	if _, err := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(time.Minute), ClientWithHashFunc(nil)); err == nil {
+		t.Error("NewClient() error = nil, want an error on a nil hash function")
+	}
+
+	tests := []struct {
+		name     string
+		hashFunc HashFunc
+		want     string
+	}{
+		{"defaults to FNV64a", nil, FNV64a("http://foo.bar/a?b=1")},
+		{"uses the hash function", SHA256, SHA256("http://foo.bar/a?b=1")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []ClientOption{ClientWithAdapter(&adapterMock{}), ClientWithTTL(time.Minute)}
+			if tt.hashFunc != nil {
+				opts = append(opts, ClientWithHashFunc(tt.hashFunc))
+			}
+			client, _ := NewClient(opts...)
+			if _, key := client.GeneratePrefixAndKey(httptest.NewRequest("GET", "http://foo.bar/a?b=1", nil)); key != tt.want {
+				t.Errorf("*Client.GeneratePrefixAndKey() key = %v, want %v", key, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareHashFunc(t *testing.T) {
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(time.Minute),
+		ClientWithHashFunc(SHA256),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept")
+		w.Write([]byte("value"))
+	}))
+	r := httptest.NewRequest("GET", "http://foo.bar/hashed", nil)
+	r.Header.Set("Accept", "text/plain")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(adapter.store["/hashed"]) == 0 {
+		t.Fatal("*Client.Middleware() did not cache the response")
+	}
+	for key := range adapter.store["/hashed"] {
+		if len(key) != 32 {
+			t.Errorf("*Client.Middleware() key = %v, want a 128-bit hex key", key)
+		}
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("X-Cached-At"); got == "" {
+		t.Error("*Client.Middleware() did not serve the variant from the cache")
+	}
+}
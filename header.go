@@ -0,0 +1,182 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// hopHeaders are the hop-by-hop headers, meaningful for a single
+// connection only, which are neither cached nor replayed (RFC 7230,
+// section 6.1).
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// HeaderPrecedence tells which of the header fields written by the
+// middleware, cached or taken from the handler, and the ones already set
+// on the response, e.g. by outer middleware, are kept.
+type HeaderPrecedence int
+
+// Header precedences.
+const (
+	// LiveWins keeps the header fields already set on the response. It
+	// is the default.
+	LiveWins HeaderPrecedence = iota
+
+	// CachedWins replaces them with the fields written by the
+	// middleware.
+	CachedWins
+)
+
+// essentialHeaders are the headers cached whatever the allowlist, being
+// needed to replay and validate the responses.
+var essentialHeaders = map[string]bool{
+	"Cache-Control":    true,
+	"Content-Encoding": true,
+	"Content-Type":     true,
+	"Etag":             true,
+	"Last-Modified":    true,
+	"Vary":             true,
+}
+
+// stripHeaders removes the hop-by-hop headers, the headers listed in the
+// Connection header and the stripped headers of the client from h.
+func (c *Client) stripHeaders(h http.Header) {
+	for _, v := range h["Connection"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+	for _, name := range c.strippedHeaders {
+		h.Del(name)
+	}
+}
+
+// cachedHeader returns the header of a response to cache, without the
+// headers missing from the allowlist of the client, if any. The header
+// taken is left as is, as it may still be served.
+func (c *Client) cachedHeader(h http.Header) http.Header {
+	if c.cachedHeaders == nil {
+		return h
+	}
+	cached := make(http.Header, len(h))
+	for name, values := range h {
+		if c.cachedHeaders[name] || essentialHeaders[name] {
+			cached[name] = values
+		}
+	}
+	return cached
+}
+
+// ClientWithCachedHeaderAllowlist sets the only response headers that are
+// cached, besides Content-Type, Content-Encoding, ETag, Last-Modified,
+// Cache-Control and Vary, so that internal headers, e.g. the backend
+// node, are not replayed to other clients. The client the response is
+// taken for gets every header. Optional setting.
+func ClientWithCachedHeaderAllowlist(names ...string) ClientOption {
+	return func(c *Client) error {
+		c.cachedHeaders = make(map[string]bool, len(names))
+		for _, name := range names {
+			if name == "" {
+				return errors.New("cache client allowed header name is empty")
+			}
+			c.cachedHeaders[http.CanonicalHeaderKey(name)] = true
+		}
+		return nil
+	}
+}
+
+// ClientWithStripHeaders sets headers, besides the hop-by-hop ones, that
+// are neither cached nor replayed, e.g. "Server" or internal tracing
+// headers, acting as a denylist. Optional setting.
+func ClientWithStripHeaders(names ...string) ClientOption {
+	return func(c *Client) error {
+		for _, name := range names {
+			if name == "" {
+				return errors.New("cache client stripped header name is empty")
+			}
+			c.strippedHeaders = append(c.strippedHeaders, http.CanonicalHeaderKey(name))
+		}
+		return nil
+	}
+}
+
+// writeHeader copies the fields of the cached or handler header to the
+// response header, see writeField.
+func (c *Client) writeHeader(dst, src http.Header) {
+	for k, v := range src {
+		c.writeField(dst, k, v)
+	}
+}
+
+// writeField sets the field of the response header, unless it is already
+// set and live fields win. The name is kept as it is, not canonicalized.
+// Set-Cookie values are always added, each being a separate cookie.
+func (c *Client) writeField(dst http.Header, k string, v []string) {
+	ck := textproto.CanonicalMIMEHeaderKey(k)
+	switch {
+	case ck == "Set-Cookie":
+		dst[k] = append(dst[k], v...)
+	case c.headerPrecedence == LiveWins && (len(dst[k]) > 0 || len(dst[ck]) > 0):
+	default:
+		if ck != k {
+			delete(dst, ck)
+		}
+		dst[k] = append([]string(nil), v...)
+	}
+}
+
+// ClientWithCachedHeaderPrecedence sets whether the header fields the
+// middleware writes, from the cache on hits and from the handler on
+// misses, replace the fields already set on the response, e.g. by an
+// outer middleware setting security or CORS headers. Default is LiveWins,
+// keeping them. Optional setting.
+func ClientWithCachedHeaderPrecedence(precedence HeaderPrecedence) ClientOption {
+	return func(c *Client) error {
+		if precedence != LiveWins && precedence != CachedWins {
+			return fmt.Errorf("cache client header precedence %d is unknown", precedence)
+		}
+		c.headerPrecedence = precedence
+		return nil
+	}
+}
@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStripHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		strip  []string
+		header http.Header
+		want   http.Header
+	}{
+		{
+			"strips hop-by-hop headers",
+			nil,
+			http.Header{
+				"Keep-Alive":        {"timeout=5"},
+				"Transfer-Encoding": {"chunked"},
+				"Upgrade":           {"websocket"},
+				"Content-Type":      {"text/plain"},
+			},
+			http.Header{"Content-Type": {"text/plain"}},
+		},
+		{
+			"strips headers listed in Connection",
+			nil,
+			http.Header{
+				"Connection":   {"X-Foo, close", "X-Bar"},
+				"X-Foo":        {"1"},
+				"X-Bar":        {"2"},
+				"Content-Type": {"text/plain"},
+			},
+			http.Header{"Content-Type": {"text/plain"}},
+		},
+		{
+			"strips configured headers",
+			[]string{"server", "X-Internal-Trace"},
+			http.Header{
+				"Server":           {"origin"},
+				"X-Internal-Trace": {"abc"},
+				"Content-Type":     {"text/plain"},
+			},
+			http.Header{"Content-Type": {"text/plain"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{}
+			if err := ClientWithStripHeaders(tt.strip...)(c); err != nil {
+				t.Fatal(err)
+			}
+			c.stripHeaders(tt.header)
+			if !reflect.DeepEqual(tt.header, tt.want) {
+				t.Errorf("*Client.stripHeaders() = %v, want %v", tt.header, tt.want)
+			}
+		})
+	}
+
+	if err := ClientWithStripHeaders("")(&Client{}); err == nil {
+		t.Error("ClientWithStripHeaders() accepted an empty header name")
+	}
+}
+
+func TestMiddlewareStripHeaders(t *testing.T) {
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithStripHeaders("Server"),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "X-Hop")
+		w.Header().Set("X-Hop", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("Server", "origin")
+		w.Header().Set("X-Kept", "1")
+		w.Write([]byte("value"))
+	}))
+
+	// an entry stored with hop-by-hop headers, e.g. by a previous version
+	r, _ := http.NewRequest("GET", "http://foo.bar/legacy", nil)
+	prefix, key := client.GeneratePrefixAndKey(r)
+	legacy := Response{
+		Value:      []byte("value"),
+		Header:     http.Header{"Transfer-Encoding": {"chunked"}, "X-Kept": {"1"}},
+		Expiration: time.Now().Add(time.Minute),
+	}
+	b := legacy.Bytes()
+	adapter.Set(prefix, key, b)
+
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "http://foo.bar/stripped", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	r, _ = http.NewRequest("GET", "http://foo.bar/stripped", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("X-Kept"); got != "1" {
+		t.Errorf("*Client.Middleware() X-Kept = %q, want it replayed", got)
+	}
+	if got := w.Header().Get("Server"); got != "" {
+		t.Errorf("*Client.Middleware() replayed Server = %q", got)
+	}
+
+	r, _ = http.NewRequest("GET", "http://foo.bar/stripped", nil)
+	prefix, key = client.GeneratePrefixAndKey(r)
+	b, _ = adapter.Get(prefix, key)
+	stored, err := BytesToResponse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Connection", "X-Hop", "Keep-Alive", "Server"} {
+		if _, ok := stored.Header[name]; ok {
+			t.Errorf("*Client.Middleware() cached the %v header", name)
+		}
+	}
+
+	r, _ = http.NewRequest("GET", "http://foo.bar/legacy", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("Transfer-Encoding"); got != "" {
+		t.Errorf("*Client.Middleware() replayed Transfer-Encoding = %q", got)
+	}
+}
+
+func TestMiddlewareCachedHeaderAllowlist(t *testing.T) {
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithCachedHeaderAllowlist("x-public"),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("X-Public", "1")
+		w.Header().Set("X-Internal-User-Id", "42")
+		w.Header().Set("X-Backend-Node", "node-1")
+		w.Write([]byte("value"))
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		miss   bool
+		hit    bool
+	}{
+		{"keeps allowed headers", "X-Public", true, true},
+		{"keeps essential headers", "Content-Type", true, true},
+		{"keeps the generated ETag", "Etag", false, true},
+		{"drops other headers", "X-Internal-User-Id", true, false},
+		{"drops other headers", "X-Backend-Node", true, false},
+	}
+	miss := httptest.NewRecorder()
+	handler.ServeHTTP(miss, httptest.NewRequest("GET", "/allowlist", nil))
+	hit := httptest.NewRecorder()
+	handler.ServeHTTP(hit, httptest.NewRequest("GET", "/allowlist", nil))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := miss.Header()[tt.header]; ok != tt.miss {
+				t.Errorf("*Client.Middleware() miss sent %v = %v, want %v", tt.header, ok, tt.miss)
+			}
+			if _, ok := hit.Header()[tt.header]; ok != tt.hit {
+				t.Errorf("*Client.Middleware() hit sent %v = %v, want %v", tt.header, ok, tt.hit)
+			}
+		})
+	}
+}
+
+func TestMiddlewareCachedHeaderPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []ClientOption
+		wantCSP    []string
+		wantCustom []string
+	}{
+		{"live fields win by default", nil, []string{"default-src 'self'"}, []string{"cached"}},
+		{"live fields win", []ClientOption{ClientWithCachedHeaderPrecedence(LiveWins)}, []string{"default-src 'self'"}, []string{"cached"}},
+		{"cached fields win", []ClientOption{ClientWithCachedHeaderPrecedence(CachedWins)}, []string{"default-src *"}, []string{"cached"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(append([]ClientOption{
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(time.Minute),
+			}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Security-Policy", "default-src *")
+				w.Header().Set("X-Custom", "cached")
+				w.Write([]byte("value"))
+			}))
+			// the outer middleware sets its headers before the cache
+			outer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Security-Policy", "default-src 'self'")
+				handler.ServeHTTP(w, r)
+			})
+
+			for _, path := range []string{"miss", "hit"} {
+				w := httptest.NewRecorder()
+				outer.ServeHTTP(w, httptest.NewRequest("GET", "http://foo.bar/precedence", nil))
+				if got := w.Header()["Content-Security-Policy"]; !reflect.DeepEqual(got, tt.wantCSP) {
+					t.Errorf("%v Content-Security-Policy = %q, want %q", path, got, tt.wantCSP)
+				}
+				if got := w.Header()["X-Custom"]; !reflect.DeepEqual(got, tt.wantCustom) {
+					t.Errorf("%v X-Custom = %q, want %q", path, got, tt.wantCustom)
+				}
+			}
+		})
+	}
+
+	if _, err := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(time.Minute),
+		ClientWithCachedHeaderPrecedence(HeaderPrecedence(2)),
+	); err == nil {
+		t.Error("ClientWithCachedHeaderPrecedence() with an unknown precedence error = nil, want an error")
+	}
+}
+
+func TestWriteField(t *testing.T) {
+	tests := []struct {
+		name       string
+		precedence HeaderPrecedence
+		dst        http.Header
+		k          string
+		v          []string
+		want       http.Header
+	}{
+		{"sets a missing field", LiveWins, http.Header{}, "X-A", []string{"1"}, http.Header{"X-A": {"1"}}},
+		{"keeps the name casing", LiveWins, http.Header{}, "x-a", []string{"1"}, http.Header{"x-a": {"1"}}},
+		{"keeps a live field", LiveWins, http.Header{"X-A": {"0"}}, "x-a", []string{"1"}, http.Header{"X-A": {"0"}}},
+		{"replaces a live field", CachedWins, http.Header{"X-A": {"0"}}, "x-a", []string{"1"}, http.Header{"x-a": {"1"}}},
+		{"adds cookies", LiveWins, http.Header{"Set-Cookie": {"a=1"}}, "Set-Cookie", []string{"b=2"}, http.Header{"Set-Cookie": {"a=1", "b=2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{headerPrecedence: tt.precedence}
+			c.writeField(tt.dst, tt.k, tt.v)
+			if !reflect.DeepEqual(tt.dst, tt.want) {
+				t.Errorf("*Client.writeField() = %v, want %v", tt.dst, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Hooks holds functions called as the middleware serves and stores
+// responses, e.g. to log or trace them. Any of them may be nil. They are
+// called synchronously and concurrently, so they should return quickly; a
+// hook panicking is logged and does not affect the response.
+type Hooks struct {
+	// OnHit is called when a response is served from the cache, stale
+	// responses included.
+	OnHit func(r *http.Request, meta EntryMeta)
+
+	// OnMiss is called when a cacheable request is not found in the
+	// cache and is passed to the handler.
+	OnMiss func(r *http.Request)
+
+	// OnStore is called when a response is stored, or queued to be when
+	// writes are asynchronous.
+	OnStore func(r *http.Request, meta EntryMeta)
+
+	// OnError is called when an adapter operation fails, with an
+	// *AdapterError, or a cached response cannot be encoded or decoded.
+	// Failed lookups are served as misses and failed stores are skipped
+	// either way, so it only makes the failures observable, e.g. to alert
+	// on a dead cache. The request is nil when the error happened in the
+	// background.
+	OnError func(r *http.Request, err error)
+
+	// OnTiming is called once a cacheable request is served, with the
+	// time it spent in each step.
+	OnTiming func(r *http.Request, timing Timing)
+
+	// OnCircuitChange is called when the circuit breaker changes state.
+	// The request is nil when the change happened in the background.
+	OnCircuitChange func(r *http.Request, from, to CircuitState)
+}
+
+// EntryMeta describes a cached response.
+type EntryMeta struct {
+	Prefix     string
+	Key        string
+	Size       int
+	StatusCode int
+	Expiration time.Time
+
+	// Age is the time elapsed since the response was cached.
+	Age time.Duration
+
+	// LastAccess and Frequency track the hits of the response when
+	// access tracking is enabled.
+	LastAccess time.Time
+	Frequency  int
+}
+
+// newEntryMeta describes the cached response by a given key.
+func newEntryMeta(prefix, key string, response Response) EntryMeta {
+	return EntryMeta{
+		Prefix:     prefix,
+		Key:        key,
+		Size:       len(response.Value),
+		StatusCode: response.StatusCode,
+		Expiration: response.Expiration,
+		Age:        time.Since(response.CachedAt),
+		LastAccess: response.LastAccess,
+		Frequency:  response.Frequency,
+	}
+}
+
+// ClientWithHooks sets the functions called on cache hits, misses, stores
+// and errors, and with the timing of the requests. Optional setting.
+func ClientWithHooks(hooks Hooks) ClientOption {
+	return func(c *Client) error {
+		if hooks.OnHit == nil && hooks.OnMiss == nil && hooks.OnStore == nil && hooks.OnError == nil && hooks.OnTiming == nil &&
+			hooks.OnCircuitChange == nil {
+			return errors.New("cache client hooks are not set")
+		}
+		c.hooks = hooks
+		return nil
+	}
+}
+
+func (c *Client) hookHit(r *http.Request, prefix, key string, response Response) {
+	if c.hooks.OnHit != nil {
+		c.runHook("OnHit", func() { c.hooks.OnHit(r, newEntryMeta(prefix, key, response)) })
+	}
+}
+
+func (c *Client) hookMiss(r *http.Request) {
+	if c.hooks.OnMiss != nil {
+		c.runHook("OnMiss", func() { c.hooks.OnMiss(r) })
+	}
+}
+
+func (c *Client) hookStore(r *http.Request, prefix, key string, response Response) {
+	if c.hooks.OnStore != nil {
+		c.runHook("OnStore", func() { c.hooks.OnStore(r, newEntryMeta(prefix, key, response)) })
+	}
+}
+
+func (c *Client) hookTiming(r *http.Request, timing Timing) {
+	if c.hooks.OnTiming != nil {
+		c.runHook("OnTiming", func() { c.hooks.OnTiming(r, timing) })
+	}
+}
+
+func (c *Client) hookError(r *http.Request, err error) {
+	if c.hooks.OnError != nil {
+		c.runHook("OnError", func() { c.hooks.OnError(r, err) })
+	}
+}
+
+// runHook calls the hook, recovering and logging its panics.
+func (c *Client) runHook(name string, hook func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			c.log.Errorf("cache %s hook panicked: %v", name, p)
+		}
+	}()
+	hook()
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		panicking bool
+		wantCalls []string
+	}{
+		{"reports misses, stores and hits", nil, false, []string{"miss", "store", "hit"}},
+		{"reports adapter errors", errors.New("connection refused"), false, []string{"error", "miss", "error", "store", "error", "miss", "error", "store"}},
+		{"recovers panicking hooks", nil, true, []string{"miss", "store", "hit"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mutex sync.Mutex
+				calls []string
+			)
+			record := func(call string) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				calls = append(calls, call)
+				if tt.panicking {
+					panic(call)
+				}
+			}
+			checkMeta := func(meta EntryMeta) {
+				if meta.Prefix != "/hooks" || meta.Key == "" || meta.Size != len("value") {
+					t.Errorf("EntryMeta = %+v, want /hooks entry of size %d", meta, len("value"))
+				}
+				if meta.Age < 0 || meta.Age > time.Minute || time.Until(meta.Expiration) > time.Minute {
+					t.Errorf("EntryMeta = %+v, want a fresh entry expiring within 1m", meta)
+				}
+			}
+			client, _ := NewClient(
+				ClientWithAdapter(&checkedAdapterMock{err: tt.err}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithHooks(Hooks{
+					OnHit: func(r *http.Request, meta EntryMeta) {
+						checkMeta(meta)
+						record("hit")
+					},
+					OnMiss: func(r *http.Request) {
+						record("miss")
+					},
+					OnStore: func(r *http.Request, meta EntryMeta) {
+						checkMeta(meta)
+						record("store")
+					},
+					OnError: func(r *http.Request, err error) {
+						if r == nil {
+							t.Error("OnError() request = nil, want the served request")
+						}
+						record("error")
+					},
+				}),
+			)
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("value"))
+			}))
+
+			for i := 0; i < 2; i++ {
+				r, _ := http.NewRequest("GET", "http://foo.bar/hooks", nil)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Body.String() != "value" {
+					t.Errorf("*Client.Middleware() body = %v, want value", w.Body.String())
+				}
+			}
+
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("hook calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClientWithHooks(t *testing.T) {
+	if _, err := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(time.Minute), ClientWithHooks(Hooks{})); err == nil {
+		t.Error("ClientWithHooks(Hooks{}) error = nil, want an error")
+	}
+}
@@ -0,0 +1,83 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"errors"
+	"net/http"
+)
+
+// identity returns the identifier of the user the request is made by, or
+// an empty string when the response to it is shared.
+func (c *Client) identity(r *http.Request) string {
+	if c.identityFunc == nil {
+		return ""
+	}
+	return c.identityFunc(r)
+}
+
+// identityPrefix returns the start of the prefixes of the responses cached
+// for a user. The identifier is hashed, so that one prefix never starts
+// another.
+func (c *Client) identityPrefix(id string) string {
+	return "@" + c.hash(id) + ":"
+}
+
+// storesPrivate reports whether responses marked with Cache-Control:
+// private may be stored for the request.
+func (c *Client) storesPrivate(r *http.Request) bool {
+	return !c.sharedCache || c.identity(r) != ""
+}
+
+// ReleaseUser frees the responses cached for the user with the given
+// identifier, e.g. on logout, and returns how many were released.
+func (c *Client) ReleaseUser(id string) (int, error) {
+	if id == "" {
+		return 0, errors.New("cache client user identifier is empty")
+	}
+	prefix := c.identityPrefix(id)
+	n, err := c.releaseIfStartsWith(c.background(), prefix)
+	c.logRelease(prefix, "", n, err)
+	return n, err
+}
+
+// ClientWithIdentityFunc sets a function returning the identifier of the
+// user a request is made by, e.g. a session ID, so that responses are
+// cached for each user apart, under prefixes that ReleaseUser frees at
+// once. Responses marked with Cache-Control: private are then stored for
+// identified users, even in a shared cache, but responses setting cookies
+// still are not. Requests with an empty identifier share their responses.
+// The function is called several times per request, so it should be
+// quick. Metrics labelled by prefix get one series per user, unless
+// mapped to route names. Optional setting.
+func ClientWithIdentityFunc(identityFunc func(r *http.Request) string) ClientOption {
+	return func(c *Client) error {
+		if identityFunc == nil {
+			return errors.New("cache client identity function is not set")
+		}
+		c.identityFunc = identityFunc
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareIdentityFunc(t *testing.T) {
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithSharedCache(true),
+		ClientWithIdentityFunc(func(r *http.Request) string {
+			return r.Header.Get("X-User")
+		}),
+	)
+	calls := map[string]int{}
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := r.Header.Get("X-User")
+		calls[r.URL.Path+" "+user]++
+		switch r.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "private")
+		case "/cookie":
+			w.Header().Set("Set-Cookie", "seen=1")
+		}
+		w.Write([]byte("hello " + user))
+	}))
+	get := func(path, user string) string {
+		r := httptest.NewRequest("GET", path, nil)
+		if user != "" {
+			r.Header.Set("X-User", user)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		user      string
+		wantCalls int
+	}{
+		{"caches the responses of a user", "/dashboard", "alice", 1},
+		{"keeps the users apart", "/dashboard", "bob", 1},
+		{"shares anonymous responses", "/dashboard", "", 1},
+		{"caches private responses of a user", "/private", "alice", 1},
+		{"skips private anonymous responses", "/private", "", 2},
+		{"skips responses setting cookies", "/cookie", "alice", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				if got, want := get(tt.path, tt.user), "hello "+tt.user; got != want {
+					t.Errorf("*Client.Middleware() = %q, want %q", got, want)
+				}
+			}
+			if got := calls[tt.path+" "+tt.user]; got != tt.wantCalls {
+				t.Errorf("*Client.Middleware() called the handler %v times, want %v", got, tt.wantCalls)
+			}
+		})
+	}
+
+	n, err := client.ReleaseUser("alice")
+	if err != nil || n != 2 {
+		t.Errorf("*Client.ReleaseUser() = %v, %v, want 2, nil", n, err)
+	}
+	get("/dashboard", "alice")
+	get("/dashboard", "bob")
+	get("/dashboard", "")
+	if calls["/dashboard alice"] != 2 || calls["/dashboard bob"] != 1 || calls["/dashboard "] != 1 {
+		t.Errorf("*Client.ReleaseUser() released other users, calls = %v", calls)
+	}
+	if _, err := client.ReleaseUser(""); err == nil {
+		t.Errorf("*Client.ReleaseUser() with an empty identifier, want error")
+	}
+}
+
+func TestIdentityPrefix(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+	)
+	// neither prefix starts the other
+	a, b := client.identityPrefix("1"), client.identityPrefix("12")
+	if strings.HasPrefix(a, b) || strings.HasPrefix(b, a) {
+		t.Errorf("identityPrefix() = %q, %q, want distinct prefixes", a, b)
+	}
+}
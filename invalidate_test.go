@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareInvalidateOnWrite(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Fail") != "" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.Write([]byte("value"))
+	})
+
+	tests := []struct {
+		name   string
+		opts   []ClientOption
+		method string
+		url    string
+		fail   bool
+		want   map[string]bool
+	}{
+		{
+			"releases path on successful write",
+			[]ClientOption{ClientWithInvalidateOnWrite(true)},
+			"PUT",
+			"http://foo.bar/items/42",
+			false,
+			map[string]bool{"/items/42": false, "/items": true},
+		},
+		{
+			"releases related prefixes",
+			[]ClientOption{ClientWithInvalidatePrefixes(func(r *http.Request) []string {
+				return []string{path.Dir(r.URL.Path)}
+			})},
+			"DELETE",
+			"http://foo.bar/items/42",
+			false,
+			map[string]bool{"/items/42": false, "/items": false},
+		},
+		{
+			"keeps cache on failed write",
+			[]ClientOption{ClientWithInvalidateOnWrite(true)},
+			"PATCH",
+			"http://foo.bar/items/42",
+			true,
+			map[string]bool{"/items/42": true, "/items": true},
+		},
+		{
+			"keeps cache on read",
+			[]ClientOption{ClientWithInvalidateOnWrite(true)},
+			"OPTIONS",
+			"http://foo.bar/items/42",
+			false,
+			map[string]bool{"/items/42": true, "/items": true},
+		},
+		{
+			"releases the normalized path",
+			[]ClientOption{ClientWithInvalidateOnWrite(true), ClientWithPathNormalization(PathNormalization{LowercasePath: true, StripTrailingSlash: true})},
+			"PUT",
+			"http://foo.bar/Items/42/",
+			false,
+			map[string]bool{"/items/42": false, "/items": true},
+		},
+		{
+			"releases the path of the user",
+			[]ClientOption{ClientWithInvalidateOnWrite(true), ClientWithIdentityFunc(func(r *http.Request) string { return "alice" })},
+			"PUT",
+			"http://foo.bar/items/42",
+			false,
+			map[string]bool{"/items/42": false, "/items": true},
+		},
+		{
+			"keeps cache when disabled",
+			nil,
+			"PUT",
+			"http://foo.bar/items/42",
+			false,
+			map[string]bool{"/items/42": true, "/items": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			opts := append([]ClientOption{ClientWithAdapter(adapter), ClientWithTTL(1 * time.Minute)}, tt.opts...)
+			client, _ := NewClient(opts...)
+			handler := client.Middleware(httpTestHandler)
+
+			for _, url := range []string{"http://foo.bar/items/42", "http://foo.bar/items"} {
+				r, _ := http.NewRequest("GET", url, nil)
+				handler.ServeHTTP(httptest.NewRecorder(), r)
+			}
+
+			r, _ := http.NewRequest(tt.method, tt.url, nil)
+			if tt.fail {
+				r.Header.Set("X-Fail", "yes")
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if tt.fail && w.Code != http.StatusConflict {
+				t.Errorf("*Client.Middleware() status = %v, want %v", w.Code, http.StatusConflict)
+			}
+
+			for path, want := range tt.want {
+				prefix := client.requestPrefix(httptest.NewRequest("GET", "http://foo.bar"+path, nil))
+				if got := len(adapter.store[prefix]) > 0; got != want {
+					t.Errorf("*Client.Middleware() cached %v = %v, want %v", path, got, want)
+				}
+			}
+		})
+	}
+
+	if _, err := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(1*time.Minute), ClientWithInvalidatePrefixes(nil)); err == nil {
+		t.Error("NewClient() with nil invalidate prefixes error = nil, want error")
+	}
+}
@@ -0,0 +1,76 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// Sweeper is implemented by adapters able to drop their expired cached
+// responses in bulk. Adapters expiring responses natively do not need it.
+type Sweeper interface {
+	// Sweep frees the cached responses expired at the given time and
+	// returns how many were released.
+	Sweep(now time.Time) int
+}
+
+// startJanitor starts sweeping the adapter every janitor interval, until
+// the client is closed.
+func (c *Client) startJanitor() {
+	sweeper, ok := c.optional().(Sweeper)
+	if !ok {
+		c.log.Debugf("the adapter does not support sweeping, not starting the janitor")
+		return
+	}
+
+	c.goAsync(func() {
+		ticker := time.NewTicker(c.janitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case now := <-ticker.C:
+				if n := sweeper.Sweep(now); n > 0 {
+					c.log.Debugf("janitor released %d expired responses", n)
+				}
+			}
+		}
+	})
+}
+
+// ClientWithJanitor makes the client release the expired responses every
+// interval, for adapters implementing Sweeper, instead of only when they
+// are requested again. Call Close to stop it. Optional setting.
+func ClientWithJanitor(interval time.Duration) ClientOption {
+	return func(c *Client) error {
+		if interval <= 0 {
+			return errors.New("cache client janitor interval must be positive")
+		}
+		c.janitorInterval = interval
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sweeperMock is an adapterMock implementing the Sweeper interface.
+type sweeperMock struct {
+	adapterMock
+	sweeps int32
+}
+
+func (a *sweeperMock) Sweep(now time.Time) int {
+	atomic.AddInt32(&a.sweeps, 1)
+	return 0
+}
+
+func TestClientWithJanitor(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		wantErr  bool
+	}{
+		{"sets the interval", time.Minute, false},
+		{"rejects a zero interval", 0, true},
+		{"rejects a negative interval", -time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{}
+			if err := ClientWithJanitor(tt.interval)(c); (err != nil) != tt.wantErr {
+				t.Errorf("ClientWithJanitor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	adapter := &sweeperMock{}
+	client, err := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithJanitor(time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&adapter.sweeps) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sweeps := atomic.LoadInt32(&adapter.sweeps)
+	if sweeps == 0 {
+		t.Fatal("janitor never swept the adapter")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if got := atomic.LoadInt32(&adapter.sweeps); got != sweeps {
+		t.Errorf("janitor swept %v times after Close(), want none", got-sweeps)
+	}
+}
+
+func TestJanitorWithoutSweeper(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithJanitor(time.Millisecond),
+	)
+	if err := client.Close(); err != nil {
+		t.Errorf("*Client.Close() error = %v", err)
+	}
+}
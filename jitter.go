@@ -0,0 +1,66 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// jitter perturbs the ttl by a random fraction of itself, up to the
+// client jitter, so that responses cached at once do not expire at once.
+// Unless it may lengthen the ttl, it only shortens it. It never returns a
+// ttl below 1ns.
+func (c *Client) jitter(ttl time.Duration, lengthen bool) time.Duration {
+	if c.ttlJitter == 0 || ttl <= 0 {
+		return ttl
+	}
+	offset := -rand.Float64()
+	if lengthen {
+		offset = 2*rand.Float64() - 1
+	}
+	jittered := time.Duration(float64(ttl) * (1 + c.ttlJitter*offset))
+	if jittered <= 0 {
+		return 1
+	}
+	return jittered
+}
+
+// ClientWithTTLJitter spreads the expiration of the responses by
+// shortening or lengthening their ttl by a random fraction of it, up to
+// the given one, e.g. 0.1 for ±10%, so that responses cached at once do
+// not all expire at once. It applies to the client ttl, the ttl function
+// and the status code ttls. Response max-ages are only shortened, as
+// their responses must not be served longer. Optional setting.
+func ClientWithTTLJitter(fraction float64) ClientOption {
+	return func(c *Client) error {
+		if fraction < 0 || fraction >= 1 {
+			return fmt.Errorf("cache client ttl jitter %v is not in [0, 1)", fraction)
+		}
+		c.ttlJitter = fraction
+		return nil
+	}
+}
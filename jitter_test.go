@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTTLJitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		maxAge  string
+		jitter  float64
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{"leaves the ttl as is by default", time.Hour, "", 0, time.Hour, time.Hour},
+		{"spreads the client ttl", time.Hour, "", 0.1, 54 * time.Minute, 66 * time.Minute},
+		{"only shortens the max-age", time.Hour, "max-age=600", 0.5, 5 * time.Minute, 10 * time.Minute},
+		{"keeps a zero max-age", time.Hour, "max-age=0", 0.5, 0, 0},
+		{"never reaches zero", 1, "", 0.9, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(tt.ttl),
+				ClientWithRespectMaxAge(true),
+				ClientWithTTLJitter(tt.jitter),
+			)
+			r, _ := http.NewRequest("GET", "http://foo.bar/jitter", nil)
+			header := http.Header{}
+			if tt.maxAge != "" {
+				header.Set("Cache-Control", tt.maxAge)
+			}
+
+			const samples = 1000
+			var (
+				min, max = time.Duration(1<<63 - 1), time.Duration(0)
+				sum      time.Duration
+				buckets  [10]int
+			)
+			for i := 0; i < samples; i++ {
+				ttl := client.responseTTL(r, http.StatusOK, header, parseCacheControl(header))
+				if ttl < tt.wantMin || ttl > tt.wantMax {
+					t.Fatalf("*Client.responseTTL() = %v, want within [%v, %v]", ttl, tt.wantMin, tt.wantMax)
+				}
+				if ttl < min {
+					min = ttl
+				}
+				if ttl > max {
+					max = ttl
+				}
+				sum += ttl / samples
+				if spread := tt.wantMax - tt.wantMin; spread > 0 {
+					buckets[int(int64(ttl-tt.wantMin)*9/int64(spread))]++
+				}
+			}
+			if tt.wantMin == tt.wantMax {
+				return
+			}
+
+			// the ttls spread over the whole range, evenly
+			spread := tt.wantMax - tt.wantMin
+			if max-min < spread*8/10 {
+				t.Errorf("*Client.responseTTL() spread = %v, want close to %v", max-min, spread)
+			}
+			if mean := tt.wantMin + spread/2; sum < mean-spread/10 || sum > mean+spread/10 {
+				t.Errorf("*Client.responseTTL() mean = %v, want close to %v", sum, mean)
+			}
+			for i, n := range buckets[:9] {
+				if n < samples/9/2 {
+					t.Errorf("*Client.responseTTL() bucket %d has %d of %d samples, want about %d", i, n, samples, samples/9)
+				}
+			}
+		})
+	}
+}
+
+func TestClientWithTTLJitter(t *testing.T) {
+	for _, fraction := range []float64{-0.1, 1, 2} {
+		if _, err := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(time.Minute), ClientWithTTLJitter(fraction)); err == nil {
+			t.Errorf("ClientWithTTLJitter(%v) error = nil, want an error", fraction)
+		}
+	}
+}
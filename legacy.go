@@ -0,0 +1,85 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+// LegacyAdapter is the Adapter interface as it was before its release
+// methods reported what they released. Wrap such adapters with
+// AdaptLegacy to keep using them.
+type LegacyAdapter interface {
+	Get(prefix, key string) ([]byte, bool)
+	Exists(prefix, key string) bool
+	Set(prefix, key string, response []byte)
+	Release(prefix, key string)
+	ReleasePrefix(prefix string)
+	ReleaseIfStartsWith(key string)
+}
+
+// ReleasedUnknown is the number of released responses reported by
+// adapters that cannot count them.
+const ReleasedUnknown = -1
+
+// legacyAdapter adapts a LegacyAdapter to the Adapter interface.
+type legacyAdapter struct {
+	LegacyAdapter
+}
+
+// AdaptLegacy returns an Adapter releasing through a LegacyAdapter. The
+// optional interfaces the legacy adapter implements are still used.
+// Releasing a single response reports whether it existed, while prefix
+// releases cannot count and report ReleasedUnknown.
+func AdaptLegacy(a LegacyAdapter) Adapter {
+	return legacyAdapter{a}
+}
+
+// Release implements the Adapter interface Release method.
+func (a legacyAdapter) Release(prefix, key string) (int, error) {
+	if !a.LegacyAdapter.Exists(prefix, key) {
+		return 0, nil
+	}
+	a.LegacyAdapter.Release(prefix, key)
+	return 1, nil
+}
+
+// ReleasePrefix implements the Adapter interface ReleasePrefix method.
+func (a legacyAdapter) ReleasePrefix(prefix string) (int, error) {
+	a.LegacyAdapter.ReleasePrefix(prefix)
+	return ReleasedUnknown, nil
+}
+
+// ReleaseIfStartsWith implements the Adapter interface
+// ReleaseIfStartsWith method.
+func (a legacyAdapter) ReleaseIfStartsWith(key string) (int, error) {
+	a.LegacyAdapter.ReleaseIfStartsWith(key)
+	return ReleasedUnknown, nil
+}
+
+// optional returns the value the optional adapter interfaces, such as
+// TTLSetter or Toucher, are looked up on.
+func (c *Client) optional() interface{} {
+	if a, ok := c.adapter.(legacyAdapter); ok {
+		return a.LegacyAdapter
+	}
+	return c.adapter
+}
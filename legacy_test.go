@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// legacyMock implements the LegacyAdapter interface on top of adapterMock,
+// along with the optional TTLSetter interface.
+type legacyMock struct {
+	mock    adapterMock
+	withTTL bool
+}
+
+func (a *legacyMock) Get(prefix, key string) ([]byte, bool) { return a.mock.Get(prefix, key) }
+func (a *legacyMock) Exists(prefix, key string) bool        { return a.mock.Exists(prefix, key) }
+func (a *legacyMock) Set(prefix, key string, response []byte) {
+	a.mock.Set(prefix, key, response)
+}
+func (a *legacyMock) SetWithTTL(prefix, key string, response []byte, ttl time.Duration) {
+	a.withTTL = true
+	a.mock.Set(prefix, key, response)
+}
+func (a *legacyMock) Release(prefix, key string)     { a.mock.Release(prefix, key) }
+func (a *legacyMock) ReleasePrefix(prefix string)    { a.mock.ReleasePrefix(prefix) }
+func (a *legacyMock) ReleaseIfStartsWith(key string) { a.mock.ReleaseIfStartsWith(key) }
+
+func TestAdaptLegacy(t *testing.T) {
+	legacy := &legacyMock{}
+	a := AdaptLegacy(legacy)
+	legacy.Set("/a", "1", []byte("1"))
+	legacy.Set("/b", "2", []byte("2"))
+
+	tests := []struct {
+		name    string
+		release func() (int, error)
+		want    int
+	}{
+		{"releases a non-existent key", func() (int, error) { return a.Release("/a", "2") }, 0},
+		{"releases a key", func() (int, error) { return a.Release("/a", "1") }, 1},
+		{"releases a prefix without counting", func() (int, error) { return a.ReleasePrefix("/b") }, ReleasedUnknown},
+		{"releases by start without counting", func() (int, error) { return a.ReleaseIfStartsWith("/c") }, ReleasedUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.release()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("legacyAdapter release = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if legacy.Exists("/a", "1") || legacy.Exists("/b", "2") {
+		t.Error("legacyAdapter did not release through the legacy adapter")
+	}
+
+	client, _ := NewClient(
+		ClientWithAdapter(a),
+		ClientWithTTL(1*time.Minute),
+	)
+	if _, ok := client.optional().(TTLSetter); !ok {
+		t.Error("*Client.optional() hides the legacy adapter optional interfaces")
+	}
+}
+
+func TestLogReleaseUnknown(t *testing.T) {
+	logger := &loggerMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(AdaptLegacy(&legacyMock{})),
+		ClientWithTTL(1*time.Minute),
+		ClientWithLogger(logger),
+	)
+	n, err := client.ReleaseURI("/a")
+	if err != nil || n != ReleasedUnknown {
+		t.Fatalf("*Client.ReleaseURI() = %v, %v, want ReleasedUnknown", n, err)
+	}
+	for _, msg := range logger.debug {
+		if strings.Contains(msg, "nothing to release") {
+			t.Errorf("*Client.ReleaseURI() logged %q for an uncounted release", msg)
+		}
+	}
+}
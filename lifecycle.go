@@ -0,0 +1,107 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// defaultCloseTimeout is how long Close waits for the background work by
+// default.
+const defaultCloseTimeout = 5 * time.Second
+
+// goAsync runs fn in a goroutine Close waits for. It reports false and
+// does not run fn once the client is closed.
+func (c *Client) goAsync(fn func()) bool {
+	c.asyncMutex.Lock()
+	defer c.asyncMutex.Unlock()
+	if c.ctx.Err() != nil {
+		return false
+	}
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		fn()
+	}()
+	return true
+}
+
+// Close stops the client background goroutines, waits up to the close
+// timeout for the pending writes to the adapter, then closes the adapter
+// when it implements io.Closer. Calling it again returns the same error.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		c.asyncMutex.Lock()
+		c.cancel()
+		c.asyncMutex.Unlock()
+
+		done := make(chan struct{})
+		go func() {
+			c.workers.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(c.closeTimeout):
+			c.closeErr = fmt.Errorf("cache client background work did not finish within %v", c.closeTimeout)
+		}
+
+		if closer, ok := c.optional().(io.Closer); ok {
+			if err := closer.Close(); err != nil && c.closeErr == nil {
+				c.closeErr = err
+			}
+		}
+	})
+	return c.closeErr
+}
+
+// ClientWithContext sets the context the client background work derives
+// from. Canceling it stops the work as Close does, but leaves the adapter
+// open. Optional setting.
+func ClientWithContext(ctx context.Context) ClientOption {
+	return func(c *Client) error {
+		if ctx == nil {
+			return errors.New("cache client context is not set")
+		}
+		c.ctx = ctx
+		return nil
+	}
+}
+
+// ClientWithCloseTimeout sets how long Close waits for the background work
+// to finish. Default is 5 seconds. Optional setting.
+func ClientWithCloseTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) error {
+		if timeout <= 0 {
+			return fmt.Errorf("cache client close timeout %v is invalid", timeout)
+		}
+		c.closeTimeout = timeout
+		return nil
+	}
+}
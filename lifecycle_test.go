@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// closerMock is an adapterMock implementing the io.Closer interface.
+type closerMock struct {
+	adapterMock
+	closed int32
+	err    error
+}
+
+func (a *closerMock) Close() error {
+	atomic.AddInt32(&a.closed, 1)
+	return a.err
+}
+
+func TestClose(t *testing.T) {
+	tests := []struct {
+		name         string
+		work         time.Duration
+		timeout      time.Duration
+		err          error
+		wantErr      bool
+		wantFinished bool
+	}{
+		{"waits for the background work", 10 * time.Millisecond, time.Second, nil, false, true},
+		{"times out", time.Second, 10 * time.Millisecond, nil, true, false},
+		{"returns the adapter error", 0, time.Second, errors.New("closing"), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &closerMock{err: tt.err}
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Minute),
+				ClientWithCloseTimeout(tt.timeout),
+			)
+			var finished int32
+			work := tt.work
+			client.goAsync(func() {
+				time.Sleep(work)
+				atomic.StoreInt32(&finished, 1)
+			})
+
+			err := client.Close()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("*Client.Close() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&finished) == 1; got != tt.wantFinished {
+				t.Errorf("*Client.Close() background work finished = %v, want %v", got, tt.wantFinished)
+			}
+			if err2 := client.Close(); err2 != err {
+				t.Errorf("*Client.Close() second error = %v, want %v", err2, err)
+			}
+			if got := atomic.LoadInt32(&adapter.closed); got != 1 {
+				t.Errorf("adapter closed %v times, want 1", got)
+			}
+			if client.goAsync(func() {}) {
+				t.Error("*Client.goAsync() ran after Close()")
+			}
+		})
+	}
+}
+
+func TestClientWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	adapter := &closerMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithContext(ctx),
+	)
+	if !client.goAsync(func() {}) {
+		t.Error("*Client.goAsync() did not run before the context was canceled")
+	}
+
+	cancel()
+	if client.goAsync(func() {}) {
+		t.Error("*Client.goAsync() ran after the context was canceled")
+	}
+	if got := atomic.LoadInt32(&adapter.closed); got != 0 {
+		t.Errorf("adapter closed %v times on cancel, want 0", got)
+	}
+}
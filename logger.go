@@ -0,0 +1,73 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Logger is the interface the client writes its log messages to. It is
+// implemented by the logrus logger, and zap or slog can be adapted to it
+// with a couple of methods.
+type Logger interface {
+	// Debugf logs the cache decisions made for each request.
+	Debugf(format string, args ...interface{})
+
+	// Errorf logs failures to use the cache.
+	Errorf(format string, args ...interface{})
+}
+
+// requestLogger is a Logger adding the cache prefix and key of the
+// request to each message.
+type requestLogger struct {
+	Logger
+	prefix string
+	key    string
+}
+
+func (l requestLogger) Debugf(format string, args ...interface{}) {
+	l.Logger.Debugf(format+" (prefix=%q key=%q)", append(args, l.prefix, l.key)...)
+}
+
+func (l requestLogger) Errorf(format string, args ...interface{}) {
+	l.Logger.Errorf(format+" (prefix=%q key=%q)", append(args, l.prefix, l.key)...)
+}
+
+// requestLog returns the logger for the request with the given cache
+// prefix and key.
+func (c *Client) requestLog(prefix, key string) requestLogger {
+	return requestLogger{Logger: c.log, prefix: prefix, key: key}
+}
+
+// debugLogger returns a logger writing every message down to the debug
+// level to the standard error.
+func debugLogger() Logger {
+	l := log.New()
+	l.Out = os.Stderr
+	l.SetLevel(log.DebugLevel)
+	return l
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type loggerMock struct {
+	debug []string
+	error []string
+}
+
+func (l *loggerMock) Debugf(format string, args ...interface{}) {
+	l.debug = append(l.debug, fmt.Sprintf(format, args...))
+}
+
+func (l *loggerMock) Errorf(format string, args ...interface{}) {
+	l.error = append(l.error, fmt.Sprintf(format, args...))
+}
+
+func TestClientWithLogger(t *testing.T) {
+	logger := &loggerMock{}
+	client, err := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithLogger(logger),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("value"))
+	}))
+
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "http://foo.bar/logger", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	want := fmt.Sprintf("serving from cache (prefix=%q key=%q)", "/logger", generateKey("http://foo.bar/logger"))
+	found := false
+	for _, msg := range logger.debug {
+		if msg == want {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("*Client.Middleware() debug messages = %v, want %v among them", strings.Join(logger.debug, "; "), want)
+	}
+	if len(logger.error) > 0 {
+		t.Errorf("*Client.Middleware() error messages = %v, want none", logger.error)
+	}
+
+	if _, err := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(1*time.Minute), ClientWithLogger(nil)); err == nil {
+		t.Error("NewClient() with nil logger error = nil, want error")
+	}
+}
+
+func TestClientWithDebugOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []ClientOption
+		wantLevel log.Level
+		wantStd   bool
+	}{
+		{
+			"uses the standard logger by default",
+			nil,
+			0,
+			true,
+		},
+		{
+			"uses a debug logger",
+			[]ClientOption{ClientWithDebugOutput(true)},
+			log.DebugLevel,
+			false,
+		},
+		{
+			"keeps the given logger",
+			[]ClientOption{ClientWithDebugOutput(true), ClientWithLogger(log.StandardLogger())},
+			0,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]ClientOption{ClientWithAdapter(&adapterMock{}), ClientWithTTL(1 * time.Minute)}, tt.opts...)
+			client, err := NewClient(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := client.log == Logger(log.StandardLogger()); got != tt.wantStd {
+				t.Errorf("NewClient() uses standard logger = %v, want %v", got, tt.wantStd)
+			}
+			if tt.wantStd {
+				return
+			}
+			if got := client.log.(*log.Logger).GetLevel(); got != tt.wantLevel {
+				t.Errorf("NewClient() logger level = %v, want %v", got, tt.wantLevel)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import "time"
+
+// Collector receives the cache events of the middleware, e.g. to export
+// them as metrics. Events are labelled by the request cache prefix.
+type Collector interface {
+	// IncHit counts a response served from the cache.
+	IncHit(prefix string)
+
+	// IncMiss counts a response taken from the handler because it was
+	// not cached or expired.
+	IncMiss(prefix string)
+
+	// IncBypass counts a request that went to the handler without a
+	// cache lookup, e.g. a refresh or a non-GET request.
+	IncBypass(prefix string)
+
+	// IncStore counts a response stored in the cache.
+	IncStore(prefix string)
+
+	// IncStoreSkip counts a handler response that was not stored, e.g.
+	// because of its status code or Cache-Control directives.
+	IncStoreSkip(prefix string)
+
+	// ObserveOriginLatency records how long the handler took to respond.
+	ObserveOriginLatency(prefix string, d time.Duration)
+}
+
+// nopCollector is the Collector used when no metrics are set.
+type nopCollector struct{}
+
+func (nopCollector) IncHit(string)                              {}
+func (nopCollector) IncMiss(string)                             {}
+func (nopCollector) IncBypass(string)                           {}
+func (nopCollector) IncStore(string)                            {}
+func (nopCollector) IncStoreSkip(string)                        {}
+func (nopCollector) ObserveOriginLatency(string, time.Duration) {}
+
+// countStatus reports the cache status of a request to the collector.
+func (c *Client) countStatus(prefix, status string) {
+	switch status {
+	case cacheStatusHit, cacheStatusStale:
+		c.metrics.IncHit(prefix)
+	case cacheStatusMiss:
+		c.metrics.IncMiss(prefix)
+	case cacheStatusBypass:
+		c.metrics.IncBypass(prefix)
+	}
+}
@@ -0,0 +1,45 @@
+package prometheus_test
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/memory"
+	cachemetrics "github.com/Columbus-internet/http-cache/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func Example() {
+	collector, err := cachemetrics.NewCollector()
+	if err != nil {
+		log.Fatal(err)
+	}
+	prometheus.MustRegister(collector)
+
+	adapter, err := memory.NewAdapter(
+		memory.AdapterWithCapacity(10000),
+		memory.AdapterWithMetrics(collector),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client, err := cache.NewClient(
+		cache.ClientWithAdapter(adapter),
+		cache.ClientWithTTL(10*time.Minute),
+		cache.ClientWithMetrics(collector),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Ok"))
+	})
+
+	http.Handle("/", client.Middleware(handler))
+	http.Handle("/metrics", promhttp.Handler())
+}
@@ -0,0 +1,294 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/memory"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector exports the cache client and memory adapter events as
+// Prometheus metrics. Register it with a Prometheus registry, then pass
+// it to cache.ClientWithMetrics and memory.AdapterWithMetrics.
+type Collector struct {
+	namespace   string
+	buckets     []float64
+	prefixLabel func(prefix string) string
+
+	hits           *prometheus.CounterVec
+	misses         *prometheus.CounterVec
+	bypasses       *prometheus.CounterVec
+	stores         *prometheus.CounterVec
+	storeSkips     *prometheus.CounterVec
+	originLatency  *prometheus.HistogramVec
+	shed           *prometheus.CounterVec
+	adapterLatency *prometheus.HistogramVec
+	codecLatency   *prometheus.HistogramVec
+	evictions      prometheus.Counter
+	entries        prometheus.Gauge
+	bytes          prometheus.Gauge
+	circuitState   prometheus.Gauge
+}
+
+// CollectorOption is used to set Collector settings.
+type CollectorOption func(c *Collector) error
+
+var (
+	_ cache.Collector        = (*Collector)(nil)
+	_ cache.ShedCollector    = (*Collector)(nil)
+	_ cache.TimingCollector  = (*Collector)(nil)
+	_ cache.CircuitCollector = (*Collector)(nil)
+	_ memory.Metrics         = (*Collector)(nil)
+	_ memory.BytesMetrics    = (*Collector)(nil)
+	_ prometheus.Collector   = (*Collector)(nil)
+)
+
+// IncHit implements the cache Collector interface IncHit method.
+func (c *Collector) IncHit(prefix string) {
+	c.hits.WithLabelValues(c.prefixLabel(prefix)).Inc()
+}
+
+// IncMiss implements the cache Collector interface IncMiss method.
+func (c *Collector) IncMiss(prefix string) {
+	c.misses.WithLabelValues(c.prefixLabel(prefix)).Inc()
+}
+
+// IncBypass implements the cache Collector interface IncBypass method.
+func (c *Collector) IncBypass(prefix string) {
+	c.bypasses.WithLabelValues(c.prefixLabel(prefix)).Inc()
+}
+
+// IncStore implements the cache Collector interface IncStore method.
+func (c *Collector) IncStore(prefix string) {
+	c.stores.WithLabelValues(c.prefixLabel(prefix)).Inc()
+}
+
+// IncStoreSkip implements the cache Collector interface IncStoreSkip
+// method.
+func (c *Collector) IncStoreSkip(prefix string) {
+	c.storeSkips.WithLabelValues(c.prefixLabel(prefix)).Inc()
+}
+
+// ObserveOriginLatency implements the cache Collector interface
+// ObserveOriginLatency method.
+func (c *Collector) ObserveOriginLatency(prefix string, d time.Duration) {
+	c.originLatency.WithLabelValues(c.prefixLabel(prefix)).Observe(d.Seconds())
+}
+
+// IncShed implements the cache ShedCollector interface IncShed method.
+func (c *Collector) IncShed(prefix string) {
+	c.shed.WithLabelValues(c.prefixLabel(prefix)).Inc()
+}
+
+// ObserveAdapterLatency implements the cache TimingCollector interface
+// ObserveAdapterLatency method.
+func (c *Collector) ObserveAdapterLatency(prefix, op string, d time.Duration) {
+	c.adapterLatency.WithLabelValues(c.prefixLabel(prefix), op).Observe(d.Seconds())
+}
+
+// ObserveCodecLatency implements the cache TimingCollector interface
+// ObserveCodecLatency method.
+func (c *Collector) ObserveCodecLatency(prefix, op string, d time.Duration) {
+	c.codecLatency.WithLabelValues(c.prefixLabel(prefix), op).Observe(d.Seconds())
+}
+
+// SetCircuitState implements the cache CircuitCollector interface
+// SetCircuitState method.
+func (c *Collector) SetCircuitState(state cache.CircuitState) {
+	c.circuitState.Set(float64(state))
+}
+
+// IncEviction implements the memory Metrics interface IncEviction method.
+func (c *Collector) IncEviction() {
+	c.evictions.Inc()
+}
+
+// SetEntries implements the memory Metrics interface SetEntries method.
+func (c *Collector) SetEntries(n int) {
+	c.entries.Set(float64(n))
+}
+
+// SetBytes implements the memory BytesMetrics interface SetBytes method.
+func (c *Collector) SetBytes(n int64) {
+	c.bytes.Set(float64(n))
+}
+
+// Describe implements the prometheus Collector interface Describe method.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.hits.Describe(ch)
+	c.misses.Describe(ch)
+	c.bypasses.Describe(ch)
+	c.stores.Describe(ch)
+	c.storeSkips.Describe(ch)
+	c.originLatency.Describe(ch)
+	c.shed.Describe(ch)
+	c.adapterLatency.Describe(ch)
+	c.codecLatency.Describe(ch)
+	c.evictions.Describe(ch)
+	c.entries.Describe(ch)
+	c.bytes.Describe(ch)
+	c.circuitState.Describe(ch)
+}
+
+// Collect implements the prometheus Collector interface Collect method.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.hits.Collect(ch)
+	c.misses.Collect(ch)
+	c.bypasses.Collect(ch)
+	c.stores.Collect(ch)
+	c.storeSkips.Collect(ch)
+	c.originLatency.Collect(ch)
+	c.shed.Collect(ch)
+	c.adapterLatency.Collect(ch)
+	c.codecLatency.Collect(ch)
+	c.evictions.Collect(ch)
+	c.entries.Collect(ch)
+	c.bytes.Collect(ch)
+	c.circuitState.Collect(ch)
+}
+
+func (c *Collector) counterVec(name, help string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: c.namespace,
+		Name:      name,
+		Help:      help,
+	}, []string{"prefix"})
+}
+
+// NewCollector initializes the Prometheus collector. Metrics are
+// labelled by the cache prefix, the request path by default, so use
+// CollectorWithPrefixLabel to keep their cardinality bounded.
+func NewCollector(opts ...CollectorOption) (*Collector, error) {
+	c := &Collector{
+		namespace: "http_cache",
+		buckets:   prometheus.DefBuckets,
+		prefixLabel: func(prefix string) string {
+			return prefix
+		},
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	c.hits = c.counterVec("hits_total", "Number of responses served from the cache.")
+	c.misses = c.counterVec("misses_total", "Number of responses taken from the handler because they were not cached.")
+	c.bypasses = c.counterVec("bypasses_total", "Number of requests that went to the handler without a cache lookup.")
+	c.stores = c.counterVec("stores_total", "Number of responses stored in the cache.")
+	c.storeSkips = c.counterVec("store_skips_total", "Number of handler responses that were not stored in the cache.")
+	c.shed = c.counterVec("shed_total", "Number of requests shed by the concurrent fetch limits.")
+	c.originLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: c.namespace,
+		Name:      "origin_latency_seconds",
+		Help:      "Time taken by the handler to respond.",
+		Buckets:   c.buckets,
+	}, []string{"prefix"})
+	// adapter calls and encoding take well under the handler time
+	fastBuckets := prometheus.ExponentialBuckets(0.0001, 2, 14)
+	c.adapterLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: c.namespace,
+		Name:      "adapter_latency_seconds",
+		Help:      "Time taken by the adapter get and set calls.",
+		Buckets:   fastBuckets,
+	}, []string{"prefix", "op"})
+	c.codecLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: c.namespace,
+		Name:      "codec_latency_seconds",
+		Help:      "Time taken to encode and decode the cached responses.",
+		Buckets:   fastBuckets,
+	}, []string{"prefix", "op"})
+	c.evictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: c.namespace,
+		Name:      "evictions_total",
+		Help:      "Number of cached responses evicted to make room for new ones.",
+	})
+	c.entries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: c.namespace,
+		Name:      "entries",
+		Help:      "Number of cached responses.",
+	})
+	c.bytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: c.namespace,
+		Name:      "bytes",
+		Help:      "Size of the cached responses in bytes.",
+	})
+	c.circuitState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: c.namespace,
+		Name:      "circuit_state",
+		Help:      "State of the circuit breaker around the adapter: 0 closed, 1 open, 2 half-open.",
+	})
+
+	return c, nil
+}
+
+// CollectorWithNamespace sets the namespace of the metric names,
+// "http_cache" by default.
+func CollectorWithNamespace(namespace string) CollectorOption {
+	return func(c *Collector) error {
+		c.namespace = namespace
+		return nil
+	}
+}
+
+// CollectorWithBuckets sets the buckets of the origin latency histogram,
+// in seconds. Optional setting.
+func CollectorWithBuckets(buckets ...float64) CollectorOption {
+	return func(c *Collector) error {
+		if len(buckets) == 0 {
+			return errors.New("prometheus collector buckets are not set")
+		}
+		for i := 1; i < len(buckets); i++ {
+			if buckets[i] <= buckets[i-1] {
+				return fmt.Errorf("prometheus collector buckets %v are not increasing", buckets)
+			}
+		}
+
+		c.buckets = buckets
+
+		return nil
+	}
+}
+
+// CollectorWithPrefixLabel sets a function mapping the cache prefix to
+// the value of the prefix label, e.g. a route name. Returning the same
+// value for every prefix drops the per prefix breakdown. Optional setting.
+func CollectorWithPrefixLabel(label func(prefix string) string) CollectorOption {
+	return func(c *Collector) error {
+		if label == nil {
+			return errors.New("prometheus collector prefix label function is not set")
+		}
+
+		c.prefixLabel = label
+
+		return nil
+	}
+}
@@ -0,0 +1,124 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	c, err := NewCollector(CollectorWithNamespace("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.IncHit("/a")
+	c.IncHit("/a")
+	c.IncMiss("/a")
+	c.IncBypass("/b")
+	c.IncStore("/a")
+	c.IncStoreSkip("/b")
+	c.ObserveOriginLatency("/a", 10*time.Millisecond)
+	c.IncShed("/a")
+	c.ObserveAdapterLatency("/a", "get", 100*time.Microsecond)
+	c.ObserveAdapterLatency("/a", "set", 200*time.Microsecond)
+	c.ObserveCodecLatency("/a", "decode", 50*time.Microsecond)
+	c.IncEviction()
+	c.SetEntries(3)
+	c.SetBytes(1024)
+	c.SetCircuitState(cache.CircuitOpen)
+
+	tests := []struct {
+		name   string
+		metric prometheus.Collector
+		want   float64
+	}{
+		{"hits", c.hits.WithLabelValues("/a"), 2},
+		{"misses", c.misses.WithLabelValues("/a"), 1},
+		{"bypasses", c.bypasses.WithLabelValues("/b"), 1},
+		{"stores", c.stores.WithLabelValues("/a"), 1},
+		{"store skips", c.storeSkips.WithLabelValues("/b"), 1},
+		{"shed", c.shed.WithLabelValues("/a"), 1},
+		{"evictions", c.evictions, 1},
+		{"entries", c.entries, 3},
+		{"bytes", c.bytes, 1024},
+		{"circuit state", c.circuitState, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testutil.ToFloat64(tt.metric); got != tt.want {
+				t.Errorf("Collector %v = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.CollectAndCount(c, "test_origin_latency_seconds"); got != 1 {
+		t.Errorf("Collector origin latency series = %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(c, "test_adapter_latency_seconds"); got != 2 {
+		t.Errorf("Collector adapter latency series = %v, want 2", got)
+	}
+	if got := testutil.CollectAndCount(c, "test_codec_latency_seconds"); got != 1 {
+		t.Errorf("Collector codec latency series = %v, want 1", got)
+	}
+}
+
+func TestCollectorWithPrefixLabel(t *testing.T) {
+	c, _ := NewCollector(CollectorWithPrefixLabel(func(prefix string) string {
+		return "all"
+	}))
+	c.IncHit("/a")
+	c.IncHit("/b")
+
+	if got := testutil.ToFloat64(c.hits.WithLabelValues("all")); got != 2 {
+		t.Errorf("Collector hits = %v, want 2", got)
+	}
+}
+
+func TestNewCollector(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []CollectorOption
+		wantErr bool
+	}{
+		{
+			"returns new collector",
+			nil,
+			false,
+		},
+		{
+			"returns new collector with buckets",
+			[]CollectorOption{CollectorWithBuckets(0.1, 1)},
+			false,
+		},
+		{
+			"returns error on empty buckets",
+			[]CollectorOption{CollectorWithBuckets()},
+			true,
+		},
+		{
+			"returns error on unordered buckets",
+			[]CollectorOption{CollectorWithBuckets(1, 0.1)},
+			true,
+		},
+		{
+			"returns error on nil prefix label function",
+			[]CollectorOption{CollectorWithPrefixLabel(nil)},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCollector(tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewCollector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type collectorMock struct {
+	events    map[string]int
+	latencies int
+}
+
+func (c *collectorMock) IncHit(prefix string)       { c.events["hit "+prefix]++ }
+func (c *collectorMock) IncMiss(prefix string)      { c.events["miss "+prefix]++ }
+func (c *collectorMock) IncBypass(prefix string)    { c.events["bypass "+prefix]++ }
+func (c *collectorMock) IncStore(prefix string)     { c.events["store "+prefix]++ }
+func (c *collectorMock) IncStoreSkip(prefix string) { c.events["skip "+prefix]++ }
+func (c *collectorMock) ObserveOriginLatency(prefix string, d time.Duration) {
+	c.latencies++
+}
+
+func TestMiddlewareMetrics(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		w.Write([]byte("value"))
+	})
+
+	collector := &collectorMock{events: make(map[string]int)}
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithRefreshKey("rk"),
+		ClientWithMetrics(collector),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	requests := []struct {
+		method string
+		url    string
+	}{
+		{"GET", "http://foo.bar/metrics"},
+		{"GET", "http://foo.bar/metrics"},
+		{"GET", "http://foo.bar/metrics?rk=1"},
+		{"POST", "http://foo.bar/metrics"},
+		{"GET", "http://foo.bar/private"},
+	}
+	for _, req := range requests {
+		r, _ := http.NewRequest(req.method, req.url, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	want := map[string]int{
+		"miss /metrics":   1,
+		"hit /metrics":    1,
+		"bypass /metrics": 2,
+		"store /metrics":  2,
+		"miss /private":   1,
+		"skip /private":   1,
+	}
+	if !reflect.DeepEqual(collector.events, want) {
+		t.Errorf("*Client.Middleware() metrics = %v, want %v", collector.events, want)
+	}
+	if collector.latencies != 4 {
+		t.Errorf("*Client.Middleware() origin latencies = %v, want 4", collector.latencies)
+	}
+}
+
+func TestClientWithMetrics(t *testing.T) {
+	_, err := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithMetrics(nil),
+	)
+	if err == nil {
+		t.Error("NewClient() with nil metrics collector error = nil, want error")
+	}
+}
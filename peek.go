@@ -0,0 +1,100 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import "net/http"
+
+// Peeker is implemented by adapters able to read the start of a cached
+// response without fetching it whole, e.g. with Redis GETRANGE, so that
+// Client.Peek does not transfer the body.
+type Peeker interface {
+	// Peek returns the first n bytes of the response cached by a given
+	// key, fewer when it is shorter, its size in bytes, and whether it
+	// exists.
+	Peek(prefix, key string, n int) (head []byte, size int, ok bool)
+}
+
+// Peek describes the response cached for the given URI, resolved as
+// Client.Release does, and reports whether one is cached, expired or not.
+// With the default codec and an adapter implementing Peeker, the body is
+// not fetched, and Size is the body size as stored, i.e. compressed when
+// compression is enabled; otherwise the response is fetched, but its body
+// is not decompressed. A response varying on request headers is described
+// by its Vary marker, with a zero status code and size, as its variants
+// depend on the request.
+func (c *Client) Peek(uri string) (EntryMeta, bool) {
+	prefix, key, err := c.uriPrefixAndKey(uri)
+	if err != nil {
+		return EntryMeta{}, false
+	}
+	if meta, ok, done := c.peekFrame(prefix, key); done {
+		return meta, ok
+	}
+	b, ok := c.get(c.background(), nil, c.log, prefix, key)
+	if !ok {
+		return EntryMeta{}, false
+	}
+	response, err := c.codec.Unmarshal(b)
+	if err != nil {
+		c.log.Debugf("cached response of %v is corrupt: %v", uri, err)
+		return EntryMeta{}, false
+	}
+	return newEntryMeta(prefix, key, response), true
+}
+
+// peekFrame describes the framed response by a given key from its fixed
+// header alone, when the adapter can fetch it without the rest. It
+// reports false for done when the response must be fetched whole, e.g.
+// a Vary marker, whose header fields are needed.
+func (c *Client) peekFrame(prefix, key string) (meta EntryMeta, ok, done bool) {
+	p, isPeeker := c.optional().(Peeker)
+	if _, isFrame := c.codec.(FrameCodec); !isPeeker || !isFrame {
+		return EntryMeta{}, false, false
+	}
+	head, size, ok := p.Peek(prefix, key, frameHeaderSize)
+	if !ok {
+		return EntryMeta{}, false, true
+	}
+	if !isFramed(head) {
+		return EntryMeta{}, false, false
+	}
+	meta, err := frameMeta(head, size)
+	if err != nil || meta.StatusCode == 0 {
+		return EntryMeta{}, false, false
+	}
+	meta.Prefix, meta.Key = prefix, key
+	return meta, true, true
+}
+
+// uriPrefixAndKey returns the prefix and key of the response cached for
+// the URI, as the middleware generates them for a GET request.
+func (c *Client) uriPrefixAndKey(uri string) (prefix, key string, err error) {
+	r, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return "", "", err
+	}
+	prefix, key = c.GeneratePrefixAndKey(r)
+	return prefix, key, nil
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// peekerAdapterMock counts the responses fetched whole.
+type peekerAdapterMock struct {
+	adapterMock
+	gets int
+}
+
+func (a *peekerAdapterMock) Get(prefix, key string) ([]byte, bool) {
+	a.gets++
+	return a.adapterMock.Get(prefix, key)
+}
+
+func (a *peekerAdapterMock) Peek(prefix, key string, n int) ([]byte, int, bool) {
+	b, ok := a.adapterMock.Get(prefix, key)
+	if len(b) > n {
+		return b[:n], len(b), ok
+	}
+	return b, len(b), ok
+}
+
+func TestPeek(t *testing.T) {
+	tests := []struct {
+		name     string
+		adapter  Adapter
+		vary     bool
+		wantGets int
+	}{
+		{"peeks the frame header", &peekerAdapterMock{}, false, 0},
+		{"fetches the response without a Peeker", &adapterMock{}, false, 1},
+		{"fetches the Vary marker", &peekerAdapterMock{}, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := NewClient(
+				ClientWithAdapter(tt.adapter),
+				ClientWithTTL(time.Minute),
+			)
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.vary {
+					w.Header().Set("Vary", "Accept-Language")
+				}
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("value"))
+			}))
+			start := time.Now()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://foo.bar/peek?a=1", nil))
+			if p, ok := tt.adapter.(*peekerAdapterMock); ok {
+				p.gets = 0
+			}
+
+			if _, ok := client.Peek("http://foo.bar/missing"); ok {
+				t.Error("*Client.Peek() of a response never cached = true, want false")
+			}
+			meta, ok := client.Peek("http://foo.bar/peek?a=1")
+			if !ok {
+				t.Fatal("*Client.Peek() = false, want true")
+			}
+			prefix, key := client.GeneratePrefixAndKey(httptest.NewRequest("GET", "http://foo.bar/peek?a=1", nil))
+			if meta.Prefix != prefix || meta.Key != key {
+				t.Errorf("*Client.Peek() prefix and key = %v, %v, want %v, %v", meta.Prefix, meta.Key, prefix, key)
+			}
+			wantStatus, wantSize := http.StatusCreated, len("value")
+			if tt.vary {
+				wantStatus, wantSize = 0, 0
+			}
+			if meta.StatusCode != wantStatus || meta.Size != wantSize {
+				t.Errorf("*Client.Peek() status and size = %v, %v, want %v, %v", meta.StatusCode, meta.Size, wantStatus, wantSize)
+			}
+			if ttl := meta.Expiration.Sub(start); ttl < time.Minute || ttl > time.Minute+time.Second {
+				t.Errorf("*Client.Peek() expiration in %v, want %v", ttl, time.Minute)
+			}
+			if !tt.vary && meta.Frequency != 1 {
+				t.Errorf("*Client.Peek() frequency = %v, want 1", meta.Frequency)
+			}
+			if p, ok := tt.adapter.(*peekerAdapterMock); ok && p.gets != tt.wantGets {
+				t.Errorf("responses fetched whole = %v, want %v", p.gets, tt.wantGets)
+			}
+		})
+	}
+}
+
+func TestFrameMeta(t *testing.T) {
+	now := time.Now()
+	b := marshalFrame(Response{
+		Value:      []byte("value"),
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		StatusCode: http.StatusOK,
+		Expiration: now.Add(time.Minute),
+		LastAccess: now,
+		Frequency:  3,
+		CachedAt:   now,
+	})
+	meta, err := frameMeta(b[:frameHeaderSize], len(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Size != 5 || meta.StatusCode != http.StatusOK || meta.Frequency != 3 ||
+		!meta.Expiration.Equal(now.Add(time.Minute)) || !meta.LastAccess.Equal(now) {
+		t.Errorf("frameMeta() = %+v", meta)
+	}
+	if _, err := frameMeta(b[:10], len(b)); err == nil {
+		t.Error("frameMeta() of a truncated header error = nil, want an error")
+	}
+	if _, err := frameMeta(b[:frameHeaderSize], frameHeaderSize+1); err == nil {
+		t.Error("frameMeta() of a truncated frame error = nil, want an error")
+	}
+}
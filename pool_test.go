@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResponseBytesOwned(t *testing.T) {
+	first := Response{Value: []byte("first")}.Bytes()
+	want := append([]byte(nil), first...)
+	// the bytes returned before must not be shared with later calls
+	Response{Value: []byte("second")}.Bytes()
+	if !bytes.Equal(first, want) {
+		t.Error("Response.Bytes() returned bytes overwritten by a later call")
+	}
+	response, err := BytesToResponse(first)
+	if err != nil || string(response.Value) != "first" {
+		t.Errorf("BytesToResponse() = %v, %v, want first", string(response.Value), err)
+	}
+}
+
+func benchmarkResponse() Response {
+	return Response{
+		Value:      bytes.Repeat([]byte("a"), 16<<10),
+		Header:     http.Header{"Content-Type": {"application/json"}, "Etag": {`W/"1"`}},
+		StatusCode: http.StatusOK,
+		Expiration: time.Now().Add(time.Minute),
+		CachedAt:   time.Now(),
+	}
+}
+
+func BenchmarkResponseBytes(b *testing.B) {
+	response := benchmarkResponse()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		response.Bytes()
+	}
+}
+
+func BenchmarkBytesToResponse(b *testing.B) {
+	encoded := benchmarkResponse().Bytes()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		BytesToResponse(encoded)
+	}
+}
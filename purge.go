@@ -0,0 +1,65 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import "net/http"
+
+// methodPurge is the Varnish style method releasing a cached response.
+const methodPurge = "PURGE"
+
+// servePurge releases the response cached for the GET request to the
+// same URL, answering 200 when there was one and 204 otherwise. With the
+// X-Soft-Purge header set to 1, the response is marked stale instead.
+// Without a purge authorizer every PURGE request is answered 403.
+func (c *Client) servePurge(w http.ResponseWriter, r *http.Request) {
+	if c.purgeAuthorizer == nil || !c.purgeAuthorizer(r) {
+		c.log.Debugf("purge request is not authorized (resource=%q)", r.URL.String())
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+
+	get := r.WithContext(r.Context())
+	get.Method = http.MethodGet
+	get.Body = nil
+	prefix, key := c.GeneratePrefixAndKey(get)
+	var (
+		n   int
+		err error
+	)
+	if r.Header.Get(softPurgeHeader) == "1" {
+		n, err = c.softRelease(r.Context(), r, prefix, key)
+	} else {
+		n, err = c.release(r.Context(), prefix, key)
+	}
+	c.logRelease(prefix, key, n, err)
+	switch {
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	case n == 0:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusOK, map[string]bool{"purged": true})
+	}
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewarePurge(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method))
+	})
+
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithPurgeMethod(true),
+		ClientWithPurgeAuthorizer(func(r *http.Request) bool {
+			return r.Header.Get("X-Purge-Token") == "token"
+		}),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	r, _ := http.NewRequest("GET", "http://foo.bar/purge?a=1", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		wantCached bool
+	}{
+		{"rejects unauthorized purge", "guess", http.StatusForbidden, true},
+		{"purges cached response", "token", http.StatusOK, false},
+		{"purges nothing", "token", http.StatusNoContent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("PURGE", "http://foo.bar/purge?a=1", nil)
+			r.Header.Set("X-Purge-Token", tt.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("*Client.Middleware() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if got := len(adapter.store["/purge"]) > 0; got != tt.wantCached {
+				t.Errorf("*Client.Middleware() cached = %v, want %v", got, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestMiddlewarePurgeUnauthorized(t *testing.T) {
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithPurgeMethod(true),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method))
+	}))
+
+	r, _ := http.NewRequest("GET", "http://foo.bar/purge", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	r, _ = http.NewRequest("PURGE", "http://foo.bar/purge", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("*Client.Middleware() status = %v, want %v", w.Code, http.StatusForbidden)
+	}
+	if len(adapter.store["/purge"]) == 0 {
+		t.Error("*Client.Middleware() released the response without a purge authorizer")
+	}
+}
+
+func TestMiddlewarePurgeDisabled(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method))
+	}))
+
+	r, _ := http.NewRequest("PURGE", "http://foo.bar/purge", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Body.String(); got != "PURGE" {
+		t.Errorf("*Client.Middleware() = %v, want the handler response", got)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+// isRanged reports whether the request asks for a part of the response.
+func isRanged(r *http.Request) bool {
+	return r.Header.Get("Range") != ""
+}
+
+// isPartial reports whether a response with the given status code and
+// header holds a part of the resource only, which must never be cached
+// nor served to other requests.
+func isPartial(statusCode int, header http.Header) bool {
+	return statusCode == http.StatusPartialContent || header.Get("Content-Range") != ""
+}
+
+// serveRange writes the part of the full response value the request asks
+// for, with a 206 status code, or the whole value when the range is
+// ignored, e.g. because of an outdated If-Range validator.
+func serveRange(w http.ResponseWriter, r *http.Request, value []byte) {
+	w.Header().Del("Content-Length")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(value))
+}
+
+// fetchRange takes the full response from the handler, caching it, and
+// serves the part of it the request asks for.
+func (c *Client) fetchRange(next http.Handler, w http.ResponseWriter, r *http.Request, ctxlog Logger, prefix, key string, t *Timing) {
+	full := r.WithContext(r.Context())
+	full.Header = make(http.Header, len(r.Header))
+	copyHeader(full.Header, r.Header)
+	full.Header.Del("Range")
+	full.Header.Del("If-Range")
+	response, value, _ := c.fetch(next, nil, full, prefix, key, t)
+	if canceled(ctxlog, r) {
+		return
+	}
+	c.writeHeader(w.Header(), response.Header)
+	if response.StatusCode == http.StatusOK {
+		serveRange(w, r, value)
+		return
+	}
+	w.WriteHeader(response.StatusCode)
+	w.Write(value)
+}
+
+// ClientWithRangeSupport makes the client serve the requests for a range
+// of a response from the cached full response. Otherwise, they bypass
+// the cache. Partial responses are never cached either way. Optional
+// setting.
+func ClientWithRangeSupport(support bool) ClientOption {
+	return func(c *Client) error {
+		c.rangeSupport = support
+		return nil
+	}
+}
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareRange(t *testing.T) {
+	tests := []struct {
+		name         string
+		support      bool
+		populate     bool
+		handlerRange bool
+		wantStatus   int
+		wantBody     string
+		wantRange    string
+		wantCalls    int
+		wantCached   bool
+	}{
+		{"bypasses the cache by default", false, true, false, http.StatusOK, "0123456789", "", 2, true},
+		{"never caches partial responses", false, false, true, http.StatusPartialContent, "2345", "bytes 2-5/10", 1, false},
+		{"serves the range of cached responses", true, true, false, http.StatusPartialContent, "2345", "bytes 2-5/10", 1, true},
+		{"caches the full response on a ranged miss", true, false, true, http.StatusPartialContent, "2345", "bytes 2-5/10", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Minute),
+				ClientWithRangeSupport(tt.support),
+			)
+			calls := 0
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if tt.handlerRange {
+					// the handler serves ranges itself
+					serveRange(w, r, []byte("0123456789"))
+					return
+				}
+				w.Write([]byte("0123456789"))
+			}))
+
+			if tt.populate {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/range", nil))
+			}
+			r := httptest.NewRequest("GET", "/range", nil)
+			r.Header.Set("Range", "bytes=2-5")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Errorf("*Client.Middleware() = %v %q, want %v %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+			if got := w.Header().Get("Content-Range"); got != tt.wantRange {
+				t.Errorf("*Client.Middleware() Content-Range = %q, want %q", got, tt.wantRange)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if got := len(adapter.store["/range"]) > 0; got != tt.wantCached {
+				t.Errorf("*Client.Middleware() cached = %v, want %v", got, tt.wantCached)
+			}
+			if tt.wantCached {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest("GET", "/range", nil))
+				if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+					t.Errorf("*Client.Middleware() cached = %v %q, want the full response", w.Code, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewarePartialResponses(t *testing.T) {
+	key := generateKey("http://foo.bar/download")
+	tests := []struct {
+		name         string
+		stored       *Response
+		status       int
+		contentRange string
+		wantCached   bool
+	}{
+		{"does not cache a 206 response", nil, http.StatusPartialContent, "bytes 0-3/10", false},
+		{"does not cache a response with a Content-Range", nil, http.StatusOK, "bytes 0-3/10", false},
+		{"caches a full response", nil, http.StatusOK, "", true},
+		{
+			"does not serve a cached 206 response",
+			&Response{Value: []byte("0123"), StatusCode: http.StatusPartialContent, Header: http.Header{"Content-Range": {"bytes 0-3/10"}}},
+			http.StatusOK, "", true,
+		},
+		{
+			"does not serve a cached response with a Content-Range",
+			&Response{Value: []byte("0123"), Header: http.Header{"Content-Range": {"bytes 0-3/10"}}},
+			http.StatusOK, "", true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			if tt.stored != nil {
+				tt.stored.Expiration = time.Now().Add(time.Minute)
+				adapter.Set("/download", key, tt.stored.Bytes())
+			}
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Minute),
+			)
+			calls := 0
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				// a resumable download origin answering with a part of
+				// the file
+				if tt.contentRange != "" {
+					w.Header().Set("Content-Range", tt.contentRange)
+					w.WriteHeader(tt.status)
+					w.Write([]byte("0123"))
+					return
+				}
+				w.Write([]byte("0123456789"))
+			}))
+
+			r, _ := http.NewRequest("GET", "http://foo.bar/download", nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if calls != 1 {
+				t.Errorf("handler calls = %v, want 1", calls)
+			}
+			if tt.stored != nil && w.Body.String() != "0123456789" {
+				t.Errorf("*Client.Middleware() = %q, want the full response", w.Body.String())
+			}
+
+			stored, cached := adapter.Get("/download", key)
+			if cached != tt.wantCached {
+				t.Fatalf("*Client.Middleware() cached = %v, want %v", cached, tt.wantCached)
+			}
+			if response, _ := (FrameCodec{}).Unmarshal(stored); cached && isPartial(response.statusCode(), response.Header) {
+				t.Errorf("*Client.Middleware() left a partial response cached")
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RefreshResponseMode is the response to the requests carrying the
+// refresh key.
+type RefreshResponseMode int
+
+// Refresh response modes.
+const (
+	// ServePage answers with the refreshed response. It is the default.
+	ServePage RefreshResponseMode = iota
+
+	// ServeStatus answers with a JSON description of the refresh, e.g.
+	// for webhooks checking it worked.
+	ServeStatus
+)
+
+// refreshStatus is the JSON description of a refresh.
+type refreshStatus struct {
+	Released   bool       `json:"released"`
+	Stored     bool       `json:"stored"`
+	StatusCode int        `json:"status"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// serveRefreshStatus takes the response to the refresh request from the
+// handler, caching it, and answers with a description of the refresh
+// instead of the response. The expiration is left out when the response
+// was not stored, or not yet when writes are asynchronous.
+func (c *Client) serveRefreshStatus(next http.Handler, w http.ResponseWriter, r *http.Request, ctxlog Logger, prefix, key string, released bool, t *Timing) {
+	c.setCacheStatus(w, cacheStatusBypass)
+	c.countStatus(prefix, cacheStatusBypass)
+	t.Status = cacheStatusBypass
+	result, _, stored := c.put(next, nil, r, prefix, key, t)
+	status := refreshStatus{Released: released, Stored: stored}
+	if result != nil {
+		status.StatusCode = result.StatusCode
+	}
+	if stored {
+		if response, _, ok := c.lookupResponse(ctxlog, r, prefix, key, nil); ok {
+			status.ExpiresAt = &response.Expiration
+		}
+	}
+	if canceled(ctxlog, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// ClientWithRefreshResponseMode sets the response to the requests
+// carrying the refresh key. The cache is refreshed either way. Default is
+// ServePage. Optional setting.
+func ClientWithRefreshResponseMode(mode RefreshResponseMode) ClientOption {
+	return func(c *Client) error {
+		if mode != ServePage && mode != ServeStatus {
+			return fmt.Errorf("cache client refresh response mode %d is unknown", mode)
+		}
+		c.refreshResponseMode = mode
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareRefreshStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		cached       bool
+		statusCode   int
+		wantReleased bool
+		wantStored   bool
+	}{
+		{"refreshes a cached response", true, http.StatusOK, true, true},
+		{"stores a response not cached", false, http.StatusOK, false, true},
+		{"reports a response not stored", true, http.StatusInternalServerError, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			client, err := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(time.Minute),
+				ClientWithRefreshKey("rk"),
+				ClientWithRefreshResponseMode(ServeStatus),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte("page"))
+			}))
+			prefix, key := client.GeneratePrefixAndKey(httptest.NewRequest("GET", "http://foo.bar/page", nil))
+			if tt.cached {
+				adapter.Set(prefix, key, Response{
+					Value:      []byte("old page"),
+					StatusCode: http.StatusOK,
+					Expiration: time.Now().Add(time.Minute),
+				}.Bytes())
+			}
+
+			start := time.Now()
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "http://foo.bar/page?rk=1", nil))
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+				t.Fatalf("refresh response = %v, %v, want 200 and JSON", w.Code, w.Header().Get("Content-Type"))
+			}
+			var got refreshStatus
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Released != tt.wantReleased || got.Stored != tt.wantStored || got.StatusCode != tt.statusCode {
+				t.Errorf("refresh status = %+v, want released %v, stored %v, status %v", got, tt.wantReleased, tt.wantStored, tt.statusCode)
+			}
+			if tt.wantStored {
+				if got.ExpiresAt == nil || got.ExpiresAt.Before(start.Add(time.Minute)) {
+					t.Errorf("refresh status expires_at = %v, want in a minute", got.ExpiresAt)
+				}
+			} else if got.ExpiresAt != nil {
+				t.Errorf("refresh status expires_at = %v, want none", got.ExpiresAt)
+			}
+
+			b, ok := adapter.Get(prefix, key)
+			if response, _ := BytesToResponse(b); ok != tt.wantStored || (ok && string(response.Value) != "page") {
+				t.Errorf("cached response = %q, %v, want the refreshed page stored %v", response.Value, ok, tt.wantStored)
+			}
+		})
+	}
+
+	if _, err := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(time.Minute),
+		ClientWithRefreshResponseMode(RefreshResponseMode(2)),
+	); err == nil {
+		t.Error("ClientWithRefreshResponseMode() with an unknown mode error = nil, want an error")
+	}
+}
@@ -0,0 +1,103 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// softPurgeHeader is the PURGE request header asking for a soft release.
+const softPurgeHeader = "X-Soft-Purge"
+
+// SoftRelease marks the response cached for the given URI as stale instead
+// of freeing it, returning how many were marked. With stale-while-revalidate
+// enabled, the next request is then served the stale response while it is
+// refreshed in the background, rather than every request hitting the
+// handler at once. The response is freed instead when stale responses are
+// not kept, or when it varies on request headers, as its variants cannot
+// be found from the URI.
+func (c *Client) SoftRelease(uri string) (int, error) {
+	prefix, key, err := c.uriPrefixAndKey(uri)
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.softRelease(c.background(), nil, prefix, key)
+	c.logRelease(prefix, key, n, err)
+	return n, err
+}
+
+// softRelease marks the response cached by a given key as stale.
+func (c *Client) softRelease(ctx context.Context, r *http.Request, prefix, key string) (int, error) {
+	if c.staleRetention() <= 0 {
+		return c.release(ctx, prefix, key)
+	}
+	var vary bool
+	now := time.Now()
+	found := c.update(ctx, r, c.requestLog(prefix, key), prefix, key, func(response *Response) bool {
+		if len(response.Vary) > 0 {
+			vary = true
+			return false
+		}
+		if !response.Expiration.After(now) {
+			// stale already
+			return false
+		}
+		response.Expiration = now
+		return true
+	})
+	switch {
+	case vary:
+		return c.release(ctx, prefix, key)
+	case found:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// update reads the response cached by a given key, changes it with fn and
+// writes it back when fn returns true, reporting whether there was one.
+// The adapters can't replace a response atomically, so it is read again
+// right before the write, and left as is when it was released or stored
+// again in the meantime, rather than bringing a released response back.
+func (c *Client) update(ctx context.Context, r *http.Request, ctxlog Logger, prefix, key string, fn func(response *Response) bool) bool {
+	original, ok := c.getResponse(ctx, r, ctxlog, prefix, key, nil)
+	if !ok {
+		return false
+	}
+	response := original
+	if !fn(&response) {
+		return true
+	}
+	current, ok := c.getResponse(ctx, r, ctxlog, prefix, key, nil)
+	if !ok || !reflect.DeepEqual(current, original) {
+		ctxlog.Debugf("the cached response changed meanwhile, leaving it as is")
+		return false
+	}
+	c.setResponse(ctx, r, ctxlog, prefix, key, response, nil)
+	return true
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSoftRelease(t *testing.T) {
+	key := generateKey("http://foo.bar/soft")
+	tests := []struct {
+		name       string
+		stale      time.Duration
+		response   *Response
+		wantN      int
+		wantCached bool
+	}{
+		{"marks the response stale", 1 * time.Minute, &Response{Value: []byte("value"), Expiration: time.Now().Add(1 * time.Minute)}, 1, true},
+		{"keeps stale responses as they are", 1 * time.Minute, &Response{Value: []byte("value"), Expiration: time.Now().Add(-1 * time.Second)}, 1, true},
+		{"frees the response without stale responses", 0, &Response{Value: []byte("value"), Expiration: time.Now().Add(1 * time.Minute)}, 1, false},
+		{"frees responses varying on headers", 1 * time.Minute, &Response{Vary: []string{"Accept-Language"}, Expiration: time.Now().Add(1 * time.Minute)}, 1, false},
+		{"marks nothing", 1 * time.Minute, nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &adapterMock{}
+			if tt.response != nil {
+				adapter.Set("/soft", key, tt.response.Bytes())
+			}
+			opts := []ClientOption{
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1 * time.Minute),
+			}
+			if tt.stale > 0 {
+				opts = append(opts, ClientWithStaleWhileRevalidate(tt.stale))
+			}
+			client, _ := NewClient(opts...)
+			n, err := client.SoftRelease("http://foo.bar/soft")
+			if err != nil || n != tt.wantN {
+				t.Fatalf("*Client.SoftRelease() = %v, %v, want %v, nil", n, err, tt.wantN)
+			}
+			b, ok := adapter.Get("/soft", key)
+			if ok != tt.wantCached {
+				t.Fatalf("*Client.SoftRelease() cached = %v, want %v", ok, tt.wantCached)
+			}
+			if !ok {
+				return
+			}
+			response, _ := BytesToResponse(b)
+			if response.Expiration.After(time.Now()) {
+				t.Errorf("*Client.SoftRelease() expiration = %v, want in the past", response.Expiration)
+			}
+			if string(response.Value) != "value" {
+				t.Errorf("*Client.SoftRelease() value = %q, want %q", response.Value, "value")
+			}
+		})
+	}
+}
+
+// releasingAdapter releases a response right after it is first read, as a
+// release running concurrently would.
+type releasingAdapter struct {
+	*adapterMock
+	once sync.Once
+}
+
+func (a *releasingAdapter) Get(prefix, key string) ([]byte, bool) {
+	b, ok := a.adapterMock.Get(prefix, key)
+	a.once.Do(func() { a.adapterMock.Release(prefix, key) })
+	return b, ok
+}
+
+func TestSoftReleaseConcurrentRelease(t *testing.T) {
+	key := generateKey("http://foo.bar/soft")
+	adapter := &releasingAdapter{adapterMock: &adapterMock{}}
+	adapter.Set("/soft", key, Response{
+		Value:      []byte("value"),
+		Expiration: time.Now().Add(1 * time.Minute),
+	}.Bytes())
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithStaleWhileRevalidate(1*time.Minute),
+	)
+
+	n, err := client.SoftRelease("http://foo.bar/soft")
+	if err != nil || n != 0 {
+		t.Errorf("*Client.SoftRelease() = %v, %v, want 0, nil", n, err)
+	}
+	if _, ok := adapter.adapterMock.Get("/soft", key); ok {
+		t.Error("*Client.SoftRelease() brought the released response back")
+	}
+}
+
+func TestMiddlewareSoftRelease(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	done := make(chan struct{}, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Write([]byte("old value"))
+			return
+		}
+		<-release
+		w.Write([]byte("new value"))
+		done <- struct{}{}
+	})
+
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithStaleWhileRevalidate(1*time.Minute),
+		ClientWithCacheStatusHeader("X-Cache"),
+		ClientWithPurgeMethod(true),
+		ClientWithPurgeAuthorizer(func(r *http.Request) bool { return true }),
+	)
+	middleware := client.Middleware(handler)
+	admin := client.AdminHandler()
+	middleware.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://foo.bar/soft", nil))
+
+	tests := []struct {
+		name    string
+		release func() int
+	}{
+		{"SoftRelease", func() int {
+			n, _ := client.SoftRelease("http://foo.bar/soft")
+			return n
+		}},
+		{"PURGE", func() int {
+			r := httptest.NewRequest("PURGE", "http://foo.bar/soft", nil)
+			r.Header.Set("X-Soft-Purge", "1")
+			w := httptest.NewRecorder()
+			middleware.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				return 0
+			}
+			return 1
+		}},
+		{"admin handler", func() int {
+			r := httptest.NewRequest("DELETE", "/keys?soft=1&uri="+url.QueryEscape("http://foo.bar/soft"), nil)
+			w := httptest.NewRecorder()
+			admin.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				return 0
+			}
+			return 1
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&calls, 1)
+			release = make(chan struct{})
+			if n := tt.release(); n != 1 {
+				t.Fatalf("soft release marked %v responses, want 1", n)
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w := httptest.NewRecorder()
+					middleware.ServeHTTP(w, httptest.NewRequest("GET", "http://foo.bar/soft", nil))
+					if got := w.Body.String(); got != "old value" {
+						t.Errorf("*Client.Middleware() = %v, want old value", got)
+					}
+					if got := w.Header().Get("X-Cache"); got != "STALE" {
+						t.Errorf("*Client.Middleware() X-Cache = %v, want STALE", got)
+					}
+				}()
+			}
+			wg.Wait()
+			close(release)
+			<-done
+
+			if got := atomic.LoadInt32(&calls); got != 2 {
+				t.Errorf("*Client.Middleware() background refreshes = %v, want 1", got-1)
+			}
+
+			// wait for the refresh to be released
+			for i := 0; i < 100; i++ {
+				client.revalidateMutex.Lock()
+				n := len(client.revalidating)
+				client.revalidateMutex.Unlock()
+				if n == 0 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			w := httptest.NewRecorder()
+			middleware.ServeHTTP(w, httptest.NewRequest("GET", "http://foo.bar/soft", nil))
+			if got := w.Header().Get("X-Cache"); got != "HIT" || w.Body.String() != "new value" {
+				t.Errorf("*Client.Middleware() after refresh = %v %v, want HIT new value", got, w.Body.String())
+			}
+
+			// serve the old value again for the next case
+			adapter.Set("/soft", generateKey("http://foo.bar/soft"), Response{
+				Value:      []byte("old value"),
+				Header:     http.Header{},
+				StatusCode: http.StatusOK,
+				Expiration: time.Now().Add(1 * time.Minute),
+				CachedAt:   time.Now(),
+			}.Bytes())
+		})
+	}
+}
@@ -0,0 +1,130 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Warning header values of stale responses.
+const (
+	staleWarning            = `110 - "Response is Stale"`
+	revalidateFailedWarning = `111 - "Revalidation Failed"`
+)
+
+// staleRetention returns how long after their expiration cached responses
+// are kept, to be served stale.
+func (c *Client) staleRetention() time.Duration {
+	if c.staleIfError > c.staleWhileRevalidate {
+		return c.staleIfError
+	}
+	return c.staleWhileRevalidate
+}
+
+// revalidate refreshes the cached response to the request in the
+// background, unless a refresh of the same key is already running.
+func (c *Client) revalidate(ctxlog Logger, next http.Handler, r *http.Request, prefix, key string) {
+	// the refresh outlives the request, so it is canceled with the client
+	// instead
+	c.refresh(ctxlog, next, r.WithContext(c.outliving(r.Context())), prefix, key)
+}
+
+// refresh calls the handler in the background to cache a fresh response
+// to the background request, unless a refresh of the same key is already
+// running.
+func (c *Client) refresh(ctxlog Logger, next http.Handler, bg *http.Request, prefix, key string) {
+	id := prefix + "\x00" + key
+	c.revalidateMutex.Lock()
+	if c.revalidating[id] {
+		c.revalidateMutex.Unlock()
+		return
+	}
+	if c.revalidating == nil {
+		c.revalidating = make(map[string]bool)
+	}
+	c.revalidating[id] = true
+	c.revalidateMutex.Unlock()
+
+	done := func() {
+		c.revalidateMutex.Lock()
+		delete(c.revalidating, id)
+		c.revalidateMutex.Unlock()
+	}
+	started := c.goAsync(func() {
+		defer func() {
+			if err := recover(); err != nil {
+				ctxlog.Errorf("background revalidation panicked: %v", err)
+			}
+			done()
+		}()
+		c.PutItemToCache(next, bg, prefix, key)
+	})
+	if !started {
+		done()
+	}
+}
+
+// fetchWithFallback takes the response from the handler and serves it,
+// unless the handler fails, in which case the stale fallback response is
+// served instead.
+func (c *Client) fetchWithFallback(next http.Handler, w http.ResponseWriter, r *http.Request, ctxlog Logger, prefix, key string, fallback Response, t *Timing) {
+	response, value, err := c.fetchRecover(next, r, prefix, key, t)
+	if err != nil {
+		ctxlog.Errorf("%v", err)
+	}
+	if err != nil || response == nil || response.StatusCode >= 500 {
+		ctxlog.Debugf("handler failed - serving stale response")
+		w.Header().Set("Warning", revalidateFailedWarning)
+		t.Status = cacheStatusStale
+		c.serveHit(w, r, ctxlog, prefix, key, fallback, cacheStatusStale)
+		return
+	}
+	atomic.AddUint64(&c.stats.misses, 1)
+	c.hookMiss(r)
+	if canceled(ctxlog, r) {
+		return
+	}
+	c.writeHeader(w.Header(), response.Header)
+	w.Header().Set("X-Cached-At", time.Now().Format(time.RFC822Z))
+	c.setCacheStatus(w, cacheStatusMiss)
+	c.countStatus(prefix, cacheStatusMiss)
+	w.WriteHeader(response.StatusCode)
+	w.Write(value)
+}
+
+// fetchRecover takes the response from the handler without writing it
+// through, turning a handler panic into an error.
+func (c *Client) fetchRecover(next http.Handler, r *http.Request, prefix, key string, t *Timing) (response *http.Response, value []byte, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panicked: %v", p)
+		}
+	}()
+	response, value, _ = c.fetch(next, nil, r, prefix, key, t)
+	return response, value, nil
+}
@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareStaleWhileRevalidate(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	done := make(chan struct{}, 1)
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Write([]byte("new value"))
+		done <- struct{}{}
+	})
+
+	key := generateKey("http://foo.bar/stale")
+	adapter := &adapterMock{}
+	adapter.Set("/stale", key, Response{
+		Value:      []byte("old value"),
+		Expiration: time.Now().Add(-1 * time.Second),
+		CachedAt:   time.Now().Add(-1 * time.Minute),
+	}.Bytes())
+
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithStaleWhileRevalidate(1*time.Minute),
+		ClientWithCacheStatusHeader("X-Cache"),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _ := http.NewRequest("GET", "http://foo.bar/stale", nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if got := w.Body.String(); got != "old value" {
+				t.Errorf("*Client.Middleware() = %v, want old value", got)
+			}
+			if got := w.Header().Get("X-Cache"); got != "STALE" {
+				t.Errorf("*Client.Middleware() X-Cache = %v, want STALE", got)
+			}
+			if got := w.Header().Get("Warning"); got != staleWarning {
+				t.Errorf("*Client.Middleware() Warning = %v, want %v", got, staleWarning)
+			}
+		}()
+	}
+	wg.Wait()
+	close(release)
+	<-done
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("*Client.Middleware() background refreshes = %v, want 1", got)
+	}
+
+	// wait for the refresh to be released before the next request
+	for i := 0; i < 100; i++ {
+		client.revalidateMutex.Lock()
+		n := len(client.revalidating)
+		client.revalidateMutex.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	r, _ := http.NewRequest("GET", "http://foo.bar/stale", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Body.String(); got != "new value" {
+		t.Errorf("*Client.Middleware() after refresh = %v, want new value", got)
+	}
+	if got := w.Header().Get("X-Cache"); got != "HIT" {
+		t.Errorf("*Client.Middleware() X-Cache after refresh = %v, want HIT", got)
+	}
+}
+
+func TestMiddlewareStaleWhileRevalidatePanic(t *testing.T) {
+	done := make(chan struct{})
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		panic("origin failure")
+	})
+
+	key := generateKey("http://foo.bar/stale")
+	adapter := &adapterMock{}
+	adapter.Set("/stale", key, Response{
+		Value:      []byte("old value"),
+		Expiration: time.Now().Add(-1 * time.Second),
+	}.Bytes())
+
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithStaleWhileRevalidate(1*time.Minute),
+		ClientWithLogger(&loggerMock{}),
+	)
+	r, _ := http.NewRequest("GET", "http://foo.bar/stale", nil)
+	w := httptest.NewRecorder()
+	client.Middleware(httpTestHandler).ServeHTTP(w, r)
+	<-done
+
+	if got := w.Body.String(); got != "old value" {
+		t.Errorf("*Client.Middleware() = %v, want old value", got)
+	}
+}
+
+func TestMiddlewareExpiredOutsideStaleWindow(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new value"))
+	})
+
+	key := generateKey("http://foo.bar/stale")
+	adapter := &adapterMock{}
+	adapter.Set("/stale", key, Response{
+		Value:      []byte("old value"),
+		Expiration: time.Now().Add(-2 * time.Minute),
+	}.Bytes())
+
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithStaleWhileRevalidate(1*time.Minute),
+	)
+	r, _ := http.NewRequest("GET", "http://foo.bar/stale", nil)
+	w := httptest.NewRecorder()
+	client.Middleware(httpTestHandler).ServeHTTP(w, r)
+
+	if got := w.Body.String(); got != "new value" {
+		t.Errorf("*Client.Middleware() = %v, want new value", got)
+	}
+}
+
+func TestMiddlewareStaleIfError(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		expiration  time.Duration
+		want        string
+		wantWarning string
+	}{
+		{
+			"serves stale response on server error",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte("error"))
+			},
+			-1 * time.Second,
+			"old value",
+			revalidateFailedWarning,
+		},
+		{
+			"serves stale response on panic",
+			func(w http.ResponseWriter, r *http.Request) {
+				panic("origin failure")
+			},
+			-1 * time.Second,
+			"old value",
+			revalidateFailedWarning,
+		},
+		{
+			"serves new response on success",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("new value"))
+			},
+			-1 * time.Second,
+			"new value",
+			"",
+		},
+		{
+			"serves error outside the window",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte("error"))
+			},
+			-2 * time.Minute,
+			"error",
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := generateKey("http://foo.bar/stale")
+			adapter := &adapterMock{}
+			adapter.Set("/stale", key, Response{
+				Value:      []byte("old value"),
+				Expiration: time.Now().Add(tt.expiration),
+			}.Bytes())
+
+			client, _ := NewClient(
+				ClientWithAdapter(adapter),
+				ClientWithTTL(1*time.Minute),
+				ClientWithStaleIfError(1*time.Minute),
+				ClientWithLogger(&loggerMock{}),
+			)
+			r, _ := http.NewRequest("GET", "http://foo.bar/stale", nil)
+			w := httptest.NewRecorder()
+			client.Middleware(tt.handler).ServeHTTP(w, r)
+
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("*Client.Middleware() = %v, want %v", got, tt.want)
+			}
+			if got := w.Header().Get("Warning"); got != tt.wantWarning {
+				t.Errorf("*Client.Middleware() Warning = %v, want %v", got, tt.wantWarning)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import "sync/atomic"
+
+// Stats is a snapshot of the client counters since it was created or
+// its stats were last reset.
+type Stats struct {
+	// Requests is the number of requests seen by the middleware.
+	Requests uint64
+
+	// Hits is the number of responses served from the cache.
+	Hits uint64
+
+	// Misses is the number of responses taken from the handler because
+	// they were not cached or expired.
+	Misses uint64
+
+	// Refreshes is the number of requests carrying the refresh key.
+	Refreshes uint64
+
+	// Errors is the number of cached responses that could not be
+	// decoded or encoded, or exceeded the max body size.
+	Errors uint64
+
+	// BytesServed is the number of body bytes served from the cache.
+	BytesServed uint64
+
+	// DroppedWrites is the number of responses not stored because the
+	// asynchronous write queue was full.
+	DroppedWrites uint64
+
+	// Shed is the number of requests denied a handler call by the fetch
+	// limits.
+	Shed uint64
+
+	// CircuitSkips is the number of adapter calls skipped because the
+	// circuit breaker was open.
+	CircuitSkips uint64
+}
+
+// stats holds the client counters, updated atomically. It is allocated
+// separately from the Client so that its fields are 64-bit aligned.
+type stats struct {
+	requests      uint64
+	hits          uint64
+	misses        uint64
+	refreshes     uint64
+	errors        uint64
+	bytesServed   uint64
+	droppedWrites uint64
+	shed          uint64
+	circuitSkips  uint64
+}
+
+// Stats returns a snapshot of the client counters.
+func (c *Client) Stats() Stats {
+	return Stats{
+		Requests:      atomic.LoadUint64(&c.stats.requests),
+		Hits:          atomic.LoadUint64(&c.stats.hits),
+		Misses:        atomic.LoadUint64(&c.stats.misses),
+		Refreshes:     atomic.LoadUint64(&c.stats.refreshes),
+		Errors:        atomic.LoadUint64(&c.stats.errors),
+		BytesServed:   atomic.LoadUint64(&c.stats.bytesServed),
+		DroppedWrites: atomic.LoadUint64(&c.stats.droppedWrites),
+		Shed:          atomic.LoadUint64(&c.stats.shed),
+		CircuitSkips:  atomic.LoadUint64(&c.stats.circuitSkips),
+	}
+}
+
+// ResetStats sets the client counters back to zero, e.g. to sample the
+// deltas between two calls to Stats.
+func (c *Client) ResetStats() {
+	atomic.StoreUint64(&c.stats.requests, 0)
+	atomic.StoreUint64(&c.stats.hits, 0)
+	atomic.StoreUint64(&c.stats.misses, 0)
+	atomic.StoreUint64(&c.stats.refreshes, 0)
+	atomic.StoreUint64(&c.stats.errors, 0)
+	atomic.StoreUint64(&c.stats.bytesServed, 0)
+	atomic.StoreUint64(&c.stats.droppedWrites, 0)
+	atomic.StoreUint64(&c.stats.shed, 0)
+	atomic.StoreUint64(&c.stats.circuitSkips, 0)
+}
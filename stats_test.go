@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientStats(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("value"))
+	})
+
+	key := generateKey("http://foo.bar/corrupt")
+	adapter := &adapterMock{
+		store: map[string]map[string][]byte{
+			"/corrupt": {
+				key: []byte("corrupt"),
+			},
+		},
+	}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithRefreshKey("rk"),
+		ClientWithAccessTracking(false),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	requests := []struct {
+		method string
+		url    string
+	}{
+		{"GET", "http://foo.bar/stats"},
+		{"GET", "http://foo.bar/stats"},
+		{"GET", "http://foo.bar/stats"},
+		{"GET", "http://foo.bar/stats?rk=1"},
+		{"POST", "http://foo.bar/stats"},
+		{"GET", "http://foo.bar/corrupt"},
+	}
+	for _, req := range requests {
+		r, _ := http.NewRequest(req.method, req.url, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	want := Stats{
+		Requests:    6,
+		Hits:        2,
+		Misses:      2,
+		Refreshes:   1,
+		Errors:      1,
+		BytesServed: 10,
+	}
+	if got := client.Stats(); got != want {
+		t.Errorf("*Client.Stats() = %+v, want %+v", got, want)
+	}
+
+	client.ResetStats()
+	if got := client.Stats(); got != (Stats{}) {
+		t.Errorf("*Client.Stats() after ResetStats() = %+v, want zero", got)
+	}
+}
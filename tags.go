@@ -0,0 +1,90 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TagStore is implemented by adapters able to index cached responses by
+// tag, so that every response carrying a tag can be released at once.
+// Without it, tags are ignored.
+type TagStore interface {
+	// AddTags indexes the cached response by a given key under the tags.
+	AddTags(prefix, key string, tags []string)
+
+	// ReleaseTag frees the cached responses indexed under the tag.
+	ReleaseTag(tag string)
+}
+
+// parseTags returns the comma separated tags of the header values.
+func parseTags(values []string) []string {
+	var tags []string
+	for _, v := range values {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// takeTags removes the tag header from the response header, returning
+// the tags it lists.
+func (c *Client) takeTags(h http.Header) []string {
+	if c.tagHeader == "" {
+		return nil
+	}
+	tags := parseTags(h[c.tagHeader])
+	h.Del(c.tagHeader)
+	return tags
+}
+
+// addTags indexes the cached response under the tags when the adapter
+// supports it.
+func (c *Client) addTags(ctxlog Logger, prefix, key string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	s, ok := c.optional().(TagStore)
+	if !ok {
+		ctxlog.Debugf("the adapter does not support tags, ignoring them")
+		return
+	}
+	s.AddTags(prefix, key, tags)
+}
+
+// ReleaseTag frees the cached responses carrying the tag. It does nothing
+// when the adapter does not implement TagStore.
+func (c *Client) ReleaseTag(tag string) {
+	s, ok := c.optional().(TagStore)
+	if !ok {
+		c.log.Debugf("the adapter does not support tags, not releasing %q", tag)
+		return
+	}
+	s.ReleaseTag(tag)
+}
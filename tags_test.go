@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type tagAdapter struct {
+	*adapterMock
+	tags map[string][][2]string
+}
+
+func (a *tagAdapter) AddTags(prefix, key string, tags []string) {
+	for _, tag := range tags {
+		a.tags[tag] = append(a.tags[tag], [2]string{prefix, key})
+	}
+}
+
+func (a *tagAdapter) ReleaseTag(tag string) {
+	for _, entry := range a.tags[tag] {
+		a.Release(entry[0], entry[1])
+	}
+	delete(a.tags, tag)
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{"no header", nil, nil},
+		{"single value", []string{"product-42, category-7"}, []string{"product-42", "category-7"}},
+		{"multiple values", []string{"a", " ,b,"}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseTags(tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareTags(t *testing.T) {
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/products/42":
+			w.Header().Set("X-Cache-Tags", "product-42,category-7")
+		case "/home":
+			w.Header().Set("X-Cache-Tags", "product-42")
+		case "/categories/8":
+			w.Header().Set("X-Cache-Tags", "category-8")
+		}
+		w.Write([]byte("value"))
+	})
+
+	adapter := &tagAdapter{&adapterMock{}, make(map[string][][2]string)}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithTagHeader("X-Cache-Tags"),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	for _, path := range []string{"/products/42", "/home", "/categories/8"} {
+		for i := 0; i < 2; i++ {
+			r, _ := http.NewRequest("GET", "http://foo.bar"+path, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if _, ok := w.Header()["X-Cache-Tags"]; ok {
+				t.Errorf("*Client.Middleware() sent the tag header for %v", path)
+			}
+		}
+	}
+
+	client.ReleaseTag("product-42")
+
+	for path, want := range map[string]bool{"/products/42": false, "/home": false, "/categories/8": true} {
+		if got := len(adapter.store[path]) > 0; got != want {
+			t.Errorf("*Client.ReleaseTag() kept %v = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestReleaseTagWithoutTagStore(t *testing.T) {
+	adapter := &adapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithTagHeader("X-Cache-Tags"),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Cache-Tags", "a")
+		w.Write([]byte("value"))
+	}))
+
+	r, _ := http.NewRequest("GET", "http://foo.bar/a", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	client.ReleaseTag("a")
+
+	if len(adapter.store["/a"]) == 0 {
+		t.Error("*Client.ReleaseTag() released without tag support")
+	}
+}
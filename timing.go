@@ -0,0 +1,145 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Timing is the time a cacheable request spent in each step of the
+// middleware, to weigh the cache against the origin.
+type Timing struct {
+	Prefix string
+	Key    string
+
+	// Status is the cache status of the request, e.g. HIT or MISS.
+	Status string
+
+	// Get is the time spent in the adapter Get calls, and Decode in
+	// decoding the cached responses.
+	Get    time.Duration
+	Decode time.Duration
+
+	// Origin is the time spent in the handler.
+	Origin time.Duration
+
+	// Encode is the time spent in encoding the response to store, and
+	// Set in the adapter Set calls. They are left out when writes are
+	// asynchronous.
+	Encode time.Duration
+	Set    time.Duration
+
+	// Total is the time the middleware took to serve the request.
+	Total time.Duration
+}
+
+// TimingCollector is implemented by collectors observing how long the
+// adapter calls and the encoding of the responses take.
+type TimingCollector interface {
+	// ObserveAdapterLatency records how long an adapter call took, with
+	// op being "get" or "set".
+	ObserveAdapterLatency(prefix, op string, d time.Duration)
+
+	// ObserveCodecLatency records how long encoding or decoding a
+	// response took, with op being "encode" or "decode".
+	ObserveCodecLatency(prefix, op string, d time.Duration)
+}
+
+// Operations observed by a TimingCollector.
+const (
+	opGet    = "get"
+	opSet    = "set"
+	opEncode = "encode"
+	opDecode = "decode"
+)
+
+// observe records the time elapsed since start in the timing, when not
+// nil, and in the collector.
+func (c *Client) observe(t *Timing, prefix, op string, start time.Time) {
+	d := time.Since(start)
+	if t != nil {
+		switch op {
+		case opGet:
+			t.Get += d
+		case opSet:
+			t.Set += d
+		case opEncode:
+			t.Encode += d
+		case opDecode:
+			t.Decode += d
+		}
+	}
+	if tc, ok := c.metrics.(TimingCollector); ok {
+		switch op {
+		case opGet, opSet:
+			tc.ObserveAdapterLatency(prefix, op, d)
+		default:
+			tc.ObserveCodecLatency(prefix, op, d)
+		}
+	}
+}
+
+// finishTiming completes the timing of a request started at start,
+// passing it to the OnTiming hook and to the debug output.
+func (c *Client) finishTiming(r *http.Request, t *Timing, start time.Time) {
+	t.Total = time.Since(start)
+	c.hookTiming(r, *t)
+	if c.debugOutput {
+		c.log.Debugf("%s", t.format(r.URL.Path))
+	}
+}
+
+// format describes the timing of the request to the path, leaving out
+// the steps it did not go through, e.g.
+// "HIT /api/x key=123 get=0.40ms total=0.60ms".
+func (t *Timing) format(path string) string {
+	var b bytes.Buffer
+	b.WriteString(t.Status + " " + path + " key=" + t.Key)
+	steps := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"get", t.Get},
+		{"decode", t.Decode},
+		{"origin", t.Origin},
+		{"encode", t.Encode},
+		{"set", t.Set},
+	}
+	for _, step := range steps {
+		if step.d > 0 {
+			b.WriteString(" " + step.name + "=" + ms(step.d))
+		}
+	}
+	b.WriteString(" total=" + ms(t.Total))
+	return b.String()
+}
+
+// ms formats the duration in milliseconds, e.g. 0.42ms.
+func ms(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 2, 64) + "ms"
+}
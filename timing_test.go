@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type timingCollector struct {
+	nopCollector
+	mutex    sync.Mutex
+	adapter  map[string]int
+	codec    map[string]int
+	observed bool
+}
+
+func (c *timingCollector) ObserveAdapterLatency(prefix, op string, d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.adapter == nil {
+		c.adapter = make(map[string]int)
+	}
+	c.adapter[op]++
+}
+
+func (c *timingCollector) ObserveCodecLatency(prefix, op string, d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.codec == nil {
+		c.codec = make(map[string]int)
+	}
+	c.codec[op]++
+}
+
+func TestMiddlewareTiming(t *testing.T) {
+	collector := &timingCollector{}
+	var timings []Timing
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithMetrics(collector),
+		ClientWithHooks(Hooks{
+			OnTiming: func(r *http.Request, timing Timing) {
+				timings = append(timings, timing)
+			},
+		}),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte("value"))
+	}))
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/timing", nil))
+	}
+	// not cacheable, so not timed
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/timing", nil))
+
+	if len(timings) != 2 {
+		t.Fatalf("OnTiming calls = %v, want 2", len(timings))
+	}
+	miss, hit := timings[0], timings[1]
+	if miss.Status != cacheStatusMiss || hit.Status != cacheStatusHit {
+		t.Errorf("OnTiming statuses = %v, %v, want %v, %v", miss.Status, hit.Status, cacheStatusMiss, cacheStatusHit)
+	}
+	if miss.Prefix != "/timing" || miss.Key == "" {
+		t.Errorf("OnTiming prefix and key = %q, %q", miss.Prefix, miss.Key)
+	}
+	if miss.Origin < 5*time.Millisecond || miss.Set <= 0 || miss.Encode <= 0 || miss.Total < miss.Origin {
+		t.Errorf("OnTiming miss = %+v, want origin, encode and set times", miss)
+	}
+	if hit.Origin != 0 || hit.Get <= 0 || hit.Decode <= 0 || hit.Total < hit.Get+hit.Decode {
+		t.Errorf("OnTiming hit = %+v, want get and decode times only", hit)
+	}
+	want := map[string]int{opGet: 2, opSet: 1}
+	for op, n := range want {
+		if collector.adapter[op] != n {
+			t.Errorf("TimingCollector.ObserveAdapterLatency(%v) calls = %v, want %v", op, collector.adapter[op], n)
+		}
+	}
+	want = map[string]int{opDecode: 1, opEncode: 1}
+	for op, n := range want {
+		if collector.codec[op] != n {
+			t.Errorf("TimingCollector.ObserveCodecLatency(%v) calls = %v, want %v", op, collector.codec[op], n)
+		}
+	}
+}
+
+func TestTimingAllocations(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithMetrics(&timingCollector{}),
+		ClientWithHooks(Hooks{OnTiming: func(r *http.Request, timing Timing) {}}),
+	)
+	r := httptest.NewRequest("GET", "/timing", nil)
+	// create the collector maps
+	client.observe(nil, "/timing", opGet, time.Now())
+	client.observe(nil, "/timing", opDecode, time.Now())
+
+	allocs := testing.AllocsPerRun(100, func() {
+		start := time.Now()
+		timing := Timing{Prefix: "/timing", Key: "1", Status: cacheStatusHit}
+		client.observe(&timing, "/timing", opGet, start)
+		client.observe(&timing, "/timing", opDecode, start)
+		client.finishTiming(r, &timing, start)
+	})
+	if allocs != 0 {
+		t.Errorf("timing a hit allocates %v times, want 0", allocs)
+	}
+}
+
+func TestMiddlewareTimingDebugOutput(t *testing.T) {
+	logger := &loggerMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithLogger(logger),
+		ClientWithDebugOutput(true),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("value"))
+	}))
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/x", nil))
+	}
+
+	_, key := client.GeneratePrefixAndKey(httptest.NewRequest("GET", "/api/x", nil))
+	want := "HIT /api/x key=" + key + " get="
+	for _, msg := range logger.debug {
+		if strings.HasPrefix(msg, want) && strings.Contains(msg, " total=") {
+			return
+		}
+	}
+	t.Errorf("*Client.Middleware() debug messages = %v, want %v... among them", strings.Join(logger.debug, "; "), want)
+}
+
+func TestTimingFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		timing Timing
+		want   string
+	}{
+		{"hit", Timing{Key: "123", Status: "HIT", Get: 400 * time.Microsecond, Total: 600 * time.Microsecond}, "HIT /api/x key=123 get=0.40ms total=0.60ms"},
+		{"miss", Timing{Key: "123", Status: "MISS", Get: 100 * time.Microsecond, Origin: 12 * time.Millisecond, Encode: 50 * time.Microsecond, Set: 200 * time.Microsecond, Total: 13 * time.Millisecond}, "MISS /api/x key=123 get=0.10ms origin=12.00ms encode=0.05ms set=0.20ms total=13.00ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.timing.format("/api/x"); got != tt.want {
+				t.Errorf("Timing.format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+)
+
+// Tracer starts the spans traced around the cache operations, e.g. to
+// export them with OpenTelemetry, which the tracing/otel package does.
+// Spans are named "cache.get", "cache.set" and "cache.origin", the latter
+// wrapping the handler.
+type Tracer interface {
+	// Start starts a span, child of the span of the context if any, and
+	// returns a context holding it. The adapters and the handler are
+	// given that context.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a traced cache operation. Attributes are named "cache.prefix",
+// "cache.key", "cache.hit" and "cache.size".
+type Span interface {
+	// SetAttribute sets a string, bool or int attribute.
+	SetAttribute(key string, value interface{})
+
+	// RecordError records the failure of the operation.
+	RecordError(err error)
+
+	// End ends the span.
+	End()
+}
+
+// span is a Span that does nothing when tracing is disabled.
+type span struct {
+	span Span
+}
+
+// startSpan starts a span for the cached response by a given key.
+func (c *Client) startSpan(ctx context.Context, name, prefix, key string) (context.Context, span) {
+	if c.tracer == nil {
+		return ctx, span{}
+	}
+	ctx, s := c.tracer.Start(ctx, name)
+	s.SetAttribute("cache.prefix", prefix)
+	s.SetAttribute("cache.key", key)
+	return ctx, span{s}
+}
+
+func (s span) setHit(hit bool) {
+	if s.span != nil {
+		s.span.SetAttribute("cache.hit", hit)
+	}
+}
+
+func (s span) setSize(size int) {
+	if s.span != nil {
+		s.span.SetAttribute("cache.size", size)
+	}
+}
+
+func (s span) recordError(err error) {
+	if s.span != nil {
+		s.span.RecordError(err)
+	}
+}
+
+func (s span) end() {
+	if s.span != nil {
+		s.span.End()
+	}
+}
+
+// ClientWithTracer sets the tracer starting spans around the cache
+// operations. Optional setting.
+func ClientWithTracer(tracer Tracer) ClientOption {
+	return func(c *Client) error {
+		if tracer == nil {
+			return errors.New("cache client tracer is not set")
+		}
+		c.tracer = tracer
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package otel traces the cache operations with OpenTelemetry.
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer the spans are started by.
+const instrumentationName = "github.com/Columbus-internet/http-cache"
+
+// Tracer starts OpenTelemetry spans around the cache operations.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// Span is an OpenTelemetry span around a cache operation.
+type Span struct {
+	span trace.Span
+}
+
+var (
+	_ cache.Tracer = (*Tracer)(nil)
+	_ cache.Span   = (*Span)(nil)
+)
+
+// NewTracer returns a Tracer starting its spans with the tracer provider.
+func NewTracer(tp trace.TracerProvider) (*Tracer, error) {
+	if tp == nil {
+		return nil, errors.New("tracer provider is not set")
+	}
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}, nil
+}
+
+// Start implements the cache Tracer interface Start method.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, cache.Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindInternal))
+	return ctx, &Span{span: span}
+}
+
+// SetAttribute implements the cache Span interface SetAttribute method.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+// RecordError implements the cache Span interface RecordError method.
+func (s *Span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End implements the cache Span interface End method.
+func (s *Span) End() {
+	s.span.End()
+}
+
+// ClientWithTracerProvider sets the tracer provider starting spans around
+// the cache lookups and stores and the handler calls of the client, as
+// children of the request span. Optional setting.
+func ClientWithTracerProvider(tp trace.TracerProvider) cache.ClientOption {
+	tracer, err := NewTracer(tp)
+	if err != nil {
+		return func(c *cache.Client) error {
+			return err
+		}
+	}
+	return cache.ClientWithTracer(tracer)
+}
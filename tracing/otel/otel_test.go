@@ -0,0 +1,73 @@
+package otel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	cache "github.com/Columbus-internet/http-cache"
+	"github.com/Columbus-internet/http-cache/adapter/memory"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestClientWithTracerProvider(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	adapter, _ := memory.NewAdapter(memory.AdapterWithCapacity(10))
+	client, err := cache.NewClient(
+		cache.ClientWithAdapter(adapter),
+		cache.ClientWithTTL(time.Minute),
+		ClientWithTracerProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("value"))
+	}))
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "http://foo.bar/traced", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(ctx))
+	}
+
+	var (
+		names []string
+		hits  []bool
+	)
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %v parent = %v, want the request span", span.Name(), span.Parent().SpanID())
+		}
+		attributes := attribute.NewSet(span.Attributes()...)
+		if prefix, _ := attributes.Value("cache.prefix"); prefix.AsString() != "/traced" {
+			t.Errorf("span %v cache.prefix = %v, want /traced", span.Name(), prefix.AsString())
+		}
+		if hit, ok := attributes.Value("cache.hit"); ok {
+			hits = append(hits, hit.AsBool())
+		}
+	}
+	wantNames := []string{"cache.get", "cache.origin", "cache.set", "cache.get"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("span names = %v, want %v", names, wantNames)
+	}
+	if !reflect.DeepEqual(hits, []bool{false, true}) {
+		t.Errorf("cache.hit = %v, want [false true]", hits)
+	}
+}
+
+func TestNewTracer(t *testing.T) {
+	if _, err := NewTracer(nil); err == nil {
+		t.Error("NewTracer(nil) error = nil, want an error")
+	}
+	if _, err := cache.NewClient(ClientWithTracerProvider(nil)); err == nil {
+		t.Error("ClientWithTracerProvider(nil) error = nil, want an error")
+	}
+}
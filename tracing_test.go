@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type spanMock struct {
+	name       string
+	attributes map[string]interface{}
+	ended      bool
+}
+
+func (s *spanMock) SetAttribute(key string, value interface{}) {
+	s.attributes[key] = value
+}
+
+func (s *spanMock) RecordError(err error) {
+	s.attributes["error"] = err.Error()
+}
+
+func (s *spanMock) End() {
+	s.ended = true
+}
+
+type tracerMock struct {
+	mutex sync.Mutex
+	spans []*spanMock
+}
+
+func (t *tracerMock) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	s := &spanMock{name: name, attributes: make(map[string]interface{})}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, contextKey("span"), name), s
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &tracerMock{}
+	adapter := &contextAdapterMock{}
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithTracer(tracer),
+	)
+	var originSpan interface{}
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		originSpan = r.Context().Value(contextKey("span"))
+		w.Write([]byte("value"))
+	}))
+
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "http://foo.bar/traced", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	var names []string
+	for _, s := range tracer.spans {
+		names = append(names, s.name)
+		if !s.ended {
+			t.Errorf("span %v not ended", s.name)
+		}
+		if s.attributes["cache.prefix"] != "/traced" || s.attributes["cache.key"] == "" {
+			t.Errorf("span %v attributes = %v, want the cache prefix and key", s.name, s.attributes)
+		}
+	}
+	wantNames := []string{"cache.get", "cache.origin", "cache.set", "cache.get"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("span names = %v, want %v", names, wantNames)
+	}
+	if hit := tracer.spans[0].attributes["cache.hit"]; hit != false {
+		t.Errorf("first cache.get hit = %v, want false", hit)
+	}
+	if hit := tracer.spans[3].attributes["cache.hit"]; hit != true {
+		t.Errorf("second cache.get hit = %v, want true", hit)
+	}
+	if size, _ := tracer.spans[3].attributes["cache.size"].(int); size <= len("value") {
+		t.Errorf("cache.get size = %v, want the entry size", size)
+	}
+	if originSpan != "cache.origin" {
+		t.Errorf("handler span = %v, want cache.origin", originSpan)
+	}
+	for op, want := range map[string]string{"get": "cache.get", "set": "cache.set"} {
+		if got := adapter.ctx(op).Value(contextKey("span")); got != want {
+			t.Errorf("adapter %s span = %v, want %v", op, got, want)
+		}
+	}
+}
+
+func TestClientWithTracer(t *testing.T) {
+	if _, err := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(time.Minute), ClientWithTracer(nil)); err == nil {
+		t.Error("ClientWithTracer(nil) error = nil, want an error")
+	}
+}
@@ -0,0 +1,152 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Transport is an http.RoundTripper caching the responses to the outgoing
+// requests, e.g. to third-party APIs, with the adapter, TTL and key
+// settings of its client. Requests are cached, and responses stored, on
+// the same conditions as with the middleware, except that requests for a
+// range always bypass the cache.
+type Transport struct {
+	client *Client
+	next   http.RoundTripper
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// NewTransport returns a Transport caching the responses of the next
+// RoundTripper, or of http.DefaultTransport when it is nil.
+func NewTransport(client *Client, next http.RoundTripper) (*Transport, error) {
+	if client == nil {
+		return nil, errors.New("cache transport client is not set")
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Transport{client: client, next: next}, nil
+}
+
+// RoundTrip implements the http.RoundTripper interface. Cached responses
+// are returned without a round trip, and their body reads the cached
+// bytes.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c := t.client
+	atomic.AddUint64(&c.stats.requests, 1)
+	if !c.isCacheableMethod(r.Method) || isRanged(r) {
+		return t.next.RoundTrip(r)
+	}
+	// the body may be read ahead, which must leave the request untouched
+	r = r.WithContext(r.Context())
+	if !c.isCacheable(r) {
+		return t.next.RoundTrip(r)
+	}
+	prefix, key := c.GeneratePrefixAndKey(r)
+	ctxlog := c.requestLog(prefix, key)
+	response, entryKey, ok := c.lookupResponse(ctxlog, r, prefix, key, nil)
+	if ok && response.Expiration.After(time.Now()) {
+		ctxlog.Debugf("serving from cache")
+		c.trackAccess(prefix, entryKey)
+		c.countStatus(prefix, cacheStatusHit)
+		atomic.AddUint64(&c.stats.hits, 1)
+		atomic.AddUint64(&c.stats.bytesServed, uint64(len(response.Value)))
+		c.hookHit(r, prefix, entryKey, response)
+		c.stripHeaders(response.Header)
+		if !response.CachedAt.IsZero() {
+			response.Header.Set("Age", strconv.FormatInt(response.age(), 10))
+		}
+		c.setCacheStatusHeader(response.Header, cacheStatusHit)
+		return newTransportResponse(r, response.statusCode(), response.Header, response.Value), nil
+	}
+	if ok {
+		ctxlog.Debugf("requested object is in cache, but expried - releasing")
+		c.release(r.Context(), prefix, entryKey)
+	}
+
+	atomic.AddUint64(&c.stats.misses, 1)
+	c.hookMiss(r)
+	c.countStatus(prefix, cacheStatusMiss)
+	var err error
+	origin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err = t.roundTrip(w, r)
+	})
+	result, value, _ := c.put(origin, nil, r, prefix, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setCacheStatusHeader(result.Header, cacheStatusMiss)
+	return newTransportResponse(r, result.StatusCode, result.Header, value), nil
+}
+
+// roundTrip sends the request through the next RoundTripper, writing its
+// response to w. A failed round trip, or body read, writes an uncacheable
+// 502 response.
+func (t *Transport) roundTrip(w http.ResponseWriter, r *http.Request) error {
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		return badGateway(w, err)
+	}
+	defer resp.Body.Close()
+	value, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return badGateway(w, err)
+	}
+	copyHeader(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	w.Write(value)
+	return nil
+}
+
+func badGateway(w http.ResponseWriter, err error) error {
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusBadGateway)
+	return err
+}
+
+// newTransportResponse returns the response to the request with a body
+// reading the value.
+func newTransportResponse(r *http.Request, statusCode int, header http.Header, value []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(value)),
+		ContentLength: int64(len(value)),
+		Request:       r,
+	}
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		header     http.Header
+		status     int
+		respHeader http.Header
+		err        error
+		wantCalls  int
+	}{
+		{"caches GET responses", "GET", nil, http.StatusOK, nil, nil, 1},
+		{"does not cache POST requests", "POST", nil, http.StatusOK, nil, nil, 2},
+		{"does not cache authorized requests", "GET", http.Header{"Authorization": []string{"Bearer token"}}, http.StatusOK, nil, nil, 2},
+		{"does not cache errors", "GET", nil, http.StatusInternalServerError, nil, nil, 2},
+		{"does not cache failed round trips", "GET", nil, 0, nil, errors.New("connection refused"), 2},
+		{"caches the variants of the response", "GET", http.Header{"Accept-Language": []string{"en"}}, http.StatusOK, http.Header{"Vary": []string{"Accept-Language"}}, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithCacheStatusHeader("X-Cache"),
+			)
+			calls := 0
+			transport, err := NewTransport(client, roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				calls++
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				header := http.Header{"Content-Type": []string{"text/plain"}}
+				copyHeader(header, tt.respHeader)
+				return &http.Response{
+					StatusCode: tt.status,
+					Header:     header,
+					Body:       ioutil.NopCloser(strings.NewReader("value " + r.Header.Get("Accept-Language"))),
+				}, nil
+			}))
+			if err != nil {
+				t.Fatalf("NewTransport() error = %v", err)
+			}
+			httpClient := &http.Client{Transport: transport}
+
+			for i := 0; i < 2; i++ {
+				r, _ := http.NewRequest(tt.method, "http://foo.bar/api", nil)
+				for k, v := range tt.header {
+					r.Header[k] = v
+				}
+				resp, err := httpClient.Do(r)
+				if tt.err != nil {
+					if err == nil {
+						t.Error("Transport.RoundTrip() error = nil, want an error")
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Transport.RoundTrip() error = %v", err)
+				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if want := "value " + r.Header.Get("Accept-Language"); string(body) != want {
+					t.Errorf("Transport.RoundTrip() body = %q, want %q", body, want)
+				}
+				if resp.StatusCode != tt.status {
+					t.Errorf("Transport.RoundTrip() status = %v, want %v", resp.StatusCode, tt.status)
+				}
+				if got := resp.Header.Get("Content-Type"); got != "text/plain" {
+					t.Errorf("Transport.RoundTrip() Content-Type = %q, want text/plain", got)
+				}
+				if i == 1 && tt.wantCalls == 1 && resp.Header.Get("X-Cache") != cacheStatusHit {
+					t.Errorf("Transport.RoundTrip() X-Cache = %q, want %v", resp.Header.Get("X-Cache"), cacheStatusHit)
+				}
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("round trips = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	if _, err := NewTransport(nil, nil); err == nil {
+		t.Error("NewTransport(nil, nil) error = nil, want an error")
+	}
+	client, _ := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(time.Minute))
+	transport, _ := NewTransport(client, nil)
+	if transport.next != http.DefaultTransport {
+		t.Errorf("NewTransport() next = %v, want http.DefaultTransport", transport.next)
+	}
+}
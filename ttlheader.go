@@ -0,0 +1,78 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// setTTLHeader sets the header to the ttl in whole seconds, rounded down
+// and never negative.
+func setTTLHeader(h http.Header, name string, ttl time.Duration) {
+	if ttl <= 0 {
+		h.Set(name, "0")
+		return
+	}
+	h.Set(name, strconv.FormatInt(int64(ttl/time.Second), 10))
+}
+
+// setKeyHeader writes the cache key header when it is enabled.
+func (c *Client) setKeyHeader(w http.ResponseWriter, key string) {
+	if c.keyHeader != "" {
+		w.Header().Set(c.keyHeader, key)
+	}
+}
+
+// ClientWithTTLHeader sets the name of a response header giving the
+// number of seconds the response is going to stay cached: the remaining
+// ones on a hit, the ttl just assigned on a miss. It is left out of the
+// responses that are not cached. As the header is only known once the
+// response is stored, the responses to misses are no longer written to
+// the client as they come. Optional setting.
+func ClientWithTTLHeader(name string) ClientOption {
+	return func(c *Client) error {
+		if name == "" {
+			return errors.New("cache client ttl header name is not set")
+		}
+		c.ttlHeader = http.CanonicalHeaderKey(name)
+		return nil
+	}
+}
+
+// ClientWithKeyHeader sets the name of a response header giving the cache
+// key of the request, e.g. to find out why similar requests miss each
+// other's responses. Optional setting.
+func ClientWithKeyHeader(name string) ClientOption {
+	return func(c *Client) error {
+		if name == "" {
+			return errors.New("cache client key header name is not set")
+		}
+		c.keyHeader = http.CanonicalHeaderKey(name)
+		return nil
+	}
+}
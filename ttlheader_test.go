@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTTLHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		status   int
+		header   http.Header
+		size     int
+		populate bool
+		wantTTL  []string
+	}{
+		{"gives the assigned ttl on a miss", "GET", http.StatusOK, nil, 5, false, []string{"60"}},
+		{"gives the remaining ttl on a hit", "GET", http.StatusOK, nil, 5, true, []string{"59"}},
+		{"gives the max-age on a miss", "GET", http.StatusOK, http.Header{"Cache-Control": {"max-age=30"}}, 5, false, []string{"30"}},
+		{"leaves it out of uncacheable responses", "GET", http.StatusOK, http.Header{"Cache-Control": {"no-store"}}, 5, false, nil},
+		{"leaves it out of uncacheable status codes", "GET", http.StatusNotFound, nil, 5, false, nil},
+		{"leaves it out of error status codes", "GET", http.StatusInternalServerError, nil, 5, false, nil},
+		{"leaves it out of responses setting cookies", "GET", http.StatusOK, http.Header{"Set-Cookie": {"session=1"}}, 5, false, nil},
+		{"leaves it out of responses varying on every request", "GET", http.StatusOK, http.Header{"Vary": {"*"}}, 5, false, nil},
+		{"leaves it out of responses exceeding the max size", "GET", http.StatusOK, http.Header{"Content-Length": {"11"}}, 11, false, nil},
+		{"leaves it out of streamed responses exceeding the max size", "GET", http.StatusOK, nil, 11, false, nil},
+		{"leaves it out of bypassed requests", "POST", http.StatusOK, nil, 5, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := NewClient(
+				ClientWithAdapter(&adapterMock{}),
+				ClientWithTTL(1*time.Minute),
+				ClientWithRespectMaxAge(true),
+				ClientWithTTLHeader("X-Cache-TTL"),
+				ClientWithMaxBodySize(10),
+			)
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				copyHeader(w.Header(), tt.header)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(strings.Repeat("v", tt.size)))
+			}))
+			if tt.populate {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, "/ttl", nil))
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, "/ttl", nil))
+			if got := w.Header()["X-Cache-Ttl"]; !reflect.DeepEqual(got, tt.wantTTL) {
+				t.Errorf("*Client.Middleware() X-Cache-TTL = %v, want %v", got, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestTTLHeaderStaleIfError(t *testing.T) {
+	key := generateKey("http://foo.bar/ttl")
+	adapter := &adapterMock{}
+	adapter.Set("/ttl", key, Response{
+		Value:      []byte("old value"),
+		Expiration: time.Now().Add(-1 * time.Second),
+	}.Bytes())
+	client, _ := NewClient(
+		ClientWithAdapter(adapter),
+		ClientWithTTL(1*time.Minute),
+		ClientWithStaleIfError(1*time.Minute),
+		ClientWithTTLHeader("X-Cache-TTL"),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new value"))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "http://foo.bar/ttl", nil))
+	if got := w.Header()["X-Cache-Ttl"]; !reflect.DeepEqual(got, []string{"60"}) {
+		t.Errorf("*Client.Middleware() X-Cache-TTL = %v, want %v", got, []string{"60"})
+	}
+}
+
+func TestSetTTLHeader(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want string
+	}{
+		{90 * time.Second, "90"},
+		{1500 * time.Millisecond, "1"},
+		{500 * time.Millisecond, "0"},
+		{-time.Second, "0"},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		setTTLHeader(h, "X-Cache-Ttl", tt.ttl)
+		if got := h.Get("X-Cache-Ttl"); got != tt.want {
+			t.Errorf("setTTLHeader(%v) = %v, want %v", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestKeyHeader(t *testing.T) {
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+		ClientWithKeyHeader("X-Cache-Key"),
+	)
+	handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("value"))
+	}))
+	r := httptest.NewRequest("GET", "/key?b=2&a=1", nil)
+	_, key := client.GeneratePrefixAndKey(r)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/key?a=1&b=2", nil))
+		if got := w.Header().Get("X-Cache-Key"); got != key {
+			t.Errorf("*Client.Middleware() X-Cache-Key = %v, want %v", got, key)
+		}
+	}
+
+	for _, opt := range []ClientOption{ClientWithTTLHeader(""), ClientWithKeyHeader("")} {
+		if _, err := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(time.Minute), opt); err == nil {
+			t.Error("header option error = nil, want an error on an empty name")
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// parseVary returns the sorted, canonical header names listed in the
+// response Vary header.
+func parseVary(h http.Header) []string {
+	var names []string
+	for _, line := range h["Vary"] {
+		for _, name := range strings.Split(line, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name != "*" {
+				name = http.CanonicalHeaderKey(name)
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// varyAll reports whether the Vary header names match every request,
+// meaning the response can never be reused.
+func varyAll(names []string) bool {
+	for _, name := range names {
+		if name == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultIgnoredHeaders are the request headers ignored by default, which
+// are set by proxies and tracers and change on every request.
+var defaultIgnoredHeaders = map[string]bool{
+	"B3":                    true,
+	"Forwarded":             true,
+	"Traceparent":           true,
+	"Tracestate":            true,
+	"Uber-Trace-Id":         true,
+	"X-Amzn-Trace-Id":       true,
+	"X-B3-Parentspanid":     true,
+	"X-B3-Sampled":          true,
+	"X-B3-Spanid":           true,
+	"X-B3-Traceid":          true,
+	"X-Cloud-Trace-Context": true,
+	"X-Correlation-Id":      true,
+	"X-Forwarded-For":       true,
+	"X-Real-Ip":             true,
+	"X-Request-Id":          true,
+}
+
+// isIgnoredHeader reports whether the request header, in canonical form,
+// is left out of the keys.
+func (c *Client) isIgnoredHeader(name string) bool {
+	if c.ignoredHeaders == nil {
+		return defaultIgnoredHeaders[name]
+	}
+	return c.ignoredHeaders[name]
+}
+
+// variantKey derives the key of the response variant selected by the
+// request values of the given headers, leaving out the ignored ones.
+func (c *Client) variantKey(key string, vary []string, r *http.Request) string {
+	var b bytes.Buffer
+	b.WriteString(key)
+	for _, name := range vary {
+		if c.isIgnoredHeader(name) {
+			continue
+		}
+		b.WriteByte(0)
+		b.WriteString(name)
+		b.WriteByte(0)
+		b.WriteString(strings.Join(r.Header[name], ","))
+	}
+
+	return c.hash(b.String())
+}
+
+// ClientWithIgnoredRequestHeaders sets the request headers left out of the
+// keys, so that responses varying on them are shared anyway, replacing
+// the default list of request ID, tracing and forwarding headers, e.g.
+// X-Request-Id, Traceparent and X-Forwarded-For. Without names, no
+// header is ignored. The Authorization header always keeps the responses
+// to different principals apart. Optional setting.
+func ClientWithIgnoredRequestHeaders(names ...string) ClientOption {
+	return func(c *Client) error {
+		c.ignoredHeaders = make(map[string]bool, len(names))
+		for _, name := range names {
+			c.ignoredHeaders[http.CanonicalHeaderKey(name)] = true
+		}
+		return nil
+	}
+}
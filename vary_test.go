@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseVary(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   []string
+	}{
+		{
+			"no vary",
+			http.Header{},
+			nil,
+		},
+		{
+			"canonical and sorted names",
+			http.Header{"Vary": {"accept-language, Accept-Encoding", "origin"}},
+			[]string{"Accept-Encoding", "Accept-Language", "Origin"},
+		},
+		{
+			"wildcard",
+			http.Header{"Vary": {"*"}},
+			[]string{"*"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseVary(tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseVary() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareVary(t *testing.T) {
+	calls := 0
+	httpTestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/any" {
+			w.Header().Set("Vary", "*")
+		} else {
+			w.Header().Set("Vary", "Accept-Encoding, Accept-Language")
+		}
+		w.Write([]byte(r.Header.Get("Accept-Encoding") + "|" + r.Header.Get("Accept-Language")))
+	})
+
+	client, _ := NewClient(
+		ClientWithAdapter(&adapterMock{}),
+		ClientWithTTL(1*time.Minute),
+	)
+	handler := client.Middleware(httpTestHandler)
+
+	tests := []struct {
+		name      string
+		url       string
+		encoding  string
+		language  string
+		wantBody  string
+		wantCalls int
+	}{
+		{
+			"stores first variant",
+			"http://foo.bar/vary",
+			"gzip",
+			"en",
+			"gzip|en",
+			1,
+		},
+		{
+			"stores variant with other encoding",
+			"http://foo.bar/vary",
+			"",
+			"en",
+			"|en",
+			2,
+		},
+		{
+			"stores variant with other language",
+			"http://foo.bar/vary",
+			"gzip",
+			"pt",
+			"gzip|pt",
+			3,
+		},
+		{
+			"serves first variant from cache",
+			"http://foo.bar/vary",
+			"gzip",
+			"en",
+			"gzip|en",
+			3,
+		},
+		{
+			"serves second variant from cache",
+			"http://foo.bar/vary",
+			"",
+			"en",
+			"|en",
+			3,
+		},
+		{
+			"does not cache vary wildcard",
+			"http://foo.bar/any",
+			"gzip",
+			"en",
+			"gzip|en",
+			4,
+		},
+		{
+			"does not serve vary wildcard from cache",
+			"http://foo.bar/any",
+			"gzip",
+			"en",
+			"gzip|en",
+			5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", tt.url, nil)
+			if tt.encoding != "" {
+				r.Header.Set("Accept-Encoding", tt.encoding)
+			}
+			r.Header.Set("Accept-Language", tt.language)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("*Client.Middleware() = %v, want %v", w.Body.String(), tt.wantBody)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("*Client.Middleware() origin calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestMiddlewareIgnoredRequestHeaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []ClientOption
+		header    string
+		wantCalls int
+	}{
+		{"shares responses varying on request IDs by default", nil, "X-Request-Id", 1},
+		{"shares responses varying on tracing headers by default", nil, "Traceparent", 1},
+		{"keeps responses varying on other headers apart", nil, "Accept-Language", 2},
+		{"shares responses varying on the ignored headers", []ClientOption{ClientWithIgnoredRequestHeaders("accept-language")}, "Accept-Language", 1},
+		{"replaces the default ignored headers", []ClientOption{ClientWithIgnoredRequestHeaders()}, "X-Request-Id", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]ClientOption{ClientWithAdapter(&adapterMock{}), ClientWithTTL(1 * time.Minute)}, tt.opts...)
+			client, _ := NewClient(opts...)
+			calls := 0
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Vary", tt.header)
+				w.Write([]byte("value"))
+			}))
+
+			for _, value := range []string{"one", "two"} {
+				r := httptest.NewRequest("GET", "/ignored", nil)
+				r.Header.Set(tt.header, value)
+				handler.ServeHTTP(httptest.NewRecorder(), r)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import "errors"
+
+// versionKey mixes the cache version into the key, so that a new version
+// misses the responses cached by the former ones.
+func (c *Client) versionKey(key string) string {
+	version, _ := c.version.Load().(string)
+	if version == "" {
+		return key
+	}
+	return c.hash(version + "\n" + key)
+}
+
+// CacheVersion returns the version mixed into the cache keys.
+func (c *Client) CacheVersion() string {
+	version, _ := c.version.Load().(string)
+	return version
+}
+
+// SetCacheVersion changes the version mixed into the cache keys, e.g.
+// after a deploy changing the responses, so that the responses cached
+// with the former version are no longer served. They are left to expire,
+// or to be swept by the janitor. It may be called concurrently with the
+// middleware.
+func (c *Client) SetCacheVersion(version string) {
+	c.version.Store(version)
+}
+
+// ClientWithCacheVersion sets a version mixed into the cache keys, e.g.
+// the application release, so that changing it invalidates every cached
+// response. Optional setting.
+func ClientWithCacheVersion(version string) ClientOption {
+	return func(c *Client) error {
+		if version == "" {
+			return errors.New("cache client version is not set")
+		}
+		c.version.Store(version)
+		return nil
+	}
+}
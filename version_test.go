@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{"versions the generated keys", nil},
+		{"versions the custom keys", []ClientOption{ClientWithKeyGenerator(func(r *http.Request) (string, string) {
+			return r.URL.Path, r.URL.Path
+		})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]ClientOption{ClientWithAdapter(&adapterMock{}), ClientWithTTL(1 * time.Minute), ClientWithCacheVersion("v1")}, tt.opts...)
+			client, _ := NewClient(opts...)
+			calls := 0
+			handler := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				fmt.Fprintf(w, "value %d", calls)
+			}))
+
+			for i, step := range []struct {
+				version  string
+				wantBody string
+			}{
+				{"v1", "value 1"},
+				{"v1", "value 1"},
+				{"v2", "value 2"},
+				{"v2", "value 2"},
+				{"v1", "value 1"},
+			} {
+				client.SetCacheVersion(step.version)
+				if got := client.CacheVersion(); got != step.version {
+					t.Errorf("*Client.CacheVersion() = %v, want %v", got, step.version)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest("GET", "/versioned", nil))
+				if w.Body.String() != step.wantBody {
+					t.Errorf("request %d: *Client.Middleware() = %v, want %v", i, w.Body.String(), step.wantBody)
+				}
+			}
+
+			if n, _ := client.ReleaseRequest(httptest.NewRequest("GET", "/versioned", nil)); n != 1 {
+				t.Errorf("*Client.ReleaseRequest() = %v, want the v1 response released", n)
+			}
+		})
+	}
+
+	if _, err := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(time.Minute), ClientWithCacheVersion("")); err == nil {
+		t.Error("ClientWithCacheVersion(\"\") error = nil, want an error")
+	}
+}
@@ -0,0 +1,137 @@
+/*
+MIT License
+
+Copyright (c) 2018 Victor Springer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrNotCacheable is returned by Store and Warm when the response was not
+// stored, e.g. because of its status code or Cache-Control directives.
+var ErrNotCacheable = errors.New("the response is not cacheable")
+
+// Lookup returns the fresh response cached for the request, as the
+// middleware would serve it. The request must be keyed as the server
+// receives it, e.g. built by httptest.NewRequest with a path.
+func (c *Client) Lookup(r *http.Request) (Response, bool) {
+	prefix, key := c.GeneratePrefixAndKey(r)
+	response, _, ok := c.lookupResponse(c.requestLog(prefix, key), r, prefix, key, nil)
+	if !ok || !response.Expiration.After(time.Now()) {
+		return Response{}, false
+	}
+	return response, true
+}
+
+// Store caches the response to the request, with the given body, on the
+// same conditions as the middleware. It returns ErrNotCacheable when the
+// response is not cached.
+func (c *Client) Store(r *http.Request, resp *http.Response, body []byte) error {
+	prefix, key := c.GeneratePrefixAndKey(r)
+	header := make(http.Header, len(resp.Header))
+	copyHeader(header, resp.Header)
+	result := &http.Response{StatusCode: resp.StatusCode, Header: header}
+	value := append([]byte(nil), body...)
+	if c.store(c.requestLog(prefix, key), r, prefix, key, result, value, nil) <= 0 {
+		return ErrNotCacheable
+	}
+	return nil
+}
+
+// Warm populates the cache with the responses of the handler to GET
+// requests for the given URLs, e.g. at deploy time, running at most
+// concurrency requests at once. It returns the error of each URL whose
+// response was not cached, which is ErrNotCacheable when the handler
+// response is not cacheable, or the context error once it is done.
+func (c *Client) Warm(ctx context.Context, urls []string, handler http.Handler, concurrency int) map[string]error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		mutex  sync.Mutex
+		errs   = make(map[string]error)
+		wg     sync.WaitGroup
+		tokens = make(chan struct{}, concurrency)
+	)
+	for _, u := range urls {
+		select {
+		case tokens <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if err := ctx.Err(); err != nil {
+			mutex.Lock()
+			errs[u] = err
+			mutex.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(u string) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			if err := c.warm(ctx, u, handler); err != nil {
+				mutex.Lock()
+				errs[u] = err
+				mutex.Unlock()
+			}
+		}(u)
+	}
+	wg.Wait()
+	return errs
+}
+
+// warm caches the response of the handler to a GET request for the URL.
+func (c *Client) warm(ctx context.Context, u string, handler http.Handler) (err error) {
+	r, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	// the request is keyed as the server would receive it
+	r.URL = &url.URL{Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+	r.RequestURI = r.URL.RequestURI()
+	r = r.WithContext(ctx)
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panicked: %v", p)
+		}
+	}()
+	prefix, key := c.GeneratePrefixAndKey(r)
+	capture, cw := newResponseCapture(nil)
+	capture.hidden = c.tagHeader
+	c.serveOrigin(handler, cw, r, prefix, key, nil)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.store(c.requestLog(prefix, key), r, prefix, key, capture.result(), capture.body.Bytes(), nil) <= 0 {
+		return ErrNotCacheable
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLookupStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  http.Header
+		wantErr error
+	}{
+		{"stores cacheable responses", http.StatusOK, http.Header{"Content-Type": []string{"text/plain"}}, nil},
+		{"does not store errors", http.StatusInternalServerError, http.Header{}, ErrNotCacheable},
+		{"does not store partial responses", http.StatusPartialContent, http.Header{"Content-Range": []string{"bytes 0-4/10"}}, ErrNotCacheable},
+		{"does not store no-store responses", http.StatusOK, http.Header{"Cache-Control": []string{"no-store"}}, ErrNotCacheable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(1*time.Minute))
+			r, _ := http.NewRequest("GET", "http://foo.bar/warm", nil)
+			if _, ok := client.Lookup(r); ok {
+				t.Fatal("*Client.Lookup() ok = true before Store()")
+			}
+
+			err := client.Store(r, &http.Response{StatusCode: tt.status, Header: tt.header}, []byte("value"))
+			if err != tt.wantErr {
+				t.Fatalf("*Client.Store() error = %v, want %v", err, tt.wantErr)
+			}
+			response, ok := client.Lookup(r)
+			if ok != (tt.wantErr == nil) {
+				t.Fatalf("*Client.Lookup() ok = %v, want %v", ok, tt.wantErr == nil)
+			}
+			if ok && (string(response.Value) != "value" || response.StatusCode != tt.status || response.Header.Get("Content-Type") != "text/plain") {
+				t.Errorf("*Client.Lookup() = %+v, want the stored response", response)
+			}
+		})
+	}
+}
+
+func TestWarm(t *testing.T) {
+	client, _ := NewClient(ClientWithAdapter(&adapterMock{}), ClientWithTTL(1*time.Minute))
+	var (
+		mutex          sync.Mutex
+		running, limit int
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		running++
+		if running > limit {
+			limit = running
+		}
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/panic":
+			panic("handler failed")
+		default:
+			w.Write([]byte(r.URL.Path))
+		}
+	})
+
+	urls := []string{"http://foo.bar/a", "http://foo.bar/b", "http://foo.bar/c", "http://foo.bar/error", "http://foo.bar/panic", ":"}
+	errs := client.Warm(context.Background(), urls, handler, 2)
+	if len(errs) != 3 || errs["http://foo.bar/error"] != ErrNotCacheable || errs["http://foo.bar/panic"] == nil || errs[":"] == nil {
+		t.Errorf("*Client.Warm() = %v, want errors for the error, panic and invalid URLs", errs)
+	}
+	if limit > 2 {
+		t.Errorf("*Client.Warm() ran %v requests at once, want at most 2", limit)
+	}
+	middleware := client.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("handler called for %v, want a warmed response", r.URL)
+	}))
+	for _, path := range []string{"/a", "/b", "/c"} {
+		w := httptest.NewRecorder()
+		middleware.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Body.String() != path {
+			t.Errorf("*Client.Middleware() body = %q, want %q", w.Body.String(), path)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	errs = client.Warm(ctx, []string{"http://foo.bar/d"}, handler, 1)
+	if errs["http://foo.bar/d"] != context.Canceled {
+		t.Errorf("*Client.Warm() canceled = %v, want %v", errs, context.Canceled)
+	}
+}